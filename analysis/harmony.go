@@ -0,0 +1,331 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// ChordQuality is the quality of a triad or seventh chord.
+type ChordQuality string
+
+const (
+	MajorTriad        ChordQuality = "major"
+	MinorTriad        ChordQuality = "minor"
+	DiminishedTriad   ChordQuality = "diminished"
+	AugmentedTriad    ChordQuality = "augmented"
+	DominantSeventh   ChordQuality = "dominant seventh"
+	MajorSeventh      ChordQuality = "major seventh"
+	MinorSeventh      ChordQuality = "minor seventh"
+	HalfDiminished    ChordQuality = "half-diminished seventh"
+	DiminishedSeventh ChordQuality = "diminished seventh"
+)
+
+type chordTemplate struct {
+	quality   ChordQuality
+	intervals []int
+}
+
+var chordTemplates = []chordTemplate{
+	{MajorTriad, []int{0, 4, 7}},
+	{MinorTriad, []int{0, 3, 7}},
+	{DiminishedTriad, []int{0, 3, 6}},
+	{AugmentedTriad, []int{0, 4, 8}},
+	{DominantSeventh, []int{0, 4, 7, 10}},
+	{MajorSeventh, []int{0, 4, 7, 11}},
+	{MinorSeventh, []int{0, 3, 7, 10}},
+	{HalfDiminished, []int{0, 3, 6, 10}},
+	{DiminishedSeventh, []int{0, 3, 6, 9}},
+}
+
+// ChordName is an identified chord.
+type ChordName struct {
+	// Root and Bass are pitch classes (0=C).
+	Root, Bass int
+	// RootTPC is the spelling of the root as a MuseScore tonal pitch class.
+	RootTPC   int
+	Quality   ChordQuality
+	Inversion int
+}
+
+// IdentifyChord finds the triad or seventh chord that best explains the
+// given MIDI pitches (with their TPC spellings), considering the lowest
+// pitch as the bass. ok is false if no chord fits.
+func IdentifyChord(pitches, tpcs []int) (ChordName, bool) {
+	if len(pitches) == 0 {
+		return ChordName{}, false
+	}
+	present := map[int]bool{}
+	spelling := map[int]int{}
+	bass := pitches[0]
+	for i, p := range pitches {
+		present[p%12] = true
+		if i < len(tpcs) {
+			spelling[p%12] = tpcs[i]
+		}
+		if p < bass {
+			bass = p
+		}
+	}
+
+	var best ChordName
+	bestScore := math.Inf(-1)
+	for root := range present {
+		for _, tmpl := range chordTemplates {
+			var matched, missing int
+			inChord := map[int]bool{}
+			for _, iv := range tmpl.intervals {
+				pc := (root + iv) % 12
+				inChord[pc] = true
+				if present[pc] {
+					matched++
+				} else {
+					missing++
+				}
+			}
+			extra := 0
+			for pc := range present {
+				if !inChord[pc] {
+					extra++
+				}
+			}
+			// The root and third must be present; the fifth may be omitted.
+			if !present[(root+tmpl.intervals[1])%12] || matched < 2 {
+				continue
+			}
+			score := 2*float64(matched) - 1.5*float64(missing) - 2*float64(extra)
+			if root == bass%12 {
+				score += 0.5
+			}
+			if score > bestScore || (score == bestScore && root < best.Root) {
+				inversion := 0
+				for i, iv := range tmpl.intervals {
+					if (root+iv)%12 == bass%12 {
+						inversion = i
+					}
+				}
+				tpc, ok := spelling[root]
+				if !ok {
+					tpc = mscx.DefaultTPC(root)
+				}
+				best = ChordName{Root: root, Bass: bass % 12, RootTPC: tpc, Quality: tmpl.quality, Inversion: inversion}
+				bestScore = score
+			}
+		}
+	}
+	return best, !math.IsInf(bestScore, -1)
+}
+
+// isSeventh reports whether the quality is a seventh chord.
+func (q ChordQuality) isSeventh() bool {
+	switch q {
+	case DominantSeventh, MajorSeventh, MinorSeventh, HalfDiminished, DiminishedSeventh:
+		return true
+	}
+	return false
+}
+
+var (
+	romanNumerals = []string{"I", "II", "III", "IV", "V", "VI", "VII"}
+	// scaleSteps maps the semitones above the tonic to a scale degree
+	// (0-based) and an alteration prefix for each mode.
+	majorSteps = map[int]string{0: "0", 1: "b1", 2: "1", 3: "b2", 4: "2", 5: "3", 6: "#3", 7: "4", 8: "b5", 9: "5", 10: "b6", 11: "6"}
+	minorSteps = map[int]string{0: "0", 1: "b1", 2: "1", 3: "2", 4: "#2", 5: "3", 6: "#3", 7: "4", 8: "5", 9: "#5", 10: "6", 11: "#6"}
+)
+
+// RomanNumeral returns the Roman numeral (e.g. "V7", "ii6", "viio") of
+// the chord in the given key.
+func (c ChordName) RomanNumeral(key Key) string {
+	steps := majorSteps
+	if key.Mode == Minor {
+		steps = minorSteps
+	}
+	step := steps[((c.Root-key.Tonic)%12+12)%12]
+	prefix := strings.TrimRight(step, "0123456789")
+	degree := int(step[len(step)-1] - '0')
+	// In minor, the raised leading tone is the normal seventh degree.
+	if key.Mode == Minor && step == "#6" {
+		prefix = ""
+	}
+
+	numeral := romanNumerals[degree]
+	switch c.Quality {
+	case MinorTriad, DiminishedTriad, MinorSeventh, HalfDiminished, DiminishedSeventh:
+		numeral = strings.ToLower(numeral)
+	}
+	switch c.Quality {
+	case DiminishedTriad, DiminishedSeventh:
+		numeral += "o"
+	case HalfDiminished:
+		numeral += "ø"
+	case AugmentedTriad:
+		numeral += "+"
+	}
+
+	figures := []string{"", "6", "64"}
+	if c.Quality.isSeventh() {
+		figures = []string{"7", "65", "43", "42"}
+	}
+	return prefix + numeral + figures[c.Inversion]
+}
+
+// RomanNumeral is the harmonic analysis of a single beat.
+type RomanNumeral struct {
+	mscx.Position
+	Key   Key
+	Chord ChordName
+	// Numeral is the Roman numeral text, e.g. "V65".
+	Numeral string
+}
+
+func (r *RomanNumeral) String() string {
+	return fmt.Sprintf("m.%v beat %v: %v (%v)", r.Measure, r.Beat, r.Numeral, r.Key)
+}
+
+type soundingNote struct {
+	start, end int
+	pitch, tpc int
+}
+
+// AnalyzeHarmony returns a Roman numeral analysis of every beat on which
+// at least one note begins, using all staves of the score and the keys
+// estimated by DetectKeys. Beats whose notes do not form a recognizable
+// triad or seventh chord, or that lie outside every key section (e.g. in
+// measures of a staff that is longer than the first), are omitted.
+func AnalyzeHarmony(score *mscx.Score) ([]*RomanNumeral, error) {
+	sections, err := DetectKeys(score)
+	if err != nil {
+		return nil, err
+	}
+
+	var notes []soundingNote
+	beats := map[int]mscx.Position{}
+	err = score.Notes(func(ev *mscx.Event, note *mscx.Note) error {
+		notes = append(notes, soundingNote{start: ev.Tick, end: ev.Tick + ev.Ticks, pitch: note.Pitch, tpc: note.TPC})
+		if _, ok := beats[ev.Tick]; !ok && ev.Beat == math.Trunc(ev.Beat) {
+			beats[ev.Tick] = ev.Position
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ticks := make([]int, 0, len(beats))
+	for tick := range beats {
+		ticks = append(ticks, tick)
+	}
+	sort.Ints(ticks)
+
+	var result []*RomanNumeral
+	for _, tick := range ticks {
+		pos := beats[tick]
+		var pitches, tpcs []int
+		for _, n := range notes {
+			if n.start <= tick && tick < n.end {
+				pitches = append(pitches, n.pitch)
+				tpcs = append(tpcs, n.tpc)
+			}
+		}
+		chord, ok := IdentifyChord(pitches, tpcs)
+		if !ok {
+			continue
+		}
+		var section *KeySection
+		for _, s := range sections {
+			if pos.Measure >= s.StartMeasure && pos.Measure <= s.EndMeasure {
+				section = s
+			}
+		}
+		if section == nil {
+			continue
+		}
+		key := section.Key
+		result = append(result, &RomanNumeral{
+			Position: pos,
+			Key:      key,
+			Chord:    chord,
+			Numeral:  chord.RomanNumeral(key),
+		})
+	}
+	return result, nil
+}
+
+// WriteRomanNumerals writes the analysis into the lowest staff of the
+// score, as Roman numeral <Harmony> elements or, if asStaffText is true, as
+// <StaffText> elements. A numeral is written only where it differs from the
+// previous one and where voice 1 of that staff has a chord or rest
+// beginning on the same beat. It returns the number of elements written.
+func WriteRomanNumerals(score *mscx.Score, numerals []*RomanNumeral, asStaffText bool) (int, error) {
+	if len(score.Staffs) == 0 {
+		return 0, nil
+	}
+	staff := score.Staffs[len(score.Staffs)-1]
+
+	byTick := map[int]*RomanNumeral{}
+	prev := ""
+	for _, rn := range numerals {
+		if rn.Numeral != prev {
+			byTick[rn.Tick] = rn
+		}
+		prev = rn.Numeral
+	}
+
+	type insertion struct {
+		voice *mscx.Voice
+		el    any
+		text  string
+	}
+	var inserts []insertion
+	err := score.WalkStaff(staff, func(ev *mscx.Event) error {
+		rn, ok := byTick[ev.Tick]
+		if !ok || ev.Voice != 1 || len(ev.Bar.Voice) == 0 {
+			return nil
+		}
+		switch ev.Element.(type) {
+		case *mscx.Chord, *mscx.Rest:
+			inserts = append(inserts, insertion{voice: ev.Bar.Voice[0], el: ev.Element, text: rn.Numeral})
+			delete(byTick, ev.Tick)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, ins := range inserts {
+		var el any = &mscx.Harmony{HarmonyType: mscx.HarmonyRoman, Name: ins.text}
+		if asStaffText {
+			el = &mscx.StaffText{Text: []byte(ins.text)}
+		}
+		v := ins.voice
+		for i, e := range v.TimedElements {
+			if e == ins.el {
+				v.TimedElements = append(v.TimedElements[:i], append([]any{el}, v.TimedElements[i:]...)...)
+				count++
+				break
+			}
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,171 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package analysis
+
+import (
+	"testing"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDetectKeys(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{filename: test01, want: "A major"},
+		{filename: "../mscx/testfiles/003-Come,_Thou_Almighty_King.mscz", want: "G major"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			sz, err := mscx.NewFromFile(tt.filename, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sections, err := DetectKeys(&sz.MuseScore.Score)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sections) == 0 {
+				t.Fatal("DetectKeys returned no sections")
+			}
+			for _, s := range sections {
+				if got := s.Key.String(); got != tt.want {
+					t.Errorf("DetectKeys measures %v-%v = %v, want %v", s.StartMeasure, s.EndMeasure, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestIdentifyChord(t *testing.T) {
+	aMajor := KeyFromSignature(3, Major)
+	cMinor := KeyFromSignature(-3, Minor)
+	tests := []struct {
+		pitches []int
+		key     Key
+		want    string
+	}{
+		{pitches: []int{45, 61, 64, 69}, key: aMajor, want: "I"},
+		{pitches: []int{49, 57, 64, 69}, key: aMajor, want: "I6"},
+		{pitches: []int{56, 62, 64, 71}, key: aMajor, want: "V65"},
+		{pitches: []int{50, 57, 62, 66}, key: aMajor, want: "IV"},
+		{pitches: []int{47, 62, 65, 68}, key: cMinor, want: "viio7"},
+		{pitches: []int{43, 59, 62, 65}, key: cMinor, want: "V7"},
+		{pitches: []int{44, 60, 63, 68}, key: cMinor, want: "VI"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			chord, ok := IdentifyChord(tt.pitches, nil)
+			if !ok {
+				t.Fatal("IdentifyChord found no chord")
+			}
+			if got := chord.RomanNumeral(tt.key); got != tt.want {
+				t.Errorf("RomanNumeral = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeHarmony_NoKeySection(t *testing.T) {
+	sz, err := mscx.NewScore().
+		AddPart("Piano").
+		AddMeasure("4/4").Chord([]string{"C4", "E4", "G4"}, "whole").
+		AddMeasure("").Chord([]string{"F4", "A4", "C5"}, "whole").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sz.MuseScore.Score
+	// Key sections are taken from the first staff, so a second staff
+	// that is longer than the first has measures without a key.
+	longer := *score.Staffs[0]
+	longer.ID = "2"
+	score.Staffs = append(score.Staffs, &longer)
+	score.Staffs[0].Measure = score.Staffs[0].Measure[:1]
+
+	numerals, err := AnalyzeHarmony(score)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, rn := range numerals {
+		got = append(got, rn.String())
+	}
+	want := []string{"m.1 beat 1: I (C major)"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("AnalyzeHarmony differs (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteRomanNumerals(t *testing.T) {
+	sz, err := mscx.NewFromFile(test01, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sz.MuseScore.Score
+	numerals, err := AnalyzeHarmony(score)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, rn := range numerals[:4] {
+		got = append(got, rn.String())
+	}
+	want := []string{
+		"m.2 beat 1: I6 (A major)",
+		"m.2 beat 2: V (A major)",
+		"m.2 beat 3: V (A major)",
+		"m.3 beat 1: I (A major)",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("AnalyzeHarmony differs (-want +got):\n%s", diff)
+	}
+
+	n, err := WriteRomanNumerals(score, numerals, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatal("WriteRomanNumerals wrote nothing")
+	}
+
+	buf, err := sz.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mscx.New(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	parsed.MuseScore.Score.Walk(func(ev *mscx.Event) error {
+		if h, ok := ev.Element.(*mscx.Harmony); ok && h.HarmonyType == mscx.HarmonyRoman {
+			count++
+		}
+		return nil
+	})
+	if count != n {
+		t.Errorf("parsed %v Roman numerals, want %v", count, n)
+	}
+}
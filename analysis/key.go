@@ -0,0 +1,211 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package analysis
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// Mode is the mode of a key.
+type Mode int
+
+const (
+	Major Mode = iota
+	Minor
+)
+
+func (m Mode) String() string {
+	if m == Minor {
+		return "minor"
+	}
+	return "major"
+}
+
+// Key is a tonal center and mode.
+type Key struct {
+	// Tonic is the pitch class (0=C, 1=C#/Db, ...) of the tonic.
+	Tonic int
+	// TPC is the spelling of the tonic as a MuseScore tonal pitch class.
+	TPC  int
+	Mode Mode
+}
+
+func (k Key) String() string {
+	return fmt.Sprintf("%v %v", mscx.TPCName(k.TPC), k.Mode)
+}
+
+// KeyFromSignature returns the major key for the given number of sharps
+// (or negative for flats), or the relative minor key if mode is Minor.
+func KeyFromSignature(fifths int, mode Mode) Key {
+	tpc := 14 + fifths // C
+	if mode == Minor {
+		tpc = 17 + fifths // A
+	}
+	return Key{Tonic: tpcPitchClass(tpc), TPC: tpc, Mode: mode}
+}
+
+// tpcPitchClass returns the pitch class of a TPC.
+func tpcPitchClass(tpc int) int {
+	return ((tpc-14)*7%12 + 12) % 12
+}
+
+// Krumhansl-Kessler key profiles, starting on the tonic.
+var (
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// EstimateKey returns the key whose Krumhansl-Kessler profile best
+// correlates with the given pitch-class weights (typically total note
+// durations), along with the correlation coefficient. fifths is the key
+// signature in effect and is used only to spell the tonic.
+func EstimateKey(weights [12]float64, fifths int) (Key, float64) {
+	best, bestR := Key{}, math.Inf(-1)
+	for tonic := 0; tonic < 12; tonic++ {
+		for _, mode := range []Mode{Major, Minor} {
+			profile := majorProfile
+			if mode == Minor {
+				profile = minorProfile
+			}
+			var rotated [12]float64
+			for i := range rotated {
+				rotated[i] = profile[((i-tonic)%12+12)%12]
+			}
+			if r := correlation(weights, rotated); r > bestR {
+				best, bestR = Key{Tonic: tonic, Mode: mode}, r
+			}
+		}
+	}
+	best.TPC = spellTonic(best.Tonic, best.Mode, fifths)
+	return best, bestR
+}
+
+// spellTonic chooses the spelling of the tonic closest on the line of
+// fifths to the tonic implied by the key signature.
+func spellTonic(pc int, mode Mode, fifths int) int {
+	want := KeyFromSignature(fifths, mode).TPC
+	best := -1
+	for tpc := -1; tpc <= 33; tpc++ {
+		if tpcPitchClass(tpc) != pc {
+			continue
+		}
+		if best < 0 || abs(tpc-want) < abs(best-want) {
+			best = tpc
+		}
+	}
+	return best
+}
+
+func correlation(x, y [12]float64) float64 {
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= 12
+	my /= 12
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// KeySection is a span of measures analyzed as being in a single key.
+type KeySection struct {
+	// StartMeasure and EndMeasure are the first and last 1-based measures.
+	StartMeasure, EndMeasure int
+	// Fifths is the key signature in effect for the section.
+	Fifths int
+	Key    Key
+	// Correlation measures how strongly the notes support Key (-1 to 1).
+	Correlation float64
+
+	weights [12]float64
+}
+
+// DetectKeys estimates the key of each section of the score, where a new
+// section begins at every key signature change and after every double or
+// final barline. All staves contribute their note durations.
+func DetectKeys(score *mscx.Score) ([]*KeySection, error) {
+	if len(score.Staffs) == 0 {
+		return nil, nil
+	}
+
+	// Section boundaries are taken from the first staff.
+	starts := map[int]int{} // start measure -> fifths
+	fifths, newSection := 0, true
+	err := score.WalkStaff(score.Staffs[0], func(ev *mscx.Event) error {
+		if ev.KeySig != nil && ev.KeySig.Fifths() != fifths {
+			fifths, newSection = ev.KeySig.Fifths(), true
+		}
+		if newSection {
+			starts[ev.Measure] = fifths
+			newSection = false
+		}
+		if bl, ok := ev.Element.(*mscx.BarLine); ok && (bl.Subtype == "double" || bl.Subtype == "end") {
+			newSection = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	numMeasures := len(score.Staffs[0].Measure)
+	var sections []*KeySection
+	for m := 1; m <= numMeasures; m++ {
+		if f, ok := starts[m]; ok || len(sections) == 0 {
+			sections = append(sections, &KeySection{StartMeasure: m, Fifths: f})
+		}
+		sections[len(sections)-1].EndMeasure = m
+	}
+
+	err = score.Notes(func(ev *mscx.Event, note *mscx.Note) error {
+		for _, s := range sections {
+			if ev.Measure >= s.StartMeasure && ev.Measure <= s.EndMeasure {
+				s.weights[note.Pitch%12] += float64(ev.Ticks)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range sections {
+		s.Key, s.Correlation = EstimateKey(s.weights, s.Fifths)
+	}
+	return sections, nil
+}
@@ -0,0 +1,353 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package analysis
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// Syllable is a single syllable of a verse of lyrics.
+type Syllable struct {
+	mscx.Position
+	// Text is the syllable without any leading verse number (e.g. "1.").
+	Text string
+	// Syllabic is "begin", "middle" or "end" for a syllable of a
+	// hyphenated word, or empty for a single-syllable word.
+	Syllabic string
+	// Pitch and TPC are those of the highest note of the syllable's chord.
+	Pitch, TPC int
+	// Ticks is the duration of the syllable including any melisma (the
+	// following notes without a syllable), and ToBarline the number of
+	// ticks from its start to the next barline.
+	Ticks, ToBarline int
+}
+
+// EndsWord reports whether the syllable is the last of its word.
+func (s *Syllable) EndsWord() bool {
+	return s.Syllabic == "" || s.Syllabic == "single" || s.Syllabic == "end"
+}
+
+// verseNumber matches a verse number at the start of a lyric.
+var verseNumber = regexp.MustCompile(`^\s*\d+\.\s*`)
+
+// VerseSyllables returns the syllables of the given 0-based verse in
+// order. When several staves have lyrics, the staff with the most
+// syllables of the verse is used.
+func VerseSyllables(score *mscx.Score, verse int) ([]*Syllable, error) {
+	var result []*Syllable
+	for _, staff := range score.Staffs {
+		var syllables []*Syllable
+		sung := map[int]*Syllable{} // by voice, the syllable still being sung
+		err := score.WalkStaff(staff, func(ev *mscx.Event) error {
+			chord, ok := ev.Element.(*mscx.Chord)
+			if !ok || len(chord.Note) == 0 {
+				if ev.Ticks > 0 {
+					delete(sung, ev.Voice)
+				}
+				return nil
+			}
+			measureTicks, err := score.MeasureTicks(ev.Bar, ev.TimeSig)
+			if err != nil {
+				return err
+			}
+			toBarline := measureTicks - ev.MeasureTick
+			melisma := true
+			for _, ly := range chord.Lyrics {
+				if ly.No != verse {
+					continue
+				}
+				top := chord.Note[0]
+				for _, note := range chord.Note {
+					if note.Pitch > top.Pitch {
+						top = note
+					}
+				}
+				s := &Syllable{
+					Position:  ev.Position,
+					Text:      verseNumber.ReplaceAllString(ly.Text, ""),
+					Syllabic:  ly.Syllabic,
+					Pitch:     top.Pitch,
+					TPC:       top.TPC,
+					Ticks:     ev.Ticks,
+					ToBarline: toBarline,
+				}
+				syllables = append(syllables, s)
+				sung[ev.Voice] = s
+				melisma = false
+			}
+			if s := sung[ev.Voice]; melisma && ev.Ticks > 0 && s != nil && s.Tick+s.Ticks == ev.Tick {
+				s.Ticks += ev.Ticks
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(syllables) > len(result) {
+			result = syllables
+		}
+	}
+	return result, nil
+}
+
+// Verses returns the number of verses of lyrics in the score.
+func Verses(score *mscx.Score) (int, error) {
+	var result int
+	err := score.Walk(func(ev *mscx.Event) error {
+		if chord, ok := ev.Element.(*mscx.Chord); ok {
+			for _, ly := range chord.Lyrics {
+				if ly.No >= result {
+					result = ly.No + 1
+				}
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Meter is the poetic meter of a hymn: the number of syllables in each
+// line of a verse.
+type Meter struct {
+	Lines []int
+	// Name is the traditional name of the meter (e.g. "CM" for common
+	// meter), if it has one.
+	Name string
+	// Refrain holds the lines of a refrain sung after the verse, if the
+	// verse's syllables include one.
+	Refrain []int
+}
+
+// String returns the meter in the form used by hymnal metrical indexes,
+// e.g. "8.6.8.6" or, for a doubled meter, "8.7.8.7 D". A meter with a
+// refrain ends in " with refrain".
+func (m *Meter) String() string {
+	lines := m.Lines
+	suffix := ""
+	if n := len(lines); n >= 8 && n%2 == 0 && equalInts(lines[:n/2], lines[n/2:]) {
+		lines, suffix = lines[:n/2], " D"
+	}
+	parts := make([]string, len(lines))
+	for i, v := range lines {
+		parts[i] = strconv.Itoa(v)
+	}
+	if len(m.Refrain) > 0 {
+		suffix += " with refrain"
+	}
+	return strings.Join(parts, ".") + suffix
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// standardMeters are common hymn meters, most common first.
+var standardMeters = []*Meter{
+	{Lines: []int{8, 6, 8, 6}, Name: "CM"},
+	{Lines: []int{8, 8, 8, 8}, Name: "LM"},
+	{Lines: []int{6, 6, 8, 6}, Name: "SM"},
+	{Lines: []int{8, 7, 8, 7}},
+	{Lines: []int{7, 7, 7, 7}},
+	{Lines: []int{7, 6, 7, 6}},
+	{Lines: []int{8, 6, 8, 6, 8, 6, 8, 6}, Name: "CMD"},
+	{Lines: []int{8, 8, 8, 8, 8, 8, 8, 8}, Name: "LMD"},
+	{Lines: []int{6, 6, 8, 6, 6, 6, 8, 6}, Name: "SMD"},
+	{Lines: []int{8, 7, 8, 7, 8, 7, 8, 7}},
+	{Lines: []int{7, 7, 7, 7, 7, 7, 7, 7}},
+	{Lines: []int{7, 6, 7, 6, 7, 6, 7, 6}},
+	{Lines: []int{6, 6, 4, 6, 6, 6, 4}},
+	{Lines: []int{8, 7, 8, 7, 8, 7}},
+	{Lines: []int{8, 8, 8, 8, 8, 8}},
+	{Lines: []int{7, 7, 7, 7, 7, 7}},
+	{Lines: []int{8, 7, 8, 7, 7, 7}},
+	{Lines: []int{8, 7, 8, 7, 6, 6, 6, 6, 7}},
+	{Lines: []int{6, 5, 6, 5}},
+	{Lines: []int{6, 5, 6, 5, 6, 5, 6, 5}},
+	{Lines: []int{6, 6, 6, 6}},
+	{Lines: []int{6, 6, 6, 6, 8, 8}},
+	{Lines: []int{10, 10}},
+	{Lines: []int{10, 10, 10, 10}},
+	{Lines: []int{10, 10, 10, 10, 10, 10}},
+	{Lines: []int{11, 10, 11, 10}},
+	{Lines: []int{11, 11, 11, 11}},
+	{Lines: []int{11, 12, 12, 10}},
+	{Lines: []int{9, 8, 9, 8}},
+	{Lines: []int{8, 8, 8}},
+	{Lines: []int{7, 7, 7}},
+	{Lines: []int{5, 5, 5, 5}},
+}
+
+// lineEnd matches punctuation that ends a line of verse.
+var lineEnd = regexp.MustCompile(`[,;:.!?]["'’”)]*$`)
+
+// DetectMeter determines the meter of a verse from its syllables.
+//
+// Lines end at musical phrase boundaries. A rest or a long note after a
+// word clearly ends a phrase; a word followed by a syllable at the same
+// distance before the barline as the verse's first syllable may end one.
+// Since not every phrase boundary ends a line, the standard meters are
+// tried first: a standard meter whose line ends all fall on phrase
+// boundaries is used, preferring the one with the most line ends at a
+// rest, a long note or punctuation. A verse that continues past a
+// standard meter ending in a rest or a long note is reported as that
+// meter with a refrain. Otherwise the lines are split at each rest or
+// long note, and at each punctuated phrase boundary. A closing "Amen" is
+// not part of the meter.
+//
+// Syllables without timing (e.g. typed text) are split at punctuation
+// instead.
+func DetectMeter(syllables []*Syllable) *Meter {
+	if n := len(syllables); n > 2 && isAmen(syllables[n-2:]) {
+		syllables = syllables[:n-2]
+	}
+	isPunctuated := map[int]bool{} // by the number of syllables up to the word end
+	for i, s := range syllables {
+		if i+1 < len(syllables) && s.EndsWord() && lineEnd.MatchString(strings.TrimSpace(s.Text)) {
+			isPunctuated[i+1] = true
+		}
+	}
+	isStrong, isWeak := phraseEnds(syllables)
+	if isStrong == nil {
+		isStrong, isWeak = isPunctuated, isPunctuated
+	}
+	isLineEnd := map[int]bool{}
+	for n := range isWeak {
+		isLineEnd[n] = isStrong[n] || isPunctuated[n]
+	}
+
+	var best *Meter
+	var bestTotal, bestScore int
+	for _, m := range standardMeters {
+		total, score, ok := 0, 0, true
+		for i, n := range m.Lines {
+			total += n
+			switch {
+			case total > len(syllables):
+				ok = false
+			case i+1 == len(m.Lines) && total < len(syllables):
+				ok = isStrong[total]
+			case i+1 < len(m.Lines):
+				ok = isWeak[total]
+			}
+			if !ok {
+				break
+			}
+			if isStrong[total] || isPunctuated[total] {
+				score++
+			}
+		}
+		if ok && (total > bestTotal || total == bestTotal && score > bestScore) {
+			best, bestTotal, bestScore = m, total, score
+		}
+	}
+	if best != nil {
+		return &Meter{
+			Lines:   append([]int(nil), best.Lines...),
+			Name:    best.Name,
+			Refrain: splitLines(isLineEnd, bestTotal, len(syllables)),
+		}
+	}
+	return &Meter{Lines: splitLines(isLineEnd, 0, len(syllables))}
+}
+
+// isAmen reports whether the two syllables sing "A-men".
+func isAmen(syllables []*Syllable) bool {
+	word := ""
+	for _, s := range syllables {
+		word += strings.ToLower(strings.Trim(s.Text, " \t,;:.!?"))
+	}
+	return word == "amen" && syllables[0].Syllabic == "begin"
+}
+
+// splitLines returns the lengths of the lines from syllable start up to
+// syllable end, split at each boundary.
+func splitLines(isBoundary map[int]bool, start, end int) []int {
+	var lines []int
+	prev := start
+	for n := start + 1; n <= end; n++ {
+		if n == end || isBoundary[n] {
+			lines = append(lines, n-prev)
+			prev = n
+		}
+	}
+	return lines
+}
+
+// phraseEnds returns the musical phrase boundaries of a verse, by the
+// number of syllables up to each: strong boundaries at a rest or a long
+// note, and weak ones (a superset) that also include words followed by a
+// syllable in the metric position of the verse's first syllable. It
+// returns nils if the syllables have no timing.
+func phraseEnds(syllables []*Syllable) (strong, weak map[int]bool) {
+	var ticks []int
+	for _, s := range syllables {
+		if s.Ticks > 0 {
+			ticks = append(ticks, s.Ticks)
+		}
+	}
+	if len(ticks) == 0 {
+		return nil, nil
+	}
+	sort.Ints(ticks)
+	median := ticks[len(ticks)/2]
+
+	strong, weak = map[int]bool{}, map[int]bool{}
+	first := syllables[0]
+	for i, s := range syllables[:len(syllables)-1] {
+		if !s.EndsWord() {
+			continue
+		}
+		next := syllables[i+1]
+		if next.Tick > s.Tick+s.Ticks || s.Ticks >= 2*median {
+			strong[i+1], weak[i+1] = true, true
+		}
+		if next.ToBarline == first.ToBarline {
+			weak[i+1] = true
+		}
+	}
+	return strong, weak
+}
+
+// FirstLine returns the words of the first line of a verse, given the
+// verse's syllables and meter.
+func FirstLine(syllables []*Syllable, meter *Meter) string {
+	n := len(syllables)
+	if len(meter.Lines) > 0 && meter.Lines[0] < n {
+		n = meter.Lines[0]
+	}
+	var sb strings.Builder
+	for i, s := range syllables[:n] {
+		sb.WriteString(strings.TrimSpace(s.Text))
+		if i+1 < n && s.EndsWord() {
+			sb.WriteString(" ")
+		}
+	}
+	return sb.String()
+}
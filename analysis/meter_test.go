@@ -0,0 +1,118 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/google/go-cmp/cmp"
+)
+
+const (
+	test02 = "../mscx/testfiles/003-Come,_Thou_Almighty_King.mscz"
+	test17 = "../mscx/testfiles/017-How_Great_Thou_Art.mscz"
+	test27 = "../mscx/testfiles/027-Immortal,_Invisible,_God_Only_Wise.mscz"
+)
+
+func TestDetectMeter(t *testing.T) {
+	tests := []struct {
+		filename  string
+		verse     int
+		want      string
+		wantName  string
+		firstLine string
+	}{
+		{filename: test01, verse: 0, want: "8.6.8.6", wantName: "CM", firstLine: "O for a thousand tongues to sing"},
+		{filename: test01, verse: 1, want: "8.6.8.6", wantName: "CM", firstLine: "My gracious Master and my God,"},
+		{filename: test02, verse: 0, want: "6.6.4.6.6.6.4", firstLine: "Come, thou almighty King,"},
+		{filename: test17, verse: 0, want: "11.10.11.10 with refrain", firstLine: "Oh Lord my God! When I in awesome wonder"},
+		{filename: test17, verse: 3, want: "11.10.11.10", firstLine: "When Christ shall come with shout of acclamation"},
+		{filename: test27, verse: 3, want: "11.10.11.10", firstLine: "Great Father of glory, pure Father of light,"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.firstLine, func(t *testing.T) {
+			sz, err := mscx.NewFromFile(tt.filename, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			syllables, err := VerseSyllables(&sz.MuseScore.Score, tt.verse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			meter := DetectMeter(syllables)
+			if got := meter.String(); got != tt.want || meter.Name != tt.wantName {
+				t.Errorf("DetectMeter = %q (%q), want %q (%q)", got, meter.Name, tt.want, tt.wantName)
+			}
+			if got := FirstLine(syllables, meter); got != tt.firstLine {
+				t.Errorf("FirstLine = %q, want %q", got, tt.firstLine)
+			}
+		})
+	}
+}
+
+func TestDetectMeter_Punctuation(t *testing.T) {
+	// A verse without timing is split at punctuation.
+	var syllables []*Syllable
+	for _, word := range strings.Fields("Sing a new song, sing it now; praise the Lord of all the earth.") {
+		syllables = append(syllables, &Syllable{Text: word})
+	}
+	meter := DetectMeter(syllables)
+	if got, want := meter.String(), "4.3.7"; got != want || meter.Name != "" {
+		t.Errorf("DetectMeter = %q (%q), want %q", got, meter.Name, want)
+	}
+
+	// A doubled meter is written with a "D".
+	m := &Meter{Lines: []int{8, 7, 8, 7, 8, 7, 8, 7}}
+	if got, want := m.String(), "8.7.8.7 D"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
+
+func TestDetectMeter_Refrain(t *testing.T) {
+	sz, err := mscx.NewFromFile(test17, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syllables, err := VerseSyllables(&sz.MuseScore.Score, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meter := DetectMeter(syllables)
+	want := &Meter{Lines: []int{11, 10, 11, 10}, Refrain: []int{4, 6, 4, 4, 4, 6, 4, 4}}
+	if diff := cmp.Diff(want, meter); diff != "" {
+		t.Errorf("DetectMeter mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestVerses(t *testing.T) {
+	sz, err := mscx.NewFromFile(test01, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Verses(&sz.MuseScore.Score)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 6; got != want {
+		t.Errorf("Verses = %v, want %v", got, want)
+	}
+}
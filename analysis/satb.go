@@ -0,0 +1,373 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package analysis provides music-theoretic analyses of parsed MuseScore scores.
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// The four voices of a SATB texture, from highest to lowest.
+const (
+	Soprano = iota
+	Alto
+	Tenor
+	Bass
+)
+
+// VoiceNames holds the display names of the SATB voices.
+var VoiceNames = [4]string{"Soprano", "Alto", "Tenor", "Bass"}
+
+// voiceInstruments holds the instrument templates providing the ranges of
+// the SATB voices.
+var voiceInstruments = [4]string{"voice.soprano", "voice.alto", "voice.tenor", "voice.bass"}
+
+// LineNote is a note (or rest) of a single melodic line.
+type LineNote struct {
+	mscx.Position
+	// Pitch is the MIDI pitch, or zero for a rest.
+	Pitch int
+	TPC   int
+	Ticks int
+	// Shared is true if a single note of the staff was assigned to both of
+	// the voices written on that staff.
+	Shared bool
+}
+
+// Line is a single monophonic voice extracted from a score.
+type Line struct {
+	Name  string
+	Notes []*LineNote
+}
+
+// SATB holds the four voices of a hymn or chorale.
+type SATB struct {
+	Voices [4]*Line
+}
+
+// ExtractSATB extracts the soprano, alto, tenor and bass lines from the
+// score. Two layouts are supported: four staves with one voice each, or two
+// staves (as in most hymnals) where the upper staff holds the soprano and
+// alto and the lower staff holds the tenor and bass, either as two-note
+// chords or as separate voices. A single note in a staff written for two
+// voices is assigned to both of them.
+func ExtractSATB(score *mscx.Score) (*SATB, error) {
+	result := &SATB{}
+	for i := range result.Voices {
+		result.Voices[i] = &Line{Name: VoiceNames[i]}
+	}
+
+	switch {
+	case len(score.Staffs) >= 4:
+		for i := 0; i < 4; i++ {
+			if err := extractLines(score, score.Staffs[i], result.Voices[i], result.Voices[i]); err != nil {
+				return nil, err
+			}
+		}
+	case len(score.Staffs) >= 2:
+		if err := extractLines(score, score.Staffs[0], result.Voices[Soprano], result.Voices[Alto]); err != nil {
+			return nil, err
+		}
+		if err := extractLines(score, score.Staffs[1], result.Voices[Tenor], result.Voices[Bass]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("ExtractSATB: need 2 or 4 staves, found %v", len(score.Staffs))
+	}
+
+	return result, nil
+}
+
+// extractLines extracts an upper and a lower line from the staff. If upper
+// and lower are the same line, the top note of each chord is used.
+func extractLines(score *mscx.Score, staff *mscx.ScoreStaff, upper, lower *Line) error {
+	return score.WalkStaff(staff, func(ev *mscx.Event) error {
+		var notes []*mscx.Note
+		switch el := ev.Element.(type) {
+		case *mscx.Chord:
+			notes = append(notes, el.Note...)
+			sort.Slice(notes, func(a, b int) bool { return notes[a].Pitch < notes[b].Pitch })
+		case *mscx.Rest:
+		default:
+			return nil
+		}
+
+		shared := len(notes) == 1
+		add := func(line *Line, note *mscx.Note) {
+			ln := &LineNote{Position: ev.Position, Ticks: ev.Ticks, Shared: shared && upper != lower}
+			if note != nil {
+				ln.Pitch, ln.TPC = note.Pitch, note.TPC
+			}
+			line.Notes = append(line.Notes, ln)
+		}
+
+		var top, bottom *mscx.Note
+		if len(notes) > 0 {
+			top, bottom = notes[len(notes)-1], notes[0]
+		}
+
+		switch {
+		case upper == lower:
+			if ev.Voice == 1 {
+				add(upper, top)
+			}
+		case ev.Voice == 1 && hasVoice2(ev.Bar):
+			add(upper, top)
+		case ev.Voice == 2:
+			add(lower, bottom)
+		case ev.Voice == 1:
+			add(upper, top)
+			add(lower, bottom)
+		}
+		return nil
+	})
+}
+
+// hasVoice2 reports whether the measure uses a second voice.
+func hasVoice2(m *mscx.Measure) bool {
+	return len(m.Voice) > 1 && len(m.Voice[1].TimedElements) > 0
+}
+
+// FindingKind identifies the type of a voice-leading problem.
+type FindingKind int
+
+const (
+	ParallelFifths FindingKind = iota + 1
+	ParallelOctaves
+	VoiceCrossing
+	SpacingError
+	RangeViolation
+)
+
+func (k FindingKind) String() string {
+	switch k {
+	case ParallelFifths:
+		return "parallel fifths"
+	case ParallelOctaves:
+		return "parallel octaves"
+	case VoiceCrossing:
+		return "voice crossing"
+	case SpacingError:
+		return "spacing error"
+	case RangeViolation:
+		return "range violation"
+	}
+	return fmt.Sprintf("FindingKind(%d)", int(k))
+}
+
+// Finding reports a single voice-leading or part-writing problem.
+type Finding struct {
+	Kind FindingKind
+	// Measure and Beat locate the problem; see mscx.Position.
+	Measure int
+	Beat    float64
+	Tick    int
+	// Voices holds the indexes (Soprano, Alto, ...) of the voices involved.
+	Voices  []int
+	Message string
+}
+
+func (f *Finding) String() string {
+	return fmt.Sprintf("m.%v beat %v: %v: %v", f.Measure, strconv.FormatFloat(f.Beat, 'f', -1, 64), f.Kind, f.Message)
+}
+
+// Sonority is the set of pitches sounding in each voice at a given moment.
+// A pitch of zero means the voice is silent.
+type Sonority struct {
+	mscx.Position
+	Pitches [4]int
+	TPCs    [4]int
+	// Attacks records which voices begin a new note at this moment.
+	Attacks [4]bool
+	// Shared records which voices share a single notehead with the other
+	// voice on the same staff.
+	Shared [4]bool
+}
+
+// Sonorities returns the vertical slices of the four voices, one for each
+// moment at which any voice begins a note or rest.
+func (s *SATB) Sonorities() []*Sonority {
+	byTick := map[int]*Sonority{}
+	var ticks []int
+	for _, line := range s.Voices {
+		for _, n := range line.Notes {
+			if _, ok := byTick[n.Tick]; !ok {
+				byTick[n.Tick] = &Sonority{Position: n.Position}
+				ticks = append(ticks, n.Tick)
+			}
+		}
+	}
+	sort.Ints(ticks)
+
+	for vi, line := range s.Voices {
+		ni := 0
+		for _, tick := range ticks {
+			for ni+1 < len(line.Notes) && line.Notes[ni+1].Tick <= tick {
+				ni++
+			}
+			if ni >= len(line.Notes) {
+				break
+			}
+			n := line.Notes[ni]
+			if n.Tick > tick || tick >= n.Tick+n.Ticks {
+				continue
+			}
+			son := byTick[tick]
+			son.Pitches[vi], son.TPCs[vi] = n.Pitch, n.TPC
+			son.Attacks[vi] = n.Tick == tick
+			son.Shared[vi] = n.Shared
+		}
+	}
+
+	result := make([]*Sonority, 0, len(ticks))
+	for _, tick := range ticks {
+		result = append(result, byTick[tick])
+	}
+	return result
+}
+
+// Analyze checks the four voices for parallel fifths and octaves, voice
+// crossing, spacing errors (more than an octave between adjacent upper
+// voices) and notes outside the usual range of each voice.
+func (s *SATB) Analyze() []*Finding {
+	var result []*Finding
+	add := func(son *Sonority, kind FindingKind, voices []int, format string, args ...any) {
+		result = append(result, &Finding{
+			Kind:    kind,
+			Measure: son.Measure,
+			Beat:    son.Beat,
+			Tick:    son.Tick,
+			Voices:  voices,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	var ranges [4][2]int
+	for i, id := range voiceInstruments {
+		if t, ok := mscx.LookupInstrument(id); ok {
+			minA, maxA, _, _, _ := t.Instrument().PitchRange()
+			ranges[i] = [2]int{minA, maxA}
+		}
+	}
+
+	sonorities := s.Sonorities()
+	for si, son := range sonorities {
+		for v := 0; v < 4; v++ {
+			p := son.Pitches[v]
+			if p == 0 || !son.Attacks[v] {
+				continue
+			}
+			if r := ranges[v]; r[1] > 0 && (p < r[0] || p > r[1]) {
+				add(son, RangeViolation, []int{v}, "%v %v is outside %v-%v", VoiceNames[v], name(p, son.TPCs[v]), name(r[0], mscx.DefaultTPC(r[0])), name(r[1], mscx.DefaultTPC(r[1])))
+			}
+		}
+
+		for v := 0; v < 3; v++ {
+			upper, lower := son.Pitches[v], son.Pitches[v+1]
+			if upper == 0 || lower == 0 {
+				continue
+			}
+			if upper < lower {
+				add(son, VoiceCrossing, []int{v, v + 1}, "%v %v is below %v %v", VoiceNames[v], name(upper, son.TPCs[v]), VoiceNames[v+1], name(lower, son.TPCs[v+1]))
+			}
+			if v < Tenor && upper-lower > 12 {
+				add(son, SpacingError, []int{v, v + 1}, "%v and %v are more than an octave apart (%v, %v)", VoiceNames[v], VoiceNames[v+1], name(upper, son.TPCs[v]), name(lower, son.TPCs[v+1]))
+			}
+		}
+
+		if si == 0 {
+			continue
+		}
+		prev := sonorities[si-1]
+		if prev.unison() && son.unison() {
+			continue // a deliberate unison (or octave) passage
+		}
+		for a := 0; a < 4; a++ {
+			for b := a + 1; b < 4; b++ {
+				kind, ok := parallel(prev, son, a, b)
+				if !ok {
+					continue
+				}
+				add(son, kind, []int{a, b}, "%v and %v move %v-%v to %v-%v",
+					VoiceNames[a], VoiceNames[b],
+					name(prev.Pitches[a], prev.TPCs[a]), name(prev.Pitches[b], prev.TPCs[b]),
+					name(son.Pitches[a], son.TPCs[a]), name(son.Pitches[b], son.TPCs[b]))
+			}
+		}
+	}
+
+	return result
+}
+
+// parallel reports whether voices a and b move in parallel perfect fifths
+// or octaves (including unisons and compound intervals) from prev to cur.
+func parallel(prev, cur *Sonority, a, b int) (FindingKind, bool) {
+	pa, pb, ca, cb := prev.Pitches[a], prev.Pitches[b], cur.Pitches[a], cur.Pitches[b]
+	if pa == 0 || pb == 0 || ca == 0 || cb == 0 {
+		return 0, false
+	}
+	// Two voices sharing one notehead are a single written line.
+	if prev.Shared[a] && prev.Shared[b] && pa == pb && cur.Shared[a] && cur.Shared[b] && ca == cb {
+		return 0, false
+	}
+	// Both voices must move, in the same direction.
+	da, db := ca-pa, cb-pb
+	if da == 0 || db == 0 || (da > 0) != (db > 0) {
+		return 0, false
+	}
+	// Crossed voices still form a fifth, so compare absolute intervals.
+	prevIv, curIv := simpleInterval(pa-pb), simpleInterval(ca-cb)
+	switch {
+	case prevIv == 7 && curIv == 7:
+		return ParallelFifths, true
+	case prevIv == 0 && curIv == 0:
+		return ParallelOctaves, true
+	}
+	return 0, false
+}
+
+// unison reports whether all sounding voices share the same pitch class.
+func (s *Sonority) unison() bool {
+	pc := -1
+	for _, p := range s.Pitches {
+		if p == 0 {
+			continue
+		}
+		if pc >= 0 && p%12 != pc {
+			return false
+		}
+		pc = p % 12
+	}
+	return true
+}
+
+// simpleInterval returns the size in semitones of an interval, ignoring
+// its direction and reduced to within an octave.
+func simpleInterval(semitones int) int {
+	if semitones < 0 {
+		semitones = -semitones
+	}
+	return semitones % 12
+}
+
+func name(pitch, tpc int) string {
+	return mscx.PitchName(pitch, tpc)
+}
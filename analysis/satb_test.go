@@ -0,0 +1,146 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package analysis
+
+import (
+	"testing"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/google/go-cmp/cmp"
+)
+
+const test01 = "../mscx/testfiles/001-O_For_a_Thousand_Tongues_to_Sing.mscz"
+
+func TestExtractSATB(t *testing.T) {
+	sz, err := mscx.NewFromFile(test01, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	satb, err := ExtractSATB(&sz.MuseScore.Score)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got [4][]int
+	for i, line := range satb.Voices {
+		for _, n := range line.Notes[:3] {
+			got[i] = append(got[i], n.Pitch)
+		}
+	}
+	want := [4][]int{
+		{64, 69, 69}, // Soprano
+		{64, 64, 61}, // Alto
+		{52, 52, 57}, // Tenor
+		{52, 49, 45}, // Bass
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ExtractSATB first notes differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	sz, err := mscx.NewScore().
+		AddPart("Choir").
+		AddMeasure("4/4").Chord([]string{"E4", "C5"}, "half").Chord([]string{"F4", "D5"}, "half").
+		AddStaff("F").
+		AddMeasure("").Chord([]string{"C3", "G3"}, "half").Chord([]string{"D3", "A3"}, "half").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	satb, err := ExtractSATB(&sz.MuseScore.Score)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range satb.Analyze() {
+		got = append(got, f.String())
+	}
+	want := []string{
+		"m.1 beat 3: parallel octaves: Soprano and Bass move C5-C3 to D5-D3",
+		"m.1 beat 3: parallel fifths: Tenor and Bass move G3-C3 to A3-D3",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Analyze differs (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnalyze_Lines(t *testing.T) {
+	// line returns a voice of half notes with the given pitches and TPCs,
+	// where a pitch of zero is a rest.
+	line := func(name string, notes ...[2]int) *Line {
+		l := &Line{Name: name}
+		for i, n := range notes {
+			tick := i * 960
+			l.Notes = append(l.Notes, &LineNote{
+				Position: mscx.Position{Measure: 1, Tick: tick, MeasureTick: tick, Beat: float64(1 + 2*i)},
+				Pitch:    n[0],
+				TPC:      n[1],
+				Ticks:    960,
+			})
+		}
+		return l
+	}
+
+	tests := []struct {
+		name string
+		satb *SATB
+		want []string
+	}{
+		{
+			name: "parallel fifths between crossed voices",
+			satb: &SATB{Voices: [4]*Line{
+				line("Soprano", [2]int{60, 14}, [2]int{62, 16}),
+				line("Alto", [2]int{67, 15}, [2]int{69, 17}),
+				line("Tenor", [2]int{}, [2]int{}),
+				line("Bass", [2]int{}, [2]int{}),
+			}},
+			want: []string{
+				"m.1 beat 1: voice crossing: Soprano C4 is below Alto G4",
+				"m.1 beat 3: voice crossing: Soprano D4 is below Alto A4",
+				"m.1 beat 3: parallel fifths: Soprano and Alto move C4-G4 to D4-A4",
+			},
+		},
+		{
+			name: "double flat",
+			satb: &SATB{Voices: [4]*Line{
+				line("Soprano", [2]int{70, 0}),
+				line("Alto", [2]int{57, 17}),
+				line("Tenor", [2]int{}),
+				line("Bass", [2]int{}),
+			}},
+			want: []string{
+				"m.1 beat 1: spacing error: Soprano and Alto are more than an octave apart (Cbb5, A3)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range tt.satb.Analyze() {
+				got = append(got, f.String())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Analyze differs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
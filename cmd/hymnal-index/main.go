@@ -0,0 +1,298 @@
+// -*- compile-command: "go run main.go"; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// hymnal-index scans directory trees of `*.mscz` and `*.mscx` hymns and
+// writes a catalog of them for building a hymnal's metrical and tune
+// indexes. For each hymn it records the number (from a filename such as
+// "001-O_For_a_Thousand_Tongues_to_Sing.mscz"), title, composer, key,
+// time signature, meter (syllables per line of the first verse), first
+// line, melodic incipit, tune range and duration
+// (with repeats and jumps played).
+//
+// The catalog is written as JSON (-json) and/or as CSV with a header row
+// (-csv), which can be imported into SQLite with:
+//
+//	sqlite3 hymnal.db '.import --csv hymns.csv hymns'
+//
+// Without either flag, JSON is written to stdout. Files that cannot be
+// parsed are reported and skipped.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gmlewis/go-musescore/analysis"
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+var (
+	jsonOut = flag.String("json", "", "Write the catalog as JSON to this file")
+	csvOut  = flag.String("csv", "", "Write the catalog as CSV to this file")
+)
+
+// incipitNotes is the number of melody notes in the incipit of a hymn
+// without lyrics.
+const incipitNotes = 8
+
+// Hymn is an entry of the catalog.
+type Hymn struct {
+	File          string  `json:"file"`
+	Number        string  `json:"number,omitempty"`
+	Title         string  `json:"title"`
+	Composer      string  `json:"composer,omitempty"`
+	Lyricist      string  `json:"lyricist,omitempty"`
+	Key           string  `json:"key,omitempty"`
+	KeySignature  int     `json:"keySignature"`
+	TimeSignature string  `json:"timeSignature,omitempty"`
+	Meter         string  `json:"meter,omitempty"`
+	MeterName     string  `json:"meterName,omitempty"`
+	Verses        int     `json:"verses"`
+	FirstLine     string  `json:"firstLine,omitempty"`
+	Incipit       string  `json:"incipit,omitempty"`
+	LowestNote    string  `json:"lowestNote,omitempty"`
+	HighestNote   string  `json:"highestNote,omitempty"`
+	Ambitus       int     `json:"ambitus"`
+	Measures      int     `json:"measures"`
+	Seconds       float64 `json:"seconds"`
+}
+
+var csvHeader = []string{
+	"file", "number", "title", "composer", "lyricist", "key", "keySignature",
+	"timeSignature", "meter", "meterName", "verses", "firstLine", "incipit",
+	"lowestNote", "highestNote", "ambitus", "measures", "seconds",
+}
+
+func (h *Hymn) csvRecord() []string {
+	return []string{
+		h.File, h.Number, h.Title, h.Composer, h.Lyricist, h.Key, strconv.Itoa(h.KeySignature),
+		h.TimeSignature, h.Meter, h.MeterName, strconv.Itoa(h.Verses), h.FirstLine, h.Incipit,
+		h.LowestNote, h.HighestNote, strconv.Itoa(h.Ambitus), strconv.Itoa(h.Measures),
+		strconv.FormatFloat(h.Seconds, 'f', 1, 64),
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	var files []string
+	for _, arg := range flag.Args() {
+		err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ext := strings.ToLower(filepath.Ext(path)); !d.IsDir() && (ext == ".mscz" || ext == ".mscx") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	sort.Strings(files)
+
+	hymns := []*Hymn{}
+	for _, filename := range files {
+		hymn, err := indexFile(filename)
+		if err != nil {
+			log.Printf("skipping %v: %v", filename, err)
+			continue
+		}
+		hymns = append(hymns, hymn)
+	}
+
+	if *jsonOut == "" && *csvOut == "" {
+		if err := writeJSON(os.Stdout, hymns); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *jsonOut != "" {
+		if err := writeFile(*jsonOut, hymns, writeJSON); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *csvOut != "" {
+		if err := writeFile(*csvOut, hymns, writeCSV); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("indexed %v of %v files", len(hymns), len(files))
+}
+
+func writeFile(filename string, hymns []*Hymn, fn func(io.Writer, []*Hymn) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := fn(f, hymns); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeJSON(w io.Writer, hymns []*Hymn) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(hymns)
+}
+
+func writeCSV(w io.Writer, hymns []*Hymn) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, h := range hymns {
+		if err := cw.Write(h.csvRecord()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// hymnNumber matches the number at the start of a hymn's filename.
+var hymnNumber = regexp.MustCompile(`^(\d+)[-_ .]`)
+
+func indexFile(filename string) (*Hymn, error) {
+	sz, err := mscx.NewFromFile(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	score := &sz.MuseScore.Score
+	if len(score.Staffs) == 0 {
+		return nil, fmt.Errorf("score has no staves")
+	}
+
+	md := score.Metadata()
+	hymn := &Hymn{
+		File:     filename,
+		Title:    md.WorkTitle,
+		Composer: md.Composer,
+		Lyricist: md.Lyricist,
+		Measures: len(score.Staffs[0].Measure),
+	}
+	if hymn.Lyricist == "" {
+		hymn.Lyricist = md.Poet
+	}
+	base := filepath.Base(filename)
+	if m := hymnNumber.FindStringSubmatch(base); m != nil {
+		hymn.Number = m[1]
+	}
+	if hymn.Title == "" {
+		title := strings.TrimSuffix(base, filepath.Ext(base))
+		title = strings.TrimPrefix(title, hymn.Number)
+		hymn.Title = strings.TrimSpace(strings.NewReplacer("_", " ", "-", " ").Replace(title))
+	}
+
+	if sections, err := analysis.DetectKeys(score); err == nil && len(sections) > 0 {
+		hymn.Key = sections[0].Key.String()
+		hymn.KeySignature = sections[0].Fifths
+	}
+
+	melody, err := walkMelody(score, hymn)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := sz.Statistics()
+	if err != nil {
+		return nil, err
+	}
+	hymn.Seconds = math.Round(stats.Duration.Seconds()*10) / 10
+
+	if hymn.Verses, err = analysis.Verses(score); err != nil {
+		return nil, err
+	}
+	syllables, err := analysis.VerseSyllables(score, 0)
+	if err != nil {
+		return nil, err
+	}
+	incipitEnd := math.MaxInt
+	if len(syllables) > 0 {
+		meter := analysis.DetectMeter(syllables)
+		hymn.Meter, hymn.MeterName = meter.String(), meter.Name
+		hymn.FirstLine = analysis.FirstLine(syllables, meter)
+		if n := meter.Lines[0]; n < len(syllables) {
+			incipitEnd = syllables[n].Tick
+		}
+	}
+
+	var incipit []string
+	low, high := -1, -1
+	for i, note := range melody {
+		if note.tick < incipitEnd && (len(syllables) > 0 || i < incipitNotes) {
+			incipit = append(incipit, mscx.PitchName(note.pitch, note.tpc))
+		}
+		if low < 0 || note.pitch < melody[low].pitch {
+			low = i
+		}
+		if high < 0 || note.pitch > melody[high].pitch {
+			high = i
+		}
+	}
+	hymn.Incipit = strings.Join(incipit, " ")
+	if low >= 0 {
+		hymn.LowestNote = mscx.PitchName(melody[low].pitch, melody[low].tpc)
+		hymn.HighestNote = mscx.PitchName(melody[high].pitch, melody[high].tpc)
+		hymn.Ambitus = melody[high].pitch - melody[low].pitch
+	}
+	return hymn, nil
+}
+
+type melodyNote struct {
+	tick, pitch, tpc int
+}
+
+// walkMelody returns the tune (the highest note of each chord in the first
+// voice of the first staff). It also records the hymn's first time
+// signature.
+func walkMelody(score *mscx.Score, hymn *Hymn) ([]*melodyNote, error) {
+	var melody []*melodyNote
+	err := score.WalkStaff(score.Staffs[0], func(ev *mscx.Event) error {
+		if hymn.TimeSignature == "" && ev.TimeSig != nil {
+			hymn.TimeSignature = ev.TimeSig.SigN + "/" + ev.TimeSig.SigD
+		}
+		el, ok := ev.Element.(*mscx.Chord)
+		if !ok || ev.Voice != 1 || len(el.Note) == 0 {
+			return nil
+		}
+		top := el.Note[0]
+		for _, note := range el.Note {
+			if note.Pitch > top.Pitch {
+				top = note
+			}
+		}
+		melody = append(melody, &melodyNote{tick: ev.Tick, pitch: top.Pitch, tpc: top.TPC})
+		return nil
+	})
+	return melody, err
+}
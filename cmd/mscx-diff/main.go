@@ -0,0 +1,90 @@
+// -*- compile-command: "go run main.go"; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// mscx-diff compares two versions of a `*.mscz` or `*.mscx` score and
+// prints the differences in musical terms, one per line:
+//
+//	$ mscx-diff old.mscz new.mscz
+//	metadata composer: Charles Wesley → Carl G. Gläser
+//	m.12 Piano staff 1 beat 2: E4 quarter → F4 quarter
+//	m.12 Piano staff 1 beat 2 verse 3 lyric: thou → you
+//
+// Use -json for machine-readable output. Like diff(1), it exits with
+// status 1 if the scores differ and 2 on error.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/gmlewis/go-musescore/scorediff"
+)
+
+var (
+	jsonOut = flag.Bool("json", false, "Print the changes as JSON")
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	if flag.NArg() != 2 {
+		log.Printf("usage: mscx-diff [-json] old.mscz new.mscz")
+		os.Exit(2)
+	}
+
+	changes, err := compareFiles(flag.Arg(0), flag.Arg(1))
+	if err != nil {
+		log.Print(err)
+		os.Exit(2)
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if changes == nil {
+			changes = []*scorediff.Change{}
+		}
+		if err := enc.Encode(changes); err != nil {
+			log.Print(err)
+			os.Exit(2)
+		}
+	} else {
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+	}
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+func compareFiles(oldFilename, newFilename string) ([]*scorediff.Change, error) {
+	old, err := mscx.NewFromFile(oldFilename, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", oldFilename, err)
+	}
+	new, err := mscx.NewFromFile(newFilename, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", newFilename, err)
+	}
+	return scorediff.Compare(&old.MuseScore.Score, &new.MuseScore.Score)
+}
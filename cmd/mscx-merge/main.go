@@ -0,0 +1,129 @@
+// -*- compile-command: "go run main.go"; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// mscx-merge is a git merge driver for MuseScore scores. It merges the
+// changes from a common ancestor to "theirs" into "ours" measure by
+// measure and staff by staff, writing the result over "ours":
+//
+//	mscx-merge base.mscx ours.mscx theirs.mscx [path]
+//
+// To use it, add to .gitattributes:
+//
+//	*.mscx merge=mscx
+//	*.mscz merge=mscx
+//
+// and to .git/config (or ~/.gitconfig):
+//
+//	[merge "mscx"]
+//		name = MuseScore score merge
+//		driver = mscx-merge %O %A %B %P
+//
+// Conflicts are printed to stderr and the version from "ours" is kept for
+// each of them. Like every git merge driver, it exits with status 1 if
+// there were conflicts, so that git marks the file as unmerged. It exits
+// with status 2 on error, leaving "ours" unchanged. That includes a
+// version of "ours" that would not be written back exactly as it was read
+// (see mscx.NewExact), since rewriting it would lose data. "ours" is not
+// rewritten if the merge changes nothing.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/gmlewis/go-musescore/scorediff"
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	if flag.NArg() < 3 || flag.NArg() > 4 {
+		log.Printf("usage: mscx-merge base ours theirs [path]")
+		os.Exit(2)
+	}
+	baseFilename, oursFilename, theirsFilename := flag.Arg(0), flag.Arg(1), flag.Arg(2)
+	name := oursFilename
+	if flag.NArg() == 4 {
+		name = flag.Arg(3)
+	}
+
+	conflicts, err := mergeFiles(baseFilename, oursFilename, theirsFilename)
+	if err != nil {
+		log.Printf("mscx-merge %v: %v", name, err)
+		os.Exit(2)
+	}
+	for _, c := range conflicts {
+		log.Printf("CONFLICT (%v): %v", name, c)
+	}
+	if len(conflicts) > 0 {
+		os.Exit(1)
+	}
+}
+
+func mergeFiles(baseFilename, oursFilename, theirsFilename string) ([]*scorediff.Conflict, error) {
+	base, err := mscx.NewFromFile(baseFilename, nil)
+	if err != nil {
+		return nil, fmt.Errorf("base: %w", err)
+	}
+	buf, err := os.ReadFile(oursFilename)
+	if err != nil {
+		return nil, err
+	}
+	// Writing the merge result over ours must not lose anything that
+	// the merge did not change.
+	ours, err := mscx.NewExact(buf)
+	if err != nil {
+		return nil, fmt.Errorf("ours: %w", err)
+	}
+	before, err := ours.XML()
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := mscx.NewFromFile(theirsFilename, nil)
+	if err != nil {
+		return nil, fmt.Errorf("theirs: %w", err)
+	}
+
+	conflicts, err := scorediff.Merge(&base.MuseScore.Score, &ours.MuseScore.Score, &theirs.MuseScore.Score)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := ours.XML()
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(out, before) {
+		return conflicts, nil
+	}
+	// git names the temporary files without an extension, so the format
+	// of ours is kept by looking at its contents.
+	if !bytes.HasPrefix(buf, []byte("<?xml")) {
+		if out, err = ours.Zip(nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.WriteFile(oursFilename, out, 0644); err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,189 @@
+// -*- compile-command: "go run main.go"; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// mscx-meta reads or edits the metaTags of `*.mscz` and `*.mscx` files.
+// Each argument is a file or a directory, which is searched recursively.
+//
+// Without edit flags, it prints one line per tag: "filename<TAB>name<TAB>text".
+// Use -get to print only the named tags and -all to include empty tags.
+//
+// With -set, -delete or -sync, it edits the files in place:
+//
+//	mscx-meta -set copyright="Public Domain" -set source=Hymnal hymns/
+//	mscx-meta -delete translator -sync=frame hymns/001-O_For_a_Thousand_Tongues_to_Sing.mscz
+//
+// -sync=frame updates the title frame from the tags after any edits, and
+// -sync=tags updates the tags from the title frame before any edits.
+// Use -n to report what would change without writing any files. Files
+// that would not be written back exactly as they were read (see
+// mscx.NewExact) are skipped, since rewriting them would lose data.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+var (
+	all      = flag.Bool("all", false, "Print empty tags too")
+	dryRun   = flag.Bool("n", false, "Report changes without writing files")
+	syncMode = flag.String("sync", "", `Sync the title frame: "frame" (from tags) or "tags" (from frame)`)
+
+	gets    stringList
+	deletes stringList
+	sets    = map[string]string{}
+)
+
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ",") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
+
+type setFlag map[string]string
+
+func (s setFlag) String() string { return fmt.Sprintf("%v", map[string]string(s)) }
+func (s setFlag) Set(v string) error {
+	name, text, ok := strings.Cut(v, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("want name=text, got %q", v)
+	}
+	s[name] = text
+	return nil
+}
+
+func main() {
+	flag.Var(&gets, "get", "Print only the named tag (repeatable)")
+	flag.Var(&deletes, "delete", "Delete the named tag (repeatable)")
+	flag.Var(setFlag(sets), "set", "Set a tag: name=text (repeatable)")
+	flag.Parse()
+
+	if *syncMode != "" && *syncMode != "frame" && *syncMode != "tags" {
+		log.Fatalf("-sync must be frame or tags, got %q", *syncMode)
+	}
+	edit := len(sets) > 0 || len(deletes) > 0 || *syncMode != ""
+
+	for _, arg := range flag.Args() {
+		err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !isScore(path) {
+				return nil
+			}
+			if edit {
+				return editFile(path)
+			}
+			return printFile(path)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func isScore(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".mscz" || ext == ".mscx"
+}
+
+func printFile(filename string) error {
+	sz, err := mscx.NewFromFile(filename, nil)
+	if err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+	score := &sz.MuseScore.Score
+
+	names := gets
+	if len(names) == 0 {
+		for _, mt := range score.MetaTags {
+			names = append(names, mt.Name)
+		}
+	}
+	for _, name := range names {
+		text, ok := score.MetaTag(name)
+		if !ok || text == "" && !*all {
+			continue
+		}
+		fmt.Printf("%v\t%v\t%v\n", filename, name, strings.ReplaceAll(text, "\n", `\n`))
+	}
+	return nil
+}
+
+func editFile(filename string) error {
+	sz, err := mscx.NewFromFileExact(filename)
+	if errors.Is(err, mscx.ErrNotExact) {
+		log.Printf("skipping %v: %v", filename, err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+	score := &sz.MuseScore.Score
+	before, err := sz.XML()
+	if err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+
+	if *syncMode == "tags" {
+		score.SyncMetaTagsFromFrame()
+	}
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		score.SetMetaTag(name, sets[name])
+	}
+	for _, name := range deletes {
+		score.DeleteMetaTag(name)
+	}
+	if *syncMode == "frame" {
+		score.SyncTitleFrame()
+	}
+
+	after, err := sz.XML()
+	if err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+	if string(before) == string(after) {
+		return nil
+	}
+	if *dryRun {
+		log.Printf("would update %v", filename)
+		return nil
+	}
+	log.Printf("updating %v", filename)
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if err := sz.WriteFile(filename, nil); err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+	return os.Chmod(filename, info.Mode().Perm())
+}
@@ -0,0 +1,139 @@
+// -*- compile-command: "go run main.go"; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// mscx-rehearsal renders practice tracks from `*.mscz` and `*.mscx` files
+// with a SoundFont (SF2) file: one WAV file for each line of each score,
+// in which that line is played loudly and panned to one side while the
+// other lines are played softly on the other side:
+//
+//	mscx-rehearsal -sf FluidR3_GM.sf2 -countin 1 hymn.mscz
+//
+// writes hymn-Soprano.wav, hymn-Alto.wav, hymn-Tenor.wav and hymn-Bass.wav
+// for a hymn written in four parts on two staves. By default, a score with
+// a single part is split into its voices (the upper and lower notes of
+// each staff of a hymn) and any other score into its parts; use -by to
+// choose. -click adds a click on every beat and -countin clicks for the
+// given number of measures before the score starts.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/gmlewis/go-musescore/synth"
+)
+
+var (
+	soundFont  = flag.String("sf", "", "SoundFont (SF2) file to play the scores with (required)")
+	by         = flag.String("by", "auto", "Lines to emphasize: part, voice or auto")
+	outDir     = flag.String("outdir", "", "Directory of the output WAV files (default: next to each score)")
+	pan        = flag.Float64("pan", -0.5, "Pan of the emphasized line from -1 (left) to 1 (right); the others are panned opposite")
+	others     = flag.Float64("others", 0.4, "Volume of the other lines from 0 (silent) to 1 (unchanged)")
+	click      = flag.Bool("click", false, "Click on every beat")
+	countIn    = flag.Int("countin", 0, "Number of measures of clicks before the score")
+	sampleRate = flag.Int("rate", synth.DefaultSampleRate, "Sample rate in Hz")
+)
+
+// unsafeFilenameChars are replaced when deriving a filename from the name
+// of a line, e.g. "S/A".
+var unsafeFilenameChars = regexp.MustCompile(`[\s/\\:*?"<>|]+`)
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+
+	if *soundFont == "" || flag.NArg() == 0 {
+		log.Fatal("usage: mscx-rehearsal -sf soundfont.sf2 [flags] score.mscz ...")
+	}
+	if *by != "auto" && *by != "part" && *by != "voice" {
+		log.Fatalf("-by must be part, voice or auto, not %q", *by)
+	}
+
+	sf, err := synth.LoadSoundFont(*soundFont)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := &synth.RehearsalOptions{Pan: *pan, Others: *others, Click: *click, CountIn: *countIn}
+
+	for _, arg := range flag.Args() {
+		if err := rehearse(sf, arg, opts); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func rehearse(sf *synth.SoundFont, filename string, opts *synth.RehearsalOptions) error {
+	sz, err := mscx.NewFromFile(filename, nil)
+	if err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+	score := &sz.MuseScore.Score
+	tracks, err := synth.Tracks(score)
+	if err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+
+	lines := synth.PartLines(tracks)
+	if *by == "voice" || *by == "auto" && len(lines) == 1 {
+		lines = synth.VoiceLines(tracks)
+	}
+	settings := synth.NewSettings(score.Synthesizer)
+
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	if *outDir != "" {
+		base = filepath.Join(*outDir, filepath.Base(base))
+	}
+	for i, line := range lines {
+		rehearsal, err := synth.Rehearsal(score, lines, line, opts)
+		if err != nil {
+			return fmt.Errorf("%v: %w", filename, err)
+		}
+		audio, err := synth.Render(sf, rehearsal, settings, *sampleRate)
+		if err != nil {
+			return fmt.Errorf("%v: %v: %w", filename, line.Name, err)
+		}
+		name := strings.Trim(unsafeFilenameChars.ReplaceAllString(line.Name, "_"), "_")
+		if name == "" {
+			name = fmt.Sprintf("line%v", i+1)
+		}
+		out := base + "-" + name + ".wav"
+		if err := writeWAV(out, audio); err != nil {
+			return err
+		}
+		log.Printf("%v: wrote %v", filename, out)
+	}
+	return nil
+}
+
+func writeWAV(filename string, audio *synth.Audio) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := audio.WriteWAV(f); err != nil {
+		f.Close()
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+	return f.Close()
+}
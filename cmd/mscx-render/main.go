@@ -0,0 +1,99 @@
+// -*- compile-command: "go run main.go"; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// mscx-render renders `*.mscz` and `*.mscx` files to WAV audio with a
+// SoundFont (SF2) file, without MuseScore or an audio device:
+//
+//	mscx-render -sf FluidR3_GM.sf2 hymn.mscz
+//
+// Each score is written next to it with the extension ".wav", or to the
+// file given by -o when there is a single score. Each part is played with
+// the program, volume, pan and reverb of its first channel, and the
+// score's master gain, tuning and reverb are applied.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/gmlewis/go-musescore/synth"
+)
+
+var (
+	soundFont  = flag.String("sf", "", "SoundFont (SF2) file to play the scores with (required)")
+	outFile    = flag.String("o", "", "Output WAV file (only with a single score)")
+	sampleRate = flag.Int("rate", synth.DefaultSampleRate, "Sample rate in Hz")
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+
+	if *soundFont == "" || flag.NArg() == 0 {
+		log.Fatal("usage: mscx-render -sf soundfont.sf2 [-o out.wav] [-rate 44100] score.mscz ...")
+	}
+	if *outFile != "" && flag.NArg() > 1 {
+		log.Fatal("-o may only be used with a single score")
+	}
+
+	sf, err := synth.LoadSoundFont(*soundFont)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, arg := range flag.Args() {
+		out := *outFile
+		if out == "" {
+			out = strings.TrimSuffix(arg, filepath.Ext(arg)) + ".wav"
+		}
+		if err := render(sf, arg, out); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func render(sf *synth.SoundFont, filename, out string) error {
+	sz, err := mscx.NewFromFile(filename, nil)
+	if err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+	audio, err := synth.RenderScore(sf, &sz.MuseScore.Score, *sampleRate)
+	if err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := audio.WriteWAV(f); err != nil {
+		f.Close()
+		return fmt.Errorf("%v: %w", out, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("%v: wrote %v (%v)", filename, out, audio.Duration().Round(100*time.Millisecond))
+	return nil
+}
@@ -0,0 +1,137 @@
+// -*- compile-command: "go run main.go"; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// mscx-repair fixes common inconsistencies in `*.mscz` and `*.mscx` files
+// in place: overfull and underfull measures, orphaned endSpanners, broken
+// lyric syllables and measure numbers. Each argument is a file or a
+// directory, which is searched recursively:
+//
+//	mscx-repair -n imported-hymns/
+//
+// It prints each change it makes, followed by any problems that remain
+// and must be fixed by hand. Use -n to report what would change without
+// writing any files. Files that cannot be read are reported and skipped,
+// and mscx-repair then exits with status 1. Files that would not be
+// written back exactly as they were read (see mscx.NewExact) are skipped
+// too, since rewriting them would lose data. A repaired `*.mscz` keeps its
+// other archive entries, and its thumbnail is rendered again.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gmlewis/go-musescore/engrave"
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+var (
+	dryRun   = flag.Bool("n", false, "Report changes without writing files")
+	warnings = flag.Bool("warnings", false, "Also print the remaining warnings, not only errors")
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+
+	failed := false
+	for _, arg := range flag.Args() {
+		err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !isScore(path) {
+				return nil
+			}
+			if err := repairFile(path); err != nil {
+				log.Print(err)
+				failed = true
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func isScore(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".mscz" || ext == ".mscx"
+}
+
+func repairFile(filename string) error {
+	sz, err := mscx.NewFromFileExact(filename)
+	if errors.Is(err, mscx.ErrNotExact) {
+		log.Printf("skipping %v: %v", filename, err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+	fixes, err := sz.Repair()
+	if err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+	for _, f := range fixes {
+		fmt.Printf("%v: %v\n", filename, f)
+	}
+	for _, f := range sz.Validate() {
+		if f.Severity == mscx.SeverityError || *warnings && f.Severity == mscx.SeverityWarning {
+			fmt.Printf("%v: remaining %v\n", filename, f)
+		}
+	}
+
+	if len(fixes) == 0 || *dryRun {
+		return nil
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	var opts *mscx.ZipOptions
+	if sz.Thumbnail != nil {
+		opts = &mscx.ZipOptions{RenderThumbnail: renderThumbnail}
+	}
+	if err := sz.WriteFile(filename, opts); err != nil {
+		return fmt.Errorf("%v: %w", filename, err)
+	}
+	return os.Chmod(filename, info.Mode().Perm())
+}
+
+// renderThumbnail renders the thumbnail of a repaired score. A score that
+// cannot be laid out is written without a thumbnail rather than with the
+// preview of the unrepaired score.
+func renderThumbnail(sz *mscx.ScoreZip) (image.Image, error) {
+	img, err := engrave.Thumbnail(sz)
+	if err != nil {
+		log.Printf("dropping thumbnail: %v", err)
+		return nil, nil
+	}
+	return img, nil
+}
@@ -0,0 +1,203 @@
+// -*- compile-command: "go run main.go"; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// mscx-stats reports the statistics of `*.mscz` and `*.mscx` files: the
+// playing time with repeats expanded and tempo changes applied, the
+// number of measures, the notes, range and lyric syllables of each part,
+// the most used durations and the key and time signature changes.
+//
+//	mscx-stats hymn.mscz
+//
+// With -json, the statistics of all the scores are written to standard
+// output as a JSON array instead. When there is more than one score, the
+// text report ends with their total playing time.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+var (
+	jsonOut  = flag.Bool("json", false, "Write the statistics as JSON")
+	topCount = flag.Int("durations", 5, "Number of most used durations to report (0 for all)")
+)
+
+// report is the JSON form of the statistics of a score.
+type report struct {
+	File           string           `json:"file"`
+	Duration       string           `json:"duration"`
+	Seconds        float64          `json:"seconds"`
+	Measures       int              `json:"measures"`
+	PlayedMeasures int              `json:"playedMeasures"`
+	Parts          []*partReport    `json:"parts"`
+	Durations      []*durationCount `json:"durations"`
+	LyricSyllables int              `json:"lyricSyllables"`
+	KeySignatures  []*change        `json:"keySignatures"`
+	TimeSignatures []*change        `json:"timeSignatures"`
+}
+
+type partReport struct {
+	Name           string `json:"name"`
+	Notes          int    `json:"notes"`
+	Lowest         string `json:"lowest,omitempty"`
+	Highest        string `json:"highest,omitempty"`
+	LyricSyllables int    `json:"lyricSyllables"`
+}
+
+type durationCount struct {
+	Duration string `json:"duration"`
+	Count    int    `json:"count"`
+}
+
+type change struct {
+	Measure int    `json:"measure"`
+	Value   string `json:"value"`
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatal("usage: mscx-stats [-json] [-durations 5] score.mscz ...")
+	}
+
+	var reports []*report
+	var total time.Duration
+	for _, arg := range flag.Args() {
+		r, d, err := newReport(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		reports = append(reports, r)
+		total += d
+		if !*jsonOut {
+			printReport(r)
+		}
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(reports) > 1 {
+		fmt.Printf("Total duration: %v\n", formatDuration(total))
+	}
+}
+
+func newReport(filename string) (*report, time.Duration, error) {
+	sz, err := mscx.NewFromFile(filename, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%v: %w", filename, err)
+	}
+	stats, err := sz.Statistics()
+	if err != nil {
+		return nil, 0, fmt.Errorf("%v: %w", filename, err)
+	}
+
+	r := &report{
+		File:           filename,
+		Duration:       formatDuration(stats.Duration),
+		Seconds:        stats.Duration.Seconds(),
+		Measures:       stats.Measures,
+		PlayedMeasures: stats.PlayedMeasures,
+		LyricSyllables: stats.LyricSyllables,
+	}
+	for _, ps := range stats.Parts {
+		pr := &partReport{Name: ps.Name, Notes: ps.Notes, LyricSyllables: ps.LyricSyllables}
+		if ps.Lowest != nil {
+			pr.Lowest = mscx.PitchName(ps.Lowest.Pitch, ps.Lowest.TPC)
+			pr.Highest = mscx.PitchName(ps.Highest.Pitch, ps.Highest.TPC)
+		}
+		r.Parts = append(r.Parts, pr)
+	}
+	for i, d := range stats.Durations {
+		if *topCount > 0 && i >= *topCount {
+			break
+		}
+		r.Durations = append(r.Durations, &durationCount{Duration: d.String(), Count: d.Count})
+	}
+	for _, k := range stats.KeyChanges {
+		r.KeySignatures = append(r.KeySignatures, &change{Measure: k.Measure, Value: keyName(k.Fifths)})
+	}
+	for _, ts := range stats.TimeSigChanges {
+		r.TimeSignatures = append(r.TimeSignatures, &change{Measure: ts.Measure, Value: ts.String()})
+	}
+	return r, stats.Duration, nil
+}
+
+func printReport(r *report) {
+	fmt.Printf("%v\n", r.File)
+	fmt.Printf("  Duration:        %v\n", r.Duration)
+	fmt.Printf("  Measures:        %v (%v played)\n", r.Measures, r.PlayedMeasures)
+	fmt.Printf("  Key signatures:  %v\n", formatChanges(r.KeySignatures))
+	fmt.Printf("  Time signatures: %v\n", formatChanges(r.TimeSignatures))
+	fmt.Printf("  Lyric syllables: %v\n", r.LyricSyllables)
+	var durations []string
+	for _, d := range r.Durations {
+		durations = append(durations, fmt.Sprintf("%v %v", d.Duration, d.Count))
+	}
+	fmt.Printf("  Durations:       %v\n", strings.Join(durations, ", "))
+	fmt.Printf("  Parts:\n")
+	for _, p := range r.Parts {
+		line := fmt.Sprintf("    %v: %v notes", p.Name, p.Notes)
+		if p.Lowest != "" {
+			line += fmt.Sprintf(", %v-%v", p.Lowest, p.Highest)
+		}
+		if p.LyricSyllables > 0 {
+			line += fmt.Sprintf(", %v lyric syllables", p.LyricSyllables)
+		}
+		fmt.Println(line)
+	}
+}
+
+func formatChanges(changes []*change) string {
+	var parts []string
+	for _, c := range changes {
+		parts = append(parts, fmt.Sprintf("m.%v %v", c.Measure, c.Value))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatDuration formats d as minutes and seconds, e.g. "3:05".
+func formatDuration(d time.Duration) string {
+	s := int(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%v:%02d", s/60, s%60)
+}
+
+// keyName returns the name of the major key with the number of sharps (or
+// negative for flats), e.g. "Eb major".
+func keyName(fifths int) string {
+	const tpcC = 14
+	return mscx.TPCName(tpcC+fifths) + " major"
+}
@@ -18,8 +18,14 @@ limitations under the License.
 
 // validate-mscx reads and parses a `*.mscz` or `*.mscx` file, then
 // compares its generated XML with the original XML and prints the
-// differences. This is used to validate the XML parser.
+// differences. This is used to validate the XML parser. For `*.mscz`
+// files it also checks that every image in a frame is in the archive.
 // If there are differences, it will print them and terminate.
+//
+// By default, whitespace at the start and end of lines is ignored. Use
+// -exact to require byte-for-byte identical output. Use -semantic to also
+// print the findings of the score's semantic validation (measure lengths,
+// spanners, lyrics, parts and brackets) and fail if any is an error.
 package main
 
 import (
@@ -32,6 +38,11 @@ import (
 	"github.com/google/go-cmp/cmp"
 )
 
+var (
+	exact    = flag.Bool("exact", false, "Require byte-for-byte identical XML")
+	semantic = flag.Bool("semantic", false, "Check the score's semantic consistency")
+)
+
 func main() {
 	flag.Parse()
 
@@ -55,15 +66,33 @@ func processFile(filename string) error {
 	if err != nil {
 		return err
 	}
-	strippedXML := strip(string(xml))
-
+	if strings.HasSuffix(filename, ".mscz") {
+		if err := sz.ValidateImages(); err != nil {
+			return err
+		}
+	}
+	if *semantic {
+		var errors int
+		for _, f := range sz.Validate() {
+			log.Print(f)
+			if f.Severity == mscx.SeverityError {
+				errors++
+			}
+		}
+		if errors > 0 {
+			return fmt.Errorf("%v: %v semantic errors", filename, errors)
+		}
+	}
 	// Compare XML in to XML out
 	gotXML, err := sz.XML()
 	if err != nil {
 		return err
 	}
 
-	strippedGot := strip(string(gotXML))
+	strippedXML, strippedGot := string(xml), string(gotXML)
+	if !*exact {
+		strippedXML, strippedGot = strip(strippedXML), strip(strippedGot)
+	}
 	if diff := cmp.Diff(strippedXML, strippedGot); diff != "" {
 		fmt.Println("\nwantXML:\n", string(xml))
 		fmt.Println("\ngotXML:\n", string(gotXML))
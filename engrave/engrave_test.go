@@ -0,0 +1,191 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engrave
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+func TestWritePage(t *testing.T) {
+	tests := []string{
+		"../mscx/testfiles/001-O_For_a_Thousand_Tongues_to_Sing.mscz",
+		"../mscx/testfiles/003-Come,_Thou_Almighty_King.mscz",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			sz, err := mscx.NewFromFile(tt, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			score := &sz.MuseScore.Score
+			l, err := LayoutScore(score)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(l.Pages) == 0 || len(l.Systems) == 0 {
+				t.Fatalf("LayoutScore = %v pages, %v systems, want at least 1 of each", len(l.Pages), len(l.Systems))
+			}
+
+			var wantNotes int
+			if err := score.Notes(func(ev *mscx.Event, note *mscx.Note) error {
+				wantNotes++
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			var gotNotes int
+			for i := range l.Pages {
+				var buf bytes.Buffer
+				if err := l.WritePage(&buf, i); err != nil {
+					t.Fatalf("WritePage(%v): %v", i, err)
+				}
+				checkSVG(t, buf.Bytes())
+				gotNotes += strings.Count(buf.String(), `class="Note"`)
+			}
+			if gotNotes != wantNotes {
+				t.Errorf("drew %v notes, want %v", gotNotes, wantNotes)
+			}
+
+			var buf bytes.Buffer
+			if err := l.WriteSystem(&buf, 0); err != nil {
+				t.Fatalf("WriteSystem: %v", err)
+			}
+			checkSVG(t, buf.Bytes())
+			if err := l.WritePage(&buf, len(l.Pages)); err == nil {
+				t.Errorf("WritePage(%v) = nil, want error", len(l.Pages))
+			}
+		})
+	}
+}
+
+func TestLayoutScore_LineBreak(t *testing.T) {
+	sz, err := mscx.NewScore().
+		Title("Line Break").
+		AddPart("Flute").
+		AddMeasure("4/4").Note("C5", "quarter").Note("D5", "quarter").Note("E5", "half").
+		AddMeasure("4/4").Note("F5", "whole").
+		AddMeasure("4/4").Rest("whole").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sz.MuseScore.Score
+
+	l, err := LayoutScore(score)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(l.Systems); got != 1 {
+		t.Fatalf("without breaks: got %v systems, want 1", got)
+	}
+
+	m := score.Staffs[0].Measure[0]
+	m.TimedElements = append(m.TimedElements, &mscx.LayoutBreak{Subtype: "line"})
+	if l, err = LayoutScore(score); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(l.Systems); got != 2 {
+		t.Fatalf("with line break: got %v systems, want 2", got)
+	}
+	if s := l.Systems[0]; s.FirstMeasure != 0 || s.LastMeasure != 0 {
+		t.Errorf("system 0 = measures %v-%v, want 0-0", s.FirstMeasure, s.LastMeasure)
+	}
+	if s := l.Systems[1]; s.FirstMeasure != 1 || s.LastMeasure != 2 {
+		t.Errorf("system 1 = measures %v-%v, want 1-2", s.FirstMeasure, s.LastMeasure)
+	}
+	if l.Systems[1].Y <= l.Systems[0].Y {
+		t.Errorf("system 1 Y = %v, want below system 0 Y = %v", l.Systems[1].Y, l.Systems[0].Y)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	sz, err := mscx.NewFromFile("../mscx/testfiles/001-O_For_a_Thousand_Tongues_to_Sing.mscz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := sz.Thumbnail
+
+	buf, err := sz.Zip(&mscx.ZipOptions{RenderThumbnail: Thumbnail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := mscx.New(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := got.Thumbnail
+	if img == nil {
+		t.Fatal("Thumbnail = nil, want image")
+	}
+	if got, want := img.Bounds(), original.Bounds(); got != want {
+		t.Errorf("Thumbnail.Bounds = %v, want %v", got, want)
+	}
+	if n := inkPixels(img, image.Rect(0, 0, 181, 40)); n == 0 {
+		t.Error("thumbnail has no title")
+	}
+	if n := inkPixels(img, image.Rect(0, 40, 181, 256)); n == 0 {
+		t.Error("thumbnail has no music")
+	}
+}
+
+// inkPixels counts the dark pixels of img within r.
+func inkPixels(img image.Image, r image.Rectangle) int {
+	var n int
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if c := color.GrayModel.Convert(img.At(x, y)).(color.Gray); c.Y < 0x40 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// checkSVG verifies that buf is well-formed XML with an <svg> root.
+func checkSVG(t *testing.T, buf []byte) {
+	t.Helper()
+	d := xml.NewDecoder(bytes.NewReader(buf))
+	var root string
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %v", err)
+		}
+		if se, ok := tok.(xml.StartElement); ok && root == "" {
+			root = se.Name.Local
+		}
+	}
+	if root != "svg" {
+		t.Errorf("root element = %q, want svg", root)
+	}
+}
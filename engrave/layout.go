@@ -0,0 +1,588 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package engrave lays out MuseScore scores on pages and renders them as
+// SVG (or as archive thumbnails) without the MuseScore application. It is
+// a minimal engraver meant for previews: it draws staves, clefs, key and
+// time signatures, notes, rests, beams, barlines, lyrics and title frames,
+// at concert pitch.
+package engrave
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// Page and spacing defaults, following MuseScore 3.
+const (
+	mmPerInch = 25.4
+	mmPerPt   = mmPerInch / 72
+
+	defaultSpatium    = 1.764 // mm
+	defaultPageWidth  = 210.0 // mm (A4)
+	defaultPageHeight = 297.0 // mm
+	defaultMargin     = 15.0  // mm
+
+	// The following are in staff spaces.
+	staffDistance     = 6.5
+	systemDistance    = 9.5
+	lyricsLineHeight  = 2.8
+	measurePadding    = 1.2
+	barPadding        = 0.5
+	emptyMeasureWidth = 6.0
+	headerPadding     = 1.0
+	keySigAccidental  = 1.0
+	aboveFirstSystem  = 4.0
+	defaultVBoxHeight = 10.0
+
+	lyricsFontSize = 11.0 // pt
+)
+
+// staffInfo describes how a staff is drawn.
+type staffInfo struct {
+	staff      *mscx.ScoreStaff
+	clef       string
+	lines      int
+	tab        bool
+	instrument *mscx.Instrument
+}
+
+// measureInfo holds the content and horizontal spacing of one measure
+// across all staves. Widths are in staff spaces.
+type measureInfo struct {
+	ticks int
+	// beamTicks is the length of a beam group.
+	beamTicks int
+	// segs are the ticks (from the start of the measure) at which chords
+	// or rests begin on any staff, in order.
+	segs []int
+	// segPre is the space before each segment (for accidentals) and
+	// segWidth is the space from each segment to the next.
+	segPre, segWidth []float64
+
+	// keySig and timeSig are the signatures displayed at the start of the
+	// measure, if any. fifths is the key in effect.
+	keySig  *mscx.KeySig
+	timeSig *mscx.TimeSig
+	fifths  int
+
+	lineBreak, pageBreak bool
+	// barLine is the subtype of the closing barline, e.g. "double" or "end".
+	barLine string
+
+	// events and verses are indexed by staff.
+	events [][]*mscx.Event
+	verses []int
+}
+
+// width returns the natural width of the measure's content.
+func (m *measureInfo) width() float64 {
+	if len(m.segs) == 0 {
+		return emptyMeasureWidth
+	}
+	w := measurePadding + barPadding
+	for i := range m.segs {
+		w += m.segPre[i] + m.segWidth[i]
+	}
+	return w
+}
+
+// System is a single line of music.
+type System struct {
+	// FirstMeasure and LastMeasure are the 0-based indices of the first
+	// and last measures of the system.
+	FirstMeasure, LastMeasure int
+	// Y is the distance in mm from the top of the page to the top line
+	// of the first staff.
+	Y float64
+	// StaffY holds the distance in mm from Y to the top line of each staff.
+	StaffY []float64
+	// Height is the distance in mm from Y to the bottom of the system,
+	// including any lyrics below the last staff.
+	Height float64
+
+	page *Page
+	// headerWidth is the width of the clefs and signatures, in staff spaces.
+	headerWidth float64
+	// stretch scales the natural widths of the measures to fill the line.
+	stretch float64
+}
+
+// Page is a single page of the layout.
+type Page struct {
+	Systems []*System
+	// Header is the title frame drawn at the top of the page, if any.
+	Header *mscx.VBox
+
+	headerHeight float64 // mm
+}
+
+// Layout is a score laid out on pages.
+type Layout struct {
+	Pages   []*Page
+	Systems []*System
+
+	score  *mscx.Score
+	font   *Font
+	sp     float64
+	staves []*staffInfo
+
+	pageWidth, pageHeight                            float64
+	marginLeft, marginRight, marginTop, marginBottom float64
+
+	measures []*measureInfo
+}
+
+// LayoutScore lays out the score using its style (spatium and page size)
+// and its line and page breaks.
+func LayoutScore(score *mscx.Score) (*Layout, error) {
+	if len(score.Staffs) == 0 {
+		return nil, fmt.Errorf("LayoutScore: score has no staves")
+	}
+	l := &Layout{score: score, font: Bravura()}
+	l.pageSetup()
+	l.staffSetup()
+	if err := l.collectMeasures(); err != nil {
+		return nil, fmt.Errorf("LayoutScore: %w", err)
+	}
+	l.spaceMeasures()
+	l.breakSystems()
+	l.placeSystems()
+	return l, nil
+}
+
+// pageSetup determines the spatium, page size and margins in mm.
+func (l *Layout) pageSetup() {
+	l.sp = defaultSpatium
+	l.pageWidth, l.pageHeight = defaultPageWidth, defaultPageHeight
+	l.marginLeft, l.marginRight, l.marginTop, l.marginBottom = defaultMargin, defaultMargin, defaultMargin, defaultMargin
+
+	st := l.score.Style
+	if st == nil {
+		return
+	}
+	if st.Spatium > 0 {
+		l.sp = st.Spatium
+	}
+	// MuseScore 2 page layouts are in units of 1/144 inch.
+	if pl := st.PageLayout; pl != nil && pl.PageWidth > 0 && pl.PageHeight > 0 {
+		const unit = mmPerInch / 144
+		l.pageWidth, l.pageHeight = pl.PageWidth*unit, pl.PageHeight*unit
+		if len(pl.PageMargins) > 0 {
+			pm := pl.PageMargins[0]
+			l.marginLeft, l.marginRight = pm.LeftMargin*unit, pm.RightMargin*unit
+			l.marginTop, l.marginBottom = pm.TopMargin*unit, pm.BottomMargin*unit
+		}
+	}
+	// MuseScore 3 page sizes are in inches.
+	if st.PageWidth > 0 && st.PageHeight > 0 {
+		l.pageWidth, l.pageHeight = st.PageWidth*mmPerInch, st.PageHeight*mmPerInch
+		if st.PagePrintableWidth > 0 && st.PagePrintableWidth < st.PageWidth {
+			margin := (st.PageWidth - st.PagePrintableWidth) / 2 * mmPerInch
+			l.marginLeft, l.marginRight = margin, margin
+		}
+	}
+}
+
+// staffSetup determines the clef and staff type of every staff.
+func (l *Layout) staffSetup() {
+	for _, staff := range l.score.Staffs {
+		si := &staffInfo{staff: staff, clef: "G", lines: 5}
+		part := l.score.PartForStaff(staff.ID)
+		if part == nil {
+			l.staves = append(l.staves, si)
+			continue
+		}
+		for i, ps := range part.Staff {
+			if ps.ID != staff.ID {
+				continue
+			}
+			if ps.StaffType.Lines > 0 {
+				si.lines = ps.StaffType.Lines
+			}
+			switch ps.StaffType.Group {
+			case "tablature":
+				si.tab = true
+			case "percussion":
+				si.clef = "PERC"
+			}
+			if inst := part.Instrument; inst != nil {
+				si.instrument = inst
+				if c := inst.Clef; c != nil && (c.Staff == "" && i == 0 || c.Staff == strconv.Itoa(i+1)) {
+					si.clef = c.Text
+				}
+			}
+			for _, el := range ps.StaffElements {
+				if dc, ok := el.(*mscx.DefaultClef); ok && dc.Type != "Transposing" {
+					si.clef = dc.Value
+				}
+			}
+		}
+		l.staves = append(l.staves, si)
+	}
+}
+
+// collectMeasures gathers the events, signatures and breaks of every measure.
+func (l *Layout) collectMeasures() error {
+	first := l.score.Staffs[0]
+	var timeSig *mscx.TimeSig
+	fifths := 0
+	for i, m := range first.Measure {
+		mi := &measureInfo{events: make([][]*mscx.Event, len(l.staves)), verses: make([]int, len(l.staves))}
+		keySig, ts := m.KeySig, m.TimeSig
+		if len(m.Voice) > 0 {
+			if v := m.Voice[0]; v.KeySig != nil {
+				keySig = v.KeySig
+			}
+			if v := m.Voice[0]; v.TimeSig != nil {
+				ts = v.TimeSig
+			}
+		}
+		if keySig != nil && (i == 0 || keySig.Fifths() != fifths) {
+			mi.keySig = keySig
+			fifths = keySig.Fifths()
+		}
+		if ts != nil {
+			mi.timeSig, timeSig = ts, ts
+		}
+		mi.fifths = fifths
+
+		ticks, err := l.score.MeasureTicks(m, timeSig)
+		if err != nil {
+			return fmt.Errorf("measure %v: %w", i+1, err)
+		}
+		mi.ticks = ticks
+		mi.beamTicks = l.division()
+		if timeSig != nil {
+			n, _ := strconv.Atoi(timeSig.SigN)
+			d, _ := strconv.Atoi(timeSig.SigD)
+			if d == 8 && n%3 == 0 {
+				mi.beamTicks = 3 * l.division() / 2
+			}
+		}
+		if m.EndRepeat != 0 {
+			mi.barLine = "end"
+		}
+		if i == len(first.Measure)-1 {
+			mi.barLine = "end"
+		}
+		l.measures = append(l.measures, mi)
+	}
+
+	for si, staff := range l.score.Staffs {
+		for i, m := range staff.Measure {
+			if i >= len(l.measures) {
+				break
+			}
+			for _, el := range m.TimedElements {
+				if lb, ok := el.(*mscx.LayoutBreak); ok {
+					switch lb.Subtype {
+					case "line":
+						l.measures[i].lineBreak = true
+					case "page":
+						l.measures[i].pageBreak = true
+					}
+				}
+			}
+		}
+
+		err := l.score.WalkStaff(staff, func(ev *mscx.Event) error {
+			if ev.Measure > len(l.measures) {
+				return nil
+			}
+			mi := l.measures[ev.Measure-1]
+			switch el := ev.Element.(type) {
+			case *mscx.Chord:
+				mi.events[si] = append(mi.events[si], ev)
+				for _, ly := range el.Lyrics {
+					if ly.No+1 > mi.verses[si] {
+						mi.verses[si] = ly.No + 1
+					}
+				}
+			case *mscx.Rest:
+				mi.events[si] = append(mi.events[si], ev)
+			case *mscx.BarLine:
+				if el.Subtype == "double" || el.Subtype == "end" {
+					mi.barLine = el.Subtype
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Layout) division() int {
+	if l.score.Division > 0 {
+		return l.score.Division
+	}
+	return mscx.DefaultDivision
+}
+
+// durationSpace returns the space (in staff spaces) given to a duration.
+func (l *Layout) durationSpace(ticks int) float64 {
+	return 1.6 + 2.4*math.Sqrt(float64(ticks)/float64(l.division()))
+}
+
+// textWidth estimates the width in staff spaces of text in the given
+// font size (in points).
+func (l *Layout) textWidth(s string, pt float64) float64 {
+	return float64(utf8.RuneCountInString(s)) * 0.5 * pt * mmPerPt / l.sp
+}
+
+// spaceMeasures computes the segments and natural widths of every measure.
+func (l *Layout) spaceMeasures() {
+	head := l.font.glyph("noteheadBlack").Width()
+	for _, mi := range l.measures {
+		onsets := map[int]bool{}
+		for _, events := range mi.events {
+			for _, ev := range events {
+				onsets[ev.MeasureTick] = true
+			}
+		}
+		for tick := range onsets {
+			mi.segs = append(mi.segs, tick)
+		}
+		sort.Ints(mi.segs)
+
+		index := map[int]int{}
+		for i, tick := range mi.segs {
+			index[tick] = i
+		}
+		mi.segPre = make([]float64, len(mi.segs))
+		mi.segWidth = make([]float64, len(mi.segs))
+		for i, tick := range mi.segs {
+			next := mi.ticks
+			if i+1 < len(mi.segs) {
+				next = mi.segs[i+1]
+			}
+			if next <= tick {
+				next = tick + l.division()/4
+			}
+			mi.segWidth[i] = math.Max(l.durationSpace(next-tick), head+0.6)
+		}
+
+		for _, events := range mi.events {
+			for _, ev := range events {
+				i := index[ev.MeasureTick]
+				chord, ok := ev.Element.(*mscx.Chord)
+				if !ok {
+					continue
+				}
+				if chord.Dots > 0 {
+					mi.segWidth[i] = math.Max(mi.segWidth[i], head+0.6+0.6*float64(chord.Dots)+0.6)
+				}
+				for _, note := range chord.Note {
+					if alteration(note.TPC) != keyAlteration(mi.fifths, noteLetter(note.TPC)) {
+						mi.segPre[i] = 1.4
+					}
+				}
+				for _, ly := range chord.Lyrics {
+					if w := l.textWidth(ly.Text, lyricsFontSize) + 0.8; w > mi.segWidth[i] {
+						mi.segWidth[i] = w
+					}
+				}
+			}
+		}
+	}
+}
+
+// clefWidth returns the width of the widest clef.
+func (l *Layout) clefWidth() float64 {
+	var w float64
+	for _, si := range l.staves {
+		if name, _ := clefGlyph(si.clef); name != "" && !si.tab {
+			w = math.Max(w, l.font.glyph(name).Width())
+		}
+	}
+	return w
+}
+
+// keySigWidth returns the width of a key signature.
+func keySigWidth(fifths int) float64 {
+	n := fifths
+	if n < 0 {
+		n = -n
+	}
+	if n == 0 {
+		return 0
+	}
+	return float64(n)*keySigAccidental + headerPadding
+}
+
+// timeSigWidth returns the width of a time signature.
+func (l *Layout) timeSigWidth(ts *mscx.TimeSig) float64 {
+	return math.Max(l.digitsWidth(ts.SigN), l.digitsWidth(ts.SigD)) + headerPadding
+}
+
+func (l *Layout) digitsWidth(s string) float64 {
+	var w float64
+	for _, c := range s {
+		if g := l.font.Glyph("timeSig" + string(c)); g != nil {
+			w += g.Width()
+		}
+	}
+	return w
+}
+
+// headerWidth returns the width of the clefs and signatures at the start
+// of a system beginning with measure i.
+func (l *Layout) headerWidth(i int) float64 {
+	mi := l.measures[i]
+	w := headerPadding + l.clefWidth() + headerPadding + keySigWidth(mi.fifths)
+	if mi.timeSig != nil {
+		w += l.timeSigWidth(mi.timeSig)
+	}
+	return w
+}
+
+// changeWidth returns the width of the key and time signature changes at
+// the start of measure i when it does not begin a system.
+func (l *Layout) changeWidth(i int) float64 {
+	mi := l.measures[i]
+	var w float64
+	if mi.keySig != nil {
+		w += keySigWidth(mi.fifths)
+	}
+	if mi.timeSig != nil {
+		w += l.timeSigWidth(mi.timeSig)
+	}
+	return w
+}
+
+// breakSystems divides the measures into systems.
+func (l *Layout) breakSystems() {
+	available := (l.pageWidth - l.marginLeft - l.marginRight) / l.sp
+	var sys *System
+	var used float64
+	for i, mi := range l.measures {
+		w := mi.width() + l.changeWidth(i)
+		if sys != nil && used+w > available {
+			sys = nil
+		}
+		if sys == nil {
+			sys = &System{FirstMeasure: i, headerWidth: l.headerWidth(i)}
+			l.Systems = append(l.Systems, sys)
+			w = mi.width()
+			used = sys.headerWidth
+		}
+		sys.LastMeasure = i
+		used += w
+		if mi.lineBreak || mi.pageBreak {
+			sys = nil
+		}
+	}
+
+	for si, sys := range l.Systems {
+		var natural float64
+		for i := sys.FirstMeasure; i <= sys.LastMeasure; i++ {
+			natural += l.measures[i].width()
+			if i > sys.FirstMeasure {
+				natural += l.changeWidth(i)
+			}
+		}
+		sys.stretch = 1
+		if natural <= 0 {
+			continue
+		}
+		stretch := (available - sys.headerWidth) / natural
+		// As in MuseScore, a short last system is not stretched.
+		last := l.measures[sys.LastMeasure]
+		if si == len(l.Systems)-1 && !last.lineBreak && !last.pageBreak && natural+sys.headerWidth < 0.7*available {
+			continue
+		}
+		sys.stretch = math.Max(stretch, 1)
+	}
+}
+
+// staffHeight returns the height of a staff in staff spaces.
+func (si *staffInfo) height() float64 {
+	if si.lines <= 1 {
+		return 0
+	}
+	if si.tab {
+		return 1.5 * float64(si.lines-1)
+	}
+	return float64(si.lines - 1)
+}
+
+// placeSystems positions the staves within each system and the systems
+// on pages.
+func (l *Layout) placeSystems() {
+	var header *mscx.VBox
+	if vbox := l.score.Staffs[0].VBox; vbox != nil && len(vbox.Text) > 0 {
+		header = vbox
+	}
+
+	var page *Page
+	var y float64
+	newPage := func() {
+		page = &Page{}
+		l.Pages = append(l.Pages, page)
+		y = l.marginTop + aboveFirstSystem*l.sp
+		if len(l.Pages) == 1 && header != nil {
+			h, err := strconv.ParseFloat(header.Height, 64)
+			if err != nil || h <= 0 {
+				h = defaultVBoxHeight
+			}
+			page.Header, page.headerHeight = header, h*l.sp
+			y += page.headerHeight
+		}
+	}
+	newPage()
+
+	for i, sys := range l.Systems {
+		// The lyrics below each staff determine the distance to the next.
+		var offset, below float64
+		for si, staff := range l.staves {
+			var verses int
+			for m := sys.FirstMeasure; m <= sys.LastMeasure; m++ {
+				if v := l.measures[m].verses[si]; v > verses {
+					verses = v
+				}
+			}
+			below = 0
+			if verses > 0 {
+				below = 2 + float64(verses)*lyricsLineHeight
+			}
+			sys.StaffY = append(sys.StaffY, offset*l.sp)
+			offset += staff.height()
+			if si < len(l.staves)-1 {
+				offset += math.Max(staffDistance, below+2.5)
+			}
+		}
+		sys.Height = (offset + below) * l.sp
+
+		if len(page.Systems) > 0 && y+sys.Height > l.pageHeight-l.marginBottom {
+			newPage()
+		}
+		sys.Y, sys.page = y, page
+		page.Systems = append(page.Systems, sys)
+		y += sys.Height + systemDistance*l.sp
+
+		if l.measures[sys.LastMeasure].pageBreak && i < len(l.Systems)-1 {
+			newPage()
+		}
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engrave
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The embedded files are the subsets of the SMuFL glyphnames.json and the
+// Bravura font metadata needed by the engraver.
+var (
+	//go:embed glyphnames.json
+	glyphnamesJSON []byte
+	//go:embed bravura_metadata.json
+	metadataJSON []byte
+)
+
+// Glyph describes a single SMuFL glyph. All dimensions are in staff
+// spaces, with y increasing upward from the glyph's baseline.
+type Glyph struct {
+	Name      string
+	Codepoint rune
+	BBoxNE    [2]float64
+	BBoxSW    [2]float64
+	// Anchors holds the glyph's attachment points, e.g. "stemUpSE".
+	Anchors map[string][2]float64
+}
+
+// Width returns the width of the glyph's bounding box.
+func (g *Glyph) Width() float64 {
+	return g.BBoxNE[0] - g.BBoxSW[0]
+}
+
+// EngravingDefaults holds the recommended line thicknesses and spacings
+// of a SMuFL font, in staff spaces.
+type EngravingDefaults struct {
+	BarlineSeparation     float64 `json:"barlineSeparation"`
+	BeamSpacing           float64 `json:"beamSpacing"`
+	BeamThickness         float64 `json:"beamThickness"`
+	LegerLineExtension    float64 `json:"legerLineExtension"`
+	LegerLineThickness    float64 `json:"legerLineThickness"`
+	StaffLineThickness    float64 `json:"staffLineThickness"`
+	StemThickness         float64 `json:"stemThickness"`
+	ThickBarlineThickness float64 `json:"thickBarlineThickness"`
+	ThinBarlineThickness  float64 `json:"thinBarlineThickness"`
+}
+
+// Font is a SMuFL music font.
+type Font struct {
+	Name     string
+	Defaults EngravingDefaults
+
+	glyphs map[string]*Glyph
+}
+
+type fontMetadata struct {
+	FontName          string                           `json:"fontName"`
+	EngravingDefaults EngravingDefaults                `json:"engravingDefaults"`
+	GlyphBBoxes       map[string]map[string][2]float64 `json:"glyphBBoxes"`
+	GlyphsWithAnchors map[string]map[string][2]float64 `json:"glyphsWithAnchors"`
+}
+
+var (
+	bravuraOnce sync.Once
+	bravura     *Font
+)
+
+// Bravura returns the embedded metrics of the Bravura font. The glyphs
+// themselves are drawn by the SVG viewer, which must have Bravura (or the
+// metrically similar Leland) installed.
+func Bravura() *Font {
+	bravuraOnce.Do(func() {
+		var err error
+		if bravura, err = parseFont(glyphnamesJSON, metadataJSON); err != nil {
+			panic(fmt.Sprintf("unable to parse embedded SMuFL metadata: %v", err))
+		}
+	})
+	return bravura
+}
+
+func parseFont(glyphnames, metadata []byte) (*Font, error) {
+	var names map[string]struct {
+		Codepoint string `json:"codepoint"`
+	}
+	if err := json.Unmarshal(glyphnames, &names); err != nil {
+		return nil, err
+	}
+	var meta fontMetadata
+	if err := json.Unmarshal(metadata, &meta); err != nil {
+		return nil, err
+	}
+
+	f := &Font{Name: meta.FontName, Defaults: meta.EngravingDefaults, glyphs: map[string]*Glyph{}}
+	for name, v := range names {
+		cp, err := strconv.ParseUint(strings.TrimPrefix(v.Codepoint, "U+"), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("glyph %v: %w", name, err)
+		}
+		g := &Glyph{Name: name, Codepoint: rune(cp), Anchors: meta.GlyphsWithAnchors[name]}
+		bbox, ok := meta.GlyphBBoxes[name]
+		if !ok {
+			return nil, fmt.Errorf("glyph %v has no bounding box", name)
+		}
+		g.BBoxNE, g.BBoxSW = bbox["bBoxNE"], bbox["bBoxSW"]
+		f.glyphs[name] = g
+	}
+	return f, nil
+}
+
+// Glyph returns the named glyph, or nil if the font does not have it.
+func (f *Font) Glyph(name string) *Glyph {
+	return f.glyphs[name]
+}
+
+// glyph is like Glyph but panics if the glyph is missing, which can only
+// happen if the embedded metadata is incomplete.
+func (f *Font) glyph(name string) *Glyph {
+	g, ok := f.glyphs[name]
+	if !ok {
+		panic(fmt.Sprintf("SMuFL glyph %q missing from embedded metadata", name))
+	}
+	return g
+}
@@ -0,0 +1,918 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engrave
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+const (
+	musicFontFamily = "Bravura, Leland"
+	textFontFamily  = "Edwin, FreeSerif, Times New Roman, serif"
+
+	titleFontSize    = 22.0 // pt
+	subtitleFontSize = 14.0 // pt
+	creditFontSize   = 12.0 // pt
+	tabFontSize      = 9.0  // pt
+
+	stemLength = 3.5 // staff spaces
+	minStem    = 2.5 // staff spaces between a beam and the nearest notehead
+)
+
+// WritePage writes the given page (0-based) as an SVG document.
+func (l *Layout) WritePage(w io.Writer, page int) error {
+	if page < 0 || page >= len(l.Pages) {
+		return fmt.Errorf("Layout.WritePage: page %v out of range (%v pages)", page, len(l.Pages))
+	}
+	p := l.Pages[page]
+	c := &canvas{l: l}
+	c.begin(0, l.pageHeight)
+	if p.Header != nil {
+		l.drawHeader(c, p)
+	}
+	for _, sys := range p.Systems {
+		l.drawSystem(c, sys)
+	}
+	c.end()
+	if _, err := w.Write(c.buf.Bytes()); err != nil {
+		return fmt.Errorf("Layout.WritePage: %w", err)
+	}
+	return nil
+}
+
+// WriteSystem writes the given system (0-based) alone as an SVG document
+// as wide as the page and just tall enough to hold the system.
+func (l *Layout) WriteSystem(w io.Writer, system int) error {
+	if system < 0 || system >= len(l.Systems) {
+		return fmt.Errorf("Layout.WriteSystem: system %v out of range (%v systems)", system, len(l.Systems))
+	}
+	sys := l.Systems[system]
+	c := &canvas{l: l}
+	margin := aboveFirstSystem * l.sp
+	c.begin(sys.Y-margin, sys.Height+2*margin)
+	l.drawSystem(c, sys)
+	c.end()
+	if _, err := w.Write(c.buf.Bytes()); err != nil {
+		return fmt.Errorf("Layout.WriteSystem: %w", err)
+	}
+	return nil
+}
+
+// canvas accumulates SVG elements. All coordinates are in mm.
+type canvas struct {
+	buf bytes.Buffer
+	l   *Layout
+}
+
+// num formats a coordinate compactly.
+func num(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 3, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+func (c *canvas) begin(top, height float64) {
+	w := c.l.pageWidth
+	c.buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&c.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%vmm" height="%vmm" viewBox="0 %v %v %v">`+"\n", num(w), num(height), num(top), num(w), num(height))
+	fmt.Fprintf(&c.buf, `<rect x="0" y="%v" width="%v" height="%v" fill="#fff"/>`+"\n", num(top), num(w), num(height))
+}
+
+func (c *canvas) end() {
+	c.buf.WriteString("</svg>\n")
+}
+
+func (c *canvas) line(class string, x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&c.buf, `<line class="%v" x1="%v" y1="%v" x2="%v" y2="%v" stroke="#000" stroke-width="%v"/>`+"\n",
+		class, num(x1), num(y1), num(x2), num(y2), num(width))
+}
+
+func (c *canvas) polygon(class string, points ...float64) {
+	var pts []string
+	for i := 0; i+1 < len(points); i += 2 {
+		pts = append(pts, num(points[i])+","+num(points[i+1]))
+	}
+	fmt.Fprintf(&c.buf, `<polygon class="%v" points="%v" fill="#000"/>`+"\n", class, strings.Join(pts, " "))
+}
+
+// glyph draws a SMuFL glyph with its origin at (x, y).
+func (c *canvas) glyph(class, name string, x, y float64) {
+	g := c.l.font.glyph(name)
+	fmt.Fprintf(&c.buf, `<text class="%v" x="%v" y="%v" font-family="%v" font-size="%v">&#x%X;</text>`+"\n",
+		class, num(x), num(y), musicFontFamily, num(4*c.l.sp), g.Codepoint)
+}
+
+// text draws text with its baseline at y. anchor is "start", "middle" or "end".
+func (c *canvas) text(class string, x, y, pt float64, anchor, s string) {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(s))
+	fmt.Fprintf(&c.buf, `<text class="%v" x="%v" y="%v" font-family="%v" font-size="%v" text-anchor="%v">%s</text>`+"\n",
+		class, num(x), num(y), textFontFamily, num(pt*mmPerPt), anchor, escaped.Bytes())
+}
+
+var markup = regexp.MustCompile(`<[^>]*>`)
+
+// drawHeader draws the title frame at the top of the page.
+func (l *Layout) drawHeader(c *canvas, p *Page) {
+	top, h := l.marginTop, p.headerHeight
+	left, right, center := l.marginLeft, l.pageWidth-l.marginRight, l.pageWidth/2
+	for _, te := range p.Header.Text {
+		s := strings.TrimSpace(markup.ReplaceAllString(string(te.Text), ""))
+		if s == "" {
+			continue
+		}
+		switch te.Style {
+		case mscx.Title:
+			c.text("Title", center, top+0.45*h, titleFontSize, "middle", s)
+		case mscx.Subtitle:
+			c.text("Subtitle", center, top+0.7*h, subtitleFontSize, "middle", s)
+		case mscx.Composer:
+			c.text("Composer", right, top+h-l.sp, creditFontSize, "end", s)
+		case mscx.Lyricist, "Poet":
+			c.text("Lyricist", left, top+h-l.sp, creditFontSize, "start", s)
+		case mscx.InstrumentExcerpt:
+			c.text("PartName", left, top+creditFontSize*mmPerPt, creditFontSize, "start", s)
+		default:
+			c.text("Text", center, top+0.85*h, creditFontSize, "middle", s)
+		}
+	}
+}
+
+// measurePos holds the horizontal positions (in mm) of a measure.
+type measurePos struct {
+	start   float64 // left barline
+	content float64 // after any signature changes
+	end     float64 // right barline
+	segX    map[int]float64
+}
+
+// measurePositions returns the positions of the measures of the system.
+func (l *Layout) measurePositions(sys *System) []*measurePos {
+	var result []*measurePos
+	x := l.marginLeft + sys.headerWidth*l.sp
+	for i := sys.FirstMeasure; i <= sys.LastMeasure; i++ {
+		mi := l.measures[i]
+		mp := &measurePos{start: x, content: x, segX: map[int]float64{}}
+		if i > sys.FirstMeasure {
+			mp.content += l.changeWidth(i) * l.sp
+		}
+		scale := sys.stretch * l.sp
+		pos := measurePadding
+		for j, tick := range mi.segs {
+			pos += mi.segPre[j]
+			mp.segX[tick] = mp.content + pos*scale
+			pos += mi.segWidth[j]
+		}
+		mp.end = mp.content + mi.width()*scale
+		x = mp.end
+		result = append(result, mp)
+	}
+	return result
+}
+
+// drawSystem draws the staves, signatures and measures of a system.
+func (l *Layout) drawSystem(c *canvas, sys *System) {
+	sp, d := l.sp, l.font.Defaults
+	positions := l.measurePositions(sys)
+	x0, x1 := l.marginLeft, positions[len(positions)-1].end
+
+	for si, staff := range l.staves {
+		top := sys.Y + sys.StaffY[si]
+		gap := sp
+		if staff.tab {
+			gap = 1.5 * sp
+		}
+		for line := 0; line < staff.lines; line++ {
+			y := top + float64(line)*gap
+			c.line("StaffLines", x0, y, x1, y, d.StaffLineThickness*sp)
+		}
+	}
+	if len(l.staves) > 1 {
+		last := len(l.staves) - 1
+		bottom := sys.Y + sys.StaffY[last] + l.staves[last].height()*sp
+		c.line("SystemBarLine", x0, sys.Y, x0, bottom, d.ThinBarlineThickness*sp)
+	}
+
+	// Clefs and signatures.
+	first := l.measures[sys.FirstMeasure]
+	for si, staff := range l.staves {
+		top := sys.Y + sys.StaffY[si]
+		x := x0 + headerPadding*sp
+		if staff.tab {
+			c.text("Clef", x, top+staff.height()/2*sp+sp/2, tabFontSize+2, "start", "TAB")
+		} else if name, y := clefGlyph(staff.clef); name != "" {
+			c.glyph("Clef", name, x, top+y*sp)
+		}
+		x += (l.clefWidth() + headerPadding) * sp
+		if staff.tab {
+			continue
+		}
+		x = l.drawKeySig(c, staff, x, top, first.fifths)
+		if first.timeSig != nil {
+			l.drawTimeSig(c, x, top, first.timeSig)
+		}
+	}
+
+	for i, mp := range positions {
+		l.drawMeasure(c, sys, sys.FirstMeasure+i, mp)
+	}
+	l.drawLyrics(c, sys, positions)
+}
+
+// clefTops maps a clef to the diatonic step (C4=28) of its top line.
+var clefTops = map[string]int{
+	"G": 38, "G8vb": 31, "G8va": 45, "G15mb": 24, "G15ma": 52,
+	"F": 26, "F8vb": 19, "F8va": 33, "F15mb": 12, "F15ma": 40,
+	"C1": 36, "C2": 34, "C3": 32, "C4": 30, "C5": 28,
+	"PERC": 38,
+}
+
+// clefGlyph returns the SMuFL glyph of the clef and the staff position
+// (in staff spaces below the top line) of its origin.
+func clefGlyph(clef string) (string, float64) {
+	switch clef {
+	case "G8vb":
+		return "gClef8vb", 3
+	case "F", "F8vb", "F8va", "F15mb", "F15ma":
+		return "fClef", 1
+	case "C1":
+		return "cClef", 4
+	case "C2":
+		return "cClef", 3
+	case "C3":
+		return "cClef", 2
+	case "C4":
+		return "cClef", 1
+	case "C5":
+		return "cClef", 0
+	case "PERC", "PERC2":
+		return "unpitchedPercussionClef1", 2
+	}
+	return "gClef", 3
+}
+
+func clefTop(clef string) int {
+	if top, ok := clefTops[clef]; ok {
+		return top
+	}
+	return clefTops["G"]
+}
+
+// tpcLetters are the note letters in TPC (line of fifths) order.
+const tpcLetters = "FCGDAEB"
+
+var letterSteps = map[byte]int{'C': 0, 'D': 1, 'E': 2, 'F': 3, 'G': 4, 'A': 5, 'B': 6}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// noteLetter returns the note letter of a TPC.
+func noteLetter(tpc int) byte {
+	return tpcLetters[((tpc+1)%7+7)%7]
+}
+
+// alteration returns the number of semitones by which a TPC alters its letter.
+func alteration(tpc int) int {
+	return floorDiv(tpc+1, 7) - 2
+}
+
+// keyAlteration returns the alteration of the letter in the key signature.
+func keyAlteration(fifths int, letter byte) int {
+	switch {
+	case fifths > 0 && strings.IndexByte("FCGDAEB"[:min(fifths, 7)], letter) >= 0:
+		return 1
+	case fifths < 0 && strings.IndexByte("BEADGCF"[:min(-fifths, 7)], letter) >= 0:
+		return -1
+	}
+	return 0
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// diatonicStep returns the diatonic step (C4=28) of a spelled pitch.
+func diatonicStep(pitch, tpc int) int {
+	natural := pitch - alteration(tpc)
+	return (floorDiv(natural, 12)-1)*7 + letterSteps[noteLetter(tpc)]
+}
+
+// Key signature accidentals in treble clef, as diatonic steps.
+var (
+	sharpSteps = []int{38, 35, 39, 36, 33, 37, 34}
+	flatSteps  = []int{34, 37, 33, 36, 32, 35, 31}
+)
+
+// drawKeySig draws a key signature and returns the x position after it.
+func (l *Layout) drawKeySig(c *canvas, staff *staffInfo, x, top float64, fifths int) float64 {
+	if fifths == 0 || staff.clef == "PERC" {
+		return x
+	}
+	clef := clefTop(staff.clef)
+	shift := int(math.Round(float64(38-clef)/7)) * 7
+	steps, name := sharpSteps, "accidentalSharp"
+	n := fifths
+	if fifths < 0 {
+		steps, name, n = flatSteps, "accidentalFlat", -fifths
+	}
+	for i := 0; i < n && i < len(steps); i++ {
+		y := float64(clef-(steps[i]-shift)) / 2
+		c.glyph("KeySig", name, x+float64(i)*keySigAccidental*l.sp, top+y*l.sp)
+	}
+	return x + keySigWidth(fifths)*l.sp
+}
+
+// drawTimeSig draws a time signature and returns the x position after it.
+func (l *Layout) drawTimeSig(c *canvas, x, top float64, ts *mscx.TimeSig) float64 {
+	w := l.timeSigWidth(ts) - headerPadding
+	for _, row := range []struct {
+		digits string
+		y      float64
+	}{{ts.SigN, 1}, {ts.SigD, 3}} {
+		dx := x + (w-l.digitsWidth(row.digits))/2*l.sp
+		for _, ch := range row.digits {
+			g := l.font.Glyph("timeSig" + string(ch))
+			if g == nil {
+				continue
+			}
+			c.glyph("TimeSig", g.Name, dx, top+row.y*l.sp)
+			dx += g.Width() * l.sp
+		}
+	}
+	return x + (w+headerPadding)*l.sp
+}
+
+// chordLayout holds the drawing positions of a chord.
+type chordLayout struct {
+	ev    *mscx.Event
+	chord *mscx.Chord
+	x     float64   // left edge of the noteheads, mm
+	ys    []float64 // note positions in staff spaces below the top line
+	up    bool
+	flags int
+	stem  bool
+	// stemX is the center of the stem and stemEnd its free end, in mm.
+	stemX, stemEnd float64
+	beamed         bool
+}
+
+// durationFlags returns the number of flags or beams of a duration.
+func durationFlags(durationType string) int {
+	switch durationType {
+	case "eighth":
+		return 1
+	case "16th":
+		return 2
+	case "32nd":
+		return 3
+	case "64th":
+		return 4
+	}
+	return 0
+}
+
+// notePosition returns the staff position of a note in staff spaces below
+// the top line, and its notehead glyph.
+func (l *Layout) notePosition(staff *staffInfo, note *mscx.Note, durationType string) (float64, string) {
+	head := "noteheadBlack"
+	switch durationType {
+	case "whole", "breve", "measure":
+		head = "noteheadWhole"
+	case "half":
+		head = "noteheadHalf"
+	}
+	if staff.clef == "PERC" && staff.instrument != nil {
+		if drum := staff.instrument.DrumForPitch(note.Pitch); drum != nil {
+			if drum.Head == "cross" && head == "noteheadBlack" {
+				head = "noteheadXBlack"
+			}
+			return float64(drum.Line) / 2, head
+		}
+	}
+	return float64(clefTop(staff.clef)-diatonicStep(note.Pitch, note.TPC)) / 2, head
+}
+
+// drawMeasure draws the contents of one measure on every staff.
+func (l *Layout) drawMeasure(c *canvas, sys *System, index int, mp *measurePos) {
+	sp := l.sp
+	mi := l.measures[index]
+
+	for si, staff := range l.staves {
+		top := sys.Y + sys.StaffY[si]
+		if index > sys.FirstMeasure && !staff.tab {
+			x := mp.start + headerPadding/2*sp
+			if mi.keySig != nil {
+				x = l.drawKeySig(c, staff, x, top, mi.fifths)
+			}
+			if mi.timeSig != nil {
+				l.drawTimeSig(c, x, top, mi.timeSig)
+			}
+		}
+
+		voices := map[int]bool{}
+		for _, ev := range mi.events[si] {
+			voices[ev.Voice] = true
+		}
+		multiVoice := len(voices) > 1
+
+		if staff.tab {
+			l.drawTabMeasure(c, staff, top, mi.events[si], mp)
+		} else {
+			accidentals := map[int]int{}
+			var byVoice [][]*chordLayout
+			current := map[int]int{}
+			for _, ev := range mi.events[si] {
+				x, ok := mp.segX[ev.MeasureTick]
+				if !ok {
+					continue
+				}
+				switch el := ev.Element.(type) {
+				case *mscx.Rest:
+					l.drawRest(c, ev, el, x, top, mp, multiVoice)
+				case *mscx.Chord:
+					cl := l.layoutChord(staff, ev, el, x, multiVoice)
+					l.drawNotes(c, staff, cl, top, mi.fifths, accidentals)
+					vi, ok := current[ev.Voice]
+					if !ok {
+						vi = len(byVoice)
+						current[ev.Voice] = vi
+						byVoice = append(byVoice, nil)
+					}
+					byVoice[vi] = append(byVoice[vi], cl)
+				}
+			}
+			for _, chords := range byVoice {
+				l.drawStems(c, chords, top, mi, multiVoice)
+			}
+		}
+
+		bottom := top + staff.height()*sp
+		l.drawBarLine(c, mi.barLine, mp.end, top, bottom)
+	}
+}
+
+// drawBarLine draws the barline at x.
+func (l *Layout) drawBarLine(c *canvas, subtype string, x, top, bottom float64) {
+	sp, d := l.sp, l.font.Defaults
+	thin, thick, sep := d.ThinBarlineThickness*sp, d.ThickBarlineThickness*sp, d.BarlineSeparation*sp
+	switch subtype {
+	case "double":
+		c.line("BarLine", x-thin/2, top, x-thin/2, bottom, thin)
+		c.line("BarLine", x-thin*1.5-sep, top, x-thin*1.5-sep, bottom, thin)
+	case "end":
+		c.line("BarLine", x-thick/2, top, x-thick/2, bottom, thick)
+		c.line("BarLine", x-thick-sep-thin/2, top, x-thick-sep-thin/2, bottom, thin)
+	default:
+		c.line("BarLine", x-thin/2, top, x-thin/2, bottom, thin)
+	}
+}
+
+// restGlyphs maps a duration type to its rest glyph.
+var restGlyphs = map[string]string{
+	"measure": "restWhole", "breve": "restWhole", "whole": "restWhole",
+	"half": "restHalf", "quarter": "restQuarter", "eighth": "rest8th",
+	"16th": "rest16th", "32nd": "rest32nd",
+}
+
+// drawRest draws a rest.
+func (l *Layout) drawRest(c *canvas, ev *mscx.Event, rest *mscx.Rest, x, top float64, mp *measurePos, multiVoice bool) {
+	sp := l.sp
+	name, ok := restGlyphs[rest.DurationType]
+	if !ok {
+		name = "restQuarter"
+	}
+	y := 2.0
+	if name == "restWhole" {
+		y = 1
+	}
+	if multiVoice {
+		if ev.Voice%2 == 1 {
+			y -= 2
+		} else {
+			y += 2
+		}
+	}
+	g := l.font.glyph(name)
+	if rest.DurationType == "measure" {
+		x = (mp.content+mp.end)/2 - g.Width()*sp/2
+	}
+	c.glyph("Rest", name, x, top+y*sp)
+	for i := 0; i < rest.Dots; i++ {
+		c.glyph("Dot", "augmentationDot", x+(g.Width()+0.4+0.6*float64(i))*sp, top+(y-0.5)*sp)
+	}
+}
+
+// layoutChord determines the note positions and stem direction of a chord.
+func (l *Layout) layoutChord(staff *staffInfo, ev *mscx.Event, chord *mscx.Chord, x float64, multiVoice bool) *chordLayout {
+	cl := &chordLayout{ev: ev, chord: chord, x: x, flags: durationFlags(chord.DurationType)}
+	for _, note := range chord.Note {
+		y, _ := l.notePosition(staff, note, chord.DurationType)
+		cl.ys = append(cl.ys, y)
+	}
+	sort.Float64s(cl.ys)
+	switch chord.DurationType {
+	case "whole", "breve", "measure":
+	default:
+		cl.stem = len(cl.ys) > 0
+	}
+	if multiVoice {
+		cl.up = ev.Voice%2 == 1
+	} else if len(cl.ys) > 0 {
+		cl.up = (cl.ys[0]+cl.ys[len(cl.ys)-1])/2 >= 2
+	}
+	return cl
+}
+
+// drawNotes draws the noteheads, accidentals, ledger lines and dots of a
+// chord, updating the accidentals in effect in the measure.
+func (l *Layout) drawNotes(c *canvas, staff *staffInfo, cl *chordLayout, top float64, fifths int, accidentals map[int]int) {
+	sp, d := l.sp, l.font.Defaults
+	type placed struct {
+		note *mscx.Note
+		y    float64
+		head string
+		dx   float64
+	}
+	var notes []*placed
+	for _, note := range cl.chord.Note {
+		y, head := l.notePosition(staff, note, cl.chord.DurationType)
+		notes = append(notes, &placed{note: note, y: y, head: head})
+	}
+	sort.Slice(notes, func(a, b int) bool { return notes[a].y < notes[b].y })
+
+	// Displace one note of each second to the other side of the stem.
+	headWidth := l.font.glyph("noteheadBlack").Width() * sp
+	if cl.up {
+		for i := len(notes) - 2; i >= 0; i-- {
+			if notes[i+1].y-notes[i].y == 0.5 && notes[i+1].dx == 0 {
+				notes[i].dx = headWidth
+			}
+		}
+	} else {
+		for i := 1; i < len(notes); i++ {
+			if notes[i].y-notes[i-1].y == 0.5 && notes[i-1].dx == 0 {
+				notes[i].dx = -headWidth
+			}
+		}
+	}
+
+	var accColumns []float64 // y of each accidental drawn, by column
+	for _, n := range notes {
+		g := l.font.glyph(n.head)
+		x := cl.x + n.dx
+		c.glyph("Note", n.head, x, top+n.y*sp)
+
+		// Ledger lines.
+		ext := d.LegerLineExtension * sp
+		for line := -1.0; line >= n.y; line-- {
+			c.line("LedgerLine", x-ext, top+line*sp, x+g.Width()*sp+ext, top+line*sp, d.LegerLineThickness*sp)
+		}
+		for line := float64(staff.lines); line <= n.y; line++ {
+			c.line("LedgerLine", x-ext, top+line*sp, x+g.Width()*sp+ext, top+line*sp, d.LegerLineThickness*sp)
+		}
+
+		// Accidentals.
+		if staff.clef != "PERC" {
+			step := diatonicStep(n.note.Pitch, n.note.TPC)
+			alter := alteration(n.note.TPC)
+			current, ok := accidentals[step]
+			if !ok {
+				current = keyAlteration(fifths, noteLetter(n.note.TPC))
+			}
+			if alter != current {
+				accidentals[step] = alter
+				name := accidentalGlyph(alter)
+				ag := l.font.glyph(name)
+				col := 0
+				for _, y := range accColumns {
+					if math.Abs(y-n.y) < 3 {
+						col++
+					}
+				}
+				accColumns = append(accColumns, n.y)
+				ax := cl.x - (ag.Width()+0.2)*sp*float64(col+1)
+				if cl.up || n.dx >= 0 {
+					ax = math.Min(ax, cl.x+math.Min(n.dx, 0)-(ag.Width()+0.2)*sp*float64(col+1))
+				}
+				c.glyph("Accidental", name, ax, top+n.y*sp)
+			}
+		}
+
+		// Dots.
+		dotY := n.y
+		if dotY == math.Floor(dotY) {
+			dotY -= 0.5
+		}
+		right := cl.x + math.Max(n.dx, 0) + g.Width()*sp
+		for i := 0; i < cl.chord.Dots; i++ {
+			c.glyph("Dot", "augmentationDot", right+(0.4+0.6*float64(i))*sp, top+dotY*sp)
+		}
+	}
+}
+
+// accidentalGlyph returns the glyph for an alteration.
+func accidentalGlyph(alter int) string {
+	switch alter {
+	case -2:
+		return "accidentalDoubleFlat"
+	case -1:
+		return "accidentalFlat"
+	case 1:
+		return "accidentalSharp"
+	case 2:
+		return "accidentalDoubleSharp"
+	}
+	return "accidentalNatural"
+}
+
+// stemAnchor returns the x offset (in mm) of the stem from the left edge
+// of the noteheads.
+func (l *Layout) stemAnchor(up bool) float64 {
+	g := l.font.glyph("noteheadBlack")
+	half := l.font.Defaults.StemThickness / 2
+	if up {
+		return (g.Anchors["stemUpSE"][0] - half) * l.sp
+	}
+	return (g.Anchors["stemDownNW"][0] + half) * l.sp
+}
+
+// defaultStemEnd returns the staff position of the free end of an
+// unbeamed stem.
+func defaultStemEnd(cl *chordLayout) float64 {
+	extra := 0.0
+	if cl.flags > 1 {
+		extra = 0.5 * float64(cl.flags-1)
+	}
+	if cl.up {
+		return math.Min(cl.ys[0]-stemLength-extra, 2)
+	}
+	return math.Max(cl.ys[len(cl.ys)-1]+stemLength+extra, 2)
+}
+
+// drawStems draws the stems, flags and beams of the chords of one voice.
+func (l *Layout) drawStems(c *canvas, chords []*chordLayout, top float64, mi *measureInfo, multiVoice bool) {
+	sp, d := l.sp, l.font.Defaults
+
+	// Find the beam groups.
+	var groups [][]*chordLayout
+	var group []*chordLayout
+	flush := func() {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+		group = nil
+	}
+	for i, cl := range chords {
+		if !cl.stem || cl.flags == 0 {
+			flush()
+			continue
+		}
+		if len(group) > 0 {
+			prev := group[len(group)-1]
+			contiguous := prev.ev.MeasureTick+prev.ev.Ticks == cl.ev.MeasureTick
+			sameBeat := prev.ev.MeasureTick/mi.beamTicks == cl.ev.MeasureTick/mi.beamTicks
+			if !contiguous || !sameBeat {
+				flush()
+			}
+		}
+		group = append(group, chords[i])
+	}
+	flush()
+
+	for _, g := range groups {
+		l.layoutBeam(g, multiVoice)
+	}
+
+	for _, cl := range chords {
+		if !cl.stem {
+			continue
+		}
+		if !cl.beamed {
+			cl.stemX = cl.x + l.stemAnchor(cl.up)
+			cl.stemEnd = top + defaultStemEnd(cl)*sp
+		}
+		anchor := 0.168
+		if cl.up {
+			c.line("Stem", cl.stemX, top+(cl.ys[len(cl.ys)-1]-anchor)*sp, cl.stemX, cl.stemEnd, d.StemThickness*sp)
+		} else {
+			c.line("Stem", cl.stemX, top+(cl.ys[0]+anchor)*sp, cl.stemX, cl.stemEnd, d.StemThickness*sp)
+		}
+		if !cl.beamed && cl.flags > 0 {
+			name := []string{"flag8th", "flag16th", "flag32nd"}[min(cl.flags, 3)-1]
+			if cl.up {
+				name += "Up"
+			} else {
+				name += "Down"
+			}
+			c.glyph("Flag", name, cl.stemX-d.StemThickness*sp/2, cl.stemEnd)
+		}
+	}
+
+	for _, g := range groups {
+		l.drawBeam(c, g, top)
+	}
+}
+
+// layoutBeam chooses the stem direction and stem ends of a beam group.
+// The stem ends are stored relative to the top of the staff until drawBeam.
+func (l *Layout) layoutBeam(g []*chordLayout, multiVoice bool) {
+	up := g[0].up
+	if !multiVoice {
+		var sum float64
+		for _, cl := range g {
+			sum += (cl.ys[0] + cl.ys[len(cl.ys)-1]) / 2
+		}
+		up = sum/float64(len(g)) >= 2
+	}
+	for _, cl := range g {
+		cl.up, cl.beamed = up, true
+		cl.stemX = cl.x + l.stemAnchor(up)
+	}
+
+	first, last := g[0], g[len(g)-1]
+	y0, y1 := defaultStemEnd(first), defaultStemEnd(last)
+	dx := last.stemX - first.stemX
+	slope := 0.0
+	if dx > 0 {
+		slope = math.Max(-1, math.Min(1, y1-y0)) / dx
+	}
+	beamAt := func(cl *chordLayout, shift float64) float64 {
+		return y0 + shift + slope*(cl.stemX-first.stemX)
+	}
+
+	// Keep every stem at least minStem (plus the inner beams) long.
+	var shift float64
+	for _, cl := range g {
+		inner := 0.75 * float64(cl.flags-1)
+		if up {
+			if limit := cl.ys[0] - minStem - inner; beamAt(cl, shift) > limit {
+				shift = limit - beamAt(cl, 0)
+			}
+		} else {
+			if limit := cl.ys[len(cl.ys)-1] + minStem + inner; beamAt(cl, shift) < limit {
+				shift = limit - beamAt(cl, 0)
+			}
+		}
+	}
+	for _, cl := range g {
+		cl.stemEnd = beamAt(cl, shift)
+	}
+}
+
+// drawBeam draws the beams of a group whose stem ends were computed by
+// layoutBeam and converts the stem ends to page coordinates.
+func (l *Layout) drawBeam(c *canvas, g []*chordLayout, top float64) {
+	sp, d := l.sp, l.font.Defaults
+	thickness := d.BeamThickness * sp
+	step := (d.BeamThickness + d.BeamSpacing) * sp
+	up := g[0].up
+	dir := 1.0 // toward the noteheads
+	if !up {
+		dir = -1
+	}
+
+	first, last := g[0], g[len(g)-1]
+	half := d.StemThickness * sp / 2
+	yAt := func(x float64) float64 {
+		if last.stemX == first.stemX {
+			return first.stemEnd
+		}
+		return first.stemEnd + (last.stemEnd-first.stemEnd)*(x-first.stemX)/(last.stemX-first.stemX)
+	}
+	beam := func(level int, xa, xb float64) {
+		off := dir * step * float64(level)
+		ya, yb := yAt(xa)+off, yAt(xb)+off
+		c.polygon("Beam", xa, ya, xb, yb, xb, yb+dir*thickness, xa, ya+dir*thickness)
+	}
+
+	// Convert the stem ends to page coordinates (the stems were drawn
+	// before the beams, so this only matters for the beams themselves).
+	for _, cl := range g {
+		cl.stemEnd = top + cl.stemEnd*sp
+	}
+	beam(0, first.stemX-half, last.stemX+half)
+
+	maxFlags := 0
+	for _, cl := range g {
+		if cl.flags > maxFlags {
+			maxFlags = cl.flags
+		}
+	}
+	for level := 1; level < maxFlags; level++ {
+		for i, cl := range g {
+			if cl.flags <= level {
+				continue
+			}
+			nextHas := i+1 < len(g) && g[i+1].flags > level
+			prevHas := i > 0 && g[i-1].flags > level
+			switch {
+			case nextHas:
+				beam(level, cl.stemX-half, g[i+1].stemX+half)
+			case !prevHas && i+1 < len(g):
+				beam(level, cl.stemX-half, cl.stemX+1.1*sp)
+			case !prevHas:
+				beam(level, cl.stemX-1.1*sp, cl.stemX+half)
+			}
+		}
+	}
+}
+
+// drawTabMeasure draws the fret numbers of a tablature staff.
+func (l *Layout) drawTabMeasure(c *canvas, staff *staffInfo, top float64, events []*mscx.Event, mp *measurePos) {
+	for _, ev := range events {
+		chord, ok := ev.Element.(*mscx.Chord)
+		if !ok {
+			continue
+		}
+		x, ok := mp.segX[ev.MeasureTick]
+		if !ok {
+			continue
+		}
+		for _, note := range chord.Note {
+			if note.Fret == nil || note.String == nil {
+				continue
+			}
+			y := top + float64(*note.String)*1.5*l.sp
+			s := strconv.Itoa(*note.Fret)
+			w := l.textWidth(s, tabFontSize) * l.sp
+			fmt.Fprintf(&c.buf, `<rect x="%v" y="%v" width="%v" height="%v" fill="#fff"/>`+"\n", num(x), num(y-0.6*l.sp), num(w+0.2*l.sp), num(1.2*l.sp))
+			c.text("Fret", x+0.1*l.sp+w/2, y+0.5*l.sp, tabFontSize, "middle", s)
+		}
+	}
+}
+
+// drawLyrics draws the lyrics of every staff of the system, with hyphens
+// between the syllables of a word.
+func (l *Layout) drawLyrics(c *canvas, sys *System, positions []*measurePos) {
+	sp := l.sp
+	head := l.font.glyph("noteheadBlack").Width() * sp
+	for si, staff := range l.staves {
+		bottom := sys.Y + sys.StaffY[si] + staff.height()*sp
+		pending := map[int]float64{} // verse -> end of a syllable awaiting a hyphen
+		for i, mp := range positions {
+			mi := l.measures[sys.FirstMeasure+i]
+			for _, ev := range mi.events[si] {
+				chord, ok := ev.Element.(*mscx.Chord)
+				if !ok {
+					continue
+				}
+				x, ok := mp.segX[ev.MeasureTick]
+				if !ok {
+					continue
+				}
+				center := x + head/2
+				for _, ly := range chord.Lyrics {
+					y := bottom + (2+float64(ly.No+1)*lyricsLineHeight-0.7)*sp
+					w := l.textWidth(ly.Text, lyricsFontSize) * sp
+					if end, ok := pending[ly.No]; ok {
+						c.text("LyricsHyphen", (end+center-w/2)/2, y, lyricsFontSize, "middle", "-")
+						delete(pending, ly.No)
+					}
+					c.text("Lyrics", center, y, lyricsFontSize, "middle", ly.Text)
+					if ly.Syllabic == "begin" || ly.Syllabic == "middle" {
+						pending[ly.No] = center + w/2
+					}
+				}
+			}
+		}
+		for verse, end := range pending {
+			y := bottom + (2+float64(verse+1)*lyricsLineHeight-0.7)*sp
+			c.text("LyricsHyphen", end+sp, y, lyricsFontSize, "middle", "-")
+		}
+	}
+}
@@ -0,0 +1,307 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engrave
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// ThumbnailHeight is the height in pixels of the thumbnails written by
+// MuseScore 3. The width follows the aspect ratio of the page.
+const ThumbnailHeight = 256
+
+var (
+	thumbInk   = color.NRGBA{A: 0xff}
+	thumbStaff = color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff}
+	thumbPaper = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+)
+
+// Thumbnail lays out the score and renders its first page as a thumbnail
+// (see Layout.Thumbnail). It can be used as the RenderThumbnail option
+// when writing an archive.
+func Thumbnail(sz *mscx.ScoreZip) (image.Image, error) {
+	l, err := LayoutScore(&sz.MuseScore.Score)
+	if err != nil {
+		return nil, fmt.Errorf("Thumbnail: %w", err)
+	}
+	return l.Thumbnail(), nil
+}
+
+// Thumbnail draws a preview of the first page of the layout, as MuseScore
+// writes into the Thumbnails/thumbnail.png of an archive: the title and
+// composer in capitals followed by the staves, barlines and noteheads of
+// the systems. The image is ThumbnailHeight pixels high.
+func (l *Layout) Thumbnail() *image.NRGBA {
+	scale := ThumbnailHeight / l.pageHeight
+	width := int(math.Round(l.pageWidth * scale))
+	img := image.NewNRGBA(image.Rect(0, 0, width, ThumbnailHeight))
+	fillRect(img, 0, 0, float64(width), ThumbnailHeight, thumbPaper)
+	if len(l.Pages) == 0 {
+		return img
+	}
+
+	p := l.Pages[0]
+	if p.Header != nil {
+		l.thumbHeader(img, p, scale)
+	}
+	for _, sys := range p.Systems {
+		l.thumbSystem(img, sys, scale)
+	}
+	return img
+}
+
+// thumbHeader draws the title and composer of the title frame at the
+// positions used by drawHeader.
+func (l *Layout) thumbHeader(img *image.NRGBA, p *Page, scale float64) {
+	top, h := l.marginTop, p.headerHeight
+	left, right := l.marginLeft*scale, (l.pageWidth-l.marginRight)*scale
+	for _, te := range p.Header.Text {
+		s := strings.TrimSpace(markup.ReplaceAllString(string(te.Text), ""))
+		if s == "" {
+			continue
+		}
+		switch te.Style {
+		case mscx.Title:
+			th := titleFontSize * mmPerPt * scale
+			w := math.Min(thumbTextWidth(s, th), right-left)
+			drawThumbText(img, (left+right-w)/2, (top+0.45*h)*scale-th, w, th, s)
+		case mscx.Composer:
+			th := creditFontSize * mmPerPt * scale
+			w := math.Min(thumbTextWidth(s, th), right-left)
+			drawThumbText(img, right-w, (top+h-l.sp)*scale-th, w, th, s)
+		}
+	}
+}
+
+// thumbSystem draws the staff lines, barlines and noteheads of a system.
+func (l *Layout) thumbSystem(img *image.NRGBA, sys *System, scale float64) {
+	sp := l.sp * scale
+	positions := l.measurePositions(sys)
+	x0, x1 := l.marginLeft*scale, positions[len(positions)-1].end*scale
+
+	top, bottom := sys.Y*scale, sys.Y*scale
+	for si, staff := range l.staves {
+		y := (sys.Y + sys.StaffY[si]) * scale
+		gap := sp
+		if staff.tab {
+			gap = 1.5 * sp
+		}
+		for line := 0; line < staff.lines; line++ {
+			fillRect(img, x0, y+float64(line)*gap, x1-x0, 1, thumbStaff)
+		}
+		bottom = y + staff.height()*sp
+	}
+	fillRect(img, x0, top, 1, bottom-top, thumbInk)
+
+	for i, mp := range positions {
+		mi := l.measures[sys.FirstMeasure+i]
+		for si, staff := range l.staves {
+			if staff.tab {
+				continue
+			}
+			y := (sys.Y + sys.StaffY[si]) * scale
+			for _, ev := range mi.events[si] {
+				chord, ok := ev.Element.(*mscx.Chord)
+				x, found := mp.segX[ev.MeasureTick]
+				if !ok || !found {
+					continue
+				}
+				cl := l.layoutChord(staff, ev, chord, x, false)
+				hollow := chord.DurationType == "half" || !cl.stem
+				for _, line := range cl.ys {
+					drawNote(img, x*scale, y, line, sp, hollow, cl.stem, cl.up)
+				}
+			}
+		}
+		fillRect(img, math.Min(mp.end*scale, x1-1), top, 1, bottom-top, thumbInk)
+	}
+}
+
+// drawNote draws a notehead, with its stem and ledger lines, on the given
+// staff line (0 is the top line; 0.5 the space below it). x is the left
+// edge of the notehead.
+func drawNote(img *image.NRGBA, x, top, line, sp float64, hollow, stem, up bool) {
+	y := top + line*sp
+	rx, ry := math.Max(0.65*sp, 1), math.Max(0.5*sp, 1)
+	x += rx
+	for l := -1.0; l >= line; l-- {
+		fillRect(img, x-1.6*rx, top+l*sp, 3.2*rx, 1, thumbInk)
+	}
+	for l := 5.0; l <= line; l++ {
+		fillRect(img, x-1.6*rx, top+l*sp, 3.2*rx, 1, thumbInk)
+	}
+	fillEllipse(img, x, y, rx, ry, thumbInk)
+	if hollow && rx > 2 {
+		fillEllipse(img, x, y, rx-1, ry-1, thumbPaper)
+	}
+	switch {
+	case !stem:
+	case up:
+		fillRect(img, x+rx-1, y-stemLength*sp, 1, stemLength*sp, thumbInk)
+	default:
+		fillRect(img, x-rx, y, 1, stemLength*sp, thumbInk)
+	}
+}
+
+// fillRect fills the rectangle with its top-left corner at (x,y).
+func fillRect(img *image.NRGBA, x, y, w, h float64, c color.NRGBA) {
+	r := image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+w)), int(math.Round(y+h)))
+	if r.Dx() == 0 {
+		r.Max.X++
+	}
+	if r.Dy() == 0 {
+		r.Max.Y++
+	}
+	r = r.Intersect(img.Bounds())
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; px++ {
+			img.SetNRGBA(px, py, c)
+		}
+	}
+}
+
+// fillEllipse fills the ellipse centered at (cx,cy).
+func fillEllipse(img *image.NRGBA, cx, cy, rx, ry float64, c color.NRGBA) {
+	r := image.Rect(int(cx-rx), int(cy-ry), int(cx+rx)+1, int(cy+ry)+1).Intersect(img.Bounds())
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; px++ {
+			dx, dy := (float64(px)+0.5-cx)/rx, (float64(py)+0.5-cy)/ry
+			if dx*dx+dy*dy <= 1 {
+				img.SetNRGBA(px, py, c)
+			}
+		}
+	}
+}
+
+// fontWidth and fontHeight are the size in pixels of a character of the
+// thumbnail font, which has only capital letters, digits and common
+// punctuation. Other characters are drawn as spaces.
+const (
+	fontWidth  = 5
+	fontHeight = 7
+)
+
+// font5x7 holds the rows (top first) of each character, with the
+// leftmost pixel in bit 4.
+var font5x7 = map[rune][fontHeight]uint8{
+	'A':  {0x0e, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'B':  {0x1e, 0x11, 0x11, 0x1e, 0x11, 0x11, 0x1e},
+	'C':  {0x0e, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0e},
+	'D':  {0x1c, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1c},
+	'E':  {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f},
+	'F':  {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x10},
+	'G':  {0x0e, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0f},
+	'H':  {0x11, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'I':  {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'J':  {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0c},
+	'K':  {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L':  {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1f},
+	'M':  {0x11, 0x1b, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N':  {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O':  {0x0e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'P':  {0x1e, 0x11, 0x11, 0x1e, 0x10, 0x10, 0x10},
+	'Q':  {0x0e, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0d},
+	'R':  {0x1e, 0x11, 0x11, 0x1e, 0x14, 0x12, 0x11},
+	'S':  {0x0f, 0x10, 0x10, 0x0e, 0x01, 0x01, 0x1e},
+	'T':  {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'V':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x0a, 0x04},
+	'W':  {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0a},
+	'X':  {0x11, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x11},
+	'Y':  {0x11, 0x11, 0x11, 0x0a, 0x04, 0x04, 0x04},
+	'Z':  {0x1f, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1f},
+	'0':  {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1':  {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2':  {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3':  {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4':  {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5':  {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6':  {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7':  {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8':  {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9':  {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	'.':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+	',':  {0x00, 0x00, 0x00, 0x00, 0x0c, 0x04, 0x08},
+	'\'': {0x0c, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00},
+	'-':  {0x00, 0x00, 0x00, 0x1f, 0x00, 0x00, 0x00},
+	'!':  {0x04, 0x04, 0x04, 0x04, 0x04, 0x00, 0x04},
+	'?':  {0x0e, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+	':':  {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+	'&':  {0x0c, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0d},
+	'(':  {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')':  {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'/':  {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+}
+
+// thumbTextWidth returns the natural width in pixels of the text drawn with
+// the given height.
+func thumbTextWidth(text string, height float64) float64 {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+	return float64(n*(fontWidth+1)-1) * height / fontHeight
+}
+
+// drawThumbText draws the text in capitals scaled to fit the w by h pixel box
+// with its top-left corner at (x,y). Partially covered pixels are drawn
+// in shades of gray.
+func drawThumbText(img *image.NRGBA, x, y, w, h float64, text string) {
+	runes := []rune(strings.ToUpper(text))
+	maskWidth := len(runes)*(fontWidth+1) - 1
+	if maskWidth <= 0 || w <= 0 || h <= 0 {
+		return
+	}
+	mask := func(mx, my int) bool {
+		col := mx % (fontWidth + 1)
+		if col == fontWidth || my < 0 || my >= fontHeight {
+			return false
+		}
+		return font5x7[runes[mx/(fontWidth+1)]][my]&(0x10>>col) != 0
+	}
+
+	// Sample each pixel on a grid to find how much of it is covered.
+	const samples = 4
+	sx, sy := float64(maskWidth)/w, fontHeight/h
+	r := image.Rect(int(x), int(y), int(math.Ceil(x+w)), int(math.Ceil(y+h))).Intersect(img.Bounds())
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; px++ {
+			var covered int
+			for j := 0; j < samples; j++ {
+				my := (float64(py) + (float64(j)+0.5)/samples - y) * sy
+				for i := 0; i < samples; i++ {
+					mx := (float64(px) + (float64(i)+0.5)/samples - x) * sx
+					if mx >= 0 && my >= 0 && int(mx) < maskWidth && mask(int(mx), int(my)) {
+						covered++
+					}
+				}
+			}
+			if covered == 0 {
+				continue
+			}
+			c := img.NRGBAAt(px, py)
+			v := uint8(int(c.R) * (samples*samples - covered) / (samples * samples))
+			img.SetNRGBA(px, py, color.NRGBA{R: v, G: v, B: v, A: 0xff})
+		}
+	}
+}
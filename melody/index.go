@@ -0,0 +1,218 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package melody
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// gramSize is the number of intervals in each key of the index.
+const gramSize = 4
+
+type gram [gramSize]int
+
+type posting struct {
+	entry, offset int
+}
+
+type entry struct {
+	id    string
+	notes []*Note
+	fp    *Fingerprint
+}
+
+// Index is a searchable collection of melodies, each identified by an ID
+// such as a filename. The zero value is not usable; call NewIndex.
+type Index struct {
+	entries []*entry
+	grams   map[gram][]posting
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{grams: map[gram][]posting{}}
+}
+
+// Len returns the number of melodies in the index.
+func (ix *Index) Len() int {
+	return len(ix.entries)
+}
+
+// Add adds a melody to the index.
+func (ix *Index) Add(id string, notes []*Note) {
+	e := &entry{id: id, notes: notes, fp: NewFingerprint(notes)}
+	index := len(ix.entries)
+	ix.entries = append(ix.entries, e)
+	for i := 0; i+gramSize <= e.fp.Len(); i++ {
+		k := gramAt(e.fp, i)
+		ix.grams[k] = append(ix.grams[k], posting{entry: index, offset: i})
+	}
+}
+
+// AddScore adds the melody of the staff (see TopVoice) to the index.
+func (ix *Index) AddScore(id string, score *mscx.Score, staff *mscx.ScoreStaff) error {
+	notes, err := TopVoice(score, staff)
+	if err != nil {
+		return fmt.Errorf("Index.AddScore(%q): %w", id, err)
+	}
+	ix.Add(id, notes)
+	return nil
+}
+
+func gramAt(fp *Fingerprint, offset int) gram {
+	var k gram
+	copy(k[:], fp.Intervals[offset:])
+	return k
+}
+
+// SearchOptions controls how closely a melody must follow a phrase to
+// match it. The zero value requires the same intervals and rhythm contour.
+type SearchOptions struct {
+	// MaxIntervalErrors is the number of intervals that may differ.
+	MaxIntervalErrors int
+	// IntervalTolerance is the number of semitones by which an interval
+	// may differ and still match, e.g. 1 to equate major and minor
+	// variants of a tune.
+	IntervalTolerance int
+	// MaxRhythmErrors is the number of steps whose rhythm contour may
+	// differ.
+	MaxRhythmErrors int
+	// IgnoreRhythm matches on intervals alone. The rhythm is always
+	// ignored for phrases without one (see ParsePhrase).
+	IgnoreRhythm bool
+}
+
+// Match is an occurrence of a phrase in a melody of the index.
+type Match struct {
+	ID string
+	// Offset is the index of the first matching note in the melody.
+	Offset int
+	// Start is the position of the first matching note.
+	Start mscx.Position
+	// Transposition is the number of semitones from the phrase to the
+	// matching notes.
+	Transposition int
+	// IntervalErrors and RhythmErrors count the steps that differ from
+	// the phrase.
+	IntervalErrors int
+	RhythmErrors   int
+}
+
+// Search returns the occurrences of the phrase in the index, best matches
+// first. Because melodies are compared by interval, the phrase is found
+// in any key. A nil opts requires an exact match of intervals and rhythm.
+func (ix *Index) Search(phrase []*Note, opts *SearchOptions) []*Match {
+	if opts == nil {
+		opts = &SearchOptions{}
+	}
+	q := NewFingerprint(phrase)
+	if q.Len() == 0 {
+		return nil
+	}
+
+	var result []*Match
+	check := func(p posting) {
+		if m := ix.match(q, phrase[0].Pitch, p, opts); m != nil {
+			result = append(result, m)
+		}
+	}
+
+	// If a match has at most k interval errors, one of k+1 disjoint
+	// segments of the phrase matches exactly, so its first gram locates
+	// every candidate.
+	segment := q.Len() / (opts.MaxIntervalErrors + 1)
+	if opts.IntervalTolerance == 0 && segment >= gramSize {
+		seen := map[posting]bool{}
+		for s := 0; s <= opts.MaxIntervalErrors; s++ {
+			for _, p := range ix.grams[gramAt(q, s*segment)] {
+				p.offset -= s * segment
+				if p.offset < 0 || seen[p] {
+					continue
+				}
+				seen[p] = true
+				check(p)
+			}
+		}
+	} else {
+		for i, e := range ix.entries {
+			for offset := 0; offset+q.Len() <= e.fp.Len(); offset++ {
+				check(posting{entry: i, offset: offset})
+			}
+		}
+	}
+
+	sort.Slice(result, func(a, b int) bool {
+		ma, mb := result[a], result[b]
+		if ea, eb := ma.IntervalErrors+ma.RhythmErrors, mb.IntervalErrors+mb.RhythmErrors; ea != eb {
+			return ea < eb
+		}
+		if ma.ID != mb.ID {
+			return ma.ID < mb.ID
+		}
+		return ma.Offset < mb.Offset
+	})
+	return result
+}
+
+// match compares the fingerprint q of a phrase starting on pitch with the
+// indexed melody at p.
+func (ix *Index) match(q *Fingerprint, pitch int, p posting, opts *SearchOptions) *Match {
+	e := ix.entries[p.entry]
+	if p.offset+q.Len() > e.fp.Len() {
+		return nil
+	}
+	useRhythm := !opts.IgnoreRhythm && q.Rhythm != nil && e.fp.Rhythm != nil
+	start := e.notes[p.offset]
+	m := &Match{ID: e.id, Offset: p.offset, Start: start.Position, Transposition: start.Pitch - pitch}
+	for i, v := range q.Intervals {
+		if d := v - e.fp.Intervals[p.offset+i]; d > opts.IntervalTolerance || -d > opts.IntervalTolerance {
+			if m.IntervalErrors++; m.IntervalErrors > opts.MaxIntervalErrors {
+				return nil
+			}
+		}
+		if useRhythm && q.Rhythm[i] != e.fp.Rhythm[p.offset+i] {
+			if m.RhythmErrors++; m.RhythmErrors > opts.MaxRhythmErrors {
+				return nil
+			}
+		}
+	}
+	return m
+}
+
+// Similar holds a melody of the index and its similarity to another.
+type Similar struct {
+	ID         string
+	Similarity float64
+}
+
+// Similar returns the melodies of the index whose opening is at least
+// minSimilarity alike (see Similarity) to the fingerprint, most similar
+// first. Each melody is compared over the length of fp, so the opening
+// phrase of a tune finds its duplicates and variants.
+func (ix *Index) Similar(fp *Fingerprint, minSimilarity float64) []*Similar {
+	var result []*Similar
+	for _, e := range ix.entries {
+		if s := Similarity(fp, e.fp.Prefix(fp.Len())); s >= minSimilarity {
+			result = append(result, &Similar{ID: e.id, Similarity: s})
+		}
+	}
+	sort.SliceStable(result, func(a, b int) bool { return result[a].Similarity > result[b].Similarity })
+	return result
+}
@@ -0,0 +1,192 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package melody derives normalized melodic fingerprints from MuseScore
+// scores and searches a corpus of them for phrases, so that duplicate
+// tunes and their variants can be found regardless of key or notation.
+package melody
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// Note is a single note of a melody.
+type Note struct {
+	mscx.Position
+	Pitch int
+	TPC   int
+	// Ticks is the time from the start of the note to the start of the
+	// next note (including any rests between them), or the duration of
+	// the last note of the melody.
+	Ticks int
+}
+
+// TopVoice returns the melody of the staff: the highest note of each
+// chord in its first voice. Rests lengthen the preceding note.
+func TopVoice(score *mscx.Score, staff *mscx.ScoreStaff) ([]*Note, error) {
+	var result []*Note
+	err := score.WalkStaff(staff, func(ev *mscx.Event) error {
+		chord, ok := ev.Element.(*mscx.Chord)
+		if !ok || ev.Voice != 1 || len(chord.Note) == 0 {
+			return nil
+		}
+		top := chord.Note[0]
+		for _, note := range chord.Note {
+			if note.Pitch > top.Pitch {
+				top = note
+			}
+		}
+		if n := len(result); n > 0 {
+			result[n-1].Ticks = ev.Tick - result[n-1].Tick
+		}
+		result = append(result, &Note{Position: ev.Position, Pitch: top.Pitch, TPC: top.TPC, Ticks: ev.Ticks})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("melody.TopVoice: %w", err)
+	}
+	return result, nil
+}
+
+// ParsePhrase returns the notes of a phrase written as space-separated
+// pitch names, e.g. "D5 B4 G4 A4". The notes have no duration, so the
+// fingerprint of the phrase has no rhythm.
+func ParsePhrase(s string) ([]*Note, error) {
+	var result []*Note
+	for _, name := range strings.Fields(s) {
+		pitch, tpc, err := mscx.ParsePitch(name)
+		if err != nil {
+			return nil, fmt.Errorf("melody.ParsePhrase: %w", err)
+		}
+		result = append(result, &Note{Pitch: pitch, TPC: tpc})
+	}
+	return result, nil
+}
+
+// Fingerprint is a normalized representation of a melody that does not
+// depend on its key or on the note values used to notate it. Element i of
+// each slice describes the step from note i to note i+1.
+type Fingerprint struct {
+	// Intervals holds the number of semitones between successive notes.
+	Intervals []int
+	// Rhythm holds the rhythm contour: -1 if the next note is shorter,
+	// 0 if it is the same length and 1 if it is longer. It is nil if the
+	// rhythm of the melody is unknown.
+	Rhythm []int
+}
+
+// NewFingerprint returns the fingerprint of the notes. If none of the
+// notes has a duration, the fingerprint has no rhythm.
+func NewFingerprint(notes []*Note) *Fingerprint {
+	fp := &Fingerprint{}
+	timed := false
+	for _, n := range notes {
+		if n.Ticks > 0 {
+			timed = true
+			break
+		}
+	}
+	for i := 1; i < len(notes); i++ {
+		fp.Intervals = append(fp.Intervals, notes[i].Pitch-notes[i-1].Pitch)
+		if timed {
+			fp.Rhythm = append(fp.Rhythm, compare(notes[i].Ticks, notes[i-1].Ticks))
+		}
+	}
+	return fp
+}
+
+func compare(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Len returns the number of steps in the fingerprint, which is one less
+// than the number of notes.
+func (fp *Fingerprint) Len() int {
+	return len(fp.Intervals)
+}
+
+// Prefix returns the fingerprint of the first n steps (n+1 notes), or fp
+// itself if it is no longer than that.
+func (fp *Fingerprint) Prefix(n int) *Fingerprint {
+	if n >= fp.Len() {
+		return fp
+	}
+	result := &Fingerprint{Intervals: fp.Intervals[:n]}
+	if fp.Rhythm != nil {
+		result.Rhythm = fp.Rhythm[:n]
+	}
+	return result
+}
+
+// String returns the fingerprint as signed intervals, each followed by
+// the rhythm contour ("<", "=" or ">") when it is known, e.g. "+2= -4>".
+func (fp *Fingerprint) String() string {
+	parts := make([]string, len(fp.Intervals))
+	for i, v := range fp.Intervals {
+		parts[i] = fmt.Sprintf("%+d", v)
+		if fp.Rhythm != nil {
+			parts[i] += [...]string{"<", "=", ">"}[fp.Rhythm[i]+1]
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// rhythmCost is the cost of a step whose interval matches but whose
+// rhythm contour does not, relative to a wrong interval.
+const rhythmCost = 0.5
+
+// Similarity returns how alike two fingerprints are, from 0 (nothing in
+// common) to 1 (identical). It is based on the edit distance between
+// them, so that variants with passing notes added or removed remain
+// similar. Rhythm is compared only when both fingerprints have it.
+func Similarity(a, b *Fingerprint) float64 {
+	n, m := a.Len(), b.Len()
+	if n == 0 && m == 0 {
+		return 1
+	}
+	useRhythm := a.Rhythm != nil && b.Rhythm != nil
+
+	prev := make([]float64, m+1)
+	cur := make([]float64, m+1)
+	for j := range prev {
+		prev[j] = float64(j)
+	}
+	for i := 1; i <= n; i++ {
+		cur[0] = float64(i)
+		for j := 1; j <= m; j++ {
+			cost := 0.0
+			switch {
+			case a.Intervals[i-1] != b.Intervals[j-1]:
+				cost = 1
+			case useRhythm && a.Rhythm[i-1] != b.Rhythm[j-1]:
+				cost = rhythmCost
+			}
+			cur[j] = math.Min(prev[j-1]+cost, math.Min(prev[j], cur[j-1])+1)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - prev[m]/math.Max(float64(n), float64(m))
+}
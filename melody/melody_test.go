@@ -0,0 +1,200 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package melody
+
+import (
+	"testing"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/google/go-cmp/cmp"
+)
+
+const (
+	test01 = "../mscx/testfiles/001-O_For_a_Thousand_Tongues_to_Sing.mscz"
+	test03 = "../mscx/testfiles/003-Come,_Thou_Almighty_King.mscz"
+)
+
+func loadIndex(t *testing.T) *Index {
+	t.Helper()
+	ix := NewIndex()
+	for _, filename := range []string{test01, test03} {
+		sz, err := mscx.NewFromFile(filename, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		score := &sz.MuseScore.Score
+		if err := ix.AddScore(filename, score, score.Staffs[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ix
+}
+
+func TestFingerprint(t *testing.T) {
+	sz, err := mscx.NewScore().
+		AddPart("Flute").
+		AddMeasure("4/4").Note("C5", "quarter").Note("D5", "quarter").Note("E5", "half").
+		AddMeasure("4/4").Note("C5", "half").Rest("quarter").Note("G4", "quarter").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sz.MuseScore.Score
+	notes, err := TopVoice(score, score.Staffs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := NewFingerprint(notes)
+	want := &Fingerprint{
+		Intervals: []int{2, 2, -4, -5},
+		Rhythm:    []int{0, 1, 1, -1},
+	}
+	if diff := cmp.Diff(want, fp); diff != "" {
+		t.Errorf("NewFingerprint mismatch (-want +got):\n%v", diff)
+	}
+	if got, want := fp.String(), "+2= +2> -4> -5<"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tune := &Fingerprint{Intervals: []int{2, 2, -4, 5, -1}, Rhythm: []int{0, 0, 1, -1, 0}}
+	tests := []struct {
+		name string
+		b    *Fingerprint
+		want float64
+	}{
+		{"identical", tune, 1},
+		{"rhythm variant", &Fingerprint{Intervals: []int{2, 2, -4, 5, -1}, Rhythm: []int{0, 0, 0, -1, 0}}, 0.9},
+		{"no rhythm", &Fingerprint{Intervals: []int{2, 2, -4, 5, -1}}, 1},
+		{"passing note", &Fingerprint{Intervals: []int{2, 2, -2, -2, 5, -1}}, 1 - 2.0/6},
+		{"unrelated", &Fingerprint{Intervals: []int{-3, -3, -3, -3, -3}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Similarity(tune, tt.b); got < tt.want-1e-9 || got > tt.want+1e-9 {
+				t.Errorf("Similarity = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ix := loadIndex(t)
+	if ix.Len() != 2 {
+		t.Fatalf("Len = %v, want 2", ix.Len())
+	}
+
+	tests := []struct {
+		name   string
+		phrase string
+		opts   *SearchOptions
+		want   []*Match
+	}{
+		{
+			name:   "opening of 003",
+			phrase: "D5 B4 G4 A4 G4 F#4 G4",
+			want:   []*Match{{ID: test03, Start: mscx.Position{StaffID: "1", Measure: 1, Voice: 1, Beat: 1}}},
+		},
+		{
+			name:   "transposed opening of 001",
+			phrase: "C4 F4 F4 G4 G4 A4 G4 F4",
+			want: []*Match{{
+				ID:            test01,
+				Start:         mscx.Position{StaffID: "1", Measure: 1, Voice: 1, Beat: 1},
+				Transposition: 4,
+			}},
+		},
+		{
+			name:   "variant of 001 with one wrong note",
+			phrase: "C4 F4 F4 G4 A4 A4 G4 F4",
+			opts:   &SearchOptions{MaxIntervalErrors: 2},
+			want: []*Match{{
+				ID:             test01,
+				Start:          mscx.Position{StaffID: "1", Measure: 1, Voice: 1, Beat: 1},
+				Transposition:  4,
+				IntervalErrors: 2,
+			}},
+		},
+		{
+			name:   "variant not found without tolerance",
+			phrase: "C4 F4 F4 G4 A4 A4 G4 F4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phrase, err := ParsePhrase(tt.phrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ix.Search(phrase, tt.opts)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Search mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestSearch_Rhythm(t *testing.T) {
+	ix := loadIndex(t)
+	sz, err := mscx.NewFromFile(test03, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sz.MuseScore.Score
+	notes, err := TopVoice(score, score.Staffs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A phrase from the middle of the tune, written a fifth lower and in
+	// note values twice as long, is still found at its own offset.
+	var phrase []*Note
+	for _, n := range notes[7:16] {
+		phrase = append(phrase, &Note{Pitch: n.Pitch - 7, Ticks: 2 * n.Ticks})
+	}
+	got := ix.Search(phrase, nil)
+	if len(got) != 1 || got[0].ID != test03 || got[0].Offset != 7 || got[0].Transposition != 7 {
+		t.Fatalf("Search = %+v, want one match of %v at offset 7", got, test03)
+	}
+
+	// Changing the rhythm of a note changes two steps of the contour.
+	phrase[3].Ticks *= 3
+	if got := ix.Search(phrase, nil); len(got) != 0 {
+		t.Errorf("Search with changed rhythm = %+v, want none", got)
+	}
+	if got := ix.Search(phrase, &SearchOptions{MaxRhythmErrors: 2}); len(got) != 1 || got[0].RhythmErrors != 2 {
+		t.Errorf("Search with MaxRhythmErrors = %+v, want one match with 2 rhythm errors", got)
+	}
+	if got := ix.Search(phrase, &SearchOptions{IgnoreRhythm: true}); len(got) != 1 || got[0].RhythmErrors != 0 {
+		t.Errorf("Search with IgnoreRhythm = %+v, want one match", got)
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	ix := loadIndex(t)
+	phrase, err := ParsePhrase("G4 C5 C5 D5 D5 E5 D5 C5 E5 F5 G5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ix.Similar(NewFingerprint(phrase), 0.5)
+	if len(got) != 1 || got[0].ID != test01 {
+		t.Fatalf("Similar = %+v, want %v", got, test01)
+	}
+}
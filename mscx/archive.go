@@ -0,0 +1,167 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Paths of the fixed entries of a `*.mscz` archive.
+const (
+	ContainerPath = "META-INF/container.xml"
+	ThumbnailPath = "Thumbnails/thumbnail.png"
+)
+
+// ZipOptions controls how an archive is written.
+type ZipOptions struct {
+	// RenderThumbnail, if set, renders a new thumbnail of the score (e.g.
+	// engrave.Thumbnail) that replaces the existing one.
+	RenderThumbnail func(*ScoreZip) (image.Image, error)
+}
+
+// ArchiveFile is a file within an archive.
+type ArchiveFile struct {
+	Name string
+	Data []byte
+}
+
+// unsafeFilenameChars are replaced when deriving a filename from a title.
+var unsafeFilenameChars = regexp.MustCompile(`[\s/\\:*?"<>|]+`)
+
+// rootFile returns the name of the `*.mscx` file within the archive,
+// deriving it from the title if the score was not read from an archive.
+func (s *ScoreZip) rootFile() string {
+	if s.RootFile != "" {
+		return s.RootFile
+	}
+	title, _ := s.MuseScore.Score.MetaTag(MetaWorkTitle)
+	if name := strings.Trim(unsafeFilenameChars.ReplaceAllString(title, "_"), "_"); name != "" {
+		return name + ".mscx"
+	}
+	return "score.mscx"
+}
+
+// WriteZip writes the score as a `*.mscz` archive. A nil opts uses the
+// defaults. The entries are written in the same order as MuseScore: the
+// container, the score, the pictures displayed in its frames and the
+// thumbnail, followed by the OtherFiles read from the source archive.
+// Pictures that no image displays are not written.
+func (s *ScoreZip) WriteZip(w io.Writer, opts *ZipOptions) error {
+	if opts == nil {
+		opts = &ZipOptions{}
+	}
+	thumbnail := s.Thumbnail
+	if opts.RenderThumbnail != nil {
+		img, err := opts.RenderThumbnail(s)
+		if err != nil {
+			return fmt.Errorf("ScoreZip.WriteZip: %w", err)
+		}
+		thumbnail = img
+	}
+
+	b, err := s.XML()
+	if err != nil {
+		return fmt.Errorf("ScoreZip.WriteZip: %w", err)
+	}
+
+	rootFile := s.rootFile()
+	var container bytes.Buffer
+	container.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n<container>\n  <rootfiles>\n    <rootfile full-path=\"")
+	if err := xml.EscapeText(&container, []byte(rootFile)); err != nil {
+		return fmt.Errorf("ScoreZip.WriteZip: %w", err)
+	}
+	container.WriteString("\">\n      </rootfile>\n")
+	var pictures []*ArchiveFile
+	for _, path := range s.imagePaths() {
+		data, ok := s.Pictures[path]
+		if !ok {
+			continue
+		}
+		pictures = append(pictures, &ArchiveFile{PicturesDir + path, data})
+		container.WriteString("    <file>")
+		if err := xml.EscapeText(&container, []byte(PicturesDir+path)); err != nil {
+			return fmt.Errorf("ScoreZip.WriteZip: %w", err)
+		}
+		container.WriteString("</file>\n")
+	}
+	container.WriteString("    </rootfiles>\n  </container>\n")
+
+	zw := zip.NewWriter(w)
+	entries := []*ArchiveFile{
+		{ContainerPath, container.Bytes()},
+		{rootFile, b},
+	}
+	entries = append(entries, pictures...)
+	if thumbnail != nil {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, thumbnail); err != nil {
+			return fmt.Errorf("ScoreZip.WriteZip: png.Encode: %w", err)
+		}
+		entries = append(entries, &ArchiveFile{ThumbnailPath, buf.Bytes()})
+	}
+	entries = append(entries, s.OtherFiles...)
+
+	for _, entry := range entries {
+		f, err := zw.Create(entry.Name)
+		if err != nil {
+			return fmt.Errorf("ScoreZip.WriteZip: zip.Create(%q): %w", entry.Name, err)
+		}
+		if _, err := f.Write(entry.Data); err != nil {
+			return fmt.Errorf("ScoreZip.WriteZip: %q: %w", entry.Name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("ScoreZip.WriteZip: %w", err)
+	}
+	return nil
+}
+
+// Zip returns the score as a `*.mscz` archive (see WriteZip).
+func (s *ScoreZip) Zip(opts *ZipOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := s.WriteZip(&buf, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteFile writes the score to a `*.mscz` archive or, if the filename
+// ends in ".mscx", to an uncompressed `*.mscx` file.
+func (s *ScoreZip) WriteFile(filename string, opts *ZipOptions) error {
+	var (
+		b   []byte
+		err error
+	)
+	if strings.HasSuffix(strings.ToLower(filename), ".mscx") {
+		b, err = s.XML()
+	} else {
+		b, err = s.Zip(opts)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, b, 0644)
+}
@@ -0,0 +1,235 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteZip(t *testing.T) {
+	sz, err := New(test01, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sz.Thumbnail == nil {
+		t.Fatal("Thumbnail = nil, want image")
+	}
+	if got, want := sz.Thumbnail.Bounds(), image.Rect(0, 0, 181, 256); got != want {
+		t.Errorf("Thumbnail.Bounds = %v, want %v", got, want)
+	}
+
+	buf, err := sz.Zip(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	wantNames := []string{ContainerPath, "O_For_a_Thousand_Tongues_to_Sing.mscx", ThumbnailPath}
+	if diff := cmp.Diff(wantNames, names); diff != "" {
+		t.Errorf("archive entries mismatch (-want +got):\n%v", diff)
+	}
+
+	got, err := New(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(sz.MuseScore, got.MuseScore); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%v", diff)
+	}
+	if got.RootFile != sz.RootFile {
+		t.Errorf("RootFile = %q, want %q", got.RootFile, sz.RootFile)
+	}
+	if !sameImage(sz.Thumbnail, got.Thumbnail) {
+		t.Error("thumbnail changed in round trip")
+	}
+
+	// Replace the thumbnail with a new rendering.
+	rendered := image.NewNRGBA(image.Rect(0, 0, 10, 20))
+	render := func(s *ScoreZip) (image.Image, error) {
+		if s != sz {
+			t.Errorf("RenderThumbnail called with %p, want %p", s, sz)
+		}
+		return rendered, nil
+	}
+	buf, err = sz.Zip(&ZipOptions{RenderThumbnail: render})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err = New(buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !sameImage(rendered, got.Thumbnail) {
+		t.Error("rendered thumbnail was not written")
+	}
+	if sz.Thumbnail == image.Image(rendered) {
+		t.Error("WriteZip replaced the score's Thumbnail")
+	}
+}
+
+func TestWriteZip_OtherFiles(t *testing.T) {
+	// Add the entries that MuseScore 3.6 writes alongside the score.
+	r, err := zip.NewReader(bytes.NewReader(test01), int64(len(test01)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var src bytes.Buffer
+	zw := zip.NewWriter(&src)
+	for _, f := range r.File {
+		if err := zw.Copy(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	others := []*ArchiveFile{
+		{Name: "audiosettings.json", Data: []byte(`{"activeSoundFonts": []}`)},
+		{Name: "viewsettings.json", Data: []byte(`{"notation": {}}`)},
+		{Name: "Audio/audio.ogg", Data: []byte("OggS")},
+	}
+	for _, f := range others {
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(f.Data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sz, err := New(src.Bytes(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(others, sz.OtherFiles); diff != "" {
+		t.Errorf("OtherFiles mismatch (-want +got):\n%v", diff)
+	}
+
+	buf, err := sz.Zip(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := New(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(others, got.OtherFiles); diff != "" {
+		t.Errorf("written OtherFiles mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestWriteZip_NewScore(t *testing.T) {
+	sz, err := NewScore().
+		Title("Thumb: Test").
+		Composer("Anon").
+		AddPart("Flute").
+		AddMeasure("4/4").Note("C5", "half").Note("E5", "half").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := sz.Zip(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := New(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Thumb_Test.mscx"; got.RootFile != want {
+		t.Errorf("RootFile = %q, want %q", got.RootFile, want)
+	}
+	if got.Thumbnail != nil {
+		t.Errorf("Thumbnail = %v, want nil", got.Thumbnail.Bounds())
+	}
+}
+
+func TestNew_BadThumbnail(t *testing.T) {
+	sz, err := New(test01, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(test01), int64(len(test01)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range r.File {
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Name == ThumbnailPath {
+			w.Write([]byte("not a PNG"))
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(w, rc); err != nil {
+			t.Fatal(err)
+		}
+		rc.Close()
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := New(buf.Bytes(), nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got.Thumbnail != nil {
+		t.Errorf("Thumbnail = %v, want nil", got.Thumbnail.Bounds())
+	}
+	if diff := cmp.Diff(sz.MuseScore, got.MuseScore); diff != "" {
+		t.Errorf("score mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func sameImage(a, b image.Image) bool {
+	if a == nil || b == nil || a.Bounds() != b.Bounds() {
+		return false
+	}
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if color.NRGBAModel.Convert(a.At(x, y)) != color.NRGBAModel.Convert(b.At(x, y)) {
+				return false
+			}
+		}
+	}
+	return true
+}
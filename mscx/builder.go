@@ -0,0 +1,582 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ScoreBuilder constructs a ScoreZip programmatically using a fluent API:
+//
+//	sz, err := NewScore().Title("Scale").
+//		AddPart("Piano").
+//		AddMeasure("4/4").Note("C4", "quarter").Note("D4", "quarter").Note("E4", "half").
+//		Build()
+//
+// Each method returns the builder so that calls may be chained. The first
+// error encountered is remembered and returned by Build; all subsequent
+// calls are then ignored.
+type ScoreBuilder struct {
+	sz *ScoreZip
+
+	part  *Part
+	staff *ScoreStaff
+	// sigs holds the score-wide key and time signature changes per measure index.
+	sigs  []*measureSigs
+	title string
+
+	err error
+}
+
+type measureSigs struct {
+	keySig  *KeySig
+	timeSig *TimeSig
+}
+
+// NewScore returns a builder for a new, empty MuseScore 3 score.
+func NewScore() *ScoreBuilder {
+	sz := &ScoreZip{
+		MuseScore: MuseScore{
+			Version:         "3.02",
+			ProgramVersion:  "3.6.2",
+			ProgramRevision: "3224f34",
+			Score: Score{
+				LayerTag:        LayerTag{ID: "0", Tag: "default"},
+				Division:        DefaultDivision,
+				Style:           &Style{Spatium: 1.75},
+				ShowInvisible:   1,
+				ShowUnprintable: 1,
+				ShowFrames:      1,
+			},
+		},
+	}
+	for _, name := range standardMetaTags {
+		sz.MuseScore.Score.MetaTags = append(sz.MuseScore.Score.MetaTags, &MetaTag{Name: name})
+	}
+	return &ScoreBuilder{sz: sz}
+}
+
+func (b *ScoreBuilder) setErr(format string, args ...any) *ScoreBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("ScoreBuilder: "+format, args...)
+	}
+	return b
+}
+
+// Title sets the workTitle metaTag and adds a title frame to the score.
+func (b *ScoreBuilder) Title(title string) *ScoreBuilder {
+	if b.err != nil {
+		return b
+	}
+	b.title = title
+	b.sz.MuseScore.Score.SetMetaTag(MetaWorkTitle, title)
+	return b
+}
+
+// Composer sets the composer metaTag and adds the composer to the title frame.
+func (b *ScoreBuilder) Composer(composer string) *ScoreBuilder {
+	if b.err != nil {
+		return b
+	}
+	b.sz.MuseScore.Score.SetMetaTag(MetaComposer, composer)
+	return b
+}
+
+// MetaTag sets an arbitrary metaTag (e.g. "copyright") on the score.
+func (b *ScoreBuilder) MetaTag(name, text string) *ScoreBuilder {
+	if b.err != nil {
+		return b
+	}
+	b.sz.MuseScore.Score.SetMetaTag(name, text)
+	return b
+}
+
+// AddPart adds a new single-staff part with the given name and makes its
+// staff the current staff for subsequent measures.
+func (b *ScoreBuilder) AddPart(name string) *ScoreBuilder {
+	if b.err != nil {
+		return b
+	}
+	b.part = &Part{
+		TrackName:  name,
+		Instrument: defaultInstrument(name),
+	}
+	b.sz.MuseScore.Score.Part = append(b.sz.MuseScore.Score.Part, b.part)
+	return b.addStaff("")
+}
+
+// AddInstrument adds a new part created from the instrument template with
+// the given ID (e.g. "wind.flutes.flute" or "piano"; see LookupInstrument)
+// and makes its first staff the current staff. Use Staff to select any
+// additional staves of the instrument. An ID missing from the embedded
+// catalog fails Build with ErrUnknownInstrument.
+func (b *ScoreBuilder) AddInstrument(id string) *ScoreBuilder {
+	if b.err != nil {
+		return b
+	}
+	t, ok := LookupInstrument(id)
+	if !ok {
+		return b.setErr("AddInstrument(%q): %w", id, ErrUnknownInstrument)
+	}
+
+	score := &b.sz.MuseScore.Score
+	b.part = t.NewPart(len(score.Staffs) + 1)
+	score.Part = append(score.Part, b.part)
+	for i, ps := range b.part.Staff {
+		staff := &ScoreStaff{ID: ps.ID}
+		score.Staffs = append(score.Staffs, staff)
+		if i == 0 {
+			b.staff = staff
+		}
+	}
+	return b
+}
+
+// AddStaff adds another staff to the current part (e.g. the lower staff of
+// a piano grand staff) using the provided clef ("G", "F", "C3", ...) and
+// makes it the current staff. An empty clef uses the treble clef.
+func (b *ScoreBuilder) AddStaff(clef string) *ScoreBuilder {
+	if b.err != nil {
+		return b
+	}
+	if b.part == nil {
+		return b.setErr("AddStaff(%q) called before AddPart", clef)
+	}
+	return b.addStaff(clef)
+}
+
+func (b *ScoreBuilder) addStaff(clef string) *ScoreBuilder {
+	score := &b.sz.MuseScore.Score
+	id := fmt.Sprintf("%v", len(score.Staffs)+1)
+
+	ps := &PartStaff{
+		ID:        id,
+		StaffType: StaffType{Group: "pitched", Name: "stdNormal"},
+	}
+	if clef != "" && clef != "G" {
+		ps.StaffElements = append(ps.StaffElements, &DefaultClef{Value: clef})
+		if b.part.Instrument != nil {
+			b.part.Instrument.Clef = &Clef{Text: clef}
+			if len(b.part.Staff) > 0 {
+				b.part.Instrument.Clef.Staff = fmt.Sprintf("%v", len(b.part.Staff)+1)
+			}
+		}
+	}
+	b.part.Staff = append(b.part.Staff, ps)
+
+	b.staff = &ScoreStaff{ID: id}
+	score.Staffs = append(score.Staffs, b.staff)
+	return b
+}
+
+// Staff makes the staff with the given 1-based score-wide ID the current
+// staff so that additional measures may be appended to it.
+func (b *ScoreBuilder) Staff(id int) *ScoreBuilder {
+	if b.err != nil {
+		return b
+	}
+	staffs := b.sz.MuseScore.Score.Staffs
+	if id < 1 || id > len(staffs) {
+		return b.setErr("Staff(%v): no such staff", id)
+	}
+	b.staff = staffs[id-1]
+	return b
+}
+
+// Key sets the key signature (as the number of sharps, or negative for
+// flats) starting at the next measure added to the current staff.
+func (b *ScoreBuilder) Key(fifths int) *ScoreBuilder {
+	if b.err != nil {
+		return b
+	}
+	if b.staff == nil {
+		return b.setErr("Key(%v) called before AddPart", fifths)
+	}
+	if fifths < -7 || fifths > 7 {
+		return b.setErr("Key(%v): must be between -7 and 7", fifths)
+	}
+	ms := b.sigsAt(len(b.staff.Measure))
+	ks := &KeySig{Accidental: fmt.Sprintf("%v", fifths)}
+	if ms.keySig != nil && *ms.keySig != *ks {
+		return b.setErr("Key(%v): conflicts with key %v on another staff", fifths, ms.keySig.Accidental)
+	}
+	ms.keySig = ks
+	return b
+}
+
+func (b *ScoreBuilder) sigsAt(index int) *measureSigs {
+	for len(b.sigs) <= index {
+		b.sigs = append(b.sigs, &measureSigs{})
+	}
+	return b.sigs[index]
+}
+
+// AddMeasure appends a new measure to the current staff. If timeSig is
+// non-empty (e.g. "4/4" or "6/8"), it sets the time signature from this
+// measure onward; otherwise the previous time signature is continued.
+func (b *ScoreBuilder) AddMeasure(timeSig string) *ScoreBuilder {
+	if b.err != nil {
+		return b
+	}
+	if b.staff == nil {
+		return b.setErr("AddMeasure(%q) called before AddPart", timeSig)
+	}
+
+	index := len(b.staff.Measure)
+	ms := b.sigsAt(index)
+	if timeSig != "" {
+		num, den, err := ParseFraction(timeSig)
+		if err != nil {
+			return b.setErr("AddMeasure: %v", err)
+		}
+		ts := &TimeSig{SigN: fmt.Sprintf("%v", num), SigD: fmt.Sprintf("%v", den)}
+		if ms.timeSig != nil && (ms.timeSig.SigN != ts.SigN || ms.timeSig.SigD != ts.SigD) {
+			return b.setErr("AddMeasure(%q): conflicts with time signature %v/%v on another staff", timeSig, ms.timeSig.SigN, ms.timeSig.SigD)
+		}
+		ms.timeSig = ts
+	}
+	if index == 0 && ms.timeSig == nil {
+		return b.setErr("AddMeasure: the first measure requires a time signature")
+	}
+
+	b.staff.Measure = append(b.staff.Measure, &Measure{Voice: []*Voice{{}}})
+	return b
+}
+
+// parseDuration parses a duration such as "quarter", "half." or "eighth.."
+// where each trailing period adds an augmentation dot.
+func parseDuration(s string) (durationType string, dots int, err error) {
+	durationType = strings.TrimRight(s, ".")
+	dots = len(s) - len(durationType)
+	if _, ok := durationQuarters[durationType]; !ok {
+		return "", 0, fmt.Errorf("unknown duration %q", s)
+	}
+	return durationType, dots, nil
+}
+
+func (b *ScoreBuilder) currentVoice(method string) *Voice {
+	if b.staff == nil || len(b.staff.Measure) == 0 {
+		b.setErr("%v called before AddMeasure", method)
+		return nil
+	}
+	m := b.staff.Measure[len(b.staff.Measure)-1]
+	return m.Voice[0]
+}
+
+// Note appends a single note with the given pitch (e.g. "C4", "F#3") and
+// duration (e.g. "quarter", "half.") to the current measure.
+func (b *ScoreBuilder) Note(pitch, duration string) *ScoreBuilder {
+	return b.Chord([]string{pitch}, duration)
+}
+
+// Chord appends a chord of the given pitches and duration to the current measure.
+func (b *ScoreBuilder) Chord(pitches []string, duration string) *ScoreBuilder {
+	if b.err != nil {
+		return b
+	}
+	v := b.currentVoice("Chord")
+	if v == nil {
+		return b
+	}
+	durationType, dots, err := parseDuration(duration)
+	if err != nil {
+		return b.setErr("Chord: %v", err)
+	}
+	if len(pitches) == 0 {
+		return b.setErr("Chord: no pitches")
+	}
+
+	chord := &Chord{Dots: dots, DurationType: durationType}
+	for _, p := range pitches {
+		pitch, tpc, err := ParsePitch(p)
+		if err != nil {
+			return b.setErr("Chord: %v", err)
+		}
+		chord.Note = append(chord.Note, &Note{Pitch: pitch, TPC: tpc})
+	}
+	v.TimedElements = append(v.TimedElements, chord)
+	return b
+}
+
+// Rest appends a rest of the given duration (e.g. "quarter") to the current measure.
+func (b *ScoreBuilder) Rest(duration string) *ScoreBuilder {
+	if b.err != nil {
+		return b
+	}
+	v := b.currentVoice("Rest")
+	if v == nil {
+		return b
+	}
+	durationType, dots, err := parseDuration(duration)
+	if err != nil {
+		return b.setErr("Rest: %v", err)
+	}
+	v.TimedElements = append(v.TimedElements, &Rest{Dots: dots, DurationType: durationType})
+	return b
+}
+
+// Lyric attaches a lyric syllable to the most recently added chord.
+// A trailing "-" marks the syllable as continuing into the next one.
+func (b *ScoreBuilder) Lyric(text string) *ScoreBuilder {
+	if b.err != nil {
+		return b
+	}
+	v := b.currentVoice("Lyric")
+	if v == nil {
+		return b
+	}
+	var chord *Chord
+	if n := len(v.TimedElements); n > 0 {
+		chord, _ = v.TimedElements[n-1].(*Chord)
+	}
+	if chord == nil {
+		return b.setErr("Lyric(%q): no preceding chord in this measure", text)
+	}
+
+	l := &Lyrics{Text: strings.TrimSuffix(text, "-")}
+	continues := strings.HasSuffix(text, "-")
+	prevContinues := b.lastSyllableContinues(chord)
+	switch {
+	case continues && prevContinues:
+		l.Syllabic = "middle"
+	case continues:
+		l.Syllabic = "begin"
+	case prevContinues:
+		l.Syllabic = "end"
+	}
+	chord.Lyrics = append(chord.Lyrics, l)
+	return b
+}
+
+// lastSyllableContinues reports whether the previous verse-1 lyric on the
+// current staff (before chord) was hyphenated into the next syllable.
+func (b *ScoreBuilder) lastSyllableContinues(chord *Chord) bool {
+	for i := len(b.staff.Measure) - 1; i >= 0; i-- {
+		for _, v := range b.staff.Measure[i].Voice {
+			for j := len(v.TimedElements) - 1; j >= 0; j-- {
+				c, ok := v.TimedElements[j].(*Chord)
+				if !ok || c == chord {
+					continue
+				}
+				for _, l := range c.Lyrics {
+					if l.No == 0 {
+						return l.Syllabic == "begin" || l.Syllabic == "middle"
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Build finalizes and returns the score. Staves with fewer measures than
+// the longest staff are padded with measure rests, and underfull measures
+// are completed with rests. An error is returned if any measure is overfull.
+func (b *ScoreBuilder) Build() (*ScoreZip, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	score := &b.sz.MuseScore.Score
+	if len(score.Staffs) == 0 {
+		return nil, fmt.Errorf("ScoreBuilder.Build: score has no parts")
+	}
+
+	numMeasures := 0
+	for _, staff := range score.Staffs {
+		if n := len(staff.Measure); n > numMeasures {
+			numMeasures = n
+		}
+	}
+	if numMeasures == 0 {
+		return nil, fmt.Errorf("ScoreBuilder.Build: score has no measures")
+	}
+	if b.sigs[0].keySig == nil {
+		b.sigs[0].keySig = &KeySig{Accidental: "0"}
+	}
+
+	for _, staff := range score.Staffs {
+		var timeSig *TimeSig
+		for i := 0; i < numMeasures; i++ {
+			if i >= len(staff.Measure) {
+				staff.Measure = append(staff.Measure, &Measure{Voice: []*Voice{{}}})
+			}
+			v := staff.Measure[i].Voice[0]
+			if i < len(b.sigs) {
+				if ks := b.sigs[i].keySig; ks != nil {
+					v.KeySig = &KeySig{Accidental: ks.Accidental}
+				}
+				if ts := b.sigs[i].timeSig; ts != nil {
+					timeSig = ts
+					v.TimeSig = &TimeSig{SigN: ts.SigN, SigD: ts.SigD}
+				}
+			}
+			if err := fillVoice(v, timeSig, score.Division); err != nil {
+				return nil, fmt.Errorf("ScoreBuilder.Build: staff %v, measure %v: %w", staff.ID, i+1, err)
+			}
+		}
+	}
+
+	for _, part := range score.Part {
+		if len(part.Staff) > 1 && !hasBracket(part.Staff[0]) {
+			first := part.Staff[0]
+			first.StaffElements = append([]any{
+				&Bracket{Type: 1, Span: len(part.Staff), Col: "0"},
+				BarLineSpan(1),
+			}, first.StaffElements...)
+		}
+	}
+
+	if b.title != "" || b.composer() != "" {
+		vbox := &VBox{Height: "10"}
+		if b.title != "" {
+			vbox.Text = append(vbox.Text, TextElement{Style: Title, Text: []byte(b.title)})
+		}
+		if c := b.composer(); c != "" {
+			vbox.Text = append(vbox.Text, TextElement{Style: Composer, Text: []byte(c)})
+		}
+		score.Staffs[0].VBox = vbox
+	}
+
+	sz := b.sz
+	b.err = fmt.Errorf("ScoreBuilder: Build already called")
+	return sz, nil
+}
+
+func hasBracket(ps *PartStaff) bool {
+	for _, el := range ps.StaffElements {
+		if _, ok := el.(*Bracket); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *ScoreBuilder) composer() string {
+	composer, _ := b.sz.MuseScore.Score.MetaTag(MetaComposer)
+	return composer
+}
+
+// fillVoice completes an underfull voice with rests. An empty voice
+// receives a single measure rest.
+func fillVoice(v *Voice, timeSig *TimeSig, division int) error {
+	measureTicks, err := timeSig.Ticks(division)
+	if err != nil {
+		return err
+	}
+
+	if len(v.TimedElements) == 0 {
+		v.TimedElements = append(v.TimedElements, &Rest{
+			DurationType: "measure",
+			Duration:     timeSig.SigN + "/" + timeSig.SigD,
+		})
+		return nil
+	}
+
+	var ticks int
+	for _, el := range v.TimedElements {
+		t, err := elementTicks(el, division)
+		if err != nil {
+			return err
+		}
+		ticks += t
+	}
+	if ticks > measureTicks {
+		return fmt.Errorf("measure is overfull: %v ticks in a %v/%v measure", ticks, timeSig.SigN, timeSig.SigD)
+	}
+	for _, dt := range SplitTicks(measureTicks-ticks, division) {
+		v.TimedElements = append(v.TimedElements, &Rest{DurationType: dt})
+	}
+	return nil
+}
+
+// elementTicks returns the duration of a Chord or Rest, or of a gap
+// (*Location) in a voice, or zero for grace notes and elements that take
+// no time. It does not shorten the chords and rests of tuplets; see
+// voiceTimer.
+func elementTicks(el any, division int) (int, error) {
+	switch e := el.(type) {
+	case *Chord:
+		if e.Acciaccatura != nil || e.Appoggiatura != nil {
+			return 0, nil
+		}
+		return DurationTicks(e.DurationType, e.Dots, division)
+	case *Rest:
+		if e.DurationType == "measure" {
+			return FractionTicks(e.Duration, division)
+		}
+		return DurationTicks(e.DurationType, e.Dots, division)
+	case *Location:
+		return FractionTicks(e.Fractions, division)
+	}
+	return 0, nil
+}
+
+// voiceTimer returns the durations of the successive elements of a voice,
+// shortening the chords and rests within tuplets.
+type voiceTimer struct {
+	division int
+	tuplets  []*TupletElement
+}
+
+// ticks returns the duration of el, the next element of the voice.
+func (t *voiceTimer) ticks(el any) (int, error) {
+	switch e := el.(type) {
+	case *TupletElement:
+		t.tuplets = append(t.tuplets, e)
+		return 0, nil
+	case *EndTuplet:
+		if len(t.tuplets) > 0 {
+			t.tuplets = t.tuplets[:len(t.tuplets)-1]
+		}
+		return 0, nil
+	}
+	ticks, err := elementTicks(el, t.division)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := el.(*Location); !ok {
+		for _, tuplet := range t.tuplets {
+			if tuplet.ActualNotes > 0 {
+				ticks = ticks * tuplet.NormalNotes / tuplet.ActualNotes
+			}
+		}
+	}
+	return ticks, nil
+}
+
+// defaultInstrument returns a generic piano-like instrument definition
+// with the given name, suitable for a newly created part.
+func defaultInstrument(name string) *Instrument {
+	inst := &Instrument{
+		LongName:     name,
+		TrackName:    name,
+		MinPitchP:    "21",
+		MaxPitchP:    "108",
+		MinPitchA:    "21",
+		MaxPitchA:    "108",
+		InstrumentID: "keyboard.piano",
+		Channel: []*Channel{
+			{ChannelElements: []any{Program{Value: "0"}}, Synti: "Fluid"},
+		},
+	}
+	for _, a := range defaultArticulations {
+		art := *a
+		inst.Articulation = append(inst.Articulation, &art)
+	}
+	return inst
+}
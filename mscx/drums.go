@@ -0,0 +1,320 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// gmDrumNames are the General MIDI percussion key map names, starting at
+// pitch 35 (Acoustic Bass Drum).
+var gmDrumNames = []string{
+	"Acoustic Bass Drum", "Bass Drum 1", "Side Stick", "Acoustic Snare",
+	"Hand Clap", "Electric Snare", "Low Floor Tom", "Closed Hi-Hat",
+	"High Floor Tom", "Pedal Hi-Hat", "Low Tom", "Open Hi-Hat",
+	"Low-Mid Tom", "Hi-Mid Tom", "Crash Cymbal 1", "High Tom",
+	"Ride Cymbal 1", "Chinese Cymbal", "Ride Bell", "Tambourine",
+	"Splash Cymbal", "Cowbell", "Crash Cymbal 2", "Vibraslap",
+	"Ride Cymbal 2", "Hi Bongo", "Low Bongo", "Mute Hi Conga",
+	"Open Hi Conga", "Low Conga", "High Timbale", "Low Timbale",
+	"High Agogo", "Low Agogo", "Cabasa", "Maracas",
+	"Short Whistle", "Long Whistle", "Short Guiro", "Long Guiro",
+	"Claves", "Hi Wood Block", "Low Wood Block", "Mute Cuica",
+	"Open Cuica", "Mute Triangle", "Open Triangle",
+}
+
+const gmFirstDrum = 35
+
+// GeneralMIDIDrumName returns the General MIDI percussion name of the
+// given pitch, or false if the pitch is outside the GM percussion key map.
+func GeneralMIDIDrumName(pitch int) (string, bool) {
+	i := pitch - gmFirstDrum
+	if i < 0 || i >= len(gmDrumNames) {
+		return "", false
+	}
+	return gmDrumNames[i], true
+}
+
+// GeneralMIDIDrumset returns a drumset containing every General MIDI
+// percussion sound. Sounds that are part of MuseScore's default drumset
+// use its notation (line, notehead, voice and stem direction); the rest
+// are placed just above the staff with normal noteheads.
+func GeneralMIDIDrumset() []*Drum {
+	defaults := map[int]*Drum{}
+	if t, ok := LookupInstrument("drum.group.set"); ok {
+		for _, d := range t.Drum {
+			defaults[d.Pitch] = d
+		}
+	}
+
+	result := make([]*Drum, 0, len(gmDrumNames))
+	for i, name := range gmDrumNames {
+		pitch := gmFirstDrum + i
+		drum := &Drum{Pitch: pitch, Head: "normal", Line: -1, Voice: 0, Name: name, Stem: 1}
+		if d, ok := defaults[pitch]; ok {
+			drum = &Drum{Pitch: pitch, Head: d.Head, Line: d.Line, Voice: d.Voice, Name: name, Stem: d.Stem, Shortcut: d.Shortcut}
+		}
+		result = append(result, drum)
+	}
+	return result
+}
+
+// Drumset returns the drum definitions of a percussion instrument. If the
+// instrument uses a drumset but does not define one, MuseScore's default
+// drumset is returned. It returns nil for pitched instruments.
+func (i *Instrument) Drumset() []*Drum {
+	if i == nil || i.UseDrumset == 0 {
+		return nil
+	}
+	if len(i.Drum) > 0 {
+		return i.Drum
+	}
+	if t, ok := LookupInstrument("drum.group.set"); ok {
+		return t.Drum
+	}
+	return nil
+}
+
+// DrumForPitch returns the drum played by the given note pitch on this
+// instrument, or nil if the instrument's drumset does not define it.
+func (i *Instrument) DrumForPitch(pitch int) *Drum {
+	for _, d := range i.Drumset() {
+		if d.Pitch == pitch {
+			return d
+		}
+	}
+	return nil
+}
+
+// DrumHit is a single note played on a percussion part.
+type DrumHit struct {
+	Position
+	Note *Note
+	// Drum is the drumset entry for the note, or nil if the note's pitch
+	// is not defined in the drumset.
+	Drum *Drum
+}
+
+// DrumHits returns every note of the given percussion part along with its
+// drum name and staff line.
+func (s *Score) DrumHits(part *Part) ([]*DrumHit, error) {
+	if part.Instrument == nil || part.Instrument.UseDrumset == 0 {
+		return nil, fmt.Errorf("Score.DrumHits: part %q does not use a drumset", part.TrackName)
+	}
+
+	var hits []*DrumHit
+	for _, ps := range part.Staff {
+		index := s.staffIndex(ps.ID)
+		if index < 0 {
+			return nil, fmt.Errorf("Score.DrumHits: part staff %v not found in score", ps.ID)
+		}
+		err := s.WalkStaff(s.Staffs[index], func(ev *Event) error {
+			chord, ok := ev.Element.(*Chord)
+			if !ok {
+				return nil
+			}
+			for _, note := range chord.Note {
+				hits = append(hits, &DrumHit{Position: ev.Position, Note: note, Drum: part.Instrument.DrumForPitch(note.Pitch)})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Score.DrumHits: %w", err)
+		}
+	}
+	return hits, nil
+}
+
+// RemapDrums converts the given percussion part to the target drumset
+// (e.g. GeneralMIDIDrumset), changing the pitch of every note so that it
+// plays the drum of the same name (ignoring case) in the target. Notes
+// whose drum has no match by name keep their pitch if the target defines
+// it. The part's drumset is then replaced by a copy of the target. It
+// returns the number of notes whose pitch changed.
+func (s *Score) RemapDrums(part *Part, to []*Drum) (int, error) {
+	hits, err := s.DrumHits(part)
+	if err != nil {
+		return 0, fmt.Errorf("Score.RemapDrums: %w", err)
+	}
+
+	byName := map[string]int{}
+	byPitch := map[int]bool{}
+	for _, d := range to {
+		byName[strings.ToLower(d.Name)] = d.Pitch
+		byPitch[d.Pitch] = true
+	}
+
+	mapping := map[*Note]int{}
+	for _, hit := range hits {
+		if hit.Drum != nil {
+			if pitch, ok := byName[strings.ToLower(hit.Drum.Name)]; ok {
+				mapping[hit.Note] = pitch
+				continue
+			}
+		}
+		if !byPitch[hit.Note.Pitch] {
+			return 0, fmt.Errorf("Score.RemapDrums: %v: pitch %v has no equivalent in the target drumset", hit.Position, hit.Note.Pitch)
+		}
+	}
+
+	var count int
+	for note, pitch := range mapping {
+		if note.Pitch != pitch {
+			note.Pitch, note.TPC = pitch, DefaultTPC(pitch)
+			count++
+		}
+	}
+
+	part.Instrument.Drum = nil
+	for _, d := range to {
+		drum := *d
+		part.Instrument.Drum = append(part.Instrument.Drum, &drum)
+	}
+	return count, nil
+}
+
+// DrumPatternRow is the hits of a single drum within a DrumPattern.
+type DrumPatternRow struct {
+	Name  string
+	Pitch int
+	// Hits has one entry per step of the measure.
+	Hits []bool
+}
+
+// DrumPattern is a grid of the drum hits in one measure of a percussion
+// part, with one row per drum and one column per step.
+type DrumPattern struct {
+	// Measure is the 1-based index of the measure.
+	Measure int
+	Rows    []*DrumPatternRow
+}
+
+// String renders the pattern as a text grid, e.g.
+//
+//	Closed Hi-Hat  |x.x.x.x.x.x.x.x.|
+//	Acoustic Snare |....x.......x...|
+//	Bass Drum 1    |x.......x.......|
+func (p *DrumPattern) String() string {
+	var width int
+	for _, row := range p.Rows {
+		if len(row.Name) > width {
+			width = len(row.Name)
+		}
+	}
+
+	var sb strings.Builder
+	for _, row := range p.Rows {
+		fmt.Fprintf(&sb, "%-*v |", width, row.Name)
+		for _, hit := range row.Hits {
+			if hit {
+				sb.WriteByte('x')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteString("|\n")
+	}
+	return sb.String()
+}
+
+// DrumPatterns returns a hit grid for every measure of the given percussion
+// part, where each step is stepTicks long (e.g. Division/4 for sixteenth
+// notes). Every pattern has a row for each drum played anywhere in the
+// part, ordered from the top of the staff to the bottom. Hits that fall
+// between steps are placed on the preceding step.
+func (s *Score) DrumPatterns(part *Part, stepTicks int) ([]*DrumPattern, error) {
+	if stepTicks <= 0 {
+		return nil, fmt.Errorf("Score.DrumPatterns: invalid step %v", stepTicks)
+	}
+	hits, err := s.DrumHits(part)
+	if err != nil {
+		return nil, fmt.Errorf("Score.DrumPatterns: %w", err)
+	}
+	if len(part.Staff) == 0 {
+		return nil, nil
+	}
+	index := s.staffIndex(part.Staff[0].ID)
+
+	// Find the length of every measure.
+	var measureTicks []int
+	err = s.WalkStaff(s.Staffs[index], func(ev *Event) error {
+		for len(measureTicks) < ev.Measure {
+			ticks, err := s.MeasureTicks(ev.Bar, ev.TimeSig)
+			if err != nil {
+				return err
+			}
+			measureTicks = append(measureTicks, ticks)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Score.DrumPatterns: %w", err)
+	}
+
+	// Choose the rows.
+	drums := map[int]*Drum{}
+	for _, hit := range hits {
+		if _, ok := drums[hit.Note.Pitch]; ok {
+			continue
+		}
+		drum := hit.Drum
+		if drum == nil {
+			name, ok := GeneralMIDIDrumName(hit.Note.Pitch)
+			if !ok {
+				name = fmt.Sprintf("Pitch %v", hit.Note.Pitch)
+			}
+			drum = &Drum{Pitch: hit.Note.Pitch, Name: name}
+		}
+		drums[hit.Note.Pitch] = drum
+	}
+	order := make([]*Drum, 0, len(drums))
+	for _, d := range drums {
+		order = append(order, d)
+	}
+	sort.Slice(order, func(a, b int) bool {
+		if order[a].Line != order[b].Line {
+			return order[a].Line < order[b].Line
+		}
+		return order[a].Pitch < order[b].Pitch
+	})
+
+	patterns := make([]*DrumPattern, len(measureTicks))
+	rows := make([]map[int]*DrumPatternRow, len(measureTicks))
+	for i, ticks := range measureTicks {
+		steps := (ticks + stepTicks - 1) / stepTicks
+		patterns[i] = &DrumPattern{Measure: i + 1}
+		rows[i] = map[int]*DrumPatternRow{}
+		for _, d := range order {
+			row := &DrumPatternRow{Name: d.Name, Pitch: d.Pitch, Hits: make([]bool, steps)}
+			patterns[i].Rows = append(patterns[i].Rows, row)
+			rows[i][d.Pitch] = row
+		}
+	}
+
+	for _, hit := range hits {
+		if hit.Measure > len(rows) {
+			continue
+		}
+		row := rows[hit.Measure-1][hit.Note.Pitch]
+		if step := hit.MeasureTick / stepTicks; step < len(row.Hits) {
+			row.Hits[step] = true
+		}
+	}
+	return patterns, nil
+}
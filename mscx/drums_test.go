@@ -0,0 +1,104 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func drumScore(t *testing.T) (*Score, *Part) {
+	t.Helper()
+	kick, snare := []string{"C2", "F#2"}, []string{"D2", "F#2"}
+	sz, err := NewScore().AddInstrument("drum.group.set").
+		AddMeasure("4/4").
+		Chord(kick, "eighth").Note("F#2", "eighth").Chord(snare, "eighth").Note("F#2", "eighth").
+		Chord(kick, "eighth").Note("F#2", "eighth").Chord(snare, "eighth").Note("F#2", "eighth").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sz.MuseScore.Score
+	return score, score.Part[0]
+}
+
+func TestDrumPatterns(t *testing.T) {
+	score, part := drumScore(t)
+
+	if got := part.Instrument.DrumForPitch(38); got == nil || got.Name != "Acoustic Snare" || got.Line != 3 {
+		t.Errorf("DrumForPitch(38) = %+v, want Acoustic Snare on line 3", got)
+	}
+
+	patterns, err := score.DrumPatterns(part, DefaultDivision/2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patterns) != 1 {
+		t.Fatalf("got %v patterns, want 1", len(patterns))
+	}
+	want := "Closed Hi-Hat  |xxxxxxxx|\n" +
+		"Acoustic Snare |..x...x.|\n" +
+		"Bass Drum 1    |x...x...|\n"
+	if got := patterns[0].String(); got != want {
+		t.Errorf("DrumPattern =\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestRemapDrums(t *testing.T) {
+	score, part := drumScore(t)
+
+	// A custom drumset that plays the snare on pitch 40.
+	custom := []*Drum{
+		{Pitch: 36, Head: "normal", Line: 7, Voice: 1, Name: "Bass Drum 1", Stem: 2},
+		{Pitch: 40, Head: "normal", Line: 3, Name: "Acoustic Snare", Stem: 1},
+		{Pitch: 42, Head: "cross", Line: -1, Name: "Closed Hi-Hat", Stem: 1},
+	}
+	n, err := score.RemapDrums(part, custom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("RemapDrums changed %v notes, want 2", n)
+	}
+
+	// And back to General MIDI.
+	if n, err = score.RemapDrums(part, GeneralMIDIDrumset()); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("RemapDrums changed %v notes, want 2", n)
+	}
+	hits, err := score.DrumHits(part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, hit := range hits[:4] {
+		got = append(got, hit.Drum.Name)
+	}
+	want := []string{"Bass Drum 1", "Closed Hi-Hat", "Closed Hi-Hat", "Acoustic Snare"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DrumHits differs (-want +got):\n%s", diff)
+	}
+
+	if _, err := score.RemapDrums(part, custom[:1]); err == nil {
+		t.Error("RemapDrums to an incomplete drumset did not fail")
+	}
+}
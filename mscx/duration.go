@@ -0,0 +1,131 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultDivision is the number of ticks per quarter note used by MuseScore 3.
+const DefaultDivision = 480
+
+// durationQuarters holds the length of each MuseScore durationType
+// expressed as a fraction of a quarter note (numerator, denominator).
+var durationQuarters = map[string][2]int{
+	"long":    {16, 1},
+	"breve":   {8, 1},
+	"whole":   {4, 1},
+	"half":    {2, 1},
+	"quarter": {1, 1},
+	"eighth":  {1, 2},
+	"16th":    {1, 4},
+	"32nd":    {1, 8},
+	"64th":    {1, 16},
+	"128th":   {1, 32},
+	"256th":   {1, 64},
+	"512th":   {1, 128},
+	"1024th":  {1, 256},
+}
+
+// durationTypesByLength lists the duration types from longest to shortest.
+var durationTypesByLength = []string{
+	"long", "breve", "whole", "half", "quarter", "eighth",
+	"16th", "32nd", "64th", "128th", "256th", "512th", "1024th",
+}
+
+// DurationTicks returns the number of ticks in a note or rest of the given
+// durationType (e.g. "quarter") and number of augmentation dots, using
+// division ticks per quarter note. The "measure" durationType is not
+// handled here since its length depends on the enclosing measure.
+func DurationTicks(durationType string, dots, division int) (int, error) {
+	q, ok := durationQuarters[durationType]
+	if !ok {
+		return 0, fmt.Errorf("DurationTicks: unknown durationType %q", durationType)
+	}
+	base := division * q[0] / q[1]
+	ticks, add := base, base
+	for i := 0; i < dots; i++ {
+		add /= 2
+		ticks += add
+	}
+	return ticks, nil
+}
+
+// TicksToDuration returns the durationType and number of dots (up to two)
+// that exactly represent the given number of ticks. ok is false if no
+// single (possibly dotted) duration matches.
+func TicksToDuration(ticks, division int) (durationType string, dots int, ok bool) {
+	for _, dt := range durationTypesByLength {
+		for d := 0; d <= 2; d++ {
+			if t, _ := DurationTicks(dt, d, division); t == ticks && t > 0 {
+				return dt, d, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// SplitTicks breaks the given number of ticks into a sequence of
+// undotted durationTypes, longest first, whose total equals ticks as
+// closely as the division permits.
+func SplitTicks(ticks, division int) []string {
+	var result []string
+	for _, dt := range durationTypesByLength[2:] { // start with "whole"
+		t, _ := DurationTicks(dt, 0, division)
+		for t > 0 && ticks >= t {
+			result = append(result, dt)
+			ticks -= t
+		}
+	}
+	return result
+}
+
+// ParseFraction parses a MuseScore fraction string such as "3/4" as used by
+// Measure.Len, Rest.Duration and Location.Fractions.
+func ParseFraction(s string) (num, den int, err error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("ParseFraction(%q): expected n/d", s)
+	}
+	if num, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, fmt.Errorf("ParseFraction(%q): %w", s, err)
+	}
+	if den, err = strconv.Atoi(parts[1]); err != nil {
+		return 0, 0, fmt.Errorf("ParseFraction(%q): %w", s, err)
+	}
+	if den == 0 {
+		return 0, 0, fmt.Errorf("ParseFraction(%q): zero denominator", s)
+	}
+	return num, den, nil
+}
+
+// FractionTicks returns the number of ticks represented by a fraction of a
+// whole note (e.g. "3/4") using division ticks per quarter note.
+func FractionTicks(s string, division int) (int, error) {
+	num, den, err := ParseFraction(s)
+	if err != nil {
+		return 0, err
+	}
+	return num * 4 * division / den, nil
+}
+
+// Ticks returns the number of ticks in a full measure of this time signature.
+func (t *TimeSig) Ticks(division int) (int, error) {
+	return FractionTicks(t.SigN+"/"+t.SigD, division)
+}
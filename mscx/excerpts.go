@@ -0,0 +1,154 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// ExcerptByName returns the excerpt (linked part score) with the given name.
+func (s *Score) ExcerptByName(name string) *Score {
+	for _, e := range s.Excerpts {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// LinkedStaff returns the staff of the main score that the excerpt staff
+// with the given ID is linked to, or nil if it is not linked.
+func (s *Score) LinkedStaff(excerpt *Score, staffID string) *ScoreStaff {
+	for _, part := range excerpt.Part {
+		for _, ps := range part.Staff {
+			if ps.ID != staffID || ps.LinkedTo < 1 || ps.LinkedTo > len(s.Staffs) {
+				continue
+			}
+			return s.Staffs[ps.LinkedTo-1]
+		}
+	}
+	return nil
+}
+
+// NewExcerpt creates a linked part score for the given part of the score
+// and appends it to s.Excerpts. The excerpt receives copies of the part's
+// staves (renumbered from 1 and linked back to the main score), the title
+// frame, and the part's instrument including any transposition, and is
+// displayed at written (transposed) pitch with multi-measure rests enabled.
+func (s *Score) NewExcerpt(part *Part) (*Score, error) {
+	name := part.TrackName
+	if name == "" && part.Instrument != nil {
+		name = part.Instrument.LongName
+	}
+	if s.ExcerptByName(name) != nil {
+		return nil, fmt.Errorf("NewExcerpt: excerpt %q already exists", name)
+	}
+
+	e := &Score{
+		LayerTag:        s.LayerTag,
+		CurrentLayer:    s.CurrentLayer,
+		Division:        s.Division,
+		ShowInvisible:   s.ShowInvisible,
+		ShowUnprintable: s.ShowUnprintable,
+		ShowFrames:      s.ShowFrames,
+		ShowMargins:     s.ShowMargins,
+		Name:            name,
+	}
+	style := &Style{}
+	if s.Style != nil {
+		if err := cloneXML(s.Style, style); err != nil {
+			return nil, fmt.Errorf("NewExcerpt: %w", err)
+		}
+	}
+	style.ConcertPitch = 0
+	e.Style = style
+
+	var hasPartName bool
+	for _, mt := range s.MetaTags {
+		v := *mt
+		if v.Name == "partName" {
+			v.Text, hasPartName = name, true
+		}
+		e.MetaTags = append(e.MetaTags, &v)
+	}
+	if !hasPartName {
+		e.MetaTags = append(e.MetaTags, &MetaTag{Name: "partName", Text: name})
+	}
+
+	newPart := &Part{}
+	if err := cloneXML(part, newPart); err != nil {
+		return nil, fmt.Errorf("NewExcerpt: %w", err)
+	}
+	e.Part = []*Part{newPart}
+
+	for i, ps := range newPart.Staff {
+		index := s.staffIndex(ps.ID)
+		if index < 0 {
+			return nil, fmt.Errorf("NewExcerpt: part staff %v not found in score", ps.ID)
+		}
+		ps.ID = fmt.Sprintf("%v", i+1)
+		ps.LinkedTo = index + 1
+
+		staff := &ScoreStaff{}
+		if err := cloneXML(s.Staffs[index], staff); err != nil {
+			return nil, fmt.Errorf("NewExcerpt: %w", err)
+		}
+		staff.ID = ps.ID
+		staff.VBox = nil
+		e.Staffs = append(e.Staffs, staff)
+	}
+
+	if len(e.Staffs) > 0 && len(s.Staffs) > 0 {
+		vbox := &VBox{Height: "10"}
+		if first := s.Staffs[0].VBox; first != nil {
+			if err := cloneXML(first, vbox); err != nil {
+				return nil, fmt.Errorf("NewExcerpt: %w", err)
+			}
+			vbox.Image = nil
+		}
+		vbox.Text = append(vbox.Text, TextElement{Style: InstrumentExcerpt, Text: []byte(name)})
+		e.Staffs[0].VBox = vbox
+	}
+
+	if _, err := e.CreateMultiMeasureRests(DefaultMinEmptyMeasures); err != nil {
+		return nil, fmt.Errorf("NewExcerpt: %w", err)
+	}
+
+	s.Excerpts = append(s.Excerpts, e)
+	return e, nil
+}
+
+// staffIndex returns the 0-based index of the staff with the given ID, or -1.
+func (s *Score) staffIndex(id string) int {
+	for i, staff := range s.Staffs {
+		if staff.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// cloneXML deep-copies src into dst by round-tripping through XML, which
+// preserves the custom element handling of the score types.
+func cloneXML(src, dst any) error {
+	b, err := xml.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(b, dst)
+}
@@ -0,0 +1,96 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewExcerpt(t *testing.T) {
+	sz, err := NewScore().Title("Duet").
+		AddInstrument("wind.flutes.flute").
+		AddMeasure("4/4").Note("C5", "whole").
+		AddInstrument("wind.reed.clarinet.bflat").
+		AddMeasure("").Note("D4", "whole").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sz.MuseScore.Score
+	score.Style.PageLayout = &PageLayout{PageHeight: 1683.36, PageWidth: 1190.88}
+
+	clarinet := score.Part[1]
+	excerpt, err := score.NewExcerpt(clarinet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := score.NewExcerpt(clarinet); err == nil {
+		t.Error("NewExcerpt of the same part twice did not fail")
+	}
+
+	if got := score.ExcerptByName(excerpt.Name); got != excerpt {
+		t.Errorf("ExcerptByName(%q) = %p, want %p", excerpt.Name, got, excerpt)
+	}
+	if got, want := len(excerpt.Staffs), 1; got != want {
+		t.Fatalf("excerpt has %v staves, want %v", got, want)
+	}
+	ps := excerpt.Part[0].Staff[0]
+	if ps.ID != "1" || ps.LinkedTo != 2 {
+		t.Errorf("excerpt part staff id=%v linkedTo=%v, want id=1 linkedTo=2", ps.ID, ps.LinkedTo)
+	}
+	if got := score.LinkedStaff(excerpt, "1"); got != score.Staffs[1] {
+		t.Errorf("LinkedStaff = staff %v, want staff 2", got.ID)
+	}
+	if got, want := excerpt.Part[0].Instrument.TransposeChromatic, clarinet.Instrument.TransposeChromatic; got != want || got == "" {
+		t.Errorf("excerpt transposeChromatic = %v, want %v", got, want)
+	}
+	if excerpt.Style.CreateMultiMeasureRests != 1 {
+		t.Error("excerpt does not create multi-measure rests")
+	}
+	if diff := cmp.Diff(score.Staffs[1].Measure, excerpt.Staffs[0].Measure); diff != "" {
+		t.Errorf("excerpt measures differ (-want +got):\n%s", diff)
+	}
+
+	// The excerpt must not share the style or title frame of the score.
+	score.Style.PageLayout.PageWidth = 1
+	score.Staffs[0].VBox.Text[0].Text[0] = 'X'
+	if got, want := excerpt.Style.PageLayout.PageWidth, 1190.88; got != want {
+		t.Errorf("excerpt page width = %v, want %v", got, want)
+	}
+	if got, want := string(excerpt.Staffs[0].VBox.Text[0].Text), "Duet"; got != want {
+		t.Errorf("excerpt title = %q, want %q", got, want)
+	}
+	score.Style.PageLayout.PageWidth = 1190.88
+	score.Staffs[0].VBox.Text[0].Text[0] = 'D'
+
+	// Round-trip through XML.
+	gotXML, err := sz.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := New(gotXML, nil)
+	if err != nil {
+		t.Fatalf("New: %v\n%s", err, gotXML)
+	}
+	if diff := cmp.Diff(sz, parsed); diff != "" {
+		t.Errorf("round trip differs (-want +got):\n%s", diff)
+	}
+}
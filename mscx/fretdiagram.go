@@ -0,0 +1,403 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed chordshapes.txt
+var chordShapesTxt []byte
+
+// DefaultFretDiagramFrets is the number of frets shown by a new diagram.
+const DefaultFretDiagramFrets = 5
+
+// chordIntervals are the semitones above the root of each supported
+// MuseScore chord name.
+var chordIntervals = map[string][]int{
+	"":     {0, 4, 7},
+	"m":    {0, 3, 7},
+	"7":    {0, 4, 7, 10},
+	"m7":   {0, 3, 7, 10},
+	"maj7": {0, 4, 7, 11},
+	"sus2": {0, 2, 7},
+	"sus4": {0, 5, 7},
+	"6":    {0, 4, 7, 9},
+	"m6":   {0, 3, 7, 9},
+	"dim":  {0, 3, 6},
+	"aug":  {0, 4, 8},
+	"9":    {0, 2, 4, 7, 10},
+}
+
+var (
+	fretDotTypes    = map[string]bool{"": true, "normal": true, "cross": true, "square": true, "triangle": true}
+	fretMarkerTypes = map[string]bool{"": true, "circle": true, "cross": true}
+)
+
+// chordShape is an entry of the embedded chord-shape dictionary.
+type chordShape struct {
+	root    int // pitch class
+	name    string
+	frets   []int // -1 for a muted string
+	movable bool
+}
+
+type chordShapeTuning struct {
+	strings []int
+	shapes  []*chordShape
+}
+
+var (
+	chordShapesOnce sync.Once
+	chordShapes     []*chordShapeTuning
+)
+
+func loadChordShapes() []*chordShapeTuning {
+	chordShapesOnce.Do(func() {
+		var err error
+		if chordShapes, err = parseChordShapes(chordShapesTxt); err != nil {
+			panic(fmt.Sprintf("unable to parse embedded chordshapes.txt: %v", err))
+		}
+	})
+	return chordShapes
+}
+
+func parseChordShapes(buf []byte) ([]*chordShapeTuning, error) {
+	var result []*chordShapeTuning
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "tuning" {
+			t := &chordShapeTuning{}
+			for _, f := range fields[1:] {
+				pitch, err := strconv.Atoi(f)
+				if err != nil {
+					return nil, fmt.Errorf("line %v: %w", lineNum, err)
+				}
+				t.strings = append(t.strings, pitch)
+			}
+			result = append(result, t)
+			continue
+		}
+		if len(result) == 0 || len(fields) < 2 {
+			return nil, fmt.Errorf("line %v: unexpected %q", lineNum, scanner.Text())
+		}
+		t := result[len(result)-1]
+		root, name, err := parseChordSymbol(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", lineNum, err)
+		}
+		if len(fields[1]) != len(t.strings) {
+			return nil, fmt.Errorf("line %v: %v frets for %v strings", lineNum, len(fields[1]), len(t.strings))
+		}
+		shape := &chordShape{root: tpcPitchClass(root), name: name, movable: len(fields) > 2 && fields[2] == "movable"}
+		for _, c := range fields[1] {
+			switch {
+			case c == 'x':
+				shape.frets = append(shape.frets, -1)
+			case c >= '0' && c <= '9':
+				shape.frets = append(shape.frets, int(c-'0'))
+			default:
+				return nil, fmt.Errorf("line %v: bad fret %q", lineNum, c)
+			}
+		}
+		t.shapes = append(t.shapes, shape)
+	}
+	return result, scanner.Err()
+}
+
+// parseChordSymbol splits a chord symbol such as "F#m7" into the TPC of
+// its root and its MuseScore chord name.
+func parseChordSymbol(s string) (root int, name string, err error) {
+	n := 1
+	for n < len(s) && (s[n] == '#' || s[n] == 'b') {
+		n++
+	}
+	if _, root, err = ParsePitch(s[:n] + "4"); err != nil {
+		return 0, "", fmt.Errorf("parseChordSymbol(%q): %w", s, err)
+	}
+	return root, s[n:], nil
+}
+
+// sameTuning reports whether the open strings are identical.
+func sameTuning(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// FretDiagramFor returns a fret diagram for the chord symbol, using the
+// embedded chord-shape dictionary for the instrument's tuning. Open chords
+// are preferred; otherwise the movable shape with the lowest position is
+// shifted up the neck. The diagram holds a copy of the chord symbol.
+func FretDiagramFor(sd *StringData, h *Harmony) (*FretDiagram, error) {
+	if h == nil || h.Root == nil {
+		return nil, fmt.Errorf("FretDiagramFor: missing chord symbol root")
+	}
+	var tuning *chordShapeTuning
+	for _, t := range loadChordShapes() {
+		if sameTuning(t.strings, sd.String) {
+			tuning = t
+		}
+	}
+	if tuning == nil {
+		return nil, fmt.Errorf("FretDiagramFor: no chord shapes for tuning %v", sd.String)
+	}
+
+	pc := tpcPitchClass(*h.Root)
+	var frets []int
+	var barre int
+	for _, shape := range tuning.shapes {
+		if shape.name != h.Name {
+			continue
+		}
+		shift := ((pc-shape.root)%12 + 12) % 12
+		if shift != 0 && !shape.movable {
+			continue
+		}
+		if frets != nil && (shift >= barre || barre == 0) {
+			continue
+		}
+		frets, barre = make([]int, len(shape.frets)), shift
+		for i, f := range shape.frets {
+			if frets[i] = f; f >= 0 {
+				frets[i] += shift
+			}
+		}
+	}
+	if frets == nil {
+		return nil, fmt.Errorf("FretDiagramFor: no chord shape for %v%v", TPCName(*h.Root), h.Name)
+	}
+
+	harmony := *h
+	fd := &FretDiagram{Strings: len(frets), Frets: DefaultFretDiagramFrets, Diagram: &FretDiagramData{}, Harmony: &harmony}
+	maxFret := 0
+	for _, f := range frets {
+		if f > maxFret {
+			maxFret = f
+		}
+	}
+	if maxFret > DefaultFretDiagramFrets {
+		fd.FretOffset = barre - 1
+	}
+
+	// The barre covers every string from the first one fretted at the barre.
+	barreStart, barreEnd := -1, -1
+	if barre > 0 {
+		for i, f := range frets {
+			if f == barre && barreStart < 0 {
+				barreStart = i
+			}
+			if f >= 0 && barreStart >= 0 {
+				barreEnd = i
+			}
+		}
+		fd.Diagram.Barre = append(fd.Diagram.Barre, &FretBarre{Start: barreStart, End: barreEnd, Fret: barre - fd.FretOffset})
+	}
+
+	for i, f := range frets {
+		fs := &FretString{No: i}
+		switch {
+		case f < 0:
+			fs.Marker = "cross"
+		case f == 0:
+			fs.Marker = "circle"
+		case f == barre && i >= barreStart && i <= barreEnd:
+			continue
+		default:
+			fs.Dot = append(fs.Dot, &FretDot{Fret: f - fd.FretOffset, Type: "normal"})
+		}
+		fd.Diagram.String = append(fd.Diagram.String, fs)
+	}
+	return fd, nil
+}
+
+// Pitches returns the MIDI pitch sounded by each string of the diagram for
+// the given tuning, or -1 for a muted string. A string without a marker,
+// dot or barre is considered open.
+func (fd *FretDiagram) Pitches(sd *StringData) []int {
+	result := make([]int, len(sd.String))
+	frets := make([]int, len(sd.String))
+	if fd.Diagram != nil {
+		for _, b := range fd.Diagram.Barre {
+			end := b.End
+			if end < 0 {
+				end = len(frets) - 1
+			}
+			for i := b.Start; i <= end && i < len(frets); i++ {
+				if i >= 0 && b.Fret > frets[i] {
+					frets[i] = b.Fret
+				}
+			}
+		}
+		for _, fs := range fd.Diagram.String {
+			if fs.No < 0 || fs.No >= len(frets) {
+				continue
+			}
+			if fs.Marker == "cross" {
+				frets[fs.No] = -1
+				continue
+			}
+			for _, d := range fs.Dot {
+				if d.Fret > frets[fs.No] {
+					frets[fs.No] = d.Fret
+				}
+			}
+		}
+	}
+	for i, f := range frets {
+		switch {
+		case f < 0:
+			result[i] = -1
+		case f == 0:
+			result[i] = sd.String[i]
+		default:
+			result[i] = sd.String[i] + fd.FretOffset + f
+		}
+	}
+	return result
+}
+
+// Validate checks that the diagram can be played on an instrument with
+// the given tuning and, if it has a chord symbol with a known chord name,
+// that every string sounds a note of that chord.
+func (fd *FretDiagram) Validate(sd *StringData) error {
+	n := len(sd.String)
+	if fd.Strings != 0 && fd.Strings != n {
+		return fmt.Errorf("FretDiagram.Validate: diagram has %v strings, instrument has %v", fd.Strings, n)
+	}
+	frets := fd.Frets
+	if frets == 0 {
+		frets = DefaultFretDiagramFrets
+	}
+	checkFret := func(fret int) error {
+		if fret < 1 || fret > frets {
+			return fmt.Errorf("FretDiagram.Validate: fret %v is outside the diagram (1-%v)", fret, frets)
+		}
+		if sd.Frets > 0 && fd.FretOffset+fret > sd.Frets {
+			return fmt.Errorf("FretDiagram.Validate: fret %v is beyond the instrument's %v frets", fd.FretOffset+fret, sd.Frets)
+		}
+		return nil
+	}
+
+	if fd.Diagram != nil {
+		for _, fs := range fd.Diagram.String {
+			if fs.No < 0 || fs.No >= n {
+				return fmt.Errorf("FretDiagram.Validate: string %v does not exist", fs.No)
+			}
+			if !fretMarkerTypes[fs.Marker] {
+				return fmt.Errorf("FretDiagram.Validate: string %v: unknown marker %q", fs.No, fs.Marker)
+			}
+			for _, d := range fs.Dot {
+				if !fretDotTypes[d.Type] {
+					return fmt.Errorf("FretDiagram.Validate: string %v: unknown dot %q", fs.No, d.Type)
+				}
+				if err := checkFret(d.Fret); err != nil {
+					return err
+				}
+			}
+		}
+		for _, b := range fd.Diagram.Barre {
+			if b.Start < 0 || b.Start >= n || b.End >= n || (b.End >= 0 && b.End < b.Start) {
+				return fmt.Errorf("FretDiagram.Validate: barre from string %v to %v is invalid", b.Start, b.End)
+			}
+			if err := checkFret(b.Fret); err != nil {
+				return err
+			}
+		}
+	}
+
+	if fd.Harmony == nil || fd.Harmony.Root == nil {
+		return nil
+	}
+	intervals, ok := chordIntervals[fd.Harmony.Name]
+	if !ok {
+		return nil
+	}
+	inChord := map[int]bool{}
+	root := tpcPitchClass(*fd.Harmony.Root)
+	for _, iv := range intervals {
+		inChord[(root+iv)%12] = true
+	}
+	if fd.Harmony.Base != nil {
+		inChord[tpcPitchClass(*fd.Harmony.Base)] = true
+	}
+	for i, pitch := range fd.Pitches(sd) {
+		if pitch >= 0 && !inChord[pitch%12] {
+			return fmt.Errorf("FretDiagram.Validate: string %v sounds %v, which is not in %v%v", i, PitchName(pitch, DefaultTPC(pitch)), TPCName(*fd.Harmony.Root), fd.Harmony.Name)
+		}
+	}
+	return nil
+}
+
+// AddFretDiagrams replaces every chord symbol on the staves of the given
+// part with a fret diagram for the part's instrument that contains the
+// chord symbol. Chord symbols that have no shape in the dictionary are
+// left unchanged. It returns the number of diagrams added.
+func (s *Score) AddFretDiagrams(part *Part) (int, error) {
+	if part.Instrument == nil || part.Instrument.StringData == nil || len(part.Instrument.StringData.String) == 0 {
+		return 0, fmt.Errorf("Score.AddFretDiagrams: part %q has no string data", part.TrackName)
+	}
+	sd := part.Instrument.StringData
+
+	replace := func(elements []any) int {
+		var count int
+		for i, el := range elements {
+			h, ok := el.(*Harmony)
+			if !ok || h.HarmonyType != HarmonyStandard || h.Root == nil {
+				continue
+			}
+			fd, err := FretDiagramFor(sd, h)
+			if err != nil {
+				continue
+			}
+			elements[i] = fd
+			count++
+		}
+		return count
+	}
+
+	var count int
+	for _, ps := range part.Staff {
+		index := s.staffIndex(ps.ID)
+		if index < 0 {
+			return 0, fmt.Errorf("Score.AddFretDiagrams: part staff %v not found in score", ps.ID)
+		}
+		for _, m := range s.Staffs[index].Measure {
+			for _, v := range m.Voice {
+				count += replace(v.TimedElements)
+			}
+			count += replace(m.TimedElements)
+		}
+	}
+	return count, nil
+}
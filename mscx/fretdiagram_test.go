@@ -0,0 +1,173 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// shapeString returns the frets of the diagram, e.g. "x32010".
+func shapeString(fd *FretDiagram, sd *StringData) string {
+	var parts []string
+	for i, p := range fd.Pitches(sd) {
+		if p < 0 {
+			parts = append(parts, "x")
+		} else {
+			parts = append(parts, fmt.Sprintf("%v", p-sd.String[i]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestFretDiagramFor(t *testing.T) {
+	guitar, _ := LookupInstrument("pluck.guitar.steel")
+	ukulele, _ := LookupInstrument("pluck.ukulele")
+
+	tests := []struct {
+		sd     *StringData
+		symbol string
+		want   string
+		offset int
+		barre  *FretBarre
+	}{
+		{sd: guitar.StringData, symbol: "C", want: "x 3 2 0 1 0"},
+		{sd: guitar.StringData, symbol: "Em7", want: "0 2 0 0 0 0"},
+		{sd: guitar.StringData, symbol: "F", want: "1 3 3 2 1 1", barre: &FretBarre{Start: 0, End: 5, Fret: 1}},
+		{sd: guitar.StringData, symbol: "Bm", want: "x 2 4 4 3 2", barre: &FretBarre{Start: 1, End: 5, Fret: 2}},
+		{sd: guitar.StringData, symbol: "Ebmaj7", want: "x 6 8 7 8 6", offset: 5, barre: &FretBarre{Start: 1, End: 5, Fret: 1}},
+		{sd: ukulele.StringData, symbol: "Bb", want: "3 2 1 1", barre: &FretBarre{Start: 2, End: 3, Fret: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			root, name, err := parseChordSymbol(tt.symbol)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fd, err := FretDiagramFor(tt.sd, &Harmony{Root: &root, Name: name})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := shapeString(fd, tt.sd); got != tt.want {
+				t.Errorf("FretDiagramFor = %v, want %v", got, tt.want)
+			}
+			if fd.FretOffset != tt.offset {
+				t.Errorf("FretOffset = %v, want %v", fd.FretOffset, tt.offset)
+			}
+			var barre *FretBarre
+			if len(fd.Diagram.Barre) > 0 {
+				barre = fd.Diagram.Barre[0]
+			}
+			if diff := cmp.Diff(tt.barre, barre); diff != "" {
+				t.Errorf("barre differs (-want +got):\n%s", diff)
+			}
+			if err := fd.Validate(tt.sd); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestFretDiagram_Validate(t *testing.T) {
+	guitar, _ := LookupInstrument("pluck.guitar.steel")
+	sd := guitar.StringData
+	root := 14 // C
+
+	tests := []struct {
+		name string
+		fd   *FretDiagram
+	}{
+		{
+			name: "wrong number of strings",
+			fd:   &FretDiagram{Strings: 4},
+		},
+		{
+			name: "fret outside diagram",
+			fd:   &FretDiagram{Diagram: &FretDiagramData{String: []*FretString{{No: 1, Dot: []*FretDot{{Fret: 6}}}}}},
+		},
+		{
+			name: "beyond the neck",
+			fd:   &FretDiagram{FretOffset: 18, Diagram: &FretDiagramData{String: []*FretString{{No: 1, Dot: []*FretDot{{Fret: 3}}}}}},
+		},
+		{
+			name: "missing string",
+			fd:   &FretDiagram{Diagram: &FretDiagramData{String: []*FretString{{No: 6, Marker: "circle"}}}},
+		},
+		{
+			name: "wrong note",
+			fd: &FretDiagram{
+				Diagram: &FretDiagramData{String: []*FretString{{No: 0, Marker: "cross"}, {No: 1, Dot: []*FretDot{{Fret: 2}}}}},
+				Harmony: &Harmony{Root: &root},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fd.Validate(sd); err == nil {
+				t.Error("Validate did not fail")
+			}
+		})
+	}
+}
+
+func TestAddFretDiagrams(t *testing.T) {
+	sz, err := NewScore().AddInstrument("pluck.guitar.steel").
+		AddMeasure("4/4").Chord([]string{"C3", "E3", "G3"}, "half").Chord([]string{"G2", "B2", "D3"}, "half").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sz.MuseScore.Score
+	c, g := 14, 15
+	v := score.Staffs[0].Measure[0].Voice[0]
+	v.TimedElements = []any{&Harmony{Root: &c}, v.TimedElements[0], &Harmony{Root: &g, Name: "7"}, v.TimedElements[1]}
+
+	n, err := score.AddFretDiagrams(score.Part[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("AddFretDiagrams = %v, want 2", n)
+	}
+	fd, ok := v.TimedElements[2].(*FretDiagram)
+	if !ok {
+		t.Fatalf("element 2 is %T, want *FretDiagram", v.TimedElements[2])
+	}
+	if got, want := shapeString(fd, score.Part[0].Instrument.StringData), "3 2 0 0 0 1"; got != want {
+		t.Errorf("G7 diagram = %v, want %v", got, want)
+	}
+
+	// Round-trip through XML.
+	gotXML, err := sz.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := New(gotXML, nil)
+	if err != nil {
+		t.Fatalf("New: %v\n%s", err, gotXML)
+	}
+	if diff := cmp.Diff(sz, parsed); diff != "" {
+		t.Errorf("round trip differs (-want +got):\n%s", diff)
+	}
+}
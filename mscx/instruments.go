@@ -0,0 +1,307 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	_ "embed"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// instrumentsXML is a subset of MuseScore 3's share/instruments/instruments.xml,
+// which has about 400 templates: the 34 most common orchestral, band,
+// keyboard, vocal, fretted and percussion instruments.
+//
+//go:embed instruments.xml
+var instrumentsXML []byte
+
+// ErrUnknownInstrument reports an instrument ID that is not in the
+// embedded catalog. The catalog holds only a subset of MuseScore's
+// instrument templates (see InstrumentTemplates), so an ID that MuseScore
+// knows may still be unknown here.
+var ErrUnknownInstrument = errors.New("unknown instrument")
+
+// InstrumentTemplate represents an entry of MuseScore's instruments.xml,
+// from which the Instrument of a new Part is created.
+type InstrumentTemplate struct {
+	// ID is the MuseScore template ID, e.g. "flute".
+	ID string `xml:"id,attr"`
+	// Group is the ID of the enclosing InstrumentGroup, e.g. "woodwinds".
+	Group string `xml:"-"`
+
+	Family      string `xml:"family"`
+	Description string `xml:"description"`
+	// MusicXMLID is the ID stored in Instrument.InstrumentID, e.g. "wind.flutes.flute".
+	MusicXMLID         string      `xml:"musicXMLid"`
+	LongName           string      `xml:"longName"`
+	ShortName          string      `xml:"shortName"`
+	TrackName          string      `xml:"trackName"`
+	Staves             int         `xml:"staves"`
+	StaffTypeGroup     string      `xml:"stafftype"`
+	Clefs              []*Clef     `xml:"clef"`
+	APitchRange        string      `xml:"aPitchRange"`
+	PPitchRange        string      `xml:"pPitchRange"`
+	TransposeDiatonic  int         `xml:"transposeDiatonic"`
+	TransposeChromatic int         `xml:"transposeChromatic"`
+	Drumset            int         `xml:"drumset"`
+	Drum               []*Drum     `xml:"Drum"`
+	StringData         *StringData `xml:"StringData"`
+	Channel            []*Channel  `xml:"Channel"`
+}
+
+type instrumentGroup struct {
+	ID         string                `xml:"id,attr"`
+	Name       string                `xml:"name"`
+	Instrument []*InstrumentTemplate `xml:"Instrument"`
+}
+
+type instrumentCatalog struct {
+	Group []*instrumentGroup `xml:"InstrumentGroup"`
+}
+
+var (
+	catalogOnce sync.Once
+	catalog     []*InstrumentTemplate
+)
+
+// defaultArticulations are the articulation playback settings written by
+// MuseScore 3 for every instrument.
+var defaultArticulations = []*ArticulationElement{
+	{Velocity: "100", GateTime: "95"},
+	{Name: "staccatissimo", Velocity: "100", GateTime: "33"},
+	{Name: "staccato", Velocity: "100", GateTime: "50"},
+	{Name: "portato", Velocity: "100", GateTime: "67"},
+	{Name: "tenuto", Velocity: "100", GateTime: "100"},
+	{Name: "marcato", Velocity: "120", GateTime: "67"},
+	{Name: "sforzato", Velocity: "150", GateTime: "100"},
+	{Name: "sforzatoStaccato", Velocity: "150", GateTime: "50"},
+	{Name: "marcatoStaccato", Velocity: "120", GateTime: "50"},
+	{Name: "marcatoTenuto", Velocity: "120", GateTime: "100"},
+}
+
+// InstrumentTemplates returns the embedded catalog of standard MuseScore
+// instruments in catalog order. The returned templates must not be modified.
+//
+// The catalog is a subset of MuseScore's: piccolo, flute, oboe, english
+// horn, clarinets, bassoon, saxophones, horn, trumpet, trombones, tuba,
+// piano, harpsichord, celesta, the SATB and baritone voices, guitars,
+// basses, ukulele, harp, the string family and drumset.
+func InstrumentTemplates() []*InstrumentTemplate {
+	catalogOnce.Do(func() {
+		var c instrumentCatalog
+		if err := xml.Unmarshal(instrumentsXML, &c); err != nil {
+			panic(fmt.Sprintf("unable to parse embedded instruments.xml: %v", err))
+		}
+		for _, g := range c.Group {
+			for _, t := range g.Instrument {
+				t.Group = g.ID
+				catalog = append(catalog, t)
+			}
+		}
+	})
+	return catalog
+}
+
+// LookupInstrument returns the template whose MusicXMLID (e.g.
+// "wind.flutes.flute") or template ID (e.g. "flute") matches id. It
+// reports false for instruments missing from the embedded catalog.
+func LookupInstrument(id string) (*InstrumentTemplate, bool) {
+	for _, t := range InstrumentTemplates() {
+		if t.MusicXMLID == id || t.ID == id {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// IdentifyInstrument returns the template that the part was most likely
+// created from, matching first on Instrument.InstrumentID and then on the
+// instrument and track names.
+func IdentifyInstrument(part *Part) (*InstrumentTemplate, bool) {
+	if part == nil {
+		return nil, false
+	}
+
+	var names []string
+	if inst := part.Instrument; inst != nil {
+		names = append(names, inst.LongName, inst.TrackName)
+	}
+	names = append(names, part.TrackName)
+	matchesName := func(t *InstrumentTemplate) bool {
+		for _, name := range names {
+			if name != "" && (strings.EqualFold(name, t.LongName) || strings.EqualFold(name, t.TrackName)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if inst := part.Instrument; inst != nil && inst.InstrumentID != "" {
+		var candidates []*InstrumentTemplate
+		for _, t := range InstrumentTemplates() {
+			if t.MusicXMLID == inst.InstrumentID {
+				candidates = append(candidates, t)
+			}
+		}
+		for _, t := range candidates {
+			if matchesName(t) {
+				return t, true
+			}
+		}
+		if len(candidates) > 0 {
+			return candidates[0], true
+		}
+	}
+
+	for _, t := range InstrumentTemplates() {
+		if matchesName(t) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// NumStaves returns the number of staves used by the instrument.
+func (t *InstrumentTemplate) NumStaves() int {
+	if t.Staves < 1 {
+		return 1
+	}
+	return t.Staves
+}
+
+// Clef returns the clef (e.g. "G", "F", "C3") of the given 1-based staff.
+func (t *InstrumentTemplate) Clef(staff int) string {
+	for _, c := range t.Clefs {
+		n := 1
+		if c.Staff != "" {
+			fmt.Sscanf(c.Staff, "%d", &n)
+		}
+		if n == staff {
+			return c.Text
+		}
+	}
+	return "G"
+}
+
+// Instrument returns a new, fully populated Instrument for this template.
+func (t *InstrumentTemplate) Instrument() *Instrument {
+	trackName := t.TrackName
+	if trackName == "" {
+		trackName = t.LongName
+	}
+
+	inst := &Instrument{
+		LongName:     t.LongName,
+		ShortName:    t.ShortName,
+		TrackName:    trackName,
+		InstrumentID: t.MusicXMLID,
+		UseDrumset:   t.Drumset,
+	}
+	inst.MinPitchA, inst.MaxPitchA = splitPitchRange(t.APitchRange)
+	inst.MinPitchP, inst.MaxPitchP = splitPitchRange(t.PPitchRange)
+	if t.TransposeDiatonic != 0 || t.TransposeChromatic != 0 {
+		inst.TransposeDiatonic = fmt.Sprintf("%v", t.TransposeDiatonic)
+		inst.TransposeChromatic = fmt.Sprintf("%v", t.TransposeChromatic)
+	}
+
+	for _, d := range t.Drum {
+		drum := *d
+		inst.Drum = append(inst.Drum, &drum)
+	}
+
+	// Instrument only records a single non-treble clef (see Part.Staff for the rest).
+	for staff := 1; staff <= t.NumStaves(); staff++ {
+		if clef := t.Clef(staff); clef != "G" {
+			inst.Clef = &Clef{Text: clef}
+			if staff > 1 {
+				inst.Clef.Staff = fmt.Sprintf("%v", staff)
+			}
+			break
+		}
+	}
+
+	if t.StringData != nil {
+		inst.StringData = &StringData{
+			Frets:  t.StringData.Frets,
+			String: append([]int(nil), t.StringData.String...),
+		}
+	}
+
+	for _, a := range defaultArticulations {
+		art := *a
+		inst.Articulation = append(inst.Articulation, &art)
+	}
+
+	for _, c := range t.Channel {
+		ch := &Channel{Name: c.Name, Synti: c.Synti, Mute: c.Mute}
+		if ch.Synti == "" {
+			ch.Synti = "Fluid"
+		}
+		for _, el := range c.ChannelElements {
+			if ctrl, ok := el.(*Controller); ok {
+				v := *ctrl
+				el = &v
+			}
+			ch.ChannelElements = append(ch.ChannelElements, el)
+		}
+		inst.Channel = append(inst.Channel, ch)
+	}
+
+	return inst
+}
+
+// NewPart returns a new Part for this template whose staves are numbered
+// consecutively starting at firstStaffID.
+func (t *InstrumentTemplate) NewPart(firstStaffID int) *Part {
+	part := &Part{
+		TrackName:  t.Instrument().TrackName,
+		Instrument: t.Instrument(),
+	}
+
+	staffType := StaffType{Group: "pitched", Name: "stdNormal"}
+	if t.StaffTypeGroup == "percussion" {
+		staffType = StaffType{Group: "percussion", Name: "perc5Line"}
+	}
+
+	for staff := 1; staff <= t.NumStaves(); staff++ {
+		ps := &PartStaff{
+			ID:        fmt.Sprintf("%v", firstStaffID+staff-1),
+			StaffType: staffType,
+		}
+		if staff == 1 && t.NumStaves() > 1 {
+			ps.StaffElements = append(ps.StaffElements, &Bracket{Type: 1, Span: t.NumStaves(), Col: "0"}, BarLineSpan(1))
+		}
+		if clef := t.Clef(staff); clef != "G" {
+			ps.StaffElements = append(ps.StaffElements, &DefaultClef{Value: clef})
+		}
+		part.Staff = append(part.Staff, ps)
+	}
+
+	return part
+}
+
+// splitPitchRange splits a MuseScore pitch range such as "60-93".
+func splitPitchRange(s string) (min, max string) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
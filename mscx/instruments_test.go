@@ -0,0 +1,114 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLookupInstrument(t *testing.T) {
+	tmpl, ok := LookupInstrument("wind.flutes.flute")
+	if !ok {
+		t.Fatal("LookupInstrument(flute) not found")
+	}
+	got := tmpl.Instrument()
+	want := &Instrument{
+		LongName:     "Flute",
+		ShortName:    "Fl.",
+		TrackName:    "Flute",
+		MinPitchP:    "59",
+		MaxPitchP:    "98",
+		MinPitchA:    "60",
+		MaxPitchA:    "93",
+		InstrumentID: "wind.flutes.flute",
+		Articulation: defaultArticulations,
+		Channel: []*Channel{
+			{ChannelElements: []any{Program{Value: "73"}}, Synti: "Fluid"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("flute Instrument differs (-want +got):\n%s", diff)
+	}
+
+	drums, ok := LookupInstrument("drum.group.set")
+	if !ok {
+		t.Fatal("LookupInstrument(drumset) not found")
+	}
+	inst := drums.Instrument()
+	if inst.UseDrumset != 1 || len(inst.Drum) == 0 || inst.Clef == nil || inst.Clef.Text != "PERC" {
+		t.Errorf("drumset Instrument = %+v, want drumset with PERC clef", inst)
+	}
+
+	if _, ok := LookupInstrument("kazoo"); ok {
+		t.Error("LookupInstrument(kazoo) found, want not found")
+	}
+}
+
+func TestIdentifyInstrument(t *testing.T) {
+	got, ok := IdentifyInstrument(test01Data.MuseScore.Score.Part[0])
+	if !ok || got.ID != "piano" {
+		t.Errorf("IdentifyInstrument(test01 piano) = %v, %v; want piano", got, ok)
+	}
+
+	part := &Part{TrackName: "Alto", Instrument: &Instrument{InstrumentID: "voice.alto"}}
+	if got, ok := IdentifyInstrument(part); !ok || got.ID != "alto" {
+		t.Errorf("IdentifyInstrument(alto) = %v, %v; want alto", got, ok)
+	}
+}
+
+func TestScoreBuilder_AddInstrument(t *testing.T) {
+	got, err := NewScore().
+		AddInstrument("piano").AddMeasure("3/4").Note("E4", "half.").
+		Staff(2).AddMeasure("").Note("C3", "half.").
+		AddInstrument("drum.group.set").AddMeasure("").Note("C2", "quarter").
+		AddInstrument("pluck.guitar.nylon-string").AddMeasure("").Rest("quarter").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	score := got.MuseScore.Score
+	if len(score.Staffs) != 4 || len(score.Part) != 3 {
+		t.Fatalf("got %v staves, %v parts; want 4 staves, 3 parts", len(score.Staffs), len(score.Part))
+	}
+	if id := score.Part[2].Staff[0].ID; id != "4" {
+		t.Errorf("guitar staff ID = %q, want 4", id)
+	}
+
+	gotXML, err := got.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := New(gotXML, nil)
+	if err != nil {
+		t.Fatalf("New: %v\n%s", err, gotXML)
+	}
+	if diff := cmp.Diff(got, parsed); diff != "" {
+		t.Errorf("round trip differs (-want +got):\n%s", diff)
+	}
+
+	// An instrument missing from the embedded catalog is reported as such.
+	_, err = NewScore().AddInstrument("wind.reed.contrabassoon").AddMeasure("4/4").Build()
+	if !errors.Is(err, ErrUnknownInstrument) {
+		t.Errorf("AddInstrument(contrabassoon) error = %v, want ErrUnknownInstrument", err)
+	}
+}
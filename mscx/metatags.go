@@ -0,0 +1,219 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Names of the standard metaTags written by MuseScore 3.
+const (
+	MetaArranger       = "arranger"
+	MetaComposer       = "composer"
+	MetaCopyright      = "copyright"
+	MetaCreationDate   = "creationDate"
+	MetaLyricist       = "lyricist"
+	MetaMovementNumber = "movementNumber"
+	MetaMovementTitle  = "movementTitle"
+	MetaPlatform       = "platform"
+	MetaPoet           = "poet"
+	MetaSource         = "source"
+	MetaTranslator     = "translator"
+	MetaWorkNumber     = "workNumber"
+	MetaWorkTitle      = "workTitle"
+)
+
+// standardMetaTags are the metaTag names written by MuseScore 3 for every
+// new score, in the order MuseScore writes them.
+var standardMetaTags = []string{
+	MetaArranger,
+	MetaComposer,
+	MetaCopyright,
+	MetaCreationDate,
+	MetaLyricist,
+	MetaMovementNumber,
+	MetaMovementTitle,
+	MetaPlatform,
+	MetaPoet,
+	MetaSource,
+	MetaTranslator,
+	MetaWorkNumber,
+	MetaWorkTitle,
+}
+
+// Metadata holds the standard metaTags of a score.
+type Metadata struct {
+	Arranger       string
+	Composer       string
+	Copyright      string
+	CreationDate   string
+	Lyricist       string
+	MovementNumber string
+	MovementTitle  string
+	Platform       string
+	Poet           string
+	Source         string
+	Translator     string
+	WorkNumber     string
+	WorkTitle      string
+}
+
+// fields returns pointers to the fields of md keyed by metaTag name.
+func (md *Metadata) fields() map[string]*string {
+	return map[string]*string{
+		MetaArranger:       &md.Arranger,
+		MetaComposer:       &md.Composer,
+		MetaCopyright:      &md.Copyright,
+		MetaCreationDate:   &md.CreationDate,
+		MetaLyricist:       &md.Lyricist,
+		MetaMovementNumber: &md.MovementNumber,
+		MetaMovementTitle:  &md.MovementTitle,
+		MetaPlatform:       &md.Platform,
+		MetaPoet:           &md.Poet,
+		MetaSource:         &md.Source,
+		MetaTranslator:     &md.Translator,
+		MetaWorkNumber:     &md.WorkNumber,
+		MetaWorkTitle:      &md.WorkTitle,
+	}
+}
+
+// MetaTag returns the text of the named metaTag and whether the score
+// has it.
+func (s *Score) MetaTag(name string) (string, bool) {
+	for _, mt := range s.MetaTags {
+		if mt.Name == name {
+			return mt.Text, true
+		}
+	}
+	return "", false
+}
+
+// SetMetaTag sets the text of the named metaTag, adding it if needed.
+func (s *Score) SetMetaTag(name, text string) {
+	for _, mt := range s.MetaTags {
+		if mt.Name == name {
+			mt.Text = text
+			return
+		}
+	}
+	s.MetaTags = append(s.MetaTags, &MetaTag{Name: name, Text: text})
+}
+
+// DeleteMetaTag removes the named metaTag and reports whether the score
+// had it.
+func (s *Score) DeleteMetaTag(name string) bool {
+	for i, mt := range s.MetaTags {
+		if mt.Name == name {
+			s.MetaTags = append(s.MetaTags[:i], s.MetaTags[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Metadata returns the standard metaTags of the score.
+func (s *Score) Metadata() *Metadata {
+	md := &Metadata{}
+	for name, field := range md.fields() {
+		*field, _ = s.MetaTag(name)
+	}
+	return md
+}
+
+// SetMetadata sets all of the standard metaTags of the score. As in
+// MuseScore, empty values are kept as empty metaTags.
+func (s *Score) SetMetadata(md *Metadata) {
+	fields := md.fields()
+	for _, name := range standardMetaTags {
+		s.SetMetaTag(name, *fields[name])
+	}
+}
+
+// frameMetaTags maps the styles of title frame text to the metaTags that
+// MuseScore fills them from.
+var frameMetaTags = []struct {
+	style StyleEnum
+	name  string
+}{
+	{Title, MetaWorkTitle},
+	{Subtitle, MetaMovementTitle},
+	{Composer, MetaComposer},
+	{Lyricist, MetaLyricist},
+}
+
+// SyncTitleFrame updates the title, subtitle, composer and lyricist text of
+// the score's title frame from its metaTags, adding or removing text (and
+// adding the frame) as needed.
+func (s *Score) SyncTitleFrame() {
+	if len(s.Staffs) == 0 {
+		return
+	}
+	vbox := s.Staffs[0].VBox
+	for _, fm := range frameMetaTags {
+		text, _ := s.MetaTag(fm.name)
+		if vbox == nil {
+			if text == "" {
+				continue
+			}
+			vbox = &VBox{Height: "10"}
+			s.Staffs[0].VBox = vbox
+		}
+
+		index := -1
+		for i, te := range vbox.Text {
+			if te.Style == fm.style {
+				index = i
+				break
+			}
+		}
+		switch {
+		case index < 0 && text != "":
+			vbox.Text = append(vbox.Text, TextElement{Style: fm.style, Text: []byte(text)})
+		case index >= 0 && text == "":
+			vbox.Text = append(vbox.Text[:index], vbox.Text[index+1:]...)
+		case index >= 0 && frameText(vbox.Text[index].Text) != text:
+			vbox.Text[index].Text = []byte(text)
+		}
+	}
+}
+
+// SyncMetaTagsFromFrame updates the workTitle, movementTitle, composer and
+// lyricist metaTags from the text of the score's title frame. Formatting
+// within the text is discarded.
+func (s *Score) SyncMetaTagsFromFrame() {
+	if len(s.Staffs) == 0 || s.Staffs[0].VBox == nil {
+		return
+	}
+	for _, fm := range frameMetaTags {
+		for _, te := range s.Staffs[0].VBox.Text {
+			if te.Style == fm.style {
+				s.SetMetaTag(fm.name, frameText(te.Text))
+				break
+			}
+		}
+	}
+}
+
+// textMarkup matches the formatting tags within a text element.
+var textMarkup = regexp.MustCompile(`<[^>]*>`)
+
+// frameText returns the plain text of frame text, without formatting.
+func frameText(text []byte) string {
+	return strings.TrimSpace(html.UnescapeString(textMarkup.ReplaceAllString(string(text), "")))
+}
@@ -0,0 +1,127 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetadata(t *testing.T) {
+	sz, err := New(test01, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sz.MuseScore.Score
+
+	got := score.Metadata()
+	want := &Metadata{
+		Composer:     "Charles Wesley",
+		Copyright:    "1964, 1966 Board of Publication of The Methodist Church, Inc.",
+		CreationDate: "2022-06-19",
+		Platform:     "Linux",
+		WorkTitle:    "O For a Thousand Tongues to Sing",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Metadata mismatch (-want +got):\n%v", diff)
+	}
+
+	got.Arranger = "G. M. Lewis"
+	got.Copyright = "Public Domain"
+	got.Platform = ""
+	score.SetMetadata(got)
+	if v, ok := score.MetaTag(MetaArranger); !ok || v != "G. M. Lewis" {
+		t.Errorf("MetaTag(arranger) = %q, %v", v, ok)
+	}
+	if diff := cmp.Diff(got, score.Metadata()); diff != "" {
+		t.Errorf("SetMetadata round trip mismatch (-want +got):\n%v", diff)
+	}
+
+	score.SetMetaTag("hymnNumber", "1")
+	if v, _ := score.MetaTag("hymnNumber"); v != "1" {
+		t.Errorf("MetaTag(hymnNumber) = %q, want 1", v)
+	}
+	if !score.DeleteMetaTag("hymnNumber") || score.DeleteMetaTag("hymnNumber") {
+		t.Error("DeleteMetaTag did not delete exactly once")
+	}
+	if _, ok := score.MetaTag("hymnNumber"); ok {
+		t.Error("MetaTag(hymnNumber) found after delete")
+	}
+
+	// The tags survive a round trip through XML.
+	buf, err := sz.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := New(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, parsed.MuseScore.Score.Metadata()); diff != "" {
+		t.Errorf("XML round trip mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestSyncTitleFrame(t *testing.T) {
+	sz, err := NewScore().
+		Title("Old Title").
+		AddPart("Flute").
+		AddMeasure("4/4").Note("C5", "whole").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sz.MuseScore.Score
+
+	score.SetMetaTag(MetaWorkTitle, "Holy, Holy, Holy")
+	score.SetMetaTag(MetaComposer, "John B. Dykes")
+	score.SetMetaTag(MetaLyricist, "Reginald Heber")
+	score.SyncTitleFrame()
+	want := []TextElement{
+		{Style: Title, Text: []byte("Holy, Holy, Holy")},
+		{Style: Composer, Text: []byte("John B. Dykes")},
+		{Style: Lyricist, Text: []byte("Reginald Heber")},
+	}
+	if diff := cmp.Diff(want, score.Staffs[0].VBox.Text); diff != "" {
+		t.Errorf("SyncTitleFrame mismatch (-want +got):\n%v", diff)
+	}
+
+	score.SetMetaTag(MetaLyricist, "")
+	score.SyncTitleFrame()
+	if diff := cmp.Diff(want[:2], score.Staffs[0].VBox.Text); diff != "" {
+		t.Errorf("SyncTitleFrame after clearing lyricist mismatch (-want +got):\n%v", diff)
+	}
+
+	score.Staffs[0].VBox.Text[0].Text = []byte("<b>Nicaea</b> &amp; more")
+	score.SyncMetaTagsFromFrame()
+	if v, _ := score.MetaTag(MetaWorkTitle); v != "Nicaea & more" {
+		t.Errorf("workTitle = %q, want %q", v, "Nicaea & more")
+	}
+	if v, _ := score.MetaTag(MetaComposer); v != "John B. Dykes" {
+		t.Errorf("composer = %q, want %q", v, "John B. Dykes")
+	}
+
+	// A score without a title frame gains one.
+	score.Staffs[0].VBox = nil
+	score.SyncTitleFrame()
+	if vbox := score.Staffs[0].VBox; vbox == nil || len(vbox.Text) != 2 {
+		t.Errorf("SyncTitleFrame without frame = %+v, want 2 texts", vbox)
+	}
+}
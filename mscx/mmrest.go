@@ -0,0 +1,183 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import "fmt"
+
+// DefaultMinEmptyMeasures is MuseScore's default minimum number of
+// consecutive empty measures that are collapsed into a multi-measure rest.
+const DefaultMinEmptyMeasures = 2
+
+// MeasureRange is a span of consecutive measures.
+type MeasureRange struct {
+	// Start is the 1-based index of the first measure.
+	Start int
+	// Count is the number of measures in the span.
+	Count int
+}
+
+// measureInfo summarizes one measure across all staves of a score.
+type measureInfo struct {
+	empty       bool
+	breakBefore bool
+	breakAfter  bool
+}
+
+// MultiMeasureRests returns the spans of at least minCount consecutive
+// measures in which every voice of every staff holds only full-measure
+// rests. A span never continues across a rehearsal mark, key or time
+// signature change, tempo change, repeat sign, or double or final barline.
+// A minCount less than 1 means DefaultMinEmptyMeasures.
+func (s *Score) MultiMeasureRests(minCount int) ([]MeasureRange, error) {
+	if len(s.Staffs) == 0 {
+		return nil, nil
+	}
+	if minCount < 1 {
+		minCount = DefaultMinEmptyMeasures
+	}
+
+	infos := make([]measureInfo, len(s.Staffs[0].Measure))
+	for i := range infos {
+		infos[i].empty = true
+	}
+
+	for _, staff := range s.Staffs {
+		prevFifths, prevTimeSig := 0, ""
+		for i, m := range staff.Measure {
+			if i >= len(infos) {
+				break
+			}
+			info := &infos[i]
+			if m.Len != "" || m.StartRepeat {
+				info.breakBefore = true
+			}
+			if m.EndRepeat != 0 {
+				info.breakAfter = true
+			}
+			keySig, timeSig := m.KeySig, m.TimeSig
+			if len(m.Voice) > 0 {
+				if v := m.Voice[0]; v.KeySig != nil {
+					keySig = v.KeySig
+				}
+				if v := m.Voice[0]; v.TimeSig != nil {
+					timeSig = v.TimeSig
+				}
+			}
+			if keySig != nil && keySig.Fifths() != prevFifths {
+				prevFifths = keySig.Fifths()
+				info.breakBefore = true
+			}
+			if timeSig != nil {
+				if sig := timeSig.SigN + "/" + timeSig.SigD; sig != prevTimeSig {
+					prevTimeSig = sig
+					info.breakBefore = true
+				}
+			}
+			if m.Tempo != nil {
+				info.breakBefore = true
+			}
+		}
+
+		err := s.WalkStaff(staff, func(ev *Event) error {
+			if ev.Measure > len(infos) {
+				return nil
+			}
+			info := &infos[ev.Measure-1]
+			switch el := ev.Element.(type) {
+			case *Rest:
+				if ev.MeasureTick != 0 {
+					info.empty = false
+					return nil
+				}
+				measureTicks, err := s.MeasureTicks(ev.Bar, ev.TimeSig)
+				if err != nil {
+					return err
+				}
+				if ev.Ticks != measureTicks {
+					info.empty = false
+				}
+			case *BarLine:
+				if el.Subtype == "double" || el.Subtype == "end" {
+					info.breakAfter = true
+				}
+			case *RehearsalMark, *Tempo:
+				info.breakBefore = true
+			case *Chord:
+				info.empty = false
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Score.MultiMeasureRests: %w", err)
+		}
+	}
+
+	var result []MeasureRange
+	flush := func(r MeasureRange) {
+		if r.Count >= minCount {
+			result = append(result, r)
+		}
+	}
+	var cur MeasureRange
+	for i, info := range infos {
+		if !info.empty || info.breakBefore {
+			flush(cur)
+			cur = MeasureRange{}
+		}
+		if info.empty {
+			if cur.Count == 0 {
+				cur.Start = i + 1
+			}
+			cur.Count++
+		}
+		if info.breakAfter {
+			flush(cur)
+			cur = MeasureRange{}
+		}
+	}
+	flush(cur)
+
+	return result, nil
+}
+
+// CreateMultiMeasureRests marks the first measure of every span found by
+// MultiMeasureRests in every staff with the length of its multi-measure
+// rest, clears any previous markings, and enables multi-measure rests in
+// the score's style. It returns the spans.
+func (s *Score) CreateMultiMeasureRests(minCount int) ([]MeasureRange, error) {
+	ranges, err := s.MultiMeasureRests(minCount)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, staff := range s.Staffs {
+		for _, m := range staff.Measure {
+			m.MultiMeasureRest = 0
+		}
+		for _, r := range ranges {
+			if r.Start <= len(staff.Measure) {
+				staff.Measure[r.Start-1].MultiMeasureRest = r.Count
+			}
+		}
+	}
+
+	if s.Style == nil {
+		s.Style = &Style{}
+	}
+	s.Style.CreateMultiMeasureRests = 1
+	return ranges, nil
+}
@@ -0,0 +1,73 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCreateMultiMeasureRests(t *testing.T) {
+	b := NewScore().AddPart("Horn").AddMeasure("4/4").Note("C4", "whole")
+	for i := 2; i <= 12; i++ {
+		b.AddMeasure("")
+	}
+	b.Rest("half").Note("E4", "half") // m.12
+	sz, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sz.MuseScore.Score
+	measures := score.Staffs[0].Measure
+
+	// m.5 begins with a rehearsal mark, m.7 ends with a double barline,
+	// m.9 changes key and m.11 stands alone.
+	v := measures[4].Voice[0]
+	v.TimedElements = append([]any{&RehearsalMark{Text: []byte("A")}}, v.TimedElements...)
+	v = measures[6].Voice[0]
+	v.TimedElements = append(v.TimedElements, &BarLine{Subtype: "double"})
+	measures[8].Voice[0].KeySig = &KeySig{Accidental: "2"}
+	measures[9].Voice[0].TimedElements = []any{&Rest{DurationType: "half"}, &Rest{DurationType: "half"}}
+
+	got, err := score.CreateMultiMeasureRests(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MeasureRange{{Start: 2, Count: 3}, {Start: 5, Count: 3}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CreateMultiMeasureRests differs (-want +got):\n%s", diff)
+	}
+	if n := measures[1].MultiMeasureRest; n != 3 {
+		t.Errorf("measure 2 multiMeasureRest = %v, want 3", n)
+	}
+
+	// Round-trip through XML.
+	gotXML, err := sz.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := New(gotXML, nil)
+	if err != nil {
+		t.Fatalf("New: %v\n%s", err, gotXML)
+	}
+	if diff := cmp.Diff(sz, parsed); diff != "" {
+		t.Errorf("round trip differs (-want +got):\n%s", diff)
+	}
+}
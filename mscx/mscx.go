@@ -25,7 +25,8 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
-	_ "image/png"
+	"image"
+	"image/png"
 	"io"
 	"log"
 	"os"
@@ -53,6 +54,45 @@ func New(buf []byte, callback CallbackFn) (*ScoreZip, error) {
 	return parseZip(buf, callback)
 }
 
+// ErrNotExact reports that a score would not be written back exactly as
+// it was read, e.g. because it uses elements that are not modeled by this
+// package. Rewriting such a score would lose those elements.
+var ErrNotExact = errors.New("score does not round-trip exactly")
+
+// NewFromFileExact is like NewFromFile but fails with ErrNotExact if the
+// score cannot be written back unchanged (see NewExact).
+func NewFromFileExact(filename string) (*ScoreZip, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewExact(b)
+}
+
+// NewExact is like New but fails with an error wrapping ErrNotExact if
+// rendering the parsed score with ScoreZip.XML does not reproduce the
+// `*.mscx` data byte for byte. Tools that rewrite files in place use it
+// to leave alone the scores that they would damage.
+func NewExact(buf []byte) (*ScoreZip, error) {
+	original := buf
+	sz, err := New(buf, func(filename string, content []byte) {
+		if strings.HasSuffix(filename, ".mscx") {
+			original = content
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	got, err := sz.XML()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(got, original) {
+		return nil, fmt.Errorf("NewExact: %w", ErrNotExact)
+	}
+	return sz, nil
+}
+
 const xmlStart = "<?xml "
 
 func parseXML(buf []byte) (*ScoreZip, error) {
@@ -69,7 +109,13 @@ func parseZip(buf []byte, callback CallbackFn) (*ScoreZip, error) {
 		return nil, fmt.Errorf("zip.NewReader: %w", err)
 	}
 
-	var result *ScoreZip
+	var (
+		result    *ScoreZip
+		rootFile  string
+		thumbnail image.Image
+		pictures  map[string][]byte
+		others    []*ArchiveFile
+	)
 	for _, fh := range r.File {
 		// log.Printf("fh.Name=%v", fh.Name)
 		if fh.FileInfo().IsDir() {
@@ -91,7 +137,21 @@ func parseZip(buf []byte, callback CallbackFn) (*ScoreZip, error) {
 			callback(fh.Name, nb)
 		}
 
-		if strings.HasSuffix(fh.Name, ".mscx") {
+		switch {
+		case fh.Name == ContainerPath:
+		case fh.Name == ThumbnailPath:
+			// A thumbnail that cannot be decoded is only a missing preview,
+			// so it does not prevent loading the score.
+			if img, err := png.Decode(bytes.NewReader(nb)); err == nil {
+				thumbnail = img
+			}
+		case strings.HasPrefix(fh.Name, PicturesDir):
+			if pictures == nil {
+				pictures = map[string][]byte{}
+			}
+			pictures[strings.TrimPrefix(fh.Name, PicturesDir)] = nb
+		case strings.HasSuffix(fh.Name, ".mscx"):
+			rootFile = fh.Name
 			result, err = parseXML(nb)
 			if err != nil {
 				var unhandledError *UnhandledError
@@ -102,6 +162,8 @@ func parseZip(buf []byte, callback CallbackFn) (*ScoreZip, error) {
 				}
 				return nil, fmt.Errorf("zip.parseXML(%q): %w", fh.Name, err)
 			}
+		default:
+			others = append(others, &ArchiveFile{Name: fh.Name, Data: nb})
 		}
 
 		if err := rc.Close(); err != nil {
@@ -109,5 +171,11 @@ func parseZip(buf []byte, callback CallbackFn) (*ScoreZip, error) {
 		}
 	}
 
+	if result != nil {
+		result.RootFile = rootFile
+		result.Thumbnail = thumbnail
+		result.Pictures = pictures
+		result.OtherFiles = others
+	}
 	return result, nil
 }
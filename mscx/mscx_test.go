@@ -19,13 +19,21 @@ limitations under the License.
 package mscx
 
 import (
-	_ "embed"
+	"bytes"
+	"embed"
+	"errors"
 	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
+// testfiles holds every test score, all of which must round-trip exactly.
+//
+//go:embed testfiles/*.mscz
+var testfiles embed.FS
+
 //go:embed testfiles/001-O_For_a_Thousand_Tongues_to_Sing.mscz
 var test01 []byte
 
@@ -92,7 +100,7 @@ func TestNew(t *testing.T) {
 					xml = buf
 				}
 			}
-			got, err := New(test01, cb)
+			got, err := New(tt.in, cb)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -100,7 +108,8 @@ func TestNew(t *testing.T) {
 
 			// Compare Go structs to Go structs
 			if tt.want != nil {
-				if diff := cmp.Diff(tt.want, got); diff != "" {
+				// The thumbnail is compared in TestWriteZip.
+				if diff := cmp.Diff(tt.want, got, cmpopts.IgnoreFields(ScoreZip{}, "Thumbnail")); diff != "" {
 					t.Errorf("New(%q) Go structs to Go struct differs (-want +got):\n%s", tt.name, diff)
 				}
 
@@ -133,6 +142,45 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewExact(t *testing.T) {
+	sz, err := NewScore().AddPart("Flute").AddMeasure("4/4").Note("C5", "whole").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	built, err := sz.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		in      []byte
+		wantErr error
+	}{
+		{name: "test01", in: test01},
+		{name: "test02", in: test02},
+		{name: "test03", in: test03},
+		{name: "test04", in: test04},
+		{name: "test05", in: test05},
+		{name: "test06", in: test06},
+		{name: "test07", in: test07},
+		{name: "mscx", in: built},
+		{name: "edited mscx", in: bytes.Replace(built, []byte("    "), []byte("\t"), 1), wantErr: ErrNotExact},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewExact(tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewExact err = %v, want %v", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.wantErr != nil) {
+				t.Errorf("NewExact = %v, want nil only on error", got)
+			}
+		})
+	}
+}
+
 func strip(s string) string {
 	lines := strings.Split(s, "\n")
 	result := make([]string, 0, len(lines))
@@ -19,6 +19,7 @@ limitations under the License.
 package mscx
 
 var test01Data = &ScoreZip{
+	RootFile: "O_For_a_Thousand_Tongues_to_Sing.mscx",
 	MuseScore: MuseScore{
 		Version:         "3.01",
 		ProgramVersion:  "3.2.3",
@@ -0,0 +1,292 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register the JPEG decoder for image.DecodeConfig
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PicturesDir is the folder of a `*.mscz` archive holding the images
+// displayed in frames.
+const PicturesDir = "Pictures/"
+
+// Image formats that can be embedded in a score, as used in the suffix
+// of the picture's filename.
+const (
+	ImagePNG  = "png"
+	ImageJPEG = "jpg"
+	ImageSVG  = "svg"
+)
+
+// imageDPMM is the resolution (dots per mm) at which MuseScore 3 converts
+// the pixel size of an image to its default size.
+const imageDPMM = 360 / 25.4
+
+// defaultSpatium is the staff space in mm of a score without a style.
+const defaultSpatium = 1.764
+
+// ImageFormat returns the format of the image data: ImagePNG, ImageJPEG
+// or ImageSVG.
+func ImageFormat(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return ImagePNG, nil
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return ImageJPEG, nil
+	}
+	if _, _, err := svgSize(data); err == nil {
+		return ImageSVG, nil
+	}
+	return "", errors.New("ImageFormat: unsupported image format")
+}
+
+// PictureName returns the filename under which MuseScore stores the image
+// data: the MD5 hash of its content followed by the format's suffix.
+func PictureName(data []byte) (string, error) {
+	format, err := ImageFormat(data)
+	if err != nil {
+		return "", fmt.Errorf("PictureName: %w", err)
+	}
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:]) + "." + format, nil
+}
+
+// ImageData returns the embedded data displayed by the image.
+func (s *ScoreZip) ImageData(img *ImageElement) ([]byte, error) {
+	data, ok := s.Pictures[img.Path]
+	if !ok {
+		return nil, fmt.Errorf("ScoreZip.ImageData: picture %q not found in %v", img.Path, PicturesDir)
+	}
+	return data, nil
+}
+
+// AddImage embeds the image data and appends an image displaying it to
+// the frame. The linkPath records the file the image came from and may be
+// empty. The image is sized from its pixel dimensions as MuseScore does.
+// The returned pointer is only valid until the frame's images change.
+func (s *ScoreZip) AddImage(vbox *VBox, data []byte, linkPath string) (*ImageElement, error) {
+	img := ImageElement{LinkPath: linkPath}
+	if err := s.setImage(&img, data); err != nil {
+		return nil, fmt.Errorf("ScoreZip.AddImage: %w", err)
+	}
+	vbox.Image = append(vbox.Image, img)
+	return &vbox.Image[len(vbox.Image)-1], nil
+}
+
+// ReplaceImage replaces the data displayed by the image, keeping its
+// position, and resizes it to the new data. The old picture is removed
+// if no other image displays it.
+func (s *ScoreZip) ReplaceImage(img *ImageElement, data []byte) error {
+	old := img.Path
+	if err := s.setImage(img, data); err != nil {
+		return fmt.Errorf("ScoreZip.ReplaceImage: %w", err)
+	}
+	s.prunePicture(old)
+	return nil
+}
+
+// RemoveImage removes the image from the frame. Its picture is removed if
+// no other image displays it.
+func (s *ScoreZip) RemoveImage(vbox *VBox, img *ImageElement) error {
+	for i := range vbox.Image {
+		if &vbox.Image[i] != img {
+			continue
+		}
+		path := img.Path
+		vbox.Image = append(vbox.Image[:i], vbox.Image[i+1:]...)
+		s.prunePicture(path)
+		return nil
+	}
+	return fmt.Errorf("ScoreZip.RemoveImage: image %q not found in frame", img.Path)
+}
+
+// ValidateImages checks that the picture displayed by every image in the
+// score and its excerpts is embedded in the archive.
+func (s *ScoreZip) ValidateImages() error {
+	var missing []string
+	for _, path := range s.imagePaths() {
+		if _, ok := s.Pictures[path]; !ok {
+			missing = append(missing, strconv.Quote(path))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("ScoreZip.ValidateImages: missing pictures: %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// setImage embeds the data and points img to it.
+func (s *ScoreZip) setImage(img *ImageElement, data []byte) error {
+	name, err := PictureName(data)
+	if err != nil {
+		return err
+	}
+	w, h, err := imagePixelSize(data)
+	if err != nil {
+		return err
+	}
+	sp := defaultSpatium
+	if st := s.MuseScore.Score.Style; st != nil && st.Spatium > 0 {
+		sp = st.Spatium
+	}
+	if s.Pictures == nil {
+		s.Pictures = map[string][]byte{}
+	}
+	s.Pictures[name] = data
+	img.Path = name
+	img.Size = ImageSize{W: w / (sp * imageDPMM), H: h / (sp * imageDPMM)}
+	return nil
+}
+
+// prunePicture removes the picture if no image displays it.
+func (s *ScoreZip) prunePicture(path string) {
+	for _, p := range s.imagePaths() {
+		if p == path {
+			return
+		}
+	}
+	delete(s.Pictures, path)
+}
+
+// imagePaths returns the sorted, distinct paths of the pictures displayed
+// by the frames of the score and its excerpts.
+func (s *ScoreZip) imagePaths() []string {
+	seen := map[string]bool{}
+	var walk func(score *Score)
+	walk = func(score *Score) {
+		for _, staff := range score.Staffs {
+			if staff.VBox == nil {
+				continue
+			}
+			for _, img := range staff.VBox.Image {
+				seen[img.Path] = true
+			}
+		}
+		for _, e := range score.Excerpts {
+			walk(e)
+		}
+	}
+	walk(&s.MuseScore.Score)
+
+	result := make([]string, 0, len(seen))
+	for path := range seen {
+		result = append(result, path)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// imagePixelSize returns the natural size of the image in pixels.
+func imagePixelSize(data []byte) (w, h float64, err error) {
+	if format, _ := ImageFormat(data); format == ImageSVG {
+		return svgSize(data)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	return float64(cfg.Width), float64(cfg.Height), nil
+}
+
+// svgUnits converts SVG lengths to pixels.
+var svgUnits = map[string]float64{
+	"":   1,
+	"px": 1,
+	"pt": 96.0 / 72,
+	"pc": 16,
+	"mm": 96 / 25.4,
+	"cm": 96 / 2.54,
+	"in": 96,
+}
+
+// svgSize returns the size in pixels of an SVG image from the width and
+// height of its root element, or else from its viewBox.
+func svgSize(data []byte) (w, h float64, err error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return 0, 0, errors.New("no <svg> element")
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if se.Name.Local != "svg" {
+			return 0, 0, fmt.Errorf("root element is <%v>, not <svg>", se.Name.Local)
+		}
+
+		var width, height, viewBox string
+		for _, attr := range se.Attr {
+			switch attr.Name.Local {
+			case "width":
+				width = attr.Value
+			case "height":
+				height = attr.Value
+			case "viewBox":
+				viewBox = attr.Value
+			}
+		}
+		w, wErr := svgLength(width)
+		h, hErr := svgLength(height)
+		if wErr == nil && hErr == nil {
+			return w, h, nil
+		}
+		fields := strings.Fields(strings.ReplaceAll(viewBox, ",", " "))
+		if len(fields) == 4 {
+			w, wErr = strconv.ParseFloat(fields[2], 64)
+			h, hErr = strconv.ParseFloat(fields[3], 64)
+			if wErr == nil && hErr == nil {
+				return w, h, nil
+			}
+		}
+		return 0, 0, errors.New("<svg> has no size")
+	}
+}
+
+// svgLength parses an absolute SVG length such as "120" or "30mm".
+func svgLength(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return r >= 'a' && r <= 'z' })
+	num, unit := s, ""
+	if i >= 0 {
+		num, unit = s[:i], s[i:]
+	}
+	scale, ok := svgUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unsupported SVG unit %q", unit)
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, err
+	}
+	return v * scale, nil
+}
@@ -0,0 +1,208 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const testSVG = `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 100"><circle cx="50" cy="50" r="40"/></svg>`
+
+func TestImageFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{name: "png", data: testPNG(t, 2, 2), want: ImagePNG},
+		{name: "jpeg", data: testJPEG(t, 2, 2), want: ImageJPEG},
+		{name: "svg", data: []byte(testSVG), want: ImageSVG},
+		{name: "svg with size", data: []byte(`<svg width="30mm" height="10mm"/>`), want: ImageSVG},
+		{name: "html", data: []byte(`<html/>`)},
+		{name: "text", data: []byte(`hello`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ImageFormat(tt.data)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("ImageFormat = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ImageFormat = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddImage(t *testing.T) {
+	sz, err := NewScore().
+		Title("Pictures").
+		AddPart("Flute").
+		AddMeasure("4/4").Note("C5", "whole").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vbox := sz.MuseScore.Score.Staffs[0].VBox
+	sp := sz.MuseScore.Score.Style.Spatium
+
+	pngData := testPNG(t, 360, 180)
+	img, err := sz.AddImage(vbox, pngData, "/home/me/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(pngData)
+	pngName := hex.EncodeToString(sum[:]) + ".png"
+	if img.Path != pngName {
+		t.Errorf("Path = %q, want %q", img.Path, pngName)
+	}
+	// 360 pixels at 360 DPI is one inch.
+	if want := 25.4 / sp; math.Abs(img.Size.W-want) > 1e-9 || math.Abs(img.Size.H-want/2) > 1e-9 {
+		t.Errorf("Size = %+v, want {W:%v H:%v}", img.Size, want, want/2)
+	}
+	if _, err := sz.AddImage(vbox, []byte(testSVG), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := sz.ValidateImages(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Round trip through an archive.
+	buf, err := sz.Zip(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var container string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+		if f.Name == ContainerPath {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			container = string(b)
+		}
+	}
+	svgName := vbox.Image[1].Path
+	wantNames := []string{ContainerPath, "Pictures.mscx", PicturesDir + pngName, PicturesDir + svgName}
+	if svgName < pngName {
+		wantNames[2], wantNames[3] = wantNames[3], wantNames[2]
+	}
+	if diff := cmp.Diff(wantNames, names); diff != "" {
+		t.Errorf("archive entries mismatch (-want +got):\n%v", diff)
+	}
+	if want := "    <file>Pictures/" + pngName + "</file>\n"; !strings.Contains(container, want) {
+		t.Errorf("container = %q, want it to contain %q", container, want)
+	}
+
+	got, err := New(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(sz.MuseScore, got.MuseScore); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%v", diff)
+	}
+	if diff := cmp.Diff(sz.Pictures, got.Pictures); diff != "" {
+		t.Errorf("round trip pictures mismatch (-want +got):\n%v", diff)
+	}
+	gotVBox := got.MuseScore.Score.Staffs[0].VBox
+	data, err := got.ImageData(&gotVBox.Image[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, pngData) {
+		t.Error("ImageData differs from the added PNG")
+	}
+
+	// Replace the PNG with a JPEG; the PNG is no longer embedded.
+	jpegData := testJPEG(t, 36, 36)
+	if err := got.ReplaceImage(&gotVBox.Image[0], jpegData); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Pictures[pngName]; ok {
+		t.Errorf("replaced picture %v still embedded", pngName)
+	}
+	if !strings.HasSuffix(gotVBox.Image[0].Path, ".jpg") || gotVBox.Image[0].LinkPath != "/home/me/logo.png" {
+		t.Errorf("replaced image = %+v", gotVBox.Image[0])
+	}
+
+	// Remove the SVG.
+	if err := got.RemoveImage(gotVBox, &gotVBox.Image[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Pictures[svgName]; ok || len(gotVBox.Image) != 1 || len(got.Pictures) != 1 {
+		t.Errorf("after RemoveImage: %v images, pictures %v", len(gotVBox.Image), len(got.Pictures))
+	}
+	if err := got.RemoveImage(gotVBox, &ImageElement{}); err == nil {
+		t.Error("RemoveImage of a foreign image = nil, want error")
+	}
+
+	// A reference to a picture that is not embedded is invalid.
+	gotVBox.Image = append(gotVBox.Image, ImageElement{Path: "missing.png"})
+	if err := got.ValidateImages(); err == nil || !strings.Contains(err.Error(), `"missing.png"`) {
+		t.Errorf("ValidateImages = %v, want missing.png error", err)
+	}
+}
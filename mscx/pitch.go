@@ -0,0 +1,129 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// stepSemitones maps a note letter to its semitone offset above C.
+var stepSemitones = map[byte]int{
+	'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11,
+}
+
+// stepTPC maps a note letter to its MuseScore "tonal pitch class"
+// (position on the line of fifths) when it has no accidental.
+var stepTPC = map[byte]int{
+	'F': 13, 'C': 14, 'G': 15, 'D': 16, 'A': 17, 'E': 18, 'B': 19,
+}
+
+// tpcNames holds the spelled note names for TPC values -1 through 33.
+var tpcNames = []string{
+	"Fbb", "Cbb", "Gbb", "Dbb", "Abb", "Ebb", "Bbb",
+	"Fb", "Cb", "Gb", "Db", "Ab", "Eb", "Bb",
+	"F", "C", "G", "D", "A", "E", "B",
+	"F#", "C#", "G#", "D#", "A#", "E#", "B#",
+	"F##", "C##", "G##", "D##", "A##", "E##", "B##",
+}
+
+// sharpTPCs holds the default spelling (using sharps) of each pitch class.
+var sharpTPCs = []int{14, 21, 16, 23, 18, 13, 20, 15, 22, 17, 24, 19}
+
+// ParsePitch parses a scientific pitch name such as "C4", "F#3" or "Bb5"
+// and returns its MIDI pitch number and MuseScore tonal pitch class (TPC).
+// Middle C is "C4" (MIDI pitch 60). Accidentals may be written as
+// "#", "b", "##" or "bb".
+func ParsePitch(s string) (pitch, tpc int, err error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return 0, 0, fmt.Errorf("ParsePitch(%q): too short", s)
+	}
+
+	step := strings.ToUpper(s[:1])[0]
+	semitone, ok := stepSemitones[step]
+	if !ok {
+		return 0, 0, fmt.Errorf("ParsePitch(%q): unknown note name", s)
+	}
+	tpc = stepTPC[step]
+
+	rest := s[1:]
+	for len(rest) > 0 && (rest[0] == '#' || rest[0] == 'b') {
+		if rest[0] == '#' {
+			semitone++
+			tpc += 7
+		} else {
+			semitone--
+			tpc -= 7
+		}
+		rest = rest[1:]
+	}
+
+	octave, err := strconv.Atoi(rest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ParsePitch(%q): bad octave: %w", s, err)
+	}
+
+	pitch = (octave+1)*12 + semitone
+	if pitch < 0 || pitch > 127 {
+		return 0, 0, fmt.Errorf("ParsePitch(%q): pitch %v out of MIDI range", s, pitch)
+	}
+
+	return pitch, tpc, nil
+}
+
+// PitchName returns the scientific pitch name of the MIDI pitch spelled
+// according to the provided TPC (e.g. "C#4"). If tpc is not a valid TPC,
+// a default spelling using sharps is used.
+func PitchName(pitch, tpc int) string {
+	if tpc < -1 || tpc > 33 {
+		tpc = DefaultTPC(pitch)
+	}
+	name := tpcNames[tpc+1]
+
+	// The octave is based on the written letter, so that e.g. B#3 and C4
+	// both sound as MIDI pitch 60.
+	letterPitch := pitch - tpcAlteration(tpc)
+	octave := letterPitch/12 - 1
+	return fmt.Sprintf("%v%v", name, octave)
+}
+
+// TPCName returns the spelled note name of the TPC without an octave
+// (e.g. "F#"), or the empty string if tpc is not a valid TPC.
+func TPCName(tpc int) string {
+	if tpc < -1 || tpc > 33 {
+		return ""
+	}
+	return tpcNames[tpc+1]
+}
+
+// DefaultTPC returns the TPC for the pitch spelled with sharps as needed.
+func DefaultTPC(pitch int) int {
+	return sharpTPCs[((pitch%12)+12)%12]
+}
+
+// tpcAlteration returns the number of semitones (e.g. -1 for a flat)
+// by which the TPC alters its natural note letter.
+func tpcAlteration(tpc int) int {
+	return (tpc+1)/7 - 2
+}
+
+// tpcPitchClass returns the pitch class (0=C) of a TPC.
+func tpcPitchClass(tpc int) int {
+	return ((tpc-14)*7%12 + 12) % 12
+}
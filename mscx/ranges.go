@@ -0,0 +1,106 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// RangeLevel describes how far a note lies outside an instrument's range.
+type RangeLevel int
+
+const (
+	// OutsideAmateurRange means the note is playable by professionals only.
+	OutsideAmateurRange RangeLevel = iota + 1
+	// OutsideProfessionalRange means the note is not playable at all.
+	OutsideProfessionalRange
+)
+
+func (r RangeLevel) String() string {
+	switch r {
+	case OutsideAmateurRange:
+		return "amateur"
+	case OutsideProfessionalRange:
+		return "professional"
+	}
+	return fmt.Sprintf("RangeLevel(%d)", int(r))
+}
+
+// RangeViolation reports a note outside the playable range of its instrument.
+type RangeViolation struct {
+	Position
+	PartName string
+	Note     *Note
+	Level    RangeLevel
+	// Min and Max are the MIDI pitch limits of the violated range.
+	Min, Max int
+}
+
+func (r *RangeViolation) String() string {
+	return fmt.Sprintf("%v %v: %v is outside the %v range (%v-%v)",
+		r.PartName, r.Position, PitchName(r.Note.Pitch, r.Note.TPC), r.Level,
+		PitchName(r.Min, DefaultTPC(r.Min)), PitchName(r.Max, DefaultTPC(r.Max)))
+}
+
+// PitchRange returns the amateur and professional pitch limits of the
+// instrument. ok is false if the instrument does not specify both ranges.
+func (i *Instrument) PitchRange() (minA, maxA, minP, maxP int, ok bool) {
+	vals := []string{i.MinPitchA, i.MaxPitchA, i.MinPitchP, i.MaxPitchP}
+	var result [4]int
+	for n, v := range vals {
+		p, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, 0, 0, false
+		}
+		result[n] = p
+	}
+	return result[0], result[1], result[2], result[3], true
+}
+
+// CheckRanges walks every note of every part and reports the notes that
+// lie outside the amateur or professional range of the part's instrument.
+// Percussion parts and parts without pitch ranges are skipped.
+func (s *ScoreZip) CheckRanges() ([]*RangeViolation, error) {
+	score := &s.MuseScore.Score
+	var result []*RangeViolation
+
+	err := score.Notes(func(ev *Event, note *Note) error {
+		part := score.PartForStaff(ev.StaffID)
+		if part == nil || part.Instrument == nil || part.Instrument.UseDrumset != 0 {
+			return nil
+		}
+		minA, maxA, minP, maxP, ok := part.Instrument.PitchRange()
+		if !ok {
+			return nil
+		}
+
+		v := &RangeViolation{Position: ev.Position, PartName: part.TrackName, Note: note}
+		switch {
+		case note.Pitch < minP || note.Pitch > maxP:
+			v.Level, v.Min, v.Max = OutsideProfessionalRange, minP, maxP
+		case note.Pitch < minA || note.Pitch > maxA:
+			v.Level, v.Min, v.Max = OutsideAmateurRange, minA, maxA
+		default:
+			return nil
+		}
+		result = append(result, v)
+		return nil
+	})
+
+	return result, err
+}
@@ -0,0 +1,59 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"testing"
+)
+
+func TestCheckRanges(t *testing.T) {
+	sz, err := NewScore().
+		AddInstrument("strings.violin").
+		AddMeasure("4/4").Note("F3", "quarter").Note("G3", "quarter").Note("C7", "quarter").Note("C8", "quarter").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := sz.CheckRanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Violin m.1 beat 1 voice 1 (staff 1): F3 is outside the professional range (G3-G7)",
+		"Violin m.1 beat 3 voice 1 (staff 1): C7 is outside the amateur range (G3-A6)",
+		"Violin m.1 beat 4 voice 1 (staff 1): C8 is outside the professional range (G3-G7)",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("CheckRanges = %v violations, want %v: %v", len(got), len(want), got)
+	}
+	for i, v := range got {
+		if v.String() != want[i] {
+			t.Errorf("violation[%v] = %q, want %q", i, v, want[i])
+		}
+	}
+
+	sz, err = New(test01, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := sz.CheckRanges(); err != nil || len(got) != 0 {
+		t.Errorf("CheckRanges(test01) = %v, %v; want no violations", got, err)
+	}
+}
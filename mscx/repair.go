@@ -0,0 +1,503 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+)
+
+// Fix is a change made by Repair, located like a Finding.
+type Fix struct {
+	Position
+	Message string
+}
+
+func (f *Fix) String() string {
+	switch {
+	case f.Measure > 0:
+		return fmt.Sprintf("%v: %v", f.Position, f.Message)
+	case f.StaffID != "":
+		return fmt.Sprintf("staff %v: %v", f.StaffID, f.Message)
+	}
+	return f.Message
+}
+
+// Repair fixes the common inconsistencies reported by Validate and returns
+// a log of the changes it made. In order, it:
+//   - splits each overfull measure in two by inserting a measure after it
+//     in every staff, moving whatever does not fit into the new measure
+//     and tying the notes of chords that cross the new barline,
+//   - pads underfull first voices with rests,
+//   - removes endSpanners that do not end a HairPin,
+//   - fixes syllabic sequences so that every word of lyrics begins and
+//     ends, and
+//   - renumbers the measures of staves whose measures are numbered.
+//
+// Voices positioned with tick markers are not split or padded, and
+// spanners that cross a split measure are not adjusted. Run Validate
+// afterwards to find any remaining problems.
+func (s *ScoreZip) Repair() ([]*Fix, error) {
+	r := &repairer{score: &s.MuseScore.Score}
+	if err := r.splitOverfullMeasures(); err != nil {
+		return r.fixes, fmt.Errorf("ScoreZip.Repair: %w", err)
+	}
+	if err := r.padUnderfullMeasures(); err != nil {
+		return r.fixes, fmt.Errorf("ScoreZip.Repair: %w", err)
+	}
+	for _, staff := range r.score.Staffs {
+		if err := r.removeOrphanedEndSpanners(staff); err != nil {
+			return r.fixes, fmt.Errorf("ScoreZip.Repair: %w", err)
+		}
+		if err := r.fixSyllables(staff); err != nil {
+			return r.fixes, fmt.Errorf("ScoreZip.Repair: %w", err)
+		}
+	}
+	r.renumberMeasures()
+	return r.fixes, nil
+}
+
+type repairer struct {
+	score *Score
+	fixes []*Fix
+}
+
+func (r *repairer) add(pos Position, format string, args ...any) {
+	r.fixes = append(r.fixes, &Fix{Position: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// measureTimeSig returns the time signature in effect in m, given the one
+// in effect in the previous measure.
+func measureTimeSig(m *Measure, prev *TimeSig) *TimeSig {
+	if m.TimeSig != nil {
+		prev = m.TimeSig
+	}
+	if len(m.Voice) > 0 && m.Voice[0].TimeSig != nil {
+		prev = m.Voice[0].TimeSig
+	}
+	return prev
+}
+
+// voiceElements returns the elements of each voice of m, including those
+// of older versions stored directly in the measure as the first voice.
+func voiceElements(m *Measure) []*[]any {
+	if len(m.Voice) == 0 {
+		return []*[]any{&m.TimedElements}
+	}
+	result := make([]*[]any, 0, len(m.Voice))
+	for _, v := range m.Voice {
+		result = append(result, &v.TimedElements)
+	}
+	return result
+}
+
+// hasTickMarkers reports whether any element of a voice is positioned by a
+// Tick.
+func hasTickMarkers(elements []any) bool {
+	for _, el := range elements {
+		if _, ok := el.(Tick); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTimedElements reports whether elements include a chord or rest.
+func hasTimedElements(elements []any) bool {
+	for _, el := range elements {
+		switch el.(type) {
+		case *Chord, *Rest:
+			return true
+		}
+	}
+	return false
+}
+
+// voiceTicks returns the total duration of the elements of a voice.
+func voiceTicks(elements []any, measureTicks, division int) (int, error) {
+	var total int
+	timer := &voiceTimer{division: division}
+	for _, el := range elements {
+		ticks, err := timer.ticks(el)
+		if err != nil {
+			return 0, err
+		}
+		if r, ok := el.(*Rest); ok && r.DurationType == "measure" && r.Duration == "" {
+			ticks = measureTicks
+		}
+		total += ticks
+	}
+	return total, nil
+}
+
+// splitOverfullMeasures moves the part of each voice that does not fit in
+// its measure into a new measure inserted after it.
+func (r *repairer) splitOverfullMeasures() error {
+	score := r.score
+	div := score.division()
+	timeSigs := make([]*TimeSig, len(score.Staffs))
+	for mi := 0; ; mi++ {
+		found := false
+		carries := make([][][]any, len(score.Staffs))
+		for si, staff := range score.Staffs {
+			if mi >= len(staff.Measure) {
+				continue
+			}
+			found = true
+			m := staff.Measure[mi]
+			timeSigs[si] = measureTimeSig(m, timeSigs[si])
+			measureTicks, err := score.MeasureTicks(m, timeSigs[si])
+			if err != nil {
+				return fmt.Errorf("staff %v, measure %v: %w", staff.ID, mi+1, err)
+			}
+			for vi, elements := range voiceElements(m) {
+				if hasTickMarkers(*elements) {
+					continue
+				}
+				keep, carry, err := splitVoice(*elements, measureTicks, div)
+				if err != nil {
+					return fmt.Errorf("staff %v, measure %v: %w", staff.ID, mi+1, err)
+				}
+				if len(carry) == 0 {
+					continue
+				}
+				*elements = keep
+				for len(carries[si]) <= vi {
+					carries[si] = append(carries[si], nil)
+				}
+				carries[si][vi] = carry
+				moved, _ := voiceTicks(carry, 0, div)
+				pos := Position{StaffID: staff.ID, Measure: mi + 1, Voice: vi + 1, Beat: 1}
+				r.add(pos, "moved %v that overfilled the measure into a new measure %v", wholeFraction(moved, div), mi+2)
+			}
+		}
+		if !found {
+			return nil
+		}
+
+		split := false
+		for _, carry := range carries {
+			split = split || len(carry) > 0
+		}
+		if !split {
+			continue
+		}
+		for si, staff := range score.Staffs {
+			if mi >= len(staff.Measure) {
+				continue
+			}
+			m := staff.Measure[mi]
+			next := &Measure{EndRepeat: m.EndRepeat}
+			m.EndRepeat = 0
+			if len(m.Voice) == 0 && len(carries[si]) > 0 {
+				next.TimedElements = carries[si][0]
+			} else {
+				next.Voice = []*Voice{{}}
+				for vi, carry := range carries[si] {
+					for len(next.Voice) <= vi {
+						next.Voice = append(next.Voice, &Voice{})
+					}
+					next.Voice[vi].TimedElements = carry
+				}
+			}
+			staff.Measure = append(staff.Measure[:mi+1], append([]*Measure{next}, staff.Measure[mi+1:]...)...)
+		}
+	}
+}
+
+// splitVoice splits the elements of a voice at the end of a measure of the
+// given length. A chord or rest that crosses the barline is split in two,
+// the chord's notes being tied across it.
+func splitVoice(elements []any, measureTicks, division int) (keep, carry []any, err error) {
+	var offset int
+	timer := &voiceTimer{division: division}
+	for i, el := range elements {
+		if offset >= measureTicks {
+			if !hasTimedElements(elements[i:]) {
+				break
+			}
+			return elements[:i:i], append([]any(nil), elements[i:]...), nil
+		}
+		ticks, err := timer.ticks(el)
+		if err != nil {
+			return nil, nil, err
+		}
+		if r, ok := el.(*Rest); ok && r.DurationType == "measure" && r.Duration == "" {
+			ticks = measureTicks
+		}
+		if offset+ticks <= measureTicks {
+			offset += ticks
+			continue
+		}
+
+		before, after := measureTicks-offset, offset+ticks-measureTicks
+		keep = append([]any(nil), elements[:i]...)
+		switch e := el.(type) {
+		case *Rest:
+			for _, dt := range SplitTicks(before, division) {
+				keep = append(keep, &Rest{DurationType: dt})
+			}
+			for _, dt := range SplitTicks(after, division) {
+				carry = append(carry, &Rest{DurationType: dt})
+			}
+		case *Chord:
+			head, tail := splitChord(e, offset, before, after, division)
+			keep = append(keep, head...)
+			carry = tail
+		}
+		return keep, append(carry, elements[i+1:]...), nil
+	}
+	return elements, nil, nil
+}
+
+// splitChord splits a chord starting at the given offset in its measure
+// into tied chords lasting before ticks in this measure and after ticks in
+// the next. The lyrics and spanners of the chord stay with the first
+// piece, except for ties to following notes, which move to the last.
+func splitChord(chord *Chord, offset, before, after, division int) (head, tail []any) {
+	var pieces []*Chord
+	var starts []int // the offset of each piece in its measure
+	add := func(ticks, start int) {
+		for _, dt := range SplitTicks(ticks, division) {
+			piece := &Chord{DurationType: dt}
+			for _, note := range chord.Note {
+				piece.Note = append(piece.Note, &Note{Pitch: note.Pitch, TPC: note.TPC, Fret: note.Fret, String: note.String})
+			}
+			pieces = append(pieces, piece)
+			starts = append(starts, start)
+			t, _ := DurationTicks(dt, 0, division)
+			start += t
+		}
+	}
+	add(before, offset)
+	numHead := len(pieces)
+	add(after, 0)
+
+	first, last := pieces[0], pieces[len(pieces)-1]
+	first.EID, first.Lyrics, first.Spanner = chord.EID, chord.Lyrics, chord.Spanner
+	for ni, note := range chord.Note {
+		first.Note[ni].EID = note.EID
+		for _, sp := range note.Spanner {
+			if sp.Next != nil {
+				last.Note[ni].Spanner = append(last.Note[ni].Spanner, sp)
+			} else {
+				first.Note[ni].Spanner = append(first.Note[ni].Spanner, sp)
+			}
+		}
+	}
+
+	for i := 1; i < len(pieces); i++ {
+		next, prev := &Location{}, &Location{}
+		distance := starts[i] - starts[i-1]
+		if i == numHead {
+			next.Measures, prev.Measures = 1, -1
+		}
+		if distance != 0 {
+			next.Fractions, prev.Fractions = wholeFraction(distance, division), wholeFraction(-distance, division)
+		}
+		for ni := range chord.Note {
+			pieces[i-1].Note[ni].Spanner = append(pieces[i-1].Note[ni].Spanner, &Spanner{Type: "Tie", Tie: &Tie{}, Next: &NextPrev{Location: next}})
+			pieces[i].Note[ni].Spanner = append([]*Spanner{{Type: "Tie", Prev: &NextPrev{Location: prev}}}, pieces[i].Note[ni].Spanner...)
+		}
+	}
+
+	for i, piece := range pieces {
+		if i < numHead {
+			head = append(head, piece)
+		} else {
+			tail = append(tail, piece)
+		}
+	}
+	return head, tail
+}
+
+// padUnderfullMeasures completes the first voice of each underfull measure
+// with rests.
+func (r *repairer) padUnderfullMeasures() error {
+	score := r.score
+	div := score.division()
+	for _, staff := range score.Staffs {
+		var timeSig *TimeSig
+		for mi, m := range staff.Measure {
+			timeSig = measureTimeSig(m, timeSig)
+			measureTicks, err := score.MeasureTicks(m, timeSig)
+			if err != nil {
+				return fmt.Errorf("staff %v, measure %v: %w", staff.ID, mi+1, err)
+			}
+			elements := voiceElements(m)[0]
+			if hasTickMarkers(*elements) {
+				continue
+			}
+			total, err := voiceTicks(*elements, measureTicks, div)
+			if err != nil {
+				return fmt.Errorf("staff %v, measure %v: %w", staff.ID, mi+1, err)
+			}
+			if total >= measureTicks {
+				continue
+			}
+
+			var rests []any
+			if total == 0 {
+				duration := m.Len
+				if duration == "" {
+					duration = timeSig.SigN + "/" + timeSig.SigD
+				}
+				rests = append(rests, &Rest{DurationType: "measure", Duration: duration})
+			} else {
+				for _, dt := range SplitTicks(measureTicks-total, div) {
+					rests = append(rests, &Rest{DurationType: dt})
+				}
+			}
+			// The rests go before any final barline.
+			at := len(*elements)
+			for at > 0 {
+				if _, ok := (*elements)[at-1].(*BarLine); !ok {
+					break
+				}
+				at--
+			}
+			*elements = append((*elements)[:at], append(rests, (*elements)[at:]...)...)
+
+			pos := Position{StaffID: staff.ID, Measure: mi + 1, Voice: 1, Beat: 1}
+			r.add(pos, "padded the measure with %v of rests", wholeFraction(measureTicks-total, div))
+		}
+	}
+	return nil
+}
+
+// removeOrphanedEndSpanners removes the endSpanners of a staff that do not
+// end a HairPin started before them.
+func (r *repairer) removeOrphanedEndSpanners(staff *ScoreStaff) error {
+	started := map[int]bool{}
+	orphans := map[*EndSpanner]bool{}
+	err := r.score.WalkStaff(staff, func(ev *Event) error {
+		switch el := ev.Element.(type) {
+		case *HairPin:
+			started[el.ID] = true
+		case *EndSpanner:
+			if !started[el.ID] {
+				orphans[el] = true
+				r.add(ev.Position, "removed endSpanner id=%v that has no matching start", el.ID)
+			}
+			delete(started, el.ID)
+		}
+		return nil
+	})
+	if err != nil || len(orphans) == 0 {
+		return err
+	}
+
+	for _, m := range staff.Measure {
+		for _, elements := range voiceElements(m) {
+			kept := (*elements)[:0]
+			for _, el := range *elements {
+				if es, ok := el.(*EndSpanner); !ok || !orphans[es] {
+					kept = append(kept, el)
+				}
+			}
+			*elements = kept
+		}
+	}
+	return nil
+}
+
+// fixSyllables fixes the syllabic of each lyric of a staff whose word is
+// not begun or ended. A syllable that follows an unfinished word ends it
+// unless it begins another word, in which case the unfinished word ends
+// at its last syllable.
+func (r *repairer) fixSyllables(staff *ScoreStaff) error {
+	type openSyllable struct {
+		pos    Position
+		lyrics *Lyrics
+	}
+	words := map[lyricLine]*openSyllable{}
+	set := func(pos Position, ly *Lyrics, syllabic string) {
+		r.add(pos, "changed the syllabic of lyric %q from %q to %q", ly.Text, ly.Syllabic, syllabic)
+		ly.Syllabic = syllabic
+	}
+	// end ends the word whose last syllable is open.
+	end := func(open *openSyllable) {
+		if open.lyrics.Syllabic == "begin" {
+			set(open.pos, open.lyrics, "")
+		} else {
+			set(open.pos, open.lyrics, "end")
+		}
+	}
+
+	err := r.score.WalkStaff(staff, func(ev *Event) error {
+		chord, ok := ev.Element.(*Chord)
+		if !ok {
+			return nil
+		}
+		for _, ly := range chord.Lyrics {
+			k := lyricLine{voice: ev.Voice, verse: ly.No}
+			open := words[k]
+			delete(words, k)
+			switch ly.Syllabic {
+			case "begin":
+				if open != nil {
+					end(open)
+				}
+			case "middle":
+				if open == nil {
+					set(ev.Position, ly, "begin")
+				}
+			case "end":
+				if open == nil {
+					set(ev.Position, ly, "")
+				}
+			default:
+				switch {
+				case open != nil:
+					set(ev.Position, ly, "end")
+				case ly.Syllabic != "" && ly.Syllabic != "single":
+					set(ev.Position, ly, "")
+				}
+			}
+			if ly.Syllabic == "begin" || ly.Syllabic == "middle" {
+				words[k] = &openSyllable{pos: ev.Position, lyrics: ly}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range sortedLyricLines(words) {
+		end(words[k])
+	}
+	return nil
+}
+
+// renumberMeasures numbers the measures of each staff with numbered
+// measures consecutively from 1.
+func (r *repairer) renumberMeasures() {
+	for _, staff := range r.score.Staffs {
+		numbered := false
+		for _, m := range staff.Measure {
+			numbered = numbered || m.Number != 0
+		}
+		if !numbered {
+			continue
+		}
+		for mi, m := range staff.Measure {
+			if m.Number != mi+1 {
+				r.add(Position{StaffID: staff.ID, Measure: mi + 1, Voice: 1, Beat: 1}, "renumbered measure %v as %v", m.Number, mi+1)
+				m.Number = mi + 1
+			}
+		}
+	}
+}
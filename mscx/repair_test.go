@@ -0,0 +1,199 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRepair_TestFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+		want []string
+	}{
+		{
+			name: "001",
+			buf:  test01,
+			want: []string{`m.8 beat 1 voice 1 (staff 1): changed the syllabic of lyric "hon" from "middle" to "begin"`},
+		},
+		{
+			name: "003",
+			buf:  test02,
+			want: []string{`m.2 beat 3 voice 1 (staff 1): changed the syllabic of lyric "y" from "" to "end"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sz, err := New(tt.buf, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fixes, err := sz.Repair()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range fixes {
+				got = append(got, f.String())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Repair mismatch (-want +got):\n%v", diff)
+			}
+			for _, f := range sz.Validate() {
+				t.Errorf("Validate after Repair: %v", f)
+			}
+		})
+	}
+}
+
+func TestRepair(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(score *Score)
+		want   []string
+		check  func(t *testing.T, score *Score)
+	}{
+		{
+			name:   "valid",
+			modify: func(score *Score) {},
+		},
+		{
+			name: "overfull measure",
+			modify: func(score *Score) {
+				v := score.Staffs[1].Measure[1].Voice[0]
+				v.TimedElements = append(v.TimedElements, &Rest{DurationType: "quarter"})
+			},
+			want: []string{
+				"m.2 beat 1 voice 1 (staff 2): moved 1/4 that overfilled the measure into a new measure 3",
+				"m.3 beat 1 voice 1 (staff 1): padded the measure with 1/1 of rests",
+				"m.3 beat 1 voice 1 (staff 2): padded the measure with 3/4 of rests",
+			},
+			check: func(t *testing.T, score *Score) {
+				got := score.Staffs[0].Measure[2].Voice[0].TimedElements
+				want := []any{&Rest{DurationType: "measure", Duration: "4/4"}}
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Errorf("new measure mismatch (-want +got):\n%v", diff)
+				}
+			},
+		},
+		{
+			name: "chord across barline",
+			modify: func(score *Score) {
+				score.Staffs[0].Measure[0].Voice[0].TimedElements[1].(*Chord).DurationType = "whole"
+			},
+			want: []string{
+				"m.1 beat 1 voice 1 (staff 1): moved 1/2 that overfilled the measure into a new measure 2",
+				"m.2 beat 1 voice 1 (staff 1): padded the measure with 1/2 of rests",
+				"m.2 beat 1 voice 1 (staff 2): padded the measure with 1/1 of rests",
+			},
+			check: func(t *testing.T, score *Score) {
+				head := score.Staffs[0].Measure[0].Voice[0].TimedElements[1].(*Chord)
+				tail := score.Staffs[0].Measure[1].Voice[0].TimedElements[0].(*Chord)
+				want := []any{
+					&Chord{DurationType: "half", Lyrics: []*Lyrics{{Syllabic: "end", Text: "ry"}}, Note: []*Note{{
+						Pitch: 74, TPC: 16,
+						Spanner: []*Spanner{{Type: "Tie", Tie: &Tie{}, Next: &NextPrev{Location: &Location{Measures: 1, Fractions: "-1/2"}}}},
+					}}},
+					&Chord{DurationType: "half", Note: []*Note{{
+						Pitch: 74, TPC: 16,
+						Spanner: []*Spanner{{Type: "Tie", Prev: &NextPrev{Location: &Location{Measures: -1, Fractions: "1/2"}}}},
+					}}},
+				}
+				if diff := cmp.Diff(want, []any{head, tail}); diff != "" {
+					t.Errorf("tied chords mismatch (-want +got):\n%v", diff)
+				}
+			},
+		},
+		{
+			name: "underfull measure",
+			modify: func(score *Score) {
+				score.Staffs[1].Measure[0].Voice[0].TimedElements[0].(*Chord).DurationType = "quarter"
+			},
+			want: []string{"m.1 beat 1 voice 1 (staff 2): padded the measure with 3/4 of rests"},
+			check: func(t *testing.T, score *Score) {
+				got := score.Staffs[1].Measure[0].Voice[0].TimedElements[1:]
+				want := []any{&Rest{DurationType: "half"}, &Rest{DurationType: "quarter"}}
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Errorf("padding mismatch (-want +got):\n%v", diff)
+				}
+			},
+		},
+		{
+			name: "orphaned endSpanner",
+			modify: func(score *Score) {
+				v := score.Staffs[0].Measure[0].Voice[0]
+				v.TimedElements = append([]any{&HairPin{ID: 2}}, v.TimedElements...)
+				v = score.Staffs[0].Measure[1].Voice[0]
+				v.TimedElements = append([]any{&EndSpanner{ID: 2}, &EndSpanner{ID: 3}}, v.TimedElements...)
+			},
+			want: []string{"m.2 beat 1 voice 1 (staff 1): removed endSpanner id=3 that has no matching start"},
+			check: func(t *testing.T, score *Score) {
+				if got := len(score.Staffs[0].Measure[1].Voice[0].TimedElements); got != 2 {
+					t.Errorf("measure 2 has %v elements, want 2", got)
+				}
+			},
+		},
+		{
+			name: "broken syllables",
+			modify: func(score *Score) {
+				score.Staffs[0].Measure[0].Voice[0].TimedElements[0].(*Chord).Lyrics[0].Syllabic = "middle"
+				score.Staffs[0].Measure[1].Voice[0].TimedElements[0].(*Chord).Lyrics[0].Syllabic = "begin"
+			},
+			want: []string{
+				`m.1 beat 1 voice 1 (staff 1): changed the syllabic of lyric "glo" from "middle" to "begin"`,
+				`m.2 beat 1 voice 1 (staff 1): changed the syllabic of lyric "be" from "begin" to ""`,
+			},
+		},
+		{
+			name: "numbered measures",
+			modify: func(score *Score) {
+				score.Staffs[1].Measure[0].Number = 1
+				score.Staffs[1].Measure[1].Number = 3
+			},
+			want: []string{"m.2 beat 1 voice 1 (staff 2): renumbered measure 3 as 2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sz := validPiano(t)
+			score := &sz.MuseScore.Score
+			tt.modify(score)
+			fixes, err := sz.Repair()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range fixes {
+				got = append(got, f.String())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Repair mismatch (-want +got):\n%v", diff)
+			}
+			if tt.check != nil {
+				tt.check(t, score)
+			}
+			for _, f := range sz.Validate() {
+				t.Errorf("Validate after Repair: %v", f)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// volta is an ending bracket over measures first to last (0-based).
+type volta struct {
+	first, last int
+	endings     map[int]bool
+}
+
+// PlaybackOrder returns the 1-based numbers of the measures of the score
+// in the order they are played, with repeats, voltas and jumps (D.C.,
+// D.S., al Fine, al Coda) expanded as MuseScore plays them. Repeat signs,
+// voltas, jumps and markers are read from the first staff. A section
+// without a start repeat sign repeats from the end of the previous
+// section. After a jump, repeats are played only if the jump's
+// PlayRepeats is set, and otherwise only the last volta of each set is
+// played.
+func (s *Score) PlaybackOrder() ([]int, error) {
+	if len(s.Staffs) == 0 {
+		return nil, nil
+	}
+	measures := s.Staffs[0].Measure
+	n := len(measures)
+
+	markers := map[string]int{"start": 0}
+	jumps := map[int]*Jump{}
+	voltas := make([]*volta, n)
+	for i, m := range measures {
+		elements := m.TimedElements
+		for _, v := range m.Voice {
+			elements = append(elements, v.TimedElements...)
+		}
+		for _, el := range elements {
+			switch el := el.(type) {
+			case *Marker:
+				if _, ok := markers[el.Label]; !ok && el.Label != "" {
+					markers[el.Label] = i
+				}
+			case *Jump:
+				jumps[i] = el
+			case *Spanner:
+				if el.Volta == nil || el.Next == nil {
+					continue
+				}
+				v := &volta{first: i, last: i, endings: parseEndings(el.Volta.Endings)}
+				if loc := el.Next.Location; loc != nil {
+					v.last = i + loc.Measures
+					if loc.Fractions == "" {
+						v.last-- // the volta ends at the start of this measure
+					}
+				}
+				for j := v.first; j <= v.last && j < n; j++ {
+					voltas[j] = v
+				}
+			}
+		}
+	}
+	// isFinal reports whether no other volta directly follows v.
+	isFinal := func(v *volta) bool {
+		return v.last+1 >= n || voltas[v.last+1] == nil
+	}
+
+	var order []int
+	repeatStart, pass := 0, 1
+	var repeating, inVolta, jumped bool
+	playRepeats := true
+	var playUntil, continueAt string
+	taken := map[int]bool{}
+	limit := 100 * (n + 1)
+	for i := 0; i < n; {
+		if len(order) > limit {
+			return nil, fmt.Errorf("Score.PlaybackOrder: measure %v: repeats do not end", i+1)
+		}
+		m, v := measures[i], voltas[i]
+		if !repeating && (m.StartRepeat || inVolta && v == nil) {
+			// A new section starts at a start repeat sign or after a set
+			// of voltas.
+			repeatStart, pass = i, 1
+		}
+		repeating, inVolta = false, v != nil
+
+		if v != nil {
+			play := v.endings[pass]
+			if jumped && !playRepeats {
+				play = isFinal(v)
+			}
+			if !play {
+				i++
+				continue
+			}
+		}
+		order = append(order, i+1)
+
+		if jumped && playUntil != "" {
+			if at, ok := markers[playUntil]; ok && at == i {
+				if continueAt == "" {
+					break
+				}
+				next, ok := markers[continueAt]
+				if !ok {
+					return nil, fmt.Errorf("Score.PlaybackOrder: measure %v: no marker %q to continue at", i+1, continueAt)
+				}
+				i, playUntil = next, ""
+				continue
+			}
+		}
+
+		if m.EndRepeat > 0 && (!jumped || playRepeats) {
+			if pass < m.EndRepeat {
+				i, pass, repeating = repeatStart, pass+1, true
+				continue
+			}
+			if v == nil {
+				// A following section without a start repeat sign repeats
+				// from here.
+				repeatStart, pass = i+1, 1
+			}
+		}
+
+		if j := jumps[i]; j != nil && !taken[i] {
+			to, ok := markers[j.JumpTo]
+			if !ok {
+				return nil, fmt.Errorf("Score.PlaybackOrder: measure %v: no marker %q to jump to", i+1, j.JumpTo)
+			}
+			taken[i], jumped = true, true
+			playRepeats = j.PlayRepeats != 0
+			playUntil, continueAt = j.PlayUntil, j.ContinueAt
+			i, repeatStart, pass, inVolta = to, to, 1, false
+			continue
+		}
+		i++
+	}
+	return order, nil
+}
+
+// parseEndings returns the pass numbers of a volta's endings, e.g. "1, 2".
+func parseEndings(endings string) map[int]bool {
+	result := map[int]bool{}
+	for _, f := range strings.Split(endings, ",") {
+		if e, err := strconv.Atoi(strings.TrimSpace(f)); err == nil {
+			result[e] = true
+		}
+	}
+	return result
+}
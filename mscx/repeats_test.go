@@ -0,0 +1,248 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// repeatScore returns a score of n measures of whole notes.
+func repeatScore(t *testing.T, n int) *Score {
+	t.Helper()
+	b := NewScore().AddPart("Melody").AddMeasure("4/4").Note("C5", "whole")
+	for i := 1; i < n; i++ {
+		b.AddMeasure("").Note("C5", "whole")
+	}
+	sz, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return &sz.MuseScore.Score
+}
+
+// addVolta adds a volta over count measures starting at the 1-based measure.
+func addVolta(score *Score, measure, count int, endings string) {
+	v := score.Staffs[0].Measure[measure-1].Voice[0]
+	v.TimedElements = append([]any{&Spanner{
+		Type:  "Volta",
+		Volta: &Volta{EndHookType: 1, BeginText: endings + ".", Endings: endings},
+		Next:  &NextPrev{Location: &Location{Measures: count}},
+	}}, v.TimedElements...)
+}
+
+// addMarker adds a marker to the 1-based measure.
+func addMarker(score *Score, measure int, label string) {
+	m := score.Staffs[0].Measure[measure-1]
+	m.TimedElements = append(m.TimedElements, &Marker{Label: label})
+}
+
+// addJump adds a jump to the 1-based measure.
+func addJump(score *Score, measure int, jump *Jump) {
+	m := score.Staffs[0].Measure[measure-1]
+	m.TimedElements = append(m.TimedElements, jump)
+}
+
+func TestPlaybackOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		modify  func(score *Score)
+		want    []int
+		wantErr bool
+	}{
+		{
+			name: "no repeats",
+			n:    4,
+			want: []int{1, 2, 3, 4},
+		},
+		{
+			name: "repeat from the start",
+			n:    4,
+			modify: func(score *Score) {
+				score.Staffs[0].Measure[1].EndRepeat = 2
+			},
+			want: []int{1, 2, 1, 2, 3, 4},
+		},
+		{
+			name: "start repeat",
+			n:    4,
+			modify: func(score *Score) {
+				score.Staffs[0].Measure[1].StartRepeat = true
+				score.Staffs[0].Measure[2].EndRepeat = 2
+			},
+			want: []int{1, 2, 3, 2, 3, 4},
+		},
+		{
+			name: "three times",
+			n:    3,
+			modify: func(score *Score) {
+				score.Staffs[0].Measure[1].EndRepeat = 3
+			},
+			want: []int{1, 2, 1, 2, 1, 2, 3},
+		},
+		{
+			name: "consecutive sections",
+			n:    4,
+			modify: func(score *Score) {
+				score.Staffs[0].Measure[1].EndRepeat = 2
+				score.Staffs[0].Measure[3].EndRepeat = 2
+			},
+			want: []int{1, 2, 1, 2, 3, 4, 3, 4},
+		},
+		{
+			name: "voltas",
+			n:    5,
+			modify: func(score *Score) {
+				score.Staffs[0].Measure[2].EndRepeat = 2
+				addVolta(score, 3, 1, "1")
+				addVolta(score, 4, 1, "2")
+			},
+			want: []int{1, 2, 3, 1, 2, 4, 5},
+		},
+		{
+			name: "shared volta",
+			n:    5,
+			modify: func(score *Score) {
+				score.Staffs[0].Measure[2].EndRepeat = 3
+				addVolta(score, 3, 1, "1, 2")
+				addVolta(score, 4, 2, "3")
+			},
+			want: []int{1, 2, 3, 1, 2, 3, 1, 2, 4, 5},
+		},
+		{
+			name: "D.C. al Fine",
+			n:    4,
+			modify: func(score *Score) {
+				addMarker(score, 2, "fine")
+				addJump(score, 4, &Jump{JumpTo: "start", PlayUntil: "fine"})
+			},
+			want: []int{1, 2, 3, 4, 1, 2},
+		},
+		{
+			name: "D.S. al Coda",
+			n:    6,
+			modify: func(score *Score) {
+				addMarker(score, 2, "segno")
+				addMarker(score, 3, "coda")
+				addJump(score, 4, &Jump{JumpTo: "segno", PlayUntil: "coda", ContinueAt: "codab"})
+				addMarker(score, 5, "codab")
+			},
+			want: []int{1, 2, 3, 4, 2, 3, 5, 6},
+		},
+		{
+			name: "D.C. without repeats",
+			n:    4,
+			modify: func(score *Score) {
+				score.Staffs[0].Measure[1].EndRepeat = 2
+				addJump(score, 3, &Jump{JumpTo: "start", PlayUntil: "end"})
+			},
+			want: []int{1, 2, 1, 2, 3, 1, 2, 3, 4},
+		},
+		{
+			name: "D.C. with repeats",
+			n:    4,
+			modify: func(score *Score) {
+				score.Staffs[0].Measure[1].EndRepeat = 2
+				addJump(score, 3, &Jump{JumpTo: "start", PlayUntil: "end", PlayRepeats: 1})
+			},
+			want: []int{1, 2, 1, 2, 3, 1, 2, 1, 2, 3, 4},
+		},
+		{
+			name: "D.C. al Fine with voltas",
+			n:    5,
+			modify: func(score *Score) {
+				score.Staffs[0].Measure[1].EndRepeat = 2
+				addVolta(score, 2, 1, "1")
+				addVolta(score, 3, 1, "2")
+				addMarker(score, 4, "fine")
+				addJump(score, 5, &Jump{JumpTo: "start", PlayUntil: "fine"})
+			},
+			want: []int{1, 2, 1, 3, 4, 5, 1, 3, 4},
+		},
+		{
+			name: "missing marker",
+			n:    2,
+			modify: func(score *Score) {
+				addJump(score, 2, &Jump{JumpTo: "segno", PlayUntil: "end"})
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := repeatScore(t, tt.n)
+			if tt.modify != nil {
+				tt.modify(score)
+			}
+			got, err := score.PlaybackOrder()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("PlaybackOrder = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PlaybackOrder: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("PlaybackOrder mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestMeasure_Repeats(t *testing.T) {
+	in := `<Measure><startRepeat/><endRepeat>3</endRepeat><Marker><text>Fine</text><label>fine</label></Marker><Jump><text>D.C. al Fine</text><jumpTo>start</jumpTo><playUntil>fine</playUntil><continueAt></continueAt></Jump><voice><Rest><durationType>measure</durationType><duration>4/4</duration></Rest></voice></Measure>`
+	m := &Measure{}
+	if err := xml.Unmarshal([]byte(in), m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := &Measure{
+		StartRepeat: true,
+		EndRepeat:   3,
+		Voice:       []*Voice{{TimedElements: []any{&Rest{DurationType: "measure", Duration: "4/4"}}}},
+		TimedElements: []any{
+			&Marker{Text: []byte("Fine"), Label: "fine"},
+			&Jump{Text: []byte("D.C. al Fine"), JumpTo: "start", PlayUntil: "fine"},
+		},
+	}
+	if diff := cmp.Diff(want, m); diff != "" {
+		t.Errorf("Unmarshal mismatch (-want +got):\n%v", diff)
+	}
+
+	sz := &ScoreZip{MuseScore: MuseScore{Score: Score{Staffs: []*ScoreStaff{{ID: "1", Measure: []*Measure{m}}}}}}
+	got, err := sz.XML()
+	if err != nil {
+		t.Fatalf("XML: %v", err)
+	}
+	for _, want := range []string{
+		"      <Measure>\n        <startRepeat/>\n        <endRepeat>3</endRepeat>\n        <Marker>\n",
+		"        <Marker>\n          <text>Fine</text>\n          <label>fine</label>\n          </Marker>\n",
+		"          <playUntil>fine</playUntil>\n          <continueAt></continueAt>\n          </Jump>\n        <voice>\n",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("XML = %v, want it to contain %q", string(got), want)
+		}
+	}
+}
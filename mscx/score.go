@@ -20,32 +20,27 @@ import (
 	"bytes"
 	"encoding/xml"
 	"fmt"
+	"image"
+	"reflect"
 	"strconv"
 )
 
 // ScoreZip represents a MuseScore 3 score in `mscz` (zip'd) format.
 type ScoreZip struct {
+	// RootFile is the name of the `*.mscx` file within the archive.
+	RootFile string `xml:"-"`
 	// MetaInf
 	MuseScore MuseScore `xml:"museScore"`
-	// Thumbnails
+	// Thumbnail is the archive's Thumbnails/thumbnail.png, if any.
+	Thumbnail image.Image `xml:"-"`
+	// Pictures holds the images of the archive's Pictures/ folder, keyed
+	// by the Path of the ImageElements that display them.
+	Pictures map[string][]byte `xml:"-"`
+	// OtherFiles holds the archive's remaining entries (e.g.
+	// audiosettings.json, viewsettings.json or Audio/), in archive order.
+	OtherFiles []*ArchiveFile `xml:"-"`
 }
 
-var (
-	xmlEndingsToShorten = []string{
-		"></bracket>",
-		"></controller>",
-		"></endSpanner>",
-		"></pos>",
-		"></program>",
-		"></size>",
-	}
-	xmlEndingsToSplitLines = []string{
-		"</Slur>",
-		"</System>",
-		"</Zerberus>",
-	}
-)
-
 type UnhandledError struct {
 	Type   string
 	Name   string
@@ -56,27 +51,6 @@ func (u *UnhandledError) Error() string {
 	return fmt.Sprintf("unhandled %v: %v at byte offset %v", u.Type, u.Name, u.Offset)
 }
 
-// XML renders the embedded MuseScore to XML format.
-func (s *ScoreZip) XML() ([]byte, error) {
-	b, err := xml.MarshalIndent(s.MuseScore, "", "  ")
-	if err != nil {
-		return nil, err
-	}
-
-	result := append([]byte(xml.Header+"<m"), b[2:]...)
-	for _, ending := range xmlEndingsToShorten {
-		result = bytes.ReplaceAll(result, []byte(ending), []byte("/>"))
-	}
-	for _, ending := range xmlEndingsToSplitLines {
-		result = bytes.ReplaceAll(result, []byte(ending), []byte("\n"+ending))
-	}
-	result = bytes.ReplaceAll(result, []byte("&#xA;"), []byte("\n"))
-	result = bytes.ReplaceAll(result, []byte("&#39;"), []byte("'"))
-	result = bytes.ReplaceAll(result, []byte("  </"), []byte("    </"))
-	result = bytes.ReplaceAll(result, []byte("</MuseScore>"), []byte("  </museScore>\n"))
-	return result, nil
-}
-
 // MuseScore represents MuseScore 3 data in XML.
 type MuseScore struct {
 	Version string `xml:"version,attr"`
@@ -98,9 +72,14 @@ type Score struct {
 	ShowFrames      int           `xml:"showFrames"`
 	ShowMargins     int           `xml:"showMargins"`
 	MetaTags        []*MetaTag    `xml:"metaTag"`
+	Order           *Order        `xml:"Order"`
 	PageList        *PageList     `xml:"PageList"`
 	Part            []*Part       `xml:"Part"`
 	Staffs          []*ScoreStaff `xml:"Staff"`
+	// Excerpts holds the linked part scores, each nested as a <Score>.
+	Excerpts []*Score `xml:"Score"`
+	// Name is the name of an excerpt (empty for the main score).
+	Name string `xml:"name,omitempty"`
 }
 
 // LayerTag represents the XML data of the same name.
@@ -109,15 +88,142 @@ type LayerTag struct {
 	Tag string `xml:"tag,attr"`
 }
 
-// Style represents the XML data of the same name.
+// Style represents the XML data of the same name. MuseScore writes only
+// the settings that differ from its defaults; the typed fields are the
+// settings this package uses, and Settings holds all others verbatim.
 type Style struct {
-	ConcertPitch         int         `xml:"concertPitch,omitempty"`
-	PageLayout           *PageLayout `xml:"page-layout"`
-	PageWidth            float64     `xml:"pageWidth,omitempty"`
-	PageHeight           float64     `xml:"pageHeight,omitempty"`
-	PagePrintableWidth   float64     `xml:"pagePrintableWidth,omitempty"`
-	UseStandardNoteNames int         `xml:"useStandardNoteNames,omitempty"`
-	Spatium              float64     `xml:"Spatium"`
+	PageLayout              *PageLayout `xml:"page-layout"`
+	PageWidth               float64     `xml:"pageWidth,omitempty"`
+	PageHeight              float64     `xml:"pageHeight,omitempty"`
+	PagePrintableWidth      float64     `xml:"pagePrintableWidth,omitempty"`
+	UseStandardNoteNames    int         `xml:"useStandardNoteNames,omitempty"`
+	ConcertPitch            int         `xml:"concertPitch,omitempty"`
+	CreateMultiMeasureRests int         `xml:"createMultiMeasureRests,omitempty"`
+	Spatium                 float64     `xml:"Spatium"`
+
+	// Settings holds the other settings, such as <enableVerticalSpread>,
+	// and the typed settings that are explicitly zero (e.g.
+	// <useStandardNoteNames>0</useStandardNoteNames>), in file order.
+	Settings []*StyleSetting `xml:"-"`
+}
+
+// StyleSetting is a style setting that is kept verbatim.
+type StyleSetting struct {
+	XMLName xml.Name
+	Attr    []xml.Attr `xml:",any,attr"`
+	Inner   []byte     `xml:",innerxml"`
+
+	// Index is the position of the setting among all the settings of its
+	// style, so that it is written back in place.
+	Index int `xml:"-"`
+}
+
+// styleField is a typed field of a Style.
+type styleField struct {
+	name  string
+	value any // a pointer to the field
+}
+
+// fields returns the typed fields of the style, except Spatium, which
+// MuseScore always writes last.
+func (s *Style) fields() []styleField {
+	return []styleField{
+		{"page-layout", &s.PageLayout},
+		{"pageWidth", &s.PageWidth},
+		{"pageHeight", &s.PageHeight},
+		{"pagePrintableWidth", &s.PagePrintableWidth},
+		{"useStandardNoteNames", &s.UseStandardNoteNames},
+		{"concertPitch", &s.ConcertPitch},
+		{"createMultiMeasureRests", &s.CreateMultiMeasureRests},
+	}
+}
+
+// Implements encoding.xml.Unmarshaler interface
+func (s *Style) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	fields := map[string]any{"Spatium": &s.Spatium}
+	for _, f := range s.fields() {
+		fields[f.name] = f.value
+	}
+
+	for index := 0; ; {
+		token, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("Style.UnmarshalXML: %w", err)
+		}
+
+		switch tok := token.(type) {
+		case xml.StartElement:
+			el := &StyleSetting{Index: index}
+			if err = decoder.DecodeElement(el, &tok); err != nil {
+				return fmt.Errorf("Style.UnmarshalXML: %w", err)
+			}
+			index++
+			if v, ok := fields[tok.Name.Local]; ok {
+				inner := xml.NewDecoder(bytes.NewReader(append(append([]byte("<v>"), el.Inner...), "</v>"...)))
+				if err = inner.Decode(v); err != nil {
+					return fmt.Errorf("Style.UnmarshalXML: %v: %w", tok.Name.Local, err)
+				}
+				if !reflect.ValueOf(v).Elem().IsZero() {
+					continue
+				}
+			}
+			s.Settings = append(s.Settings, el)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// Implements encoding.xml.Marshaler interface
+func (s *Style) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	var typed []styleField
+	set := map[string]bool{}
+	for _, f := range s.fields() {
+		if !reflect.ValueOf(f.value).Elem().IsZero() {
+			typed = append(typed, f)
+			set[f.name] = true
+		}
+	}
+	encodeField := func(f styleField) error {
+		return encoder.EncodeElement(f.value, xml.StartElement{Name: xml.Name{Local: f.name}})
+	}
+
+	if err := encoder.EncodeToken(start); err != nil {
+		return fmt.Errorf("Style.MarshalXML: %w", err)
+	}
+	// The typed settings fill the positions between the other settings.
+	index := 0
+	for _, el := range s.Settings {
+		if set[el.XMLName.Local] {
+			continue // superseded by the typed field
+		}
+		for ; index < el.Index && len(typed) > 0; index++ {
+			if err := encodeField(typed[0]); err != nil {
+				return fmt.Errorf("Style.MarshalXML: %w", err)
+			}
+			typed = typed[1:]
+		}
+		if err := encoder.Encode(el); err != nil {
+			return fmt.Errorf("Style.MarshalXML: %w", err)
+		}
+		index++
+	}
+	for _, f := range append(typed, styleField{"Spatium", &s.Spatium}) {
+		if err := encodeField(f); err != nil {
+			return fmt.Errorf("Style.MarshalXML: %w", err)
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// Order is the instrument order of a MuseScore 3.6 score: the sections of
+// instrument families that new instruments are sorted into. Its contents
+// are kept verbatim.
+type Order struct {
+	ID         string `xml:"id,attr"`
+	Customized string `xml:"customized,attr,omitempty"`
+
+	Inner []byte `xml:",innerxml"`
 }
 
 // MetaTag represents the XML data of the same name.
@@ -139,6 +245,9 @@ type Part struct {
 type PartStaff struct {
 	ID string `xml:"id,attr"`
 
+	// LinkedTo is the 1-based index of the staff in the main score that an
+	// excerpt staff is linked to, or zero if the staff is not linked.
+	LinkedTo      int       `xml:"linkedTo,omitempty"`
 	StaffType     StaffType `xml:"StaffType"`
 	StaffElements []any
 }
@@ -157,6 +266,13 @@ func (p *PartStaff) MarshalXML(encoder *xml.Encoder, start xml.StartElement) err
 		return fmt.Errorf("PartStaff.MarshalXML: %w", err)
 	}
 
+	if p.LinkedTo != 0 {
+		linkedToEl := xml.StartElement{Name: xml.Name{Local: "linkedTo"}}
+		if err := encoder.EncodeElement(p.LinkedTo, linkedToEl); err != nil {
+			return fmt.Errorf("PartStaff.MarshalXML: %w", err)
+		}
+	}
+
 	if err := encoder.Encode(p.StaffType); err != nil {
 		return fmt.Errorf("PartStaff.MarshalXML: %w", err)
 	}
@@ -195,6 +311,10 @@ func (p *PartStaff) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) e
 		switch tok := token.(type) {
 		case xml.StartElement:
 			switch tok.Name.Local {
+			case "linkedTo":
+				if err = decoder.DecodeElement(&p.LinkedTo, &tok); err != nil {
+					return fmt.Errorf("PartStaff.UnmarshalXML: %w", err)
+				}
 			case "StaffType":
 				if err = decoder.DecodeElement(&p.StaffType, &tok); err != nil {
 					return fmt.Errorf("PartStaff.UnmarshalXML: %w", err)
@@ -400,20 +520,117 @@ type ScoreStaff struct {
 	Measure []*Measure `xml:"Measure"`
 }
 
+// Implements encoding.xml.Marshaler interface
+func (s *ScoreStaff) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	se := xml.StartElement{
+		Name: xml.Name{Local: "Staff"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "id"}, Value: s.ID}},
+	}
+	if err := encoder.EncodeToken(se); err != nil {
+		return fmt.Errorf("ScoreStaff.MarshalXML: %w", err)
+	}
+
+	if s.VBox != nil {
+		if err := encoder.Encode(s.VBox); err != nil {
+			return fmt.Errorf("ScoreStaff.MarshalXML: %w", err)
+		}
+	}
+
+	for _, m := range s.Measure {
+		if m.HBox != nil {
+			if err := encoder.Encode(m.HBox); err != nil {
+				return fmt.Errorf("ScoreStaff.MarshalXML: %w", err)
+			}
+		}
+		if err := encoder.Encode(m); err != nil {
+			return fmt.Errorf("ScoreStaff.MarshalXML: %w", err)
+		}
+	}
+
+	return encoder.EncodeToken(se.End())
+}
+
+// Implements encoding.xml.Unmarshaler interface
+func (s *ScoreStaff) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "id":
+			s.ID = attr.Value
+		default:
+			err := &UnhandledError{Type: "attr", Name: attr.Name.Local, Offset: decoder.InputOffset()}
+			return fmt.Errorf("ScoreStaff.UnmarshalXML: %w", err)
+		}
+	}
+
+	var hbox *HBox
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("ScoreStaff.UnmarshalXML: %w", err)
+		}
+
+		switch tok := token.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "VBox":
+				if err = decoder.DecodeElement(&s.VBox, &tok); err != nil {
+					return fmt.Errorf("ScoreStaff.UnmarshalXML: %w", err)
+				}
+			case "HBox":
+				if err = decoder.DecodeElement(&hbox, &tok); err != nil {
+					return fmt.Errorf("ScoreStaff.UnmarshalXML: %w", err)
+				}
+			case "Measure":
+				m := &Measure{HBox: hbox}
+				if err = decoder.DecodeElement(m, &tok); err != nil {
+					return fmt.Errorf("ScoreStaff.UnmarshalXML: %w", err)
+				}
+				s.Measure = append(s.Measure, m)
+				hbox = nil
+			default:
+				err := &UnhandledError{Type: "token", Name: tok.Name.Local, Offset: decoder.InputOffset()}
+				return fmt.Errorf("ScoreStaff.UnmarshalXML: %w", err)
+			}
+
+		case xml.EndElement:
+			if hbox != nil {
+				err := &UnhandledError{Type: "token", Name: "HBox", Offset: decoder.InputOffset()}
+				return fmt.Errorf("ScoreStaff.UnmarshalXML: after the last measure: %w", err)
+			}
+			return nil
+		}
+	}
+}
+
 // Measure represents the XML data of the same name.
 type Measure struct {
 	Len    string `xml:"len,attr,omitempty"`
 	Number int    `xml:"number,attr,omitempty"`
 
-	Irregular   int      `xml:"irregular,omitempty"`
+	Irregular int `xml:"irregular,omitempty"`
+	// MultiMeasureRest is the number of measures collapsed into a
+	// multi-measure rest beginning at this measure, or zero.
+	MultiMeasureRest int `xml:"multiMeasureRest,omitempty"`
+	// StartRepeat is true if the measure begins with a start repeat sign.
+	StartRepeat bool `xml:"startRepeat,omitempty"`
+	// EndRepeat is the number of times the repeated section ending with
+	// this measure is played, or zero if it has no end repeat sign.
+	EndRepeat int `xml:"endRepeat,omitempty"`
+	// HBox is a horizontal frame before the measure. Only the measures of
+	// the first staff hold frames.
+	HBox *HBox `xml:"-"`
+
+	// VSpacerDown is the extra space below the staff, in spatiums.
+	VSpacerDown float64  `xml:"vspacerDown,omitempty"`
 	Voice       []*Voice `xml:"voice"`
-	StartRepeat string   `xml:"startRepeat,omitempty"`
-	EndRepeat   string   `xml:"endRepeat,omitempty"`
 
 	// older versions
-	KeySig        *KeySig  `xml:"KeySig"`
-	TimeSig       *TimeSig `xml:"TimeSig"`
-	Tempo         *Tempo   `xml:"Tempo"`
+	KeySig  *KeySig  `xml:"KeySig"`
+	TimeSig *TimeSig `xml:"TimeSig"`
+	Tempo   *Tempo   `xml:"Tempo"`
+	// TimedElements holds the elements of the measure itself, such as
+	// layout breaks, which MuseScore 3 writes before the voices, or the
+	// first voice of older versions.
 	TimedElements []any
 }
 
@@ -445,20 +662,41 @@ func (m *Measure) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error
 		}
 	}
 
-	if m.Voice != nil {
-		if err := encoder.Encode(m.Voice); err != nil {
+	if m.MultiMeasureRest != 0 {
+		mmRestEl := xml.StartElement{Name: xml.Name{Local: "multiMeasureRest"}}
+		if err := encoder.EncodeElement(m.MultiMeasureRest, mmRestEl); err != nil {
+			return fmt.Errorf("Measure.MarshalXML: %w", err)
+		}
+	}
+
+	if m.StartRepeat {
+		startRepeatEl := xml.StartElement{Name: xml.Name{Local: "startRepeat"}}
+		if err := encoder.EncodeElement("", startRepeatEl); err != nil {
+			return fmt.Errorf("Measure.MarshalXML: %w", err)
+		}
+	}
+
+	if m.EndRepeat != 0 {
+		endRepeatEl := xml.StartElement{Name: xml.Name{Local: "endRepeat"}}
+		if err := encoder.EncodeElement(m.EndRepeat, endRepeatEl); err != nil {
 			return fmt.Errorf("Measure.MarshalXML: %w", err)
 		}
 	}
 
-	if m.StartRepeat != "" {
-		if err := encoder.Encode(m.StartRepeat); err != nil {
+	if m.VSpacerDown != 0 {
+		vspacerDownEl := xml.StartElement{Name: xml.Name{Local: "vspacerDown"}}
+		if err := encoder.EncodeElement(m.VSpacerDown, vspacerDownEl); err != nil {
 			return fmt.Errorf("Measure.MarshalXML: %w", err)
 		}
 	}
 
-	if m.EndRepeat != "" {
-		if err := encoder.Encode(m.EndRepeat); err != nil {
+	if m.Voice != nil {
+		for _, el := range m.TimedElements {
+			if err := encoder.Encode(el); err != nil {
+				return fmt.Errorf("Measure.MarshalXML: %w", err)
+			}
+		}
+		if err := encoder.Encode(m.Voice); err != nil {
 			return fmt.Errorf("Measure.MarshalXML: %w", err)
 		}
 	}
@@ -481,9 +719,11 @@ func (m *Measure) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error
 		}
 	}
 
-	for _, el := range m.TimedElements {
-		if err := encoder.Encode(el); err != nil {
-			return fmt.Errorf("Measure.MarshalXML: %w", err)
+	if m.Voice == nil {
+		for _, el := range m.TimedElements {
+			if err := encoder.Encode(el); err != nil {
+				return fmt.Errorf("Measure.MarshalXML: %w", err)
+			}
 		}
 	}
 
@@ -525,6 +765,23 @@ func (m *Measure) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) err
 				if err = decoder.DecodeElement(&m.Irregular, &tok); err != nil {
 					return fmt.Errorf("Measure.UnmarshalXML: %w", err)
 				}
+			case "multiMeasureRest":
+				if err = decoder.DecodeElement(&m.MultiMeasureRest, &tok); err != nil {
+					return fmt.Errorf("Measure.UnmarshalXML: %w", err)
+				}
+			case "startRepeat":
+				if err = decoder.Skip(); err != nil {
+					return fmt.Errorf("Measure.UnmarshalXML: %w", err)
+				}
+				m.StartRepeat = true
+			case "endRepeat":
+				if err = decoder.DecodeElement(&m.EndRepeat, &tok); err != nil {
+					return fmt.Errorf("Measure.UnmarshalXML: %w", err)
+				}
+			case "vspacerDown":
+				if err = decoder.DecodeElement(&m.VSpacerDown, &tok); err != nil {
+					return fmt.Errorf("Measure.UnmarshalXML: %w", err)
+				}
 			case "voice":
 				if err = decoder.DecodeElement(&m.Voice, &tok); err != nil {
 					return fmt.Errorf("Measure.UnmarshalXML: %w", err)
@@ -577,12 +834,30 @@ func (m *Measure) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) err
 					return fmt.Errorf("Measure.UnmarshalXML: %w", err)
 				}
 				m.TimedElements = append(m.TimedElements, el)
+			case "Jump":
+				el := &Jump{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Measure.UnmarshalXML: %w", err)
+				}
+				m.TimedElements = append(m.TimedElements, el)
+			case "Marker":
+				el := &Marker{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Measure.UnmarshalXML: %w", err)
+				}
+				m.TimedElements = append(m.TimedElements, el)
 			case "StaffText":
 				el := &StaffText{}
 				if err = decoder.DecodeElement(el, &tok); err != nil {
 					return fmt.Errorf("Measure.UnmarshalXML: %w", err)
 				}
 				m.TimedElements = append(m.TimedElements, el)
+			case "FretDiagram":
+				el := &FretDiagram{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Measure.UnmarshalXML: %w", err)
+				}
+				m.TimedElements = append(m.TimedElements, el)
 			case "Chord":
 				el := &Chord{}
 				if err = decoder.DecodeElement(el, &tok); err != nil {
@@ -617,13 +892,16 @@ type EndSpanner struct {
 }
 
 type HairPin struct {
-	ID int `xml:"id,attr"`
+	// ID is the id of a hairpin of older versions, which is not in a
+	// Spanner.
+	ID int `xml:"id,attr,omitempty"`
 
 	Subtype      string       `xml:"subtype"`
 	VeloChange   int          `xml:"veloChange,omitempty"`
 	Segment      *Segment     `xml:"Segment"`
 	BeginText    *TextElement `xml:"beginText"`
 	ContinueText *TextElement `xml:"continueText"`
+	EndText      *RichText    `xml:"endText"`
 }
 
 type Segment struct {
@@ -635,26 +913,91 @@ type Segment struct {
 type Tick int64
 
 type Dynamic struct {
-	Subtype  string `xml:"subtype"`
-	Velocity int    `xml:"velocity,omitempty"`
+	Subtype  string   `xml:"subtype"`
+	Velocity int      `xml:"velocity,omitempty"`
+	Offset   *TextPos `xml:"offset"`
 }
 
 type LayoutBreak struct {
 	Subtype string `xml:"subtype"`
 }
 
+// Jump is a jump such as "D.S. al Coda" at the end of its measure. It
+// continues playback at the Marker labeled JumpTo ("start" for the
+// start of the score), plays until the end of the measure with the
+// marker labeled PlayUntil ("end" for the end of the score) and then
+// continues at the marker labeled ContinueAt, if any. Repeats are
+// played again after the jump only if PlayRepeats is 1.
+type Jump struct {
+	Text        []byte `xml:"text"`
+	JumpTo      string `xml:"jumpTo"`
+	PlayUntil   string `xml:"playUntil"`
+	ContinueAt  string `xml:"continueAt"`
+	PlayRepeats int    `xml:"playRepeats,omitempty"`
+}
+
+// Marker is a navigation mark of its measure, such as a segno, a coda or
+// "Fine", which jumps refer to by its Label ("segno", "codab", "fine",
+// "coda" for "To Coda", etc.).
+type Marker struct {
+	Text  []byte `xml:"text"`
+	Label string `xml:"label"`
+}
+
 type Tempo struct {
 	Tempo      float64  `xml:"tempo"`
 	FollowText int      `xml:"followText,omitempty"`
 	Pos        *TextPos `xml:"pos"`
-	Visible    int      `xml:"visible"`
-	Text       []byte   `xml:"text"`
+	// Visible is 0 for a tempo marking that is hidden.
+	Visible *int     `xml:"visible"`
+	Text    RichText `xml:"text"`
+}
+
+// RichText is the raw, escaped inner XML of a text element, including
+// formatting tags such as <b>, <font> and <sym>.
+type RichText []byte
+
+// UnmarshalXML implements xml.Unmarshaler.
+func (t *RichText) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	var v struct {
+		Inner []byte `xml:",innerxml"`
+	}
+	if err := decoder.DecodeElement(&v, &start); err != nil {
+		return fmt.Errorf("RichText.UnmarshalXML: %w", err)
+	}
+	*t = v.Inner
+	return nil
+}
+
+// MarshalXML implements xml.Marshaler.
+func (t RichText) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	v := struct {
+		Inner []byte `xml:",innerxml"`
+	}{Inner: t}
+	return encoder.EncodeElement(v, start)
+}
+
+// Fermata holds the chord or rest that follows it in its voice. MuseScore
+// plays the notes at that time TimeStretch times as long, or with no
+// change if TimeStretch is zero (unset). Play is 0 if the fermata is
+// ignored in playback.
+type Fermata struct {
+	Subtype     string  `xml:"subtype"`
+	TimeStretch float64 `xml:"timeStretch,omitempty"`
+	Play        *int    `xml:"play"`
+	Placement   string  `xml:"placement,omitempty"`
 }
 
 type StaffText struct {
-	Pos   *TextPos `xml:"pos"`
-	Style string   `xml:"style,omitempty"`
-	Text  []byte   `xml:"text"`
+	Pos       *TextPos `xml:"pos"`
+	Style     string   `xml:"style,omitempty"`
+	Placement string   `xml:"placement,omitempty"`
+	Text      RichText `xml:"text"`
+}
+
+// RehearsalMark represents the XML data of the same name.
+type RehearsalMark struct {
+	Text []byte `xml:"text"`
 }
 
 // type TempoText struct {
@@ -663,6 +1006,9 @@ type StaffText struct {
 
 // Instrument represents the XML data of the same name.
 type Instrument struct {
+	// ID is the id of the instrument's template (MuseScore 3.6 only).
+	ID string `xml:"id,attr,omitempty"`
+
 	LongName           string `xml:"longName,omitempty"`
 	ShortName          string `xml:"shortName,omitempty"`
 	TrackName          string `xml:"trackName"`
@@ -693,7 +1039,7 @@ type StringData struct {
 type Drum struct {
 	Pitch int `xml:"pitch,attr"`
 
-	Head     int    `xml:"head"`
+	Head     string `xml:"head"` // e.g. "normal", "cross", "diamond"
 	Line     int    `xml:"line"`
 	Voice    int    `xml:"voice"`
 	Name     string `xml:"name"`
@@ -912,7 +1258,18 @@ func (v *Voice) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
 	}
 
 	for _, el := range v.TimedElements {
-		if err := encoder.Encode(el); err != nil {
+		var err error
+		switch el.(type) {
+		case *Location:
+			err = encoder.EncodeElement(el, xml.StartElement{Name: xml.Name{Local: "location"}})
+		case *TupletElement:
+			err = encoder.EncodeElement(el, xml.StartElement{Name: xml.Name{Local: "Tuplet"}})
+		case *EndTuplet:
+			err = encoder.EncodeElement(el, xml.StartElement{Name: xml.Name{Local: "endTuplet"}})
+		default:
+			err = encoder.Encode(el)
+		}
+		if err != nil {
 			return fmt.Errorf("Voice.MarshalXML: %w", err)
 		}
 	}
@@ -969,6 +1326,85 @@ func (v *Voice) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error
 					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
 				}
 				v.TimedElements = append(v.TimedElements, el)
+			case "Harmony":
+				el := &Harmony{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, el)
+			case "StaffText":
+				el := &StaffText{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, el)
+			case "FretDiagram":
+				el := &FretDiagram{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, el)
+			case "RehearsalMark":
+				el := &RehearsalMark{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, el)
+			case "Tempo":
+				el := &Tempo{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, el)
+			case "Dynamic":
+				el := &Dynamic{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, el)
+			case "Fermata":
+				el := &Fermata{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, el)
+			case "Spanner":
+				el := &Spanner{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, el)
+			case "Beam":
+				el := &Beam{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, el)
+			case "Breath":
+				el := &Breath{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, el)
+			case "Tuplet":
+				el := &TupletElement{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, el)
+			case "endTuplet":
+				if err = decoder.Skip(); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, &EndTuplet{})
+			case "location":
+				// A gap in the voice, e.g. before the first chord of a
+				// second voice that starts in the middle of the measure.
+				el := &Location{}
+				if err = decoder.DecodeElement(el, &tok); err != nil {
+					return fmt.Errorf("Voice.UnmarshalXML: %w", err)
+				}
+				v.TimedElements = append(v.TimedElements, el)
 			default:
 				err := &UnhandledError{Type: "token", Name: tok.Name.Local, Offset: decoder.InputOffset()}
 				return fmt.Errorf("Voice.UnmarshalXML: %w", err)
@@ -981,17 +1417,92 @@ func (v *Voice) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error
 }
 
 type Rest struct {
-	DurationType string `xml:"durationType"`
+	EID string `xml:"eid,omitempty"`
+	// Visible is 0 for a rest that is hidden.
+	Visible      *int      `xml:"visible"`
+	BeamMode     string    `xml:"BeamMode,omitempty"`
+	Dots         int       `xml:"dots,omitempty"`
+	DurationType string    `xml:"durationType"`
+	Duration     string    `xml:"duration,omitempty"`
+	Lyrics       []*Lyrics `xml:"Lyrics"`
 }
 
 type BarLine struct {
-	Subtype string `xml:"subtype"`
+	Subtype string `xml:"subtype,omitempty"`
 }
 
 type KeySig struct {
 	Accidental string `xml:"accidental"`
 }
 
+// Fifths returns the number of sharps (or negative for flats) in the key signature.
+func (k *KeySig) Fifths() int {
+	v, _ := strconv.Atoi(k.Accidental)
+	return v
+}
+
+// Harmony represents a chord symbol, or a Roman numeral or Nashville
+// number analysis, attached to the following chord or rest.
+type Harmony struct {
+	// HarmonyType is 0 for chord symbols, 1 for Nashville numbers and
+	// 2 for Roman numeral analysis.
+	HarmonyType int `xml:"harmonyType,omitempty"`
+	// Root is the TPC of the chord root (chord symbols only).
+	Root *int   `xml:"root"`
+	Name string `xml:"name,omitempty"`
+	// Base is the TPC of the bass note of a slash chord (e.g. "C/G").
+	Base *int `xml:"base"`
+}
+
+// FretDiagram represents the XML data of the same name. Strings are
+// numbered from 0 for the leftmost (lowest-pitched) string, and fret
+// numbers are relative to FretOffset.
+type FretDiagram struct {
+	FretOffset int              `xml:"fretOffset,omitempty"`
+	Strings    int              `xml:"strings,omitempty"`
+	Frets      int              `xml:"frets,omitempty"`
+	Diagram    *FretDiagramData `xml:"fretDiagram"`
+	Harmony    *Harmony         `xml:"Harmony"`
+}
+
+// FretDiagramData represents the <fretDiagram> element of a FretDiagram.
+type FretDiagramData struct {
+	String []*FretString `xml:"string"`
+	Barre  []*FretBarre  `xml:"barre"`
+}
+
+// FretString represents the markings of a single string of a FretDiagram.
+type FretString struct {
+	No int `xml:"no,attr"`
+
+	// Marker is "circle" for an open string or "cross" for a muted one.
+	Marker string     `xml:"marker,omitempty"`
+	Dot    []*FretDot `xml:"dot"`
+}
+
+// FretDot represents a finger position on a string of a FretDiagram.
+type FretDot struct {
+	Fret int `xml:"fret,attr"`
+
+	// Type is the shape of the dot, e.g. "normal" or "cross".
+	Type string `xml:",chardata"`
+}
+
+// FretBarre represents a barre across the strings Start through End.
+type FretBarre struct {
+	Start int `xml:"start,attr"`
+	End   int `xml:"end,attr"`
+
+	Fret int `xml:",chardata"`
+}
+
+// Harmony types.
+const (
+	HarmonyStandard  = 0
+	HarmonyNashville = 1
+	HarmonyRoman     = 2
+)
+
 type TimeSig struct {
 	SigN            string `xml:"sigN"`
 	SigD            string `xml:"sigD"`
@@ -1022,28 +1533,101 @@ type TextPos struct {
 }
 
 type VBox struct {
-	Height string         `xml:"height"`
-	Text   []TextElement  `xml:"Text"`
-	Image  []ImageElement `xml:"Image"`
+	Height    string `xml:"height"`
+	BottomGap string `xml:"bottomGap,omitempty"`
+	// BoxAutoSize is 0 if the frame is not resized with its contents.
+	BoxAutoSize *int           `xml:"boxAutoSize"`
+	Text        []TextElement  `xml:"Text"`
+	Image       []ImageElement `xml:"Image"`
+}
+
+// HBox is a horizontal frame, such as the space before the first measure.
+type HBox struct {
+	Width string `xml:"width"`
+	// BoxAutoSize is 0 if the frame is not resized with its contents.
+	BoxAutoSize *int `xml:"boxAutoSize"`
 }
 
 type StyleEnum string
 
 const (
-	Composer StyleEnum = "Composer"
-	Subtitle StyleEnum = "Subtitle"
-	Title    StyleEnum = "Title"
-	Tuplet   StyleEnum = "Tuplet"
+	Composer          StyleEnum = "Composer"
+	InstrumentExcerpt StyleEnum = "Instrument Name (Part)"
+	Lyricist          StyleEnum = "Lyricist"
+	Subtitle          StyleEnum = "Subtitle"
+	Title             StyleEnum = "Title"
+	Tuplet            StyleEnum = "Tuplet"
 )
 
 type Chord struct {
-	Dots         int        `xml:"dots,omitempty"`
-	DurationType string     `xml:"durationType"`
-	Lyrics       []*Lyrics  `xml:"Lyrics"`
-	Spanner      []*Spanner `xml:"Spanner"`
-	Note         []*Note    `xml:"Note"`
+	// EID identifies linked elements across the main score and excerpts.
+	EID string `xml:"eid,omitempty"`
+	// BeamMode is "no" for a chord that is not beamed, "begin" for one
+	// that starts a new beam, etc., or empty for automatic beaming.
+	BeamMode     string          `xml:"BeamMode,omitempty"`
+	Dots         int             `xml:"dots,omitempty"`
+	DurationType string          `xml:"durationType"`
+	Lyrics       []*Lyrics       `xml:"Lyrics"`
+	Spanner      []*Spanner      `xml:"Spanner"`
+	Articulation []*Articulation `xml:"Articulation"`
+	// Acciaccatura and Appoggiatura are set for grace notes, which take
+	// no time of their own.
+	Acciaccatura  *struct{} `xml:"acciaccatura"`
+	Appoggiatura  *struct{} `xml:"appoggiatura"`
+	StemDirection string    `xml:"StemDirection,omitempty"`
+	Note          []*Note   `xml:"Note"`
+	Arpeggio      *Arpeggio `xml:"Arpeggio"`
+	Tremolo       *Tremolo  `xml:"Tremolo"`
+}
+
+// Articulation is an articulation or ornament of a chord, such as
+// "articAccentAbove".
+type Articulation struct {
+	Subtype string `xml:"subtype"`
+	Anchor  string `xml:"anchor,omitempty"`
+}
+
+// Arpeggio represents the XML data of the same name.
+type Arpeggio struct {
+	Subtype string `xml:"subtype"`
+}
+
+// Tremolo represents the XML data of the same name, e.g. "r16" for a
+// single-note tremolo of three strokes.
+type Tremolo struct {
+	Subtype string `xml:"subtype"`
+}
+
+// Beam holds the properties of the beam of the chords that follow it.
+type Beam struct {
+	StemDirection string          `xml:"StemDirection,omitempty"`
+	Fragment      []*BeamFragment `xml:"Fragment"`
+}
+
+// BeamFragment is a user-adjusted position of a beam.
+type BeamFragment struct {
+	Y1 float64 `xml:"y1"`
+	Y2 float64 `xml:"y2"`
 }
 
+// Breath is a breath mark or caesura after the preceding chord.
+type Breath struct {
+	Symbol string `xml:"symbol"`
+}
+
+// TupletElement starts a tuplet: the chords and rests up to the next
+// EndTuplet are played in NormalNotes / ActualNotes of their duration.
+type TupletElement struct {
+	Offset      *TextPos     `xml:"offset"`
+	NormalNotes int          `xml:"normalNotes"`
+	ActualNotes int          `xml:"actualNotes"`
+	BaseNote    string       `xml:"baseNote"`
+	Number      *TextElement `xml:"Number"`
+}
+
+// EndTuplet ends the innermost tuplet of a voice.
+type EndTuplet struct{}
+
 type Lyrics struct {
 	No       int    `xml:"no,omitempty"`
 	Syllabic string `xml:"syllabic,omitempty"`
@@ -1054,26 +1638,92 @@ type Lyrics struct {
 type Spanner struct {
 	Type string `xml:"type,attr"`
 
-	Slur *Slur     `xml:"Slur"`
-	Next *NextPrev `xml:"next"`
-	Prev *NextPrev `xml:"prev"`
+	Slur              *Slur              `xml:"Slur"`
+	Tie               *Tie               `xml:"Tie"`
+	TempoChangeRanged *TempoChangeRanged `xml:"TempoChangeRanged"`
+	Volta             *Volta             `xml:"Volta"`
+	HairPin           *HairPin           `xml:"HairPin"`
+	Ottava            *Ottava            `xml:"Ottava"`
+	Next              *NextPrev          `xml:"next"`
+	Prev              *NextPrev          `xml:"prev"`
+}
+
+// Volta is an ending bracket over the measures of its spanner, which are
+// played only on the passes through the repeated section listed in
+// Endings (e.g. "1, 2").
+type Volta struct {
+	EndHookType int    `xml:"endHookType,omitempty"`
+	BeginText   string `xml:"beginText,omitempty"`
+	Endings     string `xml:"endings"`
 }
 
 type Slur struct {
-	Up string `xml:"up,omitempty"`
+	Up          string         `xml:"up,omitempty"`
+	SlurSegment []*SlurSegment `xml:"SlurSegment"`
+}
+
+// SlurSegment holds the user adjustments of the No-th segment of a slur
+// (one per system): the offsets of its start, its two control points and
+// its end.
+type SlurSegment struct {
+	No int `xml:"no,attr"`
+
+	O1 *TextPos `xml:"o1"`
+	O2 *TextPos `xml:"o2"`
+	O3 *TextPos `xml:"o3"`
+	O4 *TextPos `xml:"o4"`
+}
+
+// Ottava is an octave line such as "8va" or "15mb".
+type Ottava struct {
+	Subtype string `xml:"subtype"`
+}
+
+// Tie joins a note to the following note of the same pitch.
+type Tie struct{}
+
+// TempoChangeRanged is a gradual change of tempo, such as a ritardando,
+// over the span of its Spanner. TempoChangeFactor is the final tempo
+// relative to the tempo at the start; if it is zero, the default factor
+// of TempoChangeType is used. TempoEasingMethod is "normal" (linear),
+// "ease-in", "ease-out", "ease-in-out" or "exponential".
+type TempoChangeRanged struct {
+	TempoChangeType   string  `xml:"tempoChangeType,omitempty"`
+	TempoEasingMethod string  `xml:"tempoEasingMethod,omitempty"`
+	TempoChangeFactor float64 `xml:"tempoChangeFactor,omitempty"`
+	BeginText         string  `xml:"beginText,omitempty"`
 }
 
 type NextPrev struct {
 	Location *Location `xml:"location"`
 }
 
+// Location is the position of the other end of a spanner relative to this
+// one: a number of measures and a fraction of a whole note within them.
 type Location struct {
-	Fractions string `xml:"fractions"`
+	Voices    int    `xml:"voices,omitempty"`
+	Measures  int    `xml:"measures,omitempty"`
+	Fractions string `xml:"fractions,omitempty"`
 }
 
 type Note struct {
-	Pitch int `xml:"pitch"`
-	TPC   int `xml:"tpc"`
+	EID        string      `xml:"eid,omitempty"`
+	Accidental *Accidental `xml:"Accidental"`
+	// Spanner holds the ties of the note.
+	Spanner []*Spanner `xml:"Spanner"`
+	Pitch   int        `xml:"pitch"`
+	TPC     int        `xml:"tpc"`
+	// Fret and String locate the note on a fretted instrument, where
+	// string 0 is the highest-pitched string.
+	Fret   *int `xml:"fret"`
+	String *int `xml:"string"`
+}
+
+// Accidental is the accidental shown on a note.
+type Accidental struct {
+	// Role is 1 for a courtesy accidental that the user added.
+	Role    int    `xml:"role,omitempty"`
+	Subtype string `xml:"subtype"`
 }
 
 type Synthesizer struct {
@@ -0,0 +1,223 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Statistics summarizes a score, e.g. to report its performance duration.
+type Statistics struct {
+	// Duration is the playing time of the score with repeats and jumps
+	// expanded (see Score.PlaybackOrder) and its tempo map applied (see
+	// Score.TempoMap).
+	Duration time.Duration
+	// Measures is the number of measures as written, and PlayedMeasures
+	// the number played with repeats and jumps expanded.
+	Measures       int
+	PlayedMeasures int
+	Parts          []*PartStatistics
+	// Durations counts the chords of the score by duration, most used
+	// first.
+	Durations []*DurationCount
+	// LyricSyllables is the number of lyric syllables of all parts.
+	LyricSyllables int
+	// KeyChanges and TimeSigChanges are the key and time signatures of
+	// the first staff, starting with the initial ones.
+	KeyChanges     []*KeyChange
+	TimeSigChanges []*TimeSigChange
+}
+
+// PartStatistics summarizes the notes of a part.
+type PartStatistics struct {
+	Name string
+	// Notes is the number of notes (noteheads) as written, counting each
+	// note of a chord and each tied note.
+	Notes int
+	// Lowest and Highest are the lowest and highest sounding notes of the
+	// part, or nil if it has no notes.
+	Lowest, Highest *Note
+	LyricSyllables  int
+}
+
+// DurationCount is the number of chords with a duration.
+type DurationCount struct {
+	DurationType string
+	Dots         int
+	Count        int
+}
+
+// String returns the duration type followed by a period for each dot,
+// e.g. "quarter.".
+func (d *DurationCount) String() string {
+	return d.DurationType + strings.Repeat(".", d.Dots)
+}
+
+// KeyChange is a key signature at the start of a 1-based measure.
+type KeyChange struct {
+	Measure int
+	// Fifths is the number of sharps, or negative for flats.
+	Fifths int
+}
+
+// TimeSigChange is a time signature at the start of a 1-based measure.
+type TimeSigChange struct {
+	Measure int
+	SigN    string
+	SigD    string
+}
+
+func (t *TimeSigChange) String() string {
+	return t.SigN + "/" + t.SigD
+}
+
+// Statistics returns statistics of the main score. Lyric syllables are
+// counted for every verse.
+func (s *ScoreZip) Statistics() (*Statistics, error) {
+	score := &s.MuseScore.Score
+	stats := &Statistics{}
+
+	byPart := map[*Part]*PartStatistics{}
+	for _, part := range score.Part {
+		ps := &PartStatistics{Name: part.TrackName}
+		if ps.Name == "" && part.Instrument != nil {
+			ps.Name = part.Instrument.LongName
+		}
+		byPart[part] = ps
+		stats.Parts = append(stats.Parts, ps)
+	}
+
+	durations := map[DurationCount]int{}
+	err := score.Walk(func(ev *Event) error {
+		chord, ok := ev.Element.(*Chord)
+		if !ok {
+			return nil
+		}
+		durations[DurationCount{DurationType: chord.DurationType, Dots: chord.Dots}]++
+		ps := byPart[score.PartForStaff(ev.StaffID)]
+		if ps == nil {
+			return nil
+		}
+		for _, lyrics := range chord.Lyrics {
+			if lyrics.Text != "" {
+				ps.LyricSyllables++
+				stats.LyricSyllables++
+			}
+		}
+		for _, note := range chord.Note {
+			ps.Notes++
+			if ps.Lowest == nil || note.Pitch < ps.Lowest.Pitch {
+				ps.Lowest = note
+			}
+			if ps.Highest == nil || note.Pitch > ps.Highest.Pitch {
+				ps.Highest = note
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ScoreZip.Statistics: %w", err)
+	}
+
+	division := score.division()
+	for d, count := range durations {
+		stats.Durations = append(stats.Durations, &DurationCount{DurationType: d.DurationType, Dots: d.Dots, Count: count})
+	}
+	sort.Slice(stats.Durations, func(i, j int) bool {
+		a, b := stats.Durations[i], stats.Durations[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		at, _ := DurationTicks(a.DurationType, a.Dots, division)
+		bt, _ := DurationTicks(b.DurationType, b.Dots, division)
+		return at > bt
+	})
+
+	if len(score.Staffs) == 0 {
+		return stats, nil
+	}
+	ends, err := stats.measures(score)
+	if err != nil {
+		return nil, fmt.Errorf("ScoreZip.Statistics: %w", err)
+	}
+	order, err := score.PlaybackOrder()
+	if err != nil {
+		return nil, fmt.Errorf("ScoreZip.Statistics: %w", err)
+	}
+	tempo, err := score.TempoMap()
+	if err != nil {
+		return nil, fmt.Errorf("ScoreZip.Statistics: %w", err)
+	}
+	var seconds float64
+	for _, measure := range order {
+		start := 0
+		if measure > 1 {
+			start = ends[measure-2]
+		}
+		seconds += tempo.Seconds(ends[measure-1]) - tempo.Seconds(start)
+	}
+	stats.PlayedMeasures = len(order)
+	stats.Duration = time.Duration(math.Round(seconds * float64(time.Second)))
+	return stats, nil
+}
+
+// measures records the measure count and the key and time signature
+// changes of the first staff of the score, and returns the tick at the
+// end of each of its measures.
+func (stats *Statistics) measures(score *Score) ([]int, error) {
+	staff := score.Staffs[0]
+	stats.Measures = len(staff.Measure)
+	var keySig *KeySig
+	var timeSig *TimeSig
+	var tick int
+	ends := make([]int, 0, len(staff.Measure))
+	for i, m := range staff.Measure {
+		prevKeySig, prevTimeSig := keySig, timeSig
+		if m.KeySig != nil {
+			keySig = m.KeySig
+		}
+		if m.TimeSig != nil {
+			timeSig = m.TimeSig
+		}
+		if len(m.Voice) > 0 {
+			if v := m.Voice[0]; v.KeySig != nil {
+				keySig = v.KeySig
+			}
+			if v := m.Voice[0]; v.TimeSig != nil {
+				timeSig = v.TimeSig
+			}
+		}
+		if keySig != prevKeySig && (prevKeySig == nil || keySig.Fifths() != prevKeySig.Fifths()) {
+			stats.KeyChanges = append(stats.KeyChanges, &KeyChange{Measure: i + 1, Fifths: keySig.Fifths()})
+		}
+		if timeSig != prevTimeSig && (prevTimeSig == nil || timeSig.SigN != prevTimeSig.SigN || timeSig.SigD != prevTimeSig.SigD) {
+			stats.TimeSigChanges = append(stats.TimeSigChanges, &TimeSigChange{Measure: i + 1, SigN: timeSig.SigN, SigD: timeSig.SigD})
+		}
+
+		ticks, err := score.MeasureTicks(m, timeSig)
+		if err != nil {
+			return nil, fmt.Errorf("staff %v, measure %v: %w", staff.ID, i+1, err)
+		}
+		tick += ticks
+		ends = append(ends, tick)
+	}
+	return ends, nil
+}
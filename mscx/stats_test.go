@@ -0,0 +1,89 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStatistics(t *testing.T) {
+	sz, err := NewScore().
+		AddPart("Soprano").Key(-1).
+		AddMeasure("3/4").Note("F4", "quarter").Lyric("Hal-").Note("A4", "quarter").Lyric("le-").Note("C5", "quarter").Lyric("lu-").
+		AddMeasure("").Note("D5", "half.").Lyric("jah").
+		Key(2).AddMeasure("4/4").Chord([]string{"D5", "F#5"}, "half").Note("A4", "quarter").Note("D4", "quarter").
+		AddPart("Bass").
+		AddMeasure("").Note("F3", "half.").
+		AddMeasure("").Rest("half.").
+		AddMeasure("").Note("D3", "whole").
+		Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	score := &sz.MuseScore.Score
+	// ♩ = 60, with the first two measures repeated.
+	v := score.Staffs[0].Measure[0].Voice[0]
+	v.TimedElements = append([]any{&Tempo{Tempo: 1}}, v.TimedElements...)
+	score.Staffs[0].Measure[1].EndRepeat = 2
+
+	got, err := sz.Statistics()
+	if err != nil {
+		t.Fatalf("Statistics: %v", err)
+	}
+	want := &Statistics{
+		Duration:       16 * time.Second,
+		Measures:       3,
+		PlayedMeasures: 5,
+		Parts: []*PartStatistics{
+			{Name: "Soprano", Notes: 8, Lowest: &Note{Pitch: 62, TPC: 16}, Highest: &Note{Pitch: 78, TPC: 20}, LyricSyllables: 4},
+			{Name: "Bass", Notes: 2, Lowest: &Note{Pitch: 50, TPC: 16}, Highest: &Note{Pitch: 53, TPC: 13}},
+		},
+		Durations: []*DurationCount{
+			{DurationType: "quarter", Count: 5},
+			{DurationType: "half", Dots: 1, Count: 2},
+			{DurationType: "whole", Count: 1},
+			{DurationType: "half", Count: 1},
+		},
+		LyricSyllables: 4,
+		KeyChanges:     []*KeyChange{{Measure: 1, Fifths: -1}, {Measure: 3, Fifths: 2}},
+		TimeSigChanges: []*TimeSigChange{{Measure: 1, SigN: "3", SigD: "4"}, {Measure: 3, SigN: "4", SigD: "4"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Statistics mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestDurationCount_String(t *testing.T) {
+	tests := []struct {
+		d    *DurationCount
+		want string
+	}{
+		{d: &DurationCount{DurationType: "quarter"}, want: "quarter"},
+		{d: &DurationCount{DurationType: "eighth", Dots: 2}, want: "eighth.."},
+	}
+
+	for _, tt := range tests {
+		if got := tt.d.String(); got != tt.want {
+			t.Errorf("String = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// TabPosition is a place on a fretted instrument where a pitch can be
+// played. String 0 is the highest-pitched string, as in MuseScore.
+type TabPosition struct {
+	String, Fret int
+}
+
+// maxTabCandidates limits the number of fingerings considered per chord.
+const maxTabCandidates = 32
+
+// Positions returns every string and fret on which the pitch can be played.
+func (sd *StringData) Positions(pitch int) []TabPosition {
+	var result []TabPosition
+	for s := range sd.String {
+		open := sd.String[len(sd.String)-1-s]
+		if fret := pitch - open; fret >= 0 && fret <= sd.Frets {
+			result = append(result, TabPosition{String: s, Fret: fret})
+		}
+	}
+	return result
+}
+
+// fingering is one way of playing all the pitches of a tabSlice.
+type fingering struct {
+	positions []TabPosition
+	cost      float64
+	// hand is the lowest fretted fret, or -1 if every string is open.
+	hand int
+}
+
+// tabSlice holds the notes of a part that begin on the same tick.
+type tabSlice struct {
+	pos     Position
+	pitches []int
+	notes   map[int][]*Note
+}
+
+// AssignFrets chooses a string and fret for every note of the given part
+// from its instrument's StringData and writes them into the notes. Notes
+// that begin together are placed on different strings, and the choice
+// minimizes the stretch within each chord and the movement of the hand
+// between chords. It returns the number of notes assigned.
+func (s *Score) AssignFrets(part *Part) (int, error) {
+	if part.Instrument == nil || part.Instrument.StringData == nil || len(part.Instrument.StringData.String) == 0 {
+		return 0, fmt.Errorf("Score.AssignFrets: part %q has no string data", part.TrackName)
+	}
+	sd := part.Instrument.StringData
+
+	byTick := map[int]*tabSlice{}
+	for _, ps := range part.Staff {
+		index := s.staffIndex(ps.ID)
+		if index < 0 {
+			return 0, fmt.Errorf("Score.AssignFrets: part staff %v not found in score", ps.ID)
+		}
+		err := s.WalkStaff(s.Staffs[index], func(ev *Event) error {
+			chord, ok := ev.Element.(*Chord)
+			if !ok {
+				return nil
+			}
+			sl, ok := byTick[ev.Tick]
+			if !ok {
+				sl = &tabSlice{pos: ev.Position, notes: map[int][]*Note{}}
+				byTick[ev.Tick] = sl
+			}
+			for _, note := range chord.Note {
+				if _, ok := sl.notes[note.Pitch]; !ok {
+					sl.pitches = append(sl.pitches, note.Pitch)
+				}
+				sl.notes[note.Pitch] = append(sl.notes[note.Pitch], note)
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, fmt.Errorf("Score.AssignFrets: %w", err)
+		}
+	}
+
+	ticks := make([]int, 0, len(byTick))
+	for tick := range byTick {
+		ticks = append(ticks, tick)
+	}
+	sort.Ints(ticks)
+
+	slices := make([]*tabSlice, len(ticks))
+	candidates := make([][]*fingering, len(ticks))
+	for i, tick := range ticks {
+		sl := byTick[tick]
+		sort.Sort(sort.Reverse(sort.IntSlice(sl.pitches)))
+		slices[i] = sl
+		candidates[i] = fingerings(sd, sl.pitches)
+		if len(candidates[i]) == 0 {
+			return 0, fmt.Errorf("Score.AssignFrets: %v: pitches %v cannot be played on this instrument", sl.pos, sl.pitches)
+		}
+	}
+
+	// Choose the cheapest path through the candidate fingerings.
+	costs := make([][]float64, len(candidates))
+	prev := make([][]int, len(candidates))
+	for i, cands := range candidates {
+		costs[i] = make([]float64, len(cands))
+		prev[i] = make([]int, len(cands))
+		for k, f := range cands {
+			if i == 0 {
+				costs[i][k] = f.cost
+				continue
+			}
+			best := math.Inf(1)
+			for j, g := range candidates[i-1] {
+				c := costs[i-1][j] + f.cost
+				if f.hand >= 0 && g.hand >= 0 {
+					c += math.Abs(float64(f.hand - g.hand))
+				}
+				if c < best {
+					best, prev[i][k] = c, j
+				}
+			}
+			costs[i][k] = best
+		}
+	}
+
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+	var count int
+	last := len(candidates) - 1
+	k := 0
+	for j := range costs[last] {
+		if costs[last][j] < costs[last][k] {
+			k = j
+		}
+	}
+	for i := last; i >= 0; i-- {
+		f := candidates[i][k]
+		for pi, pitch := range slices[i].pitches {
+			for _, note := range slices[i].notes[pitch] {
+				str, fret := f.positions[pi].String, f.positions[pi].Fret
+				note.String, note.Fret = &str, &fret
+				count++
+			}
+		}
+		k = prev[i][k]
+	}
+	return count, nil
+}
+
+// fingerings returns the cheapest ways to play the given pitches at once,
+// each on a different string.
+func fingerings(sd *StringData, pitches []int) []*fingering {
+	var result []*fingering
+	used := make([]bool, len(sd.String))
+	current := make([]TabPosition, len(pitches))
+
+	var search func(i int)
+	search = func(i int) {
+		if i == len(pitches) {
+			result = append(result, newFingering(current))
+			return
+		}
+		for _, p := range sd.Positions(pitches[i]) {
+			if used[p.String] {
+				continue
+			}
+			used[p.String] = true
+			current[i] = p
+			search(i + 1)
+			used[p.String] = false
+		}
+	}
+	search(0)
+
+	sort.SliceStable(result, func(a, b int) bool { return result[a].cost < result[b].cost })
+	if len(result) > maxTabCandidates {
+		result = result[:maxTabCandidates]
+	}
+	return result
+}
+
+func newFingering(positions []TabPosition) *fingering {
+	f := &fingering{positions: append([]TabPosition(nil), positions...), hand: -1}
+	maxFret := -1
+	for _, p := range positions {
+		if p.Fret == 0 {
+			continue
+		}
+		if f.hand < 0 || p.Fret < f.hand {
+			f.hand = p.Fret
+		}
+		if p.Fret > maxFret {
+			maxFret = p.Fret
+		}
+		// Prefer lower positions.
+		f.cost += 0.1 * float64(p.Fret)
+	}
+	// A hand comfortably spans four frets.
+	if span := maxFret - f.hand; f.hand >= 0 && span > 3 {
+		f.cost += 10 * float64(span-3)
+	}
+	return f
+}
+
+// tabStaff returns the tablature staff of the part, or its first staff.
+func (s *Score) tabStaff(part *Part) *ScoreStaff {
+	for _, ps := range part.Staff {
+		if ps.StaffType.Group == "tablature" {
+			if index := s.staffIndex(ps.ID); index >= 0 {
+				return s.Staffs[index]
+			}
+		}
+	}
+	if len(part.Staff) > 0 {
+		if index := s.staffIndex(part.Staff[0].ID); index >= 0 {
+			return s.Staffs[index]
+		}
+	}
+	return nil
+}
+
+// stringNames returns the names of the open strings of sd, highest first.
+// The name of a string is lowercased if a lower string has the same name
+// (e.g. "e" and "E" on a guitar).
+func stringNames(sd *StringData) []string {
+	n := len(sd.String)
+	names := make([]string, n)
+	seen := map[string]bool{}
+	for s := n - 1; s >= 0; s-- {
+		open := sd.String[n-1-s]
+		name := strings.TrimRight(PitchName(open, DefaultTPC(open)), "-0123456789")
+		if seen[name] {
+			names[s] = strings.ToLower(name)
+		} else {
+			names[s] = name
+		}
+		seen[name] = true
+	}
+	return names
+}
+
+// RenderTab renders the given part as ASCII tablature using the string and
+// fret of each note (see AssignFrets). The part's tablature staff is used
+// if it has one; otherwise its first staff. Each system holds
+// measuresPerLine measures, or all of them if measuresPerLine <= 0.
+func (s *Score) RenderTab(part *Part, measuresPerLine int) (string, error) {
+	if part.Instrument == nil || part.Instrument.StringData == nil || len(part.Instrument.StringData.String) == 0 {
+		return "", fmt.Errorf("Score.RenderTab: part %q has no string data", part.TrackName)
+	}
+	sd := part.Instrument.StringData
+	staff := s.tabStaff(part)
+	if staff == nil {
+		return "", fmt.Errorf("Score.RenderTab: part %q has no staves", part.TrackName)
+	}
+	numStrings := len(sd.String)
+
+	// columns[measure][tick] holds the text of each string at that tick.
+	var columns []map[int][]string
+	err := s.WalkStaff(staff, func(ev *Event) error {
+		for len(columns) < ev.Measure {
+			columns = append(columns, map[int][]string{})
+		}
+		switch el := ev.Element.(type) {
+		case *Chord, *Rest:
+			col, ok := columns[ev.Measure-1][ev.MeasureTick]
+			if !ok {
+				col = make([]string, numStrings)
+				columns[ev.Measure-1][ev.MeasureTick] = col
+			}
+			chord, ok := el.(*Chord)
+			if !ok {
+				return nil
+			}
+			for _, note := range chord.Note {
+				if note.Fret == nil || note.String == nil {
+					return fmt.Errorf("%v: note has no string and fret", ev.Position)
+				}
+				if *note.String < 0 || *note.String >= numStrings {
+					return fmt.Errorf("%v: invalid string %v", ev.Position, *note.String)
+				}
+				col[*note.String] = fmt.Sprintf("%v", *note.Fret)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("Score.RenderTab: %w", err)
+	}
+
+	names := stringNames(sd)
+	var width int
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	if measuresPerLine <= 0 {
+		measuresPerLine = len(columns)
+	}
+
+	var sb strings.Builder
+	for start := 0; start < len(columns); start += measuresPerLine {
+		if start > 0 {
+			sb.WriteString("\n")
+		}
+		lines := make([]strings.Builder, numStrings)
+		for str := range lines {
+			fmt.Fprintf(&lines[str], "%-*v|", width, names[str])
+		}
+		for m := start; m < start+measuresPerLine && m < len(columns); m++ {
+			ticks := make([]int, 0, len(columns[m]))
+			for tick := range columns[m] {
+				ticks = append(ticks, tick)
+			}
+			sort.Ints(ticks)
+			for str := range lines {
+				lines[str].WriteString("-")
+			}
+			for _, tick := range ticks {
+				col := columns[m][tick]
+				var w int
+				for _, cell := range col {
+					if len(cell) > w {
+						w = len(cell)
+					}
+				}
+				if w == 0 {
+					w = 1
+				}
+				for str, cell := range col {
+					lines[str].WriteString(cell + strings.Repeat("-", w-len(cell)+1))
+				}
+			}
+			for str := range lines {
+				lines[str].WriteString("|")
+			}
+		}
+		for str := range lines {
+			sb.WriteString(lines[str].String())
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,109 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAssignFrets(t *testing.T) {
+	tests := []struct {
+		name       string
+		instrument string
+		build      func(b *ScoreBuilder) *ScoreBuilder
+		want       string
+	}{
+		{
+			name:       "guitar C major chord and scale",
+			instrument: "pluck.guitar.steel",
+			build: func(b *ScoreBuilder) *ScoreBuilder {
+				return b.AddMeasure("4/4").Chord([]string{"C3", "E3", "G3", "C4", "E4"}, "half").
+					Note("C4", "quarter").Note("D4", "quarter").
+					AddMeasure("").Note("E4", "quarter").Note("F4", "quarter").Note("G4", "quarter").Rest("quarter")
+			},
+			want: "e|-0-----|-0-1-3---|\n" +
+				"B|-1-1-3-|---------|\n" +
+				"G|-0-----|---------|\n" +
+				"D|-2-----|---------|\n" +
+				"A|-3-----|---------|\n" +
+				"E|-------|---------|\n",
+		},
+		{
+			name:       "ukulele",
+			instrument: "pluck.ukulele",
+			build: func(b *ScoreBuilder) *ScoreBuilder {
+				return b.AddMeasure("3/4").Chord([]string{"G4", "C4", "E4", "A4"}, "quarter").Note("B4", "quarter").Note("C5", "quarter")
+			},
+			want: "A|-0-2-3-|\n" +
+				"E|-0-----|\n" +
+				"C|-0-----|\n" +
+				"G|-0-----|\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sz, err := tt.build(NewScore().AddInstrument(tt.instrument)).Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			score := &sz.MuseScore.Score
+			part := score.Part[0]
+			if _, err := score.AssignFrets(part); err != nil {
+				t.Fatal(err)
+			}
+			got, err := score.RenderTab(part, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("RenderTab differs (-want +got):\n%s", diff)
+			}
+
+			// Round-trip through XML.
+			gotXML, err := sz.XML()
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := New(gotXML, nil)
+			if err != nil {
+				t.Fatalf("New: %v\n%s", err, gotXML)
+			}
+			if diff := cmp.Diff(sz, parsed); diff != "" {
+				t.Errorf("round trip differs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAssignFrets_Errors(t *testing.T) {
+	sz, err := NewScore().AddInstrument("pluck.ukulele").AddMeasure("4/4").Note("C3", "whole").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := &sz.MuseScore.Score
+	if _, err := score.AssignFrets(score.Part[0]); err == nil {
+		t.Error("AssignFrets of an unplayable pitch did not fail")
+	}
+	if _, err := score.RenderTab(score.Part[0], 0); err == nil {
+		t.Error("RenderTab of a note without a fret did not fail")
+	}
+}
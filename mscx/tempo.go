@@ -0,0 +1,419 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultTempo is MuseScore's tempo in quarter notes per second for a
+// score without a tempo marking (♩ = 120).
+const DefaultTempo = 2.0
+
+// TempoMap converts between score time in ticks and real time. It is
+// built from a score's Tempo markings, its gradual tempo changes
+// (TempoChangeRanged spanners) and its fermatas.
+type TempoMap struct {
+	division int
+	// The tempo is constant from each tick until the next.
+	ticks   []int
+	tempos  []float64 // in quarter notes per second
+	seconds []float64 // the time of each tick
+}
+
+// tempoPoint is a change of tempo at a tick.
+type tempoPoint struct {
+	tick  int
+	tempo float64
+}
+
+// tempoRamp is a gradual change of tempo.
+type tempoRamp struct {
+	start, end int
+	factor     float64
+	easing     string
+}
+
+// defaultTempoChangeFactors are MuseScore's factors for gradual tempo
+// changes without an explicit factor.
+var defaultTempoChangeFactors = map[string]float64{
+	"accelerando":  1.33,
+	"allargando":   0.75,
+	"calando":      0.5,
+	"lentando":     0.75,
+	"morendo":      0.5,
+	"precipitando": 1.15,
+	"rallentando":  0.75,
+	"ritardando":   0.75,
+	"smorzando":    0.5,
+	"sostenuto":    0.95,
+	"stringendo":   1.5,
+}
+
+// TempoMap returns the tempo map of the score. Tempo markings set the
+// tempo from their tick onward; a marking whose FollowText is set takes
+// its tempo from its text if ParseTempoText understands it. A gradual
+// tempo change moves from the tempo at its start to that tempo times its
+// factor at its end, which then lasts until the next tempo marking. A
+// fermata slows the tempo by its TimeStretch until the next chord or rest
+// of any staff begins or ends. Tempo markings and fermatas are read from
+// every staff.
+func (s *Score) TempoMap() (*TempoMap, error) {
+	div := s.division()
+	marks := map[int]float64{}
+	fermatas := map[int]float64{}
+	onsets := map[int]bool{}
+	var ramps []tempoRamp
+	var pending []*Event // TempoChangeRanged starts, resolved once measures are known
+	// measureStarts holds the start of each measure of each staff, and the
+	// end of its last measure as the start of the next.
+	measureStarts := map[*ScoreStaff]map[int]int{}
+
+	err := s.Walk(func(ev *Event) error {
+		starts := measureStarts[ev.Staff]
+		if starts == nil {
+			starts = map[int]int{}
+			measureStarts[ev.Staff] = starts
+		}
+		if _, ok := starts[ev.Measure+1]; !ok {
+			ticks, err := s.MeasureTicks(ev.Bar, ev.TimeSig)
+			if err != nil {
+				return err
+			}
+			starts[ev.Measure] = ev.Tick - ev.MeasureTick
+			starts[ev.Measure+1] = starts[ev.Measure] + ticks
+		}
+		switch el := ev.Element.(type) {
+		case *Tempo:
+			if el.FollowText != 0 {
+				if tempo, ok := ParseTempoText(string(el.Text)); ok {
+					marks[ev.Tick] = tempo
+					break
+				}
+			}
+			if el.Tempo > 0 {
+				marks[ev.Tick] = el.Tempo
+			}
+		case *Fermata:
+			if el.TimeStretch > 0 && (el.Play == nil || *el.Play != 0) && el.TimeStretch > fermatas[ev.Tick] {
+				fermatas[ev.Tick] = el.TimeStretch
+			}
+		case *Spanner:
+			if el.TempoChangeRanged != nil && el.Next != nil {
+				pending = append(pending, ev)
+			}
+		case *Chord, *Rest:
+			onsets[ev.Tick] = true
+			onsets[ev.Tick+ev.Ticks] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Score.TempoMap: %w", err)
+	}
+
+	for _, ev := range pending {
+		sp := ev.Element.(*Spanner)
+		end, err := s.spannerEndTick(ev, sp.Next.Location, measureStarts[ev.Staff])
+		if err != nil {
+			return nil, fmt.Errorf("Score.TempoMap: %v: %w", ev.Position, err)
+		}
+		tc := sp.TempoChangeRanged
+		factor := tc.TempoChangeFactor
+		if factor <= 0 {
+			factor = defaultTempoChangeFactors[strings.ToLower(tc.TempoChangeType)]
+		}
+		if factor > 0 && end > ev.Tick {
+			ramps = append(ramps, tempoRamp{start: ev.Tick, end: end, factor: factor, easing: tc.TempoEasingMethod})
+		}
+	}
+
+	points := []tempoPoint{{tick: 0, tempo: DefaultTempo}}
+	for _, tick := range sortedKeys(marks) {
+		points = setTempo(points, tick, marks[tick])
+	}
+	sort.Slice(ramps, func(i, j int) bool { return ramps[i].start < ramps[j].start })
+	for _, r := range ramps {
+		points = applyRamp(points, r, marks, div)
+	}
+	sortedOnsets := sortedKeys(onsets)
+	for _, tick := range sortedKeys(fermatas) {
+		i := sort.SearchInts(sortedOnsets, tick+1)
+		if i == len(sortedOnsets) {
+			continue // a fermata after the end of the score takes no time
+		}
+		points = scaleTempo(points, tick, sortedOnsets[i], 1/fermatas[tick])
+	}
+
+	t := &TempoMap{division: div}
+	for i, p := range points {
+		if i > 0 && p.tempo == t.tempos[len(t.tempos)-1] {
+			continue
+		}
+		secs := 0.0
+		if i > 0 {
+			secs = t.Seconds(p.tick)
+		}
+		t.ticks = append(t.ticks, p.tick)
+		t.tempos = append(t.tempos, p.tempo)
+		t.seconds = append(t.seconds, secs)
+	}
+	return t, nil
+}
+
+// spannerEndTick returns the tick of the other end of a voice spanner at
+// ev, given the tick at which each measure of the staff starts.
+func (s *Score) spannerEndTick(ev *Event, loc *Location, measureStarts map[int]int) (int, error) {
+	if loc == nil {
+		return ev.Tick, nil
+	}
+	at := ev.MeasureTick
+	if loc.Fractions != "" {
+		ticks, err := FractionTicks(loc.Fractions, s.division())
+		if err != nil {
+			return 0, err
+		}
+		at += ticks
+	}
+	measure := ev.Measure + loc.Measures
+	start, ok := measureStarts[measure]
+	if !ok {
+		return 0, fmt.Errorf("spanner ends in missing measure %v", measure)
+	}
+	return start + at, nil
+}
+
+func sortedKeys[T any](m map[int]T) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// tempoAt returns the tempo at a tick of sorted points.
+func tempoAt(points []tempoPoint, tick int) float64 {
+	i := sort.Search(len(points), func(i int) bool { return points[i].tick > tick })
+	return points[i-1].tempo
+}
+
+// setTempo sets the tempo from a tick to the next point.
+func setTempo(points []tempoPoint, tick int, tempo float64) []tempoPoint {
+	i := sort.Search(len(points), func(i int) bool { return points[i].tick >= tick })
+	if i < len(points) && points[i].tick == tick {
+		points[i].tempo = tempo
+		return points
+	}
+	points = append(points, tempoPoint{})
+	copy(points[i+1:], points[i:])
+	points[i] = tempoPoint{tick: tick, tempo: tempo}
+	return points
+}
+
+// applyRamp replaces the tempo during a gradual change with steps of a
+// sixteenth note. The final tempo lasts until the next tempo marking
+// after the change, unless a marking coincides with its end.
+func applyRamp(points []tempoPoint, r tempoRamp, marks map[int]float64, division int) []tempoPoint {
+	from := tempoAt(points, r.start)
+	to := from * r.factor
+	after, ok := marks[r.end]
+	if !ok {
+		after = to
+	}
+
+	kept := points[:0]
+	for _, p := range points {
+		if p.tick < r.start || p.tick > r.end {
+			kept = append(kept, p)
+		}
+	}
+	points = kept
+
+	step := division / 4
+	if step < 1 {
+		step = 1
+	}
+	length := float64(r.end - r.start)
+	for tick := r.start; tick < r.end; tick += step {
+		mid := math.Min(float64(tick+step/2), float64(r.end)) - float64(r.start)
+		x := ease(r.easing, mid/length)
+		tempo := from + (to-from)*x
+		if r.easing == "exponential" {
+			tempo = from * math.Pow(r.factor, mid/length)
+		}
+		points = setTempo(points, tick, tempo)
+	}
+	return setTempo(points, r.end, after)
+}
+
+// ease returns the proportion of a gradual change made after a proportion
+// x of its time.
+func ease(method string, x float64) float64 {
+	switch method {
+	case "ease-in":
+		return x * x
+	case "ease-out":
+		return 1 - (1-x)*(1-x)
+	case "ease-in-out":
+		return x * x * (3 - 2*x)
+	}
+	return x
+}
+
+// scaleTempo multiplies the tempo from start to end by factor.
+func scaleTempo(points []tempoPoint, start, end int, factor float64) []tempoPoint {
+	points = setTempo(points, end, tempoAt(points, end))
+	points = setTempo(points, start, tempoAt(points, start))
+	for i := range points {
+		if points[i].tick >= start && points[i].tick < end {
+			points[i].tempo *= factor
+		}
+	}
+	return points
+}
+
+// index returns the index of the constant-tempo span containing tick.
+func (t *TempoMap) index(tick int) int {
+	i := sort.SearchInts(t.ticks, tick+1) - 1
+	if i < 0 {
+		return 0
+	}
+	return i
+}
+
+// Tempo returns the tempo at a tick in quarter notes per second.
+func (t *TempoMap) Tempo(tick int) float64 {
+	return t.tempos[t.index(tick)]
+}
+
+// Seconds returns the time in seconds from the start of the score to a
+// tick, without repeats.
+func (t *TempoMap) Seconds(tick int) float64 {
+	i := t.index(tick)
+	return t.seconds[i] + float64(tick-t.ticks[i])/float64(t.division)/t.tempos[i]
+}
+
+// Time is like Seconds but returns a time.Duration.
+func (t *TempoMap) Time(tick int) time.Duration {
+	return time.Duration(math.Round(t.Seconds(tick) * float64(time.Second)))
+}
+
+// Tick returns the tick, rounded to the nearest, at a time in seconds
+// from the start of the score. It is the inverse of Seconds.
+func (t *TempoMap) Tick(seconds float64) int {
+	i := sort.SearchFloat64s(t.seconds, seconds)
+	if i == len(t.seconds) || t.seconds[i] > seconds {
+		i--
+	}
+	if i < 0 {
+		i = 0
+	}
+	return t.ticks[i] + int(math.Round((seconds-t.seconds[i])*t.tempos[i]*float64(t.division)))
+}
+
+var (
+	// noteValues are the lengths in quarter notes of the note symbols of
+	// metronome markings: Unicode musical symbols and the SMuFL metronome
+	// marks used in MuseScore's text.
+	noteValues = map[string]float64{
+		"\U0001D15D": 4, "\U0001D15E": 2, "\u2669": 1, "\U0001D15F": 1,
+		"\u266A": 0.5, "\U0001D160": 0.5, "\U0001D161": 0.25,
+		"\uE1D2": 4, "\uE1D3": 2, "\uE1D4": 2, "\uE1D5": 1, "\uE1D6": 1,
+		"\uE1D7": 0.5, "\uE1D8": 0.5, "\uE1D9": 0.25, "\uE1DA": 0.25,
+	}
+	// symNotes are the SMuFL characters of MuseScore's <sym> names.
+	symNotes = map[string]string{
+		"metNoteWhole": "\uE1D2", "metNoteHalfUp": "\uE1D3", "metNoteHalfDown": "\uE1D4",
+		"metNoteQuarterUp": "\uE1D5", "metNoteQuarterDown": "\uE1D6",
+		"metNote8thUp": "\uE1D7", "metNote8thDown": "\uE1D8",
+		"metNote16thUp": "\uE1D9", "metNote16thDown": "\uE1DA",
+		"metAugmentationDot": ".",
+	}
+	symRE       = regexp.MustCompile(`<sym>(\w+)</sym>`)
+	tagRE       = regexp.MustCompile(`<[^>]*>`)
+	metronomeRE = newMetronomeRE()
+	// tempoWords are the tempo markings of MuseScore's tempo palette and
+	// their tempos in quarter notes per minute, longest first.
+	tempoWords = []struct {
+		word string
+		bpm  float64
+	}{
+		{"allegro moderato", 116}, {"prestissimo", 200}, {"larghetto", 63},
+		{"allegretto", 116}, {"andantino", 94}, {"moderato", 114}, {"allegro", 144},
+		{"andante", 92}, {"adagio", 71}, {"vivace", 172}, {"presto", 187},
+		{"grave", 35}, {"largo", 50}, {"lento", 52.5},
+	}
+)
+
+// newMetronomeRE returns a regexp that matches a metronome mark: a note,
+// any augmentation dots, "=" and a number of beats per minute.
+func newMetronomeRE() *regexp.Regexp {
+	var notes []string
+	for note := range noteValues {
+		notes = append(notes, regexp.QuoteMeta(note))
+	}
+	sort.Strings(notes)
+	return regexp.MustCompile(`(` + strings.Join(notes, "|") + `)\s*((?:[.\x{E1E7}\x{1D16D}]\s*)*)=\s*(\d+(?:[.,]\d+)?)`)
+}
+
+// ParseTempoText returns the tempo in quarter notes per second of the
+// text of a tempo marking: the metronome mark if it has one (e.g.
+// "♩ = 72", "♩. = 60" or MuseScore's equivalent symbols), or
+// else the tempo of a tempo word such as "Andante". It returns false if
+// the text has neither.
+func ParseTempoText(text string) (float64, bool) {
+	text = symRE.ReplaceAllStringFunc(text, func(sym string) string {
+		return symNotes[symRE.FindStringSubmatch(sym)[1]]
+	})
+	text = tagRE.ReplaceAllString(text, "")
+	text = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'", "&amp;", "&").Replace(text)
+
+	if m := metronomeRE.FindStringSubmatch(text); m != nil {
+		bpm, err := strconv.ParseFloat(strings.Replace(m[3], ",", ".", 1), 64)
+		if err == nil && bpm > 0 {
+			value, dot := noteValues[m[1]], noteValues[m[1]]
+			dots := utf8.RuneCountInString(strings.Join(strings.Fields(m[2]), ""))
+			for i := 0; i < dots; i++ {
+				dot /= 2
+				value += dot
+			}
+			return bpm * value / 60, true
+		}
+	}
+
+	lower := strings.ToLower(text)
+	for _, w := range tempoWords {
+		if i := strings.Index(lower, w.word); i >= 0 && isWordBoundary(lower, i, i+len(w.word)) {
+			return w.bpm / 60, true
+		}
+	}
+	return 0, false
+}
+
+// isWordBoundary reports whether s[start:end] is a whole word.
+func isWordBoundary(s string, start, end int) bool {
+	isLetter := func(b byte) bool { return b >= 'a' && b <= 'z' }
+	return (start == 0 || !isLetter(s[start-1])) && (end == len(s) || !isLetter(s[end]))
+}
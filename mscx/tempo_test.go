@@ -0,0 +1,228 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseTempoText(t *testing.T) {
+	tests := []struct {
+		text   string
+		want   float64
+		wantOK bool
+	}{
+		{text: "♩ = 72", want: 1.2, wantOK: true},
+		{text: "♩. = 60", want: 1.5, wantOK: true},
+		{text: "\U0001D15E = 50", want: 100.0 / 60, wantOK: true},
+		{text: "<sym>metNoteQuarterUp</sym> = 100", want: 100.0 / 60, wantOK: true},
+		{text: "<sym>metNote8thUp</sym><sym>metAugmentationDot</sym> = 80", want: 1, wantOK: true},
+		{text: "\uE1D5 = 110", want: 110.0 / 60, wantOK: true},
+		{text: "<b>Andante</b> ♩ = 84", want: 1.4, wantOK: true},
+		{text: "Andante", want: 92.0 / 60, wantOK: true},
+		{text: "Allegro moderato", want: 116.0 / 60, wantOK: true},
+		{text: "Allegretto", want: 116.0 / 60, wantOK: true},
+		{text: "Tempo di marcia"},
+		{text: "♩ = fast"},
+		{text: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, ok := ParseTempoText(tt.text)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseTempoText = %v, %v, want ok %v", got, ok, tt.wantOK)
+			}
+			if diff := cmp.Diff(tt.want, got, cmpopts.EquateApprox(0, 1e-12)); diff != "" {
+				t.Errorf("ParseTempoText mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestTempoMap(t *testing.T) {
+	// tempoScore returns two measures of 4/4 quarter notes.
+	tempoScore := func(t *testing.T) *Score {
+		t.Helper()
+		sz, err := NewScore().
+			AddPart("Melody").
+			AddMeasure("4/4").Note("C5", "quarter").Note("D5", "quarter").Note("E5", "quarter").Note("F5", "quarter").
+			AddMeasure("").Note("G5", "quarter").Note("A5", "quarter").Note("B5", "quarter").Note("C6", "quarter").
+			Build()
+		if err != nil {
+			t.Fatalf("Build: %v", err)
+		}
+		return &sz.MuseScore.Score
+	}
+	// insert inserts el before the i-th element of the voice of measure m.
+	insert := func(score *Score, m, i int, el any) {
+		v := score.Staffs[0].Measure[m].Voice[0]
+		v.TimedElements = append(v.TimedElements[:i], append([]any{el}, v.TimedElements[i:]...)...)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(score *Score)
+		ticks  []int
+		want   []float64 // seconds at each tick
+	}{
+		{
+			name:  "default tempo",
+			ticks: []int{0, 480, 1920, 3840},
+			want:  []float64{0, 0.5, 2, 4},
+		},
+		{
+			name: "tempo changes",
+			modify: func(score *Score) {
+				insert(score, 0, 0, &Tempo{Tempo: 1})
+				insert(score, 1, 2, &Tempo{Tempo: 4})
+			},
+			ticks: []int{0, 480, 1920, 2400, 2880, 3840},
+			want:  []float64{0, 1, 4, 5, 6, 6.5},
+		},
+		{
+			name: "tempo text",
+			modify: func(score *Score) {
+				insert(score, 0, 0, &Tempo{Tempo: 1, FollowText: 1, Text: []byte("♩ = 90")})
+			},
+			ticks: []int{0, 1920},
+			want:  []float64{0, 8.0 / 3},
+		},
+		{
+			name: "unparsed tempo text",
+			modify: func(score *Score) {
+				insert(score, 0, 0, &Tempo{Tempo: 1, FollowText: 1, Text: []byte("Tempo di marcia")})
+			},
+			ticks: []int{1920},
+			want:  []float64{4},
+		},
+		{
+			name: "fermata",
+			modify: func(score *Score) {
+				insert(score, 0, 1, &Fermata{Subtype: "fermataAbove", TimeStretch: 2})
+			},
+			ticks: []int{480, 960, 1920},
+			want:  []float64{0.5, 1.5, 2.5},
+		},
+		{
+			name: "fermata on the last note",
+			modify: func(score *Score) {
+				insert(score, 1, 3, &Fermata{Subtype: "fermataAbove", TimeStretch: 3})
+			},
+			ticks: []int{3360, 3840},
+			want:  []float64{3.5, 5},
+		},
+		{
+			name: "fermata not played",
+			modify: func(score *Score) {
+				play := 0
+				insert(score, 0, 1, &Fermata{Subtype: "fermataAbove", TimeStretch: 2, Play: &play})
+			},
+			ticks: []int{960},
+			want:  []float64{1},
+		},
+		{
+			name: "ritardando",
+			modify: func(score *Score) {
+				// A linear change from ♩ = 120 to ♩ = 60 over the first
+				// measure, in sixteenth-note steps, then ♩ = 180.
+				insert(score, 0, 0, &Spanner{
+					Type:              "TempoChangeRanged",
+					TempoChangeRanged: &TempoChangeRanged{TempoChangeType: "ritardando", TempoChangeFactor: 0.5},
+					Next:              &NextPrev{Location: &Location{Measures: 1}},
+				})
+				insert(score, 1, 0, &Spanner{
+					Type: "TempoChangeRanged",
+					Prev: &NextPrev{Location: &Location{Measures: -1}},
+				})
+				insert(score, 1, 1, &Tempo{Tempo: 3})
+			},
+			ticks: []int{0, 1920, 3840},
+			want:  []float64{0, 2.772100857323884, 4.105434190657217},
+		},
+		{
+			name: "default factor",
+			modify: func(score *Score) {
+				// A ritardando to ♩ = 90 over the last beat of the score.
+				insert(score, 1, 3, &Spanner{
+					Type:              "TempoChangeRanged",
+					TempoChangeRanged: &TempoChangeRanged{TempoChangeType: "ritardando", TempoEasingMethod: "exponential"},
+					Next:              &NextPrev{Location: &Location{Fractions: "1/4"}},
+				})
+			},
+			ticks: []int{3360, 3840},
+			want:  []float64{3.5, 4.079218406287997},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := tempoScore(t)
+			if tt.modify != nil {
+				tt.modify(score)
+			}
+			tm, err := score.TempoMap()
+			if err != nil {
+				t.Fatalf("TempoMap: %v", err)
+			}
+
+			var got []float64
+			for _, tick := range tt.ticks {
+				got = append(got, tm.Seconds(tick))
+				if back := tm.Tick(tm.Seconds(tick)); back != tick {
+					t.Errorf("Tick(Seconds(%v)) = %v", tick, back)
+				}
+			}
+			if diff := cmp.Diff(tt.want, got, cmpopts.EquateApprox(0, 1e-12)); diff != "" {
+				t.Errorf("Seconds mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestTempo_Text(t *testing.T) {
+	in := `<Tempo><tempo>1</tempo><followText>1</followText><text><b><sym>metNote8thUp</sym><sym>metAugmentationDot</sym> = 80</b></text></Tempo>`
+	tempo := &Tempo{}
+	if err := xml.Unmarshal([]byte(in), tempo); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := &Tempo{Tempo: 1, FollowText: 1, Text: RichText("<b><sym>metNote8thUp</sym><sym>metAugmentationDot</sym> = 80</b>")}
+	if diff := cmp.Diff(want, tempo); diff != "" {
+		t.Errorf("Unmarshal mismatch (-want +got):\n%v", diff)
+	}
+	if got, ok := ParseTempoText(string(tempo.Text)); !ok || got != 1 {
+		t.Errorf("ParseTempoText = %v, %v, want 1, true", got, ok)
+	}
+
+	sz := &ScoreZip{MuseScore: MuseScore{Score: Score{Staffs: []*ScoreStaff{{ID: "1", Measure: []*Measure{{
+		Voice: []*Voice{{TimedElements: []any{tempo}}},
+	}}}}}}}
+	got, err := sz.XML()
+	if err != nil {
+		t.Fatalf("XML: %v", err)
+	}
+	if want := "<text><b><sym>metNote8thUp</sym><sym>metAugmentationDot</sym> = 80</b></text>\n"; !strings.Contains(string(got), want) {
+		t.Errorf("XML = %v, want it to contain %q", string(got), want)
+	}
+}
@@ -0,0 +1,394 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Severity ranks the findings of Validate.
+type Severity int
+
+// Severities of findings, from least to most severe.
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Finding is a problem found by Validate. Its Position locates it as
+// closely as possible: findings about the score as a whole have a zero
+// Position, and findings about a staff have only a StaffID.
+type Finding struct {
+	Severity Severity
+	Position
+	Message string
+}
+
+func (f *Finding) String() string {
+	switch {
+	case f.Measure > 0:
+		return fmt.Sprintf("%v: %v: %v", f.Severity, f.Position, f.Message)
+	case f.StaffID != "":
+		return fmt.Sprintf("%v: staff %v: %v", f.Severity, f.StaffID, f.Message)
+	}
+	return fmt.Sprintf("%v: %v", f.Severity, f.Message)
+}
+
+// Validate checks that the score is coherent and returns its findings,
+// most severe first and then in score order. It checks that:
+//   - every voice of every measure fills (and does not overfill) the
+//     measure's time signature or actual length (Measure.Len),
+//   - the staves of the parts match the staves of the score,
+//   - every staff has the same number of measures,
+//   - every spanner start has a matching end (and vice versa), and every
+//     endSpanner matches a started HairPin,
+//   - the syllables of each verse of lyrics form complete words,
+//   - brackets do not span more staves than there are, and
+//   - every image in a frame is in the archive (if there is one).
+//
+// A score without findings may still be rejected by MuseScore, but one
+// with errors almost certainly will be.
+func (s *ScoreZip) Validate() []*Finding {
+	score := &s.MuseScore.Score
+	v := &validator{score: score}
+	v.checkStaves()
+	for _, staff := range score.Staffs {
+		v.checkStaff(staff)
+	}
+	// A bare .mscx file has nowhere to keep its pictures.
+	if s.RootFile != "" || len(s.Pictures) > 0 {
+		if err := s.ValidateImages(); err != nil {
+			v.add(SeverityError, Position{}, "%v", err)
+		}
+	}
+
+	// Findings about the whole score come first and those about staves
+	// missing from the score come last.
+	staffIndex := map[string]int{"": 0}
+	for i, staff := range score.Staffs {
+		staffIndex[staff.ID] = i + 1
+	}
+	staffOrder := func(id string) int {
+		if i, ok := staffIndex[id]; ok {
+			return i
+		}
+		return len(score.Staffs) + 1
+	}
+	sort.SliceStable(v.findings, func(a, b int) bool {
+		fa, fb := v.findings[a], v.findings[b]
+		if fa.Severity != fb.Severity {
+			return fa.Severity > fb.Severity
+		}
+		if sa, sb := staffOrder(fa.StaffID), staffOrder(fb.StaffID); sa != sb {
+			return sa < sb
+		}
+		if fa.Tick != fb.Tick {
+			return fa.Tick < fb.Tick
+		}
+		return fa.Voice < fb.Voice
+	})
+	return v.findings
+}
+
+type validator struct {
+	score    *Score
+	findings []*Finding
+}
+
+func (v *validator) add(severity Severity, pos Position, format string, args ...any) {
+	v.findings = append(v.findings, &Finding{Severity: severity, Position: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// checkStaves checks the parts, staff IDs, measure counts and brackets.
+func (v *validator) checkStaves() {
+	score := v.score
+	index := map[string]int{}
+	for i, staff := range score.Staffs {
+		if _, ok := index[staff.ID]; ok {
+			v.add(SeverityError, Position{StaffID: staff.ID}, "duplicate staff ID")
+			continue
+		}
+		index[staff.ID] = i
+		if n := len(score.Staffs[0].Measure); len(staff.Measure) != n {
+			v.add(SeverityError, Position{StaffID: staff.ID}, "has %v measures, but staff %v has %v", len(staff.Measure), score.Staffs[0].ID, n)
+		}
+	}
+
+	owner := map[string]*Part{}
+	for _, part := range score.Part {
+		for _, ps := range part.Staff {
+			if other := owner[ps.ID]; other != nil {
+				v.add(SeverityError, Position{StaffID: ps.ID}, "is in parts %q and %q", other.TrackName, part.TrackName)
+				continue
+			}
+			owner[ps.ID] = part
+			i, ok := index[ps.ID]
+			if !ok {
+				v.add(SeverityError, Position{StaffID: ps.ID}, "part %q has a staff that is not in the score", part.TrackName)
+				continue
+			}
+			for _, el := range ps.StaffElements {
+				if b, ok := el.(*Bracket); ok && i+b.Span > len(score.Staffs) {
+					v.add(SeverityError, Position{StaffID: ps.ID}, "bracket spans %v staves, but only %v remain", b.Span, len(score.Staffs)-i)
+				}
+			}
+		}
+	}
+	for _, staff := range score.Staffs {
+		if owner[staff.ID] == nil {
+			v.add(SeverityError, Position{StaffID: staff.ID}, "is not in any part")
+		}
+	}
+}
+
+// spannerEnd identifies the two ends of a spanner within a staff, each as
+// a measure number and a tick within the measure.
+type spannerEnd struct {
+	spannerType           string
+	startMeasure, startAt int
+	endMeasure, endAt     int
+}
+
+// lyricLine identifies a verse of lyrics of a voice.
+type lyricLine struct {
+	voice, verse int
+}
+
+type openWord struct {
+	pos  Position
+	text string
+}
+
+// checkStaff checks the measure durations, spanners and lyrics of a staff.
+func (v *validator) checkStaff(staff *ScoreStaff) {
+	div := v.score.division()
+
+	type voiceKey struct{ measure, voice int }
+	type voiceFill struct {
+		pos      Position // the position of the first element
+		end, len int
+	}
+	fills := map[voiceKey]*voiceFill{}
+	var order []voiceKey
+
+	starts := map[spannerEnd][]Position{}
+	ends := map[spannerEnd][]Position{}
+	var spanners []spannerEnd
+	hairPins := map[int]Position{}
+	words := map[lyricLine]*openWord{}
+
+	err := v.score.WalkStaff(staff, func(ev *Event) error {
+		switch el := ev.Element.(type) {
+		case *Chord:
+			for _, sp := range el.Spanner {
+				v.collectSpanner(sp, ev, starts, ends, &spanners)
+			}
+			for _, note := range el.Note {
+				for _, sp := range note.Spanner {
+					v.collectSpanner(sp, ev, starts, ends, &spanners)
+				}
+			}
+			for _, ly := range el.Lyrics {
+				v.checkSyllable(ly, ev, words)
+			}
+		case *Spanner:
+			v.collectSpanner(el, ev, starts, ends, &spanners)
+			return nil
+		case *HairPin:
+			hairPins[el.ID] = ev.Position
+			return nil
+		case *EndSpanner:
+			if _, ok := hairPins[el.ID]; !ok {
+				v.add(SeverityError, ev.Position, "endSpanner id=%v has no matching start", el.ID)
+			}
+			delete(hairPins, el.ID)
+			return nil
+		case *Rest:
+		default:
+			return nil
+		}
+
+		k := voiceKey{measure: ev.Measure, voice: ev.Voice}
+		f := fills[k]
+		if f == nil {
+			measureTicks, err := v.score.MeasureTicks(ev.Bar, ev.TimeSig)
+			if err != nil {
+				return err
+			}
+			f = &voiceFill{pos: ev.Position, len: measureTicks}
+			fills[k] = f
+			order = append(order, k)
+		}
+		if end := ev.MeasureTick + ev.Ticks; end > f.end {
+			f.end = end
+		}
+		return nil
+	})
+	if err != nil {
+		v.add(SeverityError, Position{StaffID: staff.ID}, "%v", err)
+		return
+	}
+
+	for _, k := range order {
+		f := fills[k]
+		pos := f.pos
+		pos.Tick -= pos.MeasureTick
+		pos.MeasureTick, pos.Beat = 0, 1
+		switch {
+		case f.end > f.len:
+			v.add(SeverityError, pos, "voice is %v too long for the measure", wholeFraction(f.end-f.len, div))
+		case f.end < f.len && k.voice == 1:
+			v.add(SeverityWarning, pos, "voice is %v too short for the measure", wholeFraction(f.len-f.end, div))
+		}
+	}
+
+	for _, se := range spanners {
+		for i, pos := range starts[se] {
+			if i >= len(ends[se]) {
+				v.add(SeverityError, pos, "%v has no end", se.spannerType)
+			}
+		}
+		for i, pos := range ends[se] {
+			if i >= len(starts[se]) {
+				v.add(SeverityError, pos, "%v has no start", se.spannerType)
+			}
+		}
+	}
+	ids := make([]int, 0, len(hairPins))
+	for id := range hairPins {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		v.add(SeverityError, hairPins[id], "HairPin id=%v is never ended", id)
+	}
+	for _, k := range sortedLyricLines(words) {
+		v.add(SeverityWarning, words[k].pos, "lyric %q begins a word that never ends", words[k].text)
+	}
+}
+
+// collectSpanner records the start or end of a spanner attached to a
+// voice, chord or note. A start's "next" location and an end's "prev" location
+// give the offset to the other end in measures and a fraction of a whole
+// note.
+func (v *validator) collectSpanner(sp *Spanner, ev *Event, starts, ends map[spannerEnd][]Position, spanners *[]spannerEnd) {
+	other := func(np *NextPrev) (measure, at int, ok bool) {
+		measure, at = ev.Measure, ev.MeasureTick
+		if np.Location == nil {
+			return measure, at, true
+		}
+		measure += np.Location.Measures
+		if np.Location.Fractions != "" {
+			ticks, err := FractionTicks(np.Location.Fractions, v.score.division())
+			if err != nil {
+				v.add(SeverityError, ev.Position, "%v location: %v", sp.Type, err)
+				return 0, 0, false
+			}
+			at += ticks
+		}
+		return measure, at, true
+	}
+	add := func(m map[spannerEnd][]Position, se spannerEnd) {
+		if len(starts[se]) == 0 && len(ends[se]) == 0 {
+			*spanners = append(*spanners, se)
+		}
+		m[se] = append(m[se], ev.Position)
+	}
+	if sp.Next != nil {
+		if measure, at, ok := other(sp.Next); ok {
+			add(starts, spannerEnd{spannerType: sp.Type, startMeasure: ev.Measure, startAt: ev.MeasureTick, endMeasure: measure, endAt: at})
+		}
+	}
+	if sp.Prev != nil {
+		if measure, at, ok := other(sp.Prev); ok {
+			add(ends, spannerEnd{spannerType: sp.Type, startMeasure: measure, startAt: at, endMeasure: ev.Measure, endAt: ev.MeasureTick})
+		}
+	}
+}
+
+// checkSyllable checks that a syllable continues (or does not continue)
+// the word of the previous syllable of the same verse.
+func (v *validator) checkSyllable(ly *Lyrics, ev *Event, words map[lyricLine]*openWord) {
+	k := lyricLine{voice: ev.Voice, verse: ly.No}
+	open := words[k]
+	switch ly.Syllabic {
+	case "", "single", "begin":
+		if open != nil {
+			v.add(SeverityWarning, open.pos, "lyric %q begins a word that does not end before %q", open.text, ly.Text)
+		}
+		delete(words, k)
+		if ly.Syllabic == "begin" {
+			words[k] = &openWord{pos: ev.Position, text: ly.Text}
+		}
+	case "middle", "end":
+		if open == nil {
+			v.add(SeverityWarning, ev.Position, "lyric %q (%v) does not continue a word", ly.Text, ly.Syllabic)
+		}
+		delete(words, k)
+		if ly.Syllabic == "middle" {
+			words[k] = &openWord{pos: ev.Position, text: ly.Text}
+		}
+	default:
+		v.add(SeverityError, ev.Position, "lyric %q has unknown syllabic %q", ly.Text, ly.Syllabic)
+	}
+}
+
+// sortedLyricLines returns the keys of m in order of voice and verse.
+func sortedLyricLines[T any](m map[lyricLine]T) []lyricLine {
+	keys := make([]lyricLine, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].voice != keys[b].voice {
+			return keys[a].voice < keys[b].voice
+		}
+		return keys[a].verse < keys[b].verse
+	})
+	return keys
+}
+
+// wholeFraction returns ticks as a reduced fraction of a whole note, such
+// as "3/4" or "-1/8".
+func wholeFraction(ticks, division int) string {
+	num, den := ticks, 4*division
+	a, b := num, den
+	if a < 0 {
+		a = -a
+	}
+	for b != 0 {
+		a, b = b, a%b
+	}
+	if a > 1 {
+		num, den = num/a, den/a
+	}
+	return fmt.Sprintf("%v/%v", num, den)
+}
@@ -0,0 +1,237 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidate_TestFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{name: "001", buf: test01},
+		{name: "003", buf: test02},
+		{name: "017", buf: test03},
+		{name: "020", buf: test04},
+		{name: "027", buf: test05},
+		{name: "Ben Hur", buf: test06},
+		{name: "Ice Palace", buf: test07},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sz, err := New(tt.buf, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range sz.Validate() {
+				if f.Severity == SeverityError {
+					t.Errorf("Validate: %v", f)
+				}
+			}
+		})
+	}
+}
+
+// validPiano returns a two-measure grand staff score with lyrics.
+func validPiano(t *testing.T) *ScoreZip {
+	t.Helper()
+	sz, err := NewScore().AddPart("Piano").
+		AddMeasure("4/4").Note("C5", "half").Lyric("glo-").Note("D5", "half").Lyric("ry").
+		AddMeasure("").Note("E5", "whole").Lyric("be").
+		AddStaff("F").
+		AddMeasure("").Note("C3", "whole").
+		AddMeasure("").Note("G2", "whole").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sz
+}
+
+func TestValidate(t *testing.T) {
+	firstChord := func(score *Score) *Chord {
+		return score.Staffs[0].Measure[0].Voice[0].TimedElements[0].(*Chord)
+	}
+	tests := []struct {
+		name   string
+		modify func(score *Score)
+		want   []string
+	}{
+		{
+			name:   "valid",
+			modify: func(score *Score) {},
+		},
+		{
+			name: "overfull measure",
+			modify: func(score *Score) {
+				v := score.Staffs[1].Measure[1].Voice[0]
+				v.TimedElements = append(v.TimedElements, &Rest{DurationType: "quarter"})
+			},
+			want: []string{"error: m.2 beat 1 voice 1 (staff 2): voice is 1/4 too long for the measure"},
+		},
+		{
+			name: "underfull measure",
+			modify: func(score *Score) {
+				firstChord(score).DurationType = "quarter"
+			},
+			want: []string{"warning: m.1 beat 1 voice 1 (staff 1): voice is 1/4 too short for the measure"},
+		},
+		{
+			name: "short measure with Len",
+			modify: func(score *Score) {
+				firstChord(score).DurationType = "quarter"
+				score.Staffs[0].Measure[0].Len = "3/4"
+				score.Staffs[1].Measure[0].Len = "3/4"
+				score.Staffs[1].Measure[0].Voice[0].TimedElements[0].(*Chord).DurationType = "half"
+				score.Staffs[1].Measure[0].Voice[0].TimedElements[0].(*Chord).Dots = 1
+			},
+		},
+		{
+			name: "tuplet, grace note and gap",
+			modify: func(score *Score) {
+				note := func() []*Note { return []*Note{{Pitch: 72, TPC: 14}} }
+				score.Staffs[0].Measure[0].Voice[0].TimedElements = []any{
+					&Chord{DurationType: "eighth", Acciaccatura: &struct{}{}, Note: note()},
+					&Location{Fractions: "1/4"},
+					&TupletElement{NormalNotes: 2, ActualNotes: 3, BaseNote: "quarter"},
+					&Chord{DurationType: "quarter", Note: note()},
+					&Chord{DurationType: "quarter", Note: note()},
+					&Chord{DurationType: "quarter", Note: note()},
+					&EndTuplet{},
+					&Rest{DurationType: "quarter"},
+				}
+			},
+		},
+		{
+			name: "missing measure",
+			modify: func(score *Score) {
+				score.Staffs[1].Measure = score.Staffs[1].Measure[:1]
+			},
+			want: []string{"error: staff 2: has 1 measures, but staff 1 has 2"},
+		},
+		{
+			name: "staff not in part",
+			modify: func(score *Score) {
+				score.Part[0].Staff[1].ID = "3"
+			},
+			want: []string{
+				"error: staff 2: is not in any part",
+				`error: staff 3: part "Piano" has a staff that is not in the score`,
+			},
+		},
+		{
+			name: "bracket too long",
+			modify: func(score *Score) {
+				score.Part[0].Staff[0].StaffElements[0].(*Bracket).Span = 3
+			},
+			want: []string{"error: staff 1: bracket spans 3 staves, but only 2 remain"},
+		},
+		{
+			name: "slur without end",
+			modify: func(score *Score) {
+				firstChord(score).Spanner = []*Spanner{{Type: "Slur", Slur: &Slur{}, Next: &NextPrev{Location: &Location{Fractions: "1/2"}}}}
+			},
+			want: []string{"error: m.1 beat 1 voice 1 (staff 1): Slur has no end"},
+		},
+		{
+			name: "matched slur",
+			modify: func(score *Score) {
+				firstChord(score).Spanner = []*Spanner{{Type: "Slur", Slur: &Slur{}, Next: &NextPrev{Location: &Location{Fractions: "1/2"}}}}
+				second := score.Staffs[0].Measure[0].Voice[0].TimedElements[1].(*Chord)
+				second.Spanner = []*Spanner{{Type: "Slur", Prev: &NextPrev{Location: &Location{Fractions: "-1/2"}}}}
+			},
+		},
+		{
+			name: "slur across a barline",
+			modify: func(score *Score) {
+				second := score.Staffs[0].Measure[0].Voice[0].TimedElements[1].(*Chord)
+				second.Spanner = []*Spanner{{Type: "Slur", Slur: &Slur{}, Next: &NextPrev{Location: &Location{Measures: 1, Fractions: "-1/2"}}}}
+				third := score.Staffs[0].Measure[1].Voice[0].TimedElements[0].(*Chord)
+				third.Spanner = []*Spanner{{Type: "Slur", Prev: &NextPrev{Location: &Location{Measures: -1, Fractions: "1/2"}}}}
+			},
+		},
+		{
+			name: "hairpin without end",
+			modify: func(score *Score) {
+				v := score.Staffs[0].Measure[0].Voice[0]
+				v.TimedElements = append([]any{&HairPin{ID: 2}}, v.TimedElements...)
+				v = score.Staffs[0].Measure[1].Voice[0]
+				v.TimedElements = append([]any{&EndSpanner{ID: 3}}, v.TimedElements...)
+			},
+			want: []string{
+				"error: m.1 beat 1 voice 1 (staff 1): HairPin id=2 is never ended",
+				"error: m.2 beat 1 voice 1 (staff 1): endSpanner id=3 has no matching start",
+			},
+		},
+		{
+			name: "unfinished word",
+			modify: func(score *Score) {
+				score.Staffs[0].Measure[0].Voice[0].TimedElements[1].(*Chord).Lyrics[0].Syllabic = "middle"
+			},
+			want: []string{`warning: m.1 beat 3 voice 1 (staff 1): lyric "ry" begins a word that does not end before "be"`},
+		},
+		{
+			name: "bad syllables",
+			modify: func(score *Score) {
+				firstChord(score).Lyrics[0].Syllabic = "start"
+				score.Staffs[0].Measure[1].Voice[0].TimedElements[0].(*Chord).Lyrics[0].Syllabic = "begin"
+			},
+			want: []string{
+				`error: m.1 beat 1 voice 1 (staff 1): lyric "glo" has unknown syllabic "start"`,
+				`warning: m.1 beat 3 voice 1 (staff 1): lyric "ry" (end) does not continue a word`,
+				`warning: m.2 beat 1 voice 1 (staff 1): lyric "be" begins a word that never ends`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sz := validPiano(t)
+			tt.modify(&sz.MuseScore.Score)
+			var got []string
+			for _, f := range sz.Validate() {
+				got = append(got, f.String())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Validate mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestWholeFraction(t *testing.T) {
+	tests := []struct {
+		ticks int
+		want  string
+	}{
+		{ticks: 1440, want: "3/4"},
+		{ticks: -240, want: "-1/8"},
+		{ticks: 0, want: "0/1"},
+		{ticks: 1920, want: "1/1"},
+	}
+
+	for _, tt := range tests {
+		if got := wholeFraction(tt.ticks, 480); got != tt.want {
+			t.Errorf("wholeFraction(%v) = %q, want %q", tt.ticks, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Position locates an element within a score.
+type Position struct {
+	StaffID string
+	// Measure is the 1-based index of the measure within its staff.
+	Measure int
+	// Voice is the 1-based voice number within the measure.
+	Voice int
+	// Tick is the number of ticks from the start of the score.
+	Tick int
+	// MeasureTick is the number of ticks from the start of the measure.
+	MeasureTick int
+	// Beat is the 1-based beat within the measure, where a beat is the
+	// denominator of the time signature (e.g. 2.5 is halfway through beat 2).
+	Beat float64
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("m.%v beat %v voice %v (staff %v)", p.Measure, strconv.FormatFloat(p.Beat, 'f', -1, 64), p.Voice, p.StaffID)
+}
+
+// Event is a single element visited by Score.Walk.
+type Event struct {
+	Position
+	// Element is the visited element, e.g. *Chord, *Rest or *BarLine.
+	Element any
+	// Ticks is the duration of a *Chord or *Rest, or of a gap (*Location)
+	// in the voice, or zero for grace notes and other elements.
+	Ticks int
+
+	Staff *ScoreStaff
+	// Bar is the measure containing the element.
+	Bar *Measure
+	// TimeSig and KeySig are the signatures in effect at this element.
+	// Either may be nil if the score has not (yet) defined one.
+	TimeSig *TimeSig
+	KeySig  *KeySig
+}
+
+// WalkFn is called by Score.Walk for each element in the score.
+type WalkFn func(ev *Event) error
+
+// division returns the ticks per quarter note of the score.
+func (s *Score) division() int {
+	if s.Division > 0 {
+		return s.Division
+	}
+	return DefaultDivision
+}
+
+// PartForStaff returns the part that contains the staff with the given ID.
+func (s *Score) PartForStaff(staffID string) *Part {
+	for _, part := range s.Part {
+		for _, ps := range part.Staff {
+			if ps.ID == staffID {
+				return part
+			}
+		}
+	}
+	return nil
+}
+
+// Walk calls fn for every timed element of every voice of every measure in
+// the score, staff by staff, in time order within each voice. If fn returns
+// an error, the walk stops and the error is returned.
+func (s *Score) Walk(fn WalkFn) error {
+	for _, staff := range s.Staffs {
+		if err := s.WalkStaff(staff, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkStaff is like Walk but visits only the elements of the given staff.
+func (s *Score) WalkStaff(staff *ScoreStaff, fn WalkFn) error {
+	div := s.division()
+	var timeSig *TimeSig
+	var keySig *KeySig
+	var measureStart int
+
+	for mi, m := range staff.Measure {
+		if m.TimeSig != nil {
+			timeSig = m.TimeSig
+		}
+		if m.KeySig != nil {
+			keySig = m.KeySig
+		}
+		// Signatures are stored in the first voice but apply to all voices.
+		if len(m.Voice) > 0 {
+			if v := m.Voice[0]; v.TimeSig != nil {
+				timeSig = v.TimeSig
+			}
+			if v := m.Voice[0]; v.KeySig != nil {
+				keySig = v.KeySig
+			}
+		}
+
+		measureTicks, err := s.MeasureTicks(m, timeSig)
+		if err != nil {
+			return fmt.Errorf("staff %v, measure %v: %w", staff.ID, mi+1, err)
+		}
+		beatTicks := div
+		if timeSig != nil {
+			if den, err := strconv.Atoi(timeSig.SigD); err == nil && den > 0 {
+				beatTicks = 4 * div / den
+			}
+		}
+
+		visit := func(voice int, elements []any) error {
+			var offset int
+			timer := &voiceTimer{division: div}
+			for _, el := range elements {
+				if t, ok := el.(Tick); ok {
+					offset = int(t) - measureStart
+					continue
+				}
+				ticks, err := timer.ticks(el)
+				if err != nil {
+					return fmt.Errorf("staff %v, measure %v: %w", staff.ID, mi+1, err)
+				}
+				if r, ok := el.(*Rest); ok && r.DurationType == "measure" && r.Duration == "" {
+					ticks = measureTicks
+				}
+				ev := &Event{
+					Position: Position{
+						StaffID:     staff.ID,
+						Measure:     mi + 1,
+						Voice:       voice,
+						Tick:        measureStart + offset,
+						MeasureTick: offset,
+						Beat:        1 + float64(offset)/float64(beatTicks),
+					},
+					Element: el,
+					Ticks:   ticks,
+					Staff:   staff,
+					Bar:     m,
+					TimeSig: timeSig,
+					KeySig:  keySig,
+				}
+				if err := fn(ev); err != nil {
+					return err
+				}
+				offset += ticks
+			}
+			return nil
+		}
+
+		for vi, v := range m.Voice {
+			if err := visit(vi+1, v.TimedElements); err != nil {
+				return err
+			}
+		}
+		// Older versions store the first voice directly in the measure.
+		if err := visit(1, m.TimedElements); err != nil {
+			return err
+		}
+
+		measureStart += measureTicks
+	}
+
+	return nil
+}
+
+// MeasureTicks returns the actual length of the measure in ticks, which is
+// given by Measure.Len for irregular measures (e.g. a pickup measure) and
+// by the time signature otherwise.
+func (s *Score) MeasureTicks(m *Measure, timeSig *TimeSig) (int, error) {
+	if m.Len != "" {
+		return FractionTicks(m.Len, s.division())
+	}
+	if timeSig == nil {
+		return 0, fmt.Errorf("no time signature")
+	}
+	return timeSig.Ticks(s.division())
+}
+
+// Notes calls fn for each note of each chord in the score along with the
+// event of its enclosing chord.
+func (s *Score) Notes(fn func(ev *Event, note *Note) error) error {
+	return s.Walk(func(ev *Event) error {
+		chord, ok := ev.Element.(*Chord)
+		if !ok {
+			return nil
+		}
+		for _, note := range chord.Note {
+			if err := fn(ev, note); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
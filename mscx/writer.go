@@ -0,0 +1,261 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// mscxHeader is the XML declaration written by MuseScore 3.
+const mscxHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+
+// MuseScore 3 writes an element without content in one of three ways,
+// depending on the element: most are written as "<name></name>" (e.g. an
+// empty metaTag), but some are always empty and are written as "<name/>",
+// and some normally contain other elements and are written with the end
+// tag on its own line.
+var (
+	selfClosingElements = map[string]bool{
+		"acciaccatura": true,
+		"appoggiatura": true,
+		"bracket":      true,
+		"controller":   true,
+		"endSpanner":   true,
+		"endTuplet":    true,
+		"o1":           true,
+		"o2":           true,
+		"o3":           true,
+		"o4":           true,
+		"off2":         true,
+		"offset":       true,
+		"pos":          true,
+		"program":      true,
+		"size":         true,
+		"soloists":     true,
+		"startRepeat":  true,
+		"unsorted":     true,
+	}
+	emptyContainerElements = map[string]bool{
+		"BarLine":  true,
+		"Slur":     true,
+		"System":   true,
+		"Tie":      true,
+		"Zerberus": true,
+	}
+	// inlineElements hold formatted text and are always written on one
+	// line, even when they contain only formatting elements.
+	inlineElements = map[string]bool{
+		"text": true,
+	}
+)
+
+// xmlNode is an element of a parsed XML document. Its children are
+// *xmlNode and string (character data) values.
+type xmlNode struct {
+	start    xml.StartElement
+	children []any
+}
+
+// XML renders the embedded MuseScore to XML format exactly as MuseScore 3
+// writes it.
+func (s *ScoreZip) XML() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := s.WriteXML(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteXML writes the embedded MuseScore to w in MuseScore 3's format:
+// two-space indentation with end tags indented like the children they
+// close, MuseScore's choice of self-closing tags for empty elements, and
+// only &, <, > and " escaped in text and attribute values.
+func (s *ScoreZip) WriteXML(w io.Writer) error {
+	var raw bytes.Buffer
+	enc := xml.NewEncoder(&raw)
+	if err := enc.EncodeElement(s.MuseScore, xml.StartElement{Name: xml.Name{Local: "museScore"}}); err != nil {
+		return fmt.Errorf("ScoreZip.WriteXML: %w", err)
+	}
+	root, err := parseXMLTree(&raw)
+	if err != nil {
+		return fmt.Errorf("ScoreZip.WriteXML: %w", err)
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(mscxHeader)
+	writeXMLNode(bw, root, 0)
+	return bw.Flush()
+}
+
+// parseXMLTree returns the root element of the XML document in r.
+func parseXMLTree(r io.Reader) (*xmlNode, error) {
+	dec := xml.NewDecoder(r)
+	var root *xmlNode
+	var stack []*xmlNode
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{start: t.Copy()}
+			if len(stack) == 0 {
+				root = n
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unexpected </%v>", t.Name.Local)
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, string(t))
+			}
+		}
+	}
+	if root == nil || len(stack) > 0 {
+		return nil, fmt.Errorf("incomplete XML document")
+	}
+	return root, nil
+}
+
+// writeXMLNode writes the element n, indented to the given level.
+func writeXMLNode(w *bufio.Writer, n *xmlNode, level int) {
+	indent := strings.Repeat("  ", level)
+	var text strings.Builder
+	hasElements := false
+	for _, child := range n.children {
+		switch c := child.(type) {
+		case *xmlNode:
+			hasElements = true
+		case string:
+			text.WriteString(c)
+		}
+	}
+	mixed := strings.TrimSpace(text.String()) != ""
+
+	w.WriteString(indent)
+	switch {
+	case hasElements && !mixed && !inlineElements[n.start.Name.Local]:
+		writeStartTag(w, n.start, false)
+		w.WriteString("\n")
+		for _, child := range n.children {
+			if c, ok := child.(*xmlNode); ok {
+				writeXMLNode(w, c, level+1)
+			}
+		}
+		w.WriteString(indent + "  ")
+		writeEndTag(w, n.start)
+	case hasElements:
+		// Formatted text (e.g. "<b>bold</b> text") stays on one line.
+		writeInline(w, n)
+	case text.Len() > 0:
+		writeStartTag(w, n.start, false)
+		w.WriteString(escapeXML(text.String()))
+		writeEndTag(w, n.start)
+	case selfClosingElements[n.start.Name.Local]:
+		writeStartTag(w, n.start, true)
+	case emptyContainerElements[n.start.Name.Local]:
+		writeStartTag(w, n.start, false)
+		w.WriteString("\n" + indent + "  ")
+		writeEndTag(w, n.start)
+	default:
+		writeStartTag(w, n.start, false)
+		writeEndTag(w, n.start)
+	}
+	w.WriteString("\n")
+}
+
+// writeInline writes the element n and its contents without line breaks.
+func writeInline(w *bufio.Writer, n *xmlNode) {
+	if len(n.children) == 0 && selfClosingElements[n.start.Name.Local] {
+		writeStartTag(w, n.start, true)
+		return
+	}
+	writeStartTag(w, n.start, false)
+	for _, child := range n.children {
+		switch c := child.(type) {
+		case *xmlNode:
+			writeInline(w, c)
+		case string:
+			w.WriteString(escapeXML(c))
+		}
+	}
+	writeEndTag(w, n.start)
+}
+
+func writeStartTag(w *bufio.Writer, start xml.StartElement, selfClosing bool) {
+	w.WriteString("<" + xmlName(start.Name))
+	for _, attr := range start.Attr {
+		w.WriteString(" " + xmlName(attr.Name) + `="` + escapeXML(attr.Value) + `"`)
+	}
+	if selfClosing {
+		w.WriteString("/")
+	}
+	w.WriteString(">")
+}
+
+func writeEndTag(w *bufio.Writer, start xml.StartElement) {
+	w.WriteString("</" + xmlName(start.Name) + ">")
+}
+
+func xmlName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// escapeXML escapes text as MuseScore 3 does: only &, <, > and " are
+// escaped, and control characters that XML 1.0 does not allow are
+// dropped.
+func escapeXML(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '&':
+			sb.WriteString("&amp;")
+		case '<':
+			sb.WriteString("&lt;")
+		case '>':
+			sb.WriteString("&gt;")
+		case '"':
+			sb.WriteString("&quot;")
+		case '\t', '\n', '\r':
+			sb.WriteRune(r)
+		default:
+			if r >= 0x20 {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	return sb.String()
+}
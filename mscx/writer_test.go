@@ -0,0 +1,125 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mscx
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestXML_ByteForByte(t *testing.T) {
+	names, err := fs.Glob(testfiles, "testfiles/*.mscz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 {
+		t.Fatal("no test files")
+	}
+	for _, name := range names {
+		t.Run(path.Base(name), func(t *testing.T) {
+			buf, err := testfiles.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []byte
+			sz, err := New(buf, func(fn string, buf []byte) {
+				if strings.HasSuffix(fn, ".mscx") {
+					want = buf
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := sz.XML()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(string(want), string(got)); diff != "" {
+				t.Errorf("XML differs from MuseScore's (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestWriteXMLNode(t *testing.T) {
+	sz := &ScoreZip{MuseScore: MuseScore{Version: "3.02", Score: Score{
+		LayerTag: LayerTag{ID: "0", Tag: "default"},
+		MetaTags: []*MetaTag{
+			{Name: "arranger"},
+			{Name: "copyright", Text: "© 2022 \"Smith\" & Sons\nAll rights reserved. Don't copy."},
+		},
+		Staffs: []*ScoreStaff{{ID: "1", Measure: []*Measure{{Voice: []*Voice{{
+			TimedElements: []any{
+				&Chord{DurationType: "quarter", Spanner: []*Spanner{{Type: "Slur", Slur: &Slur{}}}, Note: []*Note{{Pitch: 60, TPC: 14}}},
+				&Tempo{Tempo: 2, Pos: &TextPos{X: 1, Y: -2.5}, Text: RichText("Allegro &lt;fast&gt;")},
+			},
+		}}}}}},
+	}}}
+	got, err := sz.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<museScore version="3.02">
+  <programVersion></programVersion>
+  <programRevision></programRevision>
+  <Score>
+    <LayerTag id="0" tag="default"></LayerTag>
+    <currentLayer>0</currentLayer>
+    <Division>0</Division>
+    <showInvisible>0</showInvisible>
+    <showUnprintable>0</showUnprintable>
+    <showFrames>0</showFrames>
+    <showMargins>0</showMargins>
+    <metaTag name="arranger"></metaTag>
+    <metaTag name="copyright">© 2022 &quot;Smith&quot; &amp; Sons
+All rights reserved. Don't copy.</metaTag>
+    <Staff id="1">
+      <Measure>
+        <voice>
+          <Chord>
+            <durationType>quarter</durationType>
+            <Spanner type="Slur">
+              <Slur>
+                </Slur>
+              </Spanner>
+            <Note>
+              <pitch>60</pitch>
+              <tpc>14</tpc>
+              </Note>
+            </Chord>
+          <Tempo>
+            <tempo>2</tempo>
+            <pos x="1" y="-2.5"/>
+            <text>Allegro &lt;fast&gt;</text>
+            </Tempo>
+          </voice>
+        </Measure>
+      </Staff>
+    </Score>
+  </museScore>
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("XML mismatch (-want +got):\n%v", diff)
+	}
+}
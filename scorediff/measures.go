@@ -0,0 +1,443 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scorediff
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// item is a comparable element of one measure of one staff.
+type item struct {
+	category Category
+	voice    int
+	tick     int // from the start of the measure
+	beat     float64
+	verse    int
+	text     string
+}
+
+func (it *item) key() string {
+	return fmt.Sprintf("%v|%v|%v|%v", it.voice, it.tick, it.category, it.verse)
+}
+
+// categoryOrder orders the changes at the same time and voice.
+var categoryOrder = map[Category]int{
+	TimeSignature: 0,
+	KeySignature:  1,
+	RehearsalMark: 2,
+	Tempo:         3,
+	Dynamic:       4,
+	Harmony:       5,
+	StaffText:     6,
+	Note:          7,
+	Lyric:         8,
+}
+
+func (it *item) less(other *item) bool {
+	if it.tick != other.tick {
+		return it.tick < other.tick
+	}
+	if it.voice != other.voice {
+		return it.voice < other.voice
+	}
+	if it.category != other.category {
+		return categoryOrder[it.category] < categoryOrder[other.category]
+	}
+	return it.verse < other.verse
+}
+
+// staffItems holds the items of each measure of a staff.
+type staffItems struct {
+	label    string
+	measures [][]*item
+}
+
+// collect returns the items of every measure of every staff of the score.
+func collect(score *mscx.Score) ([]*staffItems, error) {
+	var result []*staffItems
+	for _, staff := range score.Staffs {
+		si := &staffItems{label: staffLabel(score, staff), measures: make([][]*item, len(staff.Measure))}
+		for mi, m := range staff.Measure {
+			si.measures[mi] = signatureItems(m)
+		}
+		err := score.WalkStaff(staff, func(ev *mscx.Event) error {
+			add := func(category Category, verse int, text string) {
+				mi := ev.Measure - 1
+				si.measures[mi] = append(si.measures[mi], &item{
+					category: category,
+					voice:    ev.Voice,
+					tick:     ev.MeasureTick,
+					beat:     ev.Beat,
+					verse:    verse,
+					text:     text,
+				})
+			}
+			switch el := ev.Element.(type) {
+			case *mscx.Chord:
+				add(Note, 0, chordText(el))
+				for _, ly := range el.Lyrics {
+					add(Lyric, ly.No+1, lyricText(ly))
+				}
+			case *mscx.Rest:
+				add(Note, 0, restText(el))
+			case *mscx.Dynamic:
+				add(Dynamic, 0, el.Subtype)
+			case *mscx.Tempo:
+				add(Tempo, 0, tempoText(el))
+			case *mscx.StaffText:
+				add(StaffText, 0, plainText(el.Text))
+			case *mscx.Harmony:
+				add(Harmony, 0, harmonyText(el))
+			case *mscx.RehearsalMark:
+				add(RehearsalMark, 0, plainText(el.Text))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, si)
+	}
+	return result, nil
+}
+
+// staffLabel names the staff by its part, numbering the staves of parts
+// that have more than one.
+func staffLabel(score *mscx.Score, staff *mscx.ScoreStaff) string {
+	part := score.PartForStaff(staff.ID)
+	if part == nil {
+		return "staff " + staff.ID
+	}
+	if len(part.Staff) == 1 {
+		return part.TrackName
+	}
+	for i, ps := range part.Staff {
+		if ps.ID == staff.ID {
+			return fmt.Sprintf("%v staff %v", part.TrackName, i+1)
+		}
+	}
+	return part.TrackName
+}
+
+// signatureItems returns the time and key signatures at the start of the
+// measure, which are stored either in the measure or in its first voice.
+func signatureItems(m *mscx.Measure) []*item {
+	timeSig, keySig := m.TimeSig, m.KeySig
+	if len(m.Voice) > 0 {
+		if v := m.Voice[0]; v.TimeSig != nil {
+			timeSig = v.TimeSig
+		}
+		if v := m.Voice[0]; v.KeySig != nil {
+			keySig = v.KeySig
+		}
+	}
+	var result []*item
+	if timeSig != nil {
+		result = append(result, &item{category: TimeSignature, text: timeSig.SigN + "/" + timeSig.SigD})
+	}
+	if keySig != nil {
+		result = append(result, &item{category: KeySignature, text: keySigText(keySig.Fifths())})
+	}
+	return result
+}
+
+func keySigText(fifths int) string {
+	switch {
+	case fifths == 1:
+		return "1 sharp"
+	case fifths > 1:
+		return fmt.Sprintf("%v sharps", fifths)
+	case fifths == -1:
+		return "1 flat"
+	case fifths < -1:
+		return fmt.Sprintf("%v flats", -fifths)
+	}
+	return "no sharps or flats"
+}
+
+func durationText(durationType string, dots int) string {
+	switch dots {
+	case 0:
+		return durationType
+	case 1:
+		return "dotted " + durationType
+	case 2:
+		return "double-dotted " + durationType
+	}
+	return fmt.Sprintf("%v-dotted %v", dots, durationType)
+}
+
+// chordText returns the notes of the chord from lowest to highest,
+// followed by its duration, e.g. "C4 E4 G4 half".
+func chordText(c *mscx.Chord) string {
+	notes := append([]*mscx.Note(nil), c.Note...)
+	sort.SliceStable(notes, func(a, b int) bool { return notes[a].Pitch < notes[b].Pitch })
+	var parts []string
+	for _, n := range notes {
+		parts = append(parts, mscx.PitchName(n.Pitch, n.TPC))
+	}
+	return strings.Join(append(parts, durationText(c.DurationType, c.Dots)), " ")
+}
+
+func restText(r *mscx.Rest) string {
+	return durationText(r.DurationType, r.Dots) + " rest"
+}
+
+// lyricText returns the syllable with a trailing hyphen if the word
+// continues.
+func lyricText(l *mscx.Lyrics) string {
+	if l.Syllabic == "begin" || l.Syllabic == "middle" {
+		return l.Text + "-"
+	}
+	return l.Text
+}
+
+var (
+	symMarkup  = regexp.MustCompile(`<sym>[^<]*</sym>`)
+	textMarkup = regexp.MustCompile(`<[^>]*>`)
+	hasLetter  = regexp.MustCompile(`\pL`)
+)
+
+// plainText returns text without formatting or symbols.
+func plainText(text []byte) string {
+	s := symMarkup.ReplaceAllString(string(text), "")
+	return strings.TrimSpace(html.UnescapeString(textMarkup.ReplaceAllString(s, "")))
+}
+
+// tempoText returns the tempo in quarter notes per minute, preceded by
+// any words of the tempo marking, e.g. "Andante (76 BPM)".
+func tempoText(t *mscx.Tempo) string {
+	bpm := strconv.FormatFloat(t.Tempo*60, 'f', -1, 64) + " BPM"
+	if s := plainText(t.Text); hasLetter.MatchString(s) {
+		return fmt.Sprintf("%v (%v)", s, bpm)
+	}
+	return bpm
+}
+
+// harmonyText returns the chord symbol, e.g. "F#m7/C#".
+func harmonyText(h *mscx.Harmony) string {
+	s := h.Name
+	if h.Root != nil {
+		s = mscx.TPCName(*h.Root) + s
+	}
+	if h.Base != nil {
+		s += "/" + mscx.TPCName(*h.Base)
+	}
+	return s
+}
+
+// measureKey returns a string that is equal for measures (across all
+// staves) with identical contents.
+func measureKey(staves []*staffItems, mi int) string {
+	var sb strings.Builder
+	for _, si := range staves {
+		sb.WriteString("\x00")
+		if mi >= len(si.measures) {
+			continue
+		}
+		for _, it := range si.measures[mi] {
+			fmt.Fprintf(&sb, "%v=%v\x01", it.key(), it.text)
+		}
+	}
+	return sb.String()
+}
+
+func numMeasures(staves []*staffItems) int {
+	var n int
+	for _, si := range staves {
+		if len(si.measures) > n {
+			n = len(si.measures)
+		}
+	}
+	return n
+}
+
+// alignment pairs measure indexes of the old and new versions; -1 marks a
+// measure missing from that version.
+type alignment struct {
+	old, new int
+}
+
+// alignMeasures aligns the measures of two versions, pairing identical
+// measures by their longest common subsequence and the remaining measures
+// between them in order.
+func alignMeasures(oldKeys, newKeys []string) []alignment {
+	n, m := len(oldKeys), len(newKeys)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case oldKeys[i] == newKeys[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var result []alignment
+	var oldGap, newGap []int
+	flush := func() {
+		for k := 0; k < len(oldGap) || k < len(newGap); k++ {
+			a := alignment{old: -1, new: -1}
+			if k < len(oldGap) {
+				a.old = oldGap[k]
+			}
+			if k < len(newGap) {
+				a.new = newGap[k]
+			}
+			result = append(result, a)
+		}
+		oldGap, newGap = nil, nil
+	}
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && oldKeys[i] == newKeys[j]:
+			flush()
+			result = append(result, alignment{old: i, new: j})
+			i++
+			j++
+		case j >= m || i < n && lcs[i+1][j] >= lcs[i][j+1]:
+			oldGap = append(oldGap, i)
+			i++
+		default:
+			newGap = append(newGap, j)
+			j++
+		}
+	}
+	flush()
+	return result
+}
+
+func compareMeasures(old, new []*staffItems) []*Change {
+	var result []*Change
+	common := len(old)
+	if len(new) < common {
+		common = len(new)
+	}
+	for _, si := range old[common:] {
+		result = append(result, &Change{Kind: Removed, Category: Staff, Staff: si.label})
+	}
+	for _, si := range new[common:] {
+		result = append(result, &Change{Kind: Added, Category: Staff, Staff: si.label})
+	}
+
+	oldKeys := make([]string, numMeasures(old))
+	for i := range oldKeys {
+		oldKeys[i] = measureKey(old[:common], i)
+	}
+	newKeys := make([]string, numMeasures(new))
+	for i := range newKeys {
+		newKeys[i] = measureKey(new[:common], i)
+	}
+
+	for _, a := range alignMeasures(oldKeys, newKeys) {
+		switch {
+		case a.new < 0:
+			result = append(result, &Change{Kind: Removed, Category: Measure, Measure: a.old + 1})
+		case a.old < 0:
+			result = append(result, &Change{Kind: Added, Category: Measure, Measure: a.new + 1})
+		case oldKeys[a.old] != newKeys[a.new]:
+			for s := 0; s < common; s++ {
+				result = append(result, compareItems(measureItems(old[s], a.old), measureItems(new[s], a.new), a.new+1, new[s].label)...)
+			}
+		}
+	}
+	return result
+}
+
+func measureItems(si *staffItems, mi int) []*item {
+	if mi < len(si.measures) {
+		return si.measures[mi]
+	}
+	return nil
+}
+
+// compareItems returns the changes between the items of a measure of a
+// staff in the old and new versions.
+func compareItems(old, new []*item, measure int, label string) []*Change {
+	keyed := func(items []*item) map[string]*item {
+		result := map[string]*item{}
+		for _, it := range items {
+			k := it.key()
+			for n := 2; result[k] != nil; n++ {
+				k = fmt.Sprintf("%v#%v", it.key(), n)
+			}
+			result[k] = it
+		}
+		return result
+	}
+	oldItems, newItems := keyed(old), keyed(new)
+
+	type pair struct{ old, new *item }
+	var pairs []pair
+	for k, o := range oldItems {
+		pairs = append(pairs, pair{old: o, new: newItems[k]})
+	}
+	for k, n := range newItems {
+		if oldItems[k] == nil {
+			pairs = append(pairs, pair{new: n})
+		}
+	}
+	at := func(p pair) *item {
+		if p.new != nil {
+			return p.new
+		}
+		return p.old
+	}
+	sort.SliceStable(pairs, func(a, b int) bool {
+		ia, ib := at(pairs[a]), at(pairs[b])
+		if ia.less(ib) || ib.less(ia) {
+			return ia.less(ib)
+		}
+		return ia.text < ib.text
+	})
+
+	var result []*Change
+	for _, p := range pairs {
+		it := at(p)
+		c := &Change{Category: it.category, Measure: measure, Staff: label, Voice: it.voice, Verse: it.verse}
+		if it.voice > 0 {
+			c.Beat = it.beat
+		}
+		switch {
+		case p.new == nil:
+			c.Kind, c.Old = Removed, p.old.text
+		case p.old == nil:
+			c.Kind, c.New = Added, p.new.text
+		case p.old.text != p.new.text:
+			c.Kind, c.Old, c.New = Changed, p.old.text, p.new.text
+		default:
+			continue
+		}
+		result = append(result, c)
+	}
+	return result
+}
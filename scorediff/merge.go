@@ -0,0 +1,329 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scorediff
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// Conflict is a part of a score that was changed differently in both
+// versions being merged.
+type Conflict struct {
+	// Measure is the 1-based measure number in the merged score.
+	Measure int `json:"measure,omitempty"`
+	// Staff names the staff by its part, or is empty if the conflict
+	// involves all staves (e.g. measures inserted in both versions).
+	Staff string `json:"staff,omitempty"`
+	// Name is the name of a conflicting metaTag.
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// String returns the conflict as a single line of text.
+func (c *Conflict) String() string {
+	var where []string
+	if c.Name != "" {
+		where = append(where, "metadata", c.Name)
+	}
+	if c.Measure > 0 {
+		where = append(where, fmt.Sprintf("m.%v", c.Measure))
+	}
+	if c.Staff != "" {
+		where = append(where, c.Staff)
+	}
+	return strings.Join(where, " ") + ": " + c.Reason
+}
+
+// Reasons for conflicts.
+const (
+	changedInBoth  = "changed in both versions"
+	insertedInBoth = "measures inserted in both versions"
+	deletedChanged = "deleted in one version and changed in the other"
+	staleExcerpt   = "excerpt could not be updated with the merged measures"
+)
+
+// Merge merges the changes made from base to theirs into ours, which is
+// modified in place, and returns the conflicts. The scores are compared
+// measure by measure and staff by staff, so edits to different measures
+// or staves of the same measure merge cleanly, as do measures inserted or
+// deleted in only one version. MetaTags are merged individually. Where
+// both versions changed the same thing differently, ours is kept and a
+// Conflict is reported. Measures taken from theirs are shared with it,
+// not copied. Everything else (parts, style) is kept from ours, except
+// that excerpts are recreated from the merged measures if any measures
+// changed (see regenerateExcerpts).
+//
+// All three scores must have the same number of staves.
+func Merge(base, ours, theirs *mscx.Score) ([]*Conflict, error) {
+	if len(ours.Staffs) != len(base.Staffs) || len(theirs.Staffs) != len(base.Staffs) {
+		return nil, fmt.Errorf("scorediff.Merge: staves differ: base has %v, ours %v, theirs %v", len(base.Staffs), len(ours.Staffs), len(theirs.Staffs))
+	}
+	conflicts := mergeMetaTags(base, ours, theirs)
+
+	baseRows, err := measureRows(base)
+	if err != nil {
+		return nil, fmt.Errorf("scorediff.Merge: base: %w", err)
+	}
+	ourRows, err := measureRows(ours)
+	if err != nil {
+		return nil, fmt.Errorf("scorediff.Merge: ours: %w", err)
+	}
+	theirRows, err := measureRows(theirs)
+	if err != nil {
+		return nil, fmt.Errorf("scorediff.Merge: theirs: %w", err)
+	}
+	ourEdits := newEdits(baseRows, ourRows)
+	theirEdits := newEdits(baseRows, theirRows)
+
+	numStaves := len(base.Staffs)
+	merged := make([][]*mscx.Measure, numStaves)
+	labels := make([]string, numStaves)
+	for s, staff := range ours.Staffs {
+		labels[s] = staffLabel(ours, staff)
+	}
+	appendRow := func(score *mscx.Score, i int) {
+		for s, staff := range score.Staffs {
+			merged[s] = append(merged[s], staff.Measure[i])
+		}
+	}
+	conflict := func(staff, reason string) {
+		conflicts = append(conflicts, &Conflict{Measure: len(merged[0]) + 1, Staff: staff, Reason: reason})
+	}
+
+	for b := 0; b <= len(baseRows); b++ {
+		oi, ti := ourEdits.inserted[b], theirEdits.inserted[b]
+		switch {
+		case len(ti) == 0:
+		case len(oi) == 0:
+			for _, i := range ti {
+				appendRow(theirs, i)
+			}
+		case !sameRows(ourRows, oi, theirRows, ti):
+			conflict("", insertedInBoth)
+		}
+		for _, i := range oi {
+			appendRow(ours, i)
+		}
+		if b == len(baseRows) {
+			break
+		}
+
+		o, t := ourEdits.kept[b], theirEdits.kept[b]
+		switch {
+		case o < 0 && t < 0:
+		case o < 0:
+			if theirRows[t].key != baseRows[b].key {
+				conflict("", deletedChanged)
+			}
+		case t < 0:
+			if ourRows[o].key != baseRows[b].key {
+				conflict("", deletedChanged)
+				appendRow(ours, o)
+			}
+		default:
+			for s := 0; s < numStaves; s++ {
+				bk, ok, tk := baseRows[b].staves[s], ourRows[o].staves[s], theirRows[t].staves[s]
+				m := ours.Staffs[s].Measure[o]
+				switch {
+				case ok == bk && tk != bk:
+					m = theirs.Staffs[s].Measure[t]
+				case tk != bk && tk != ok:
+					conflict(labels[s], changedInBoth)
+				}
+				merged[s] = append(merged[s], m)
+			}
+		}
+	}
+
+	var changed bool
+	for s, staff := range ours.Staffs {
+		if len(merged[s]) != len(staff.Measure) {
+			changed = true
+		}
+		for i, m := range merged[s] {
+			if i < len(staff.Measure) && staff.Measure[i] != m {
+				changed = true
+			}
+		}
+		staff.Measure = merged[s]
+	}
+	if changed {
+		conflicts = append(conflicts, regenerateExcerpts(ours)...)
+	}
+	return conflicts, nil
+}
+
+// regenerateExcerpts recreates the excerpts of the score with
+// NewExcerpt, so that they show the merged measures, keeping their names.
+// An excerpt that does not show exactly one part of the score cannot be
+// recreated, so it is kept unchanged and reported as a conflict.
+func regenerateExcerpts(score *mscx.Score) []*Conflict {
+	var conflicts []*Conflict
+	excerpts := score.Excerpts
+	score.Excerpts = nil
+	for _, old := range excerpts {
+		part := excerptPart(score, old)
+		if part == nil {
+			score.Excerpts = append(score.Excerpts, old)
+			conflicts = append(conflicts, &Conflict{Staff: old.Name, Reason: staleExcerpt})
+			continue
+		}
+		e, err := score.NewExcerpt(part)
+		if err != nil {
+			score.Excerpts = append(score.Excerpts, old)
+			conflicts = append(conflicts, &Conflict{Staff: old.Name, Reason: staleExcerpt})
+			continue
+		}
+		e.Name = old.Name
+	}
+	return conflicts
+}
+
+// excerptPart returns the part of the score whose staves are shown by the
+// excerpt, or nil if the excerpt shows more or less than one part.
+func excerptPart(score, excerpt *mscx.Score) *mscx.Part {
+	if len(excerpt.Part) != 1 {
+		return nil
+	}
+	var part *mscx.Part
+	for _, ps := range excerpt.Part[0].Staff {
+		staff := score.LinkedStaff(excerpt, ps.ID)
+		if staff == nil {
+			return nil
+		}
+		p := score.PartForStaff(staff.ID)
+		if p == nil || part != nil && p != part {
+			return nil
+		}
+		part = p
+	}
+	if part == nil || len(part.Staff) != len(excerpt.Part[0].Staff) {
+		return nil
+	}
+	return part
+}
+
+func mergeMetaTags(base, ours, theirs *mscx.Score) []*Conflict {
+	var conflicts []*Conflict
+	var names []string
+	seen := map[string]bool{}
+	for _, score := range []*mscx.Score{ours, theirs, base} {
+		for _, mt := range score.MetaTags {
+			if !seen[mt.Name] {
+				seen[mt.Name] = true
+				names = append(names, mt.Name)
+			}
+		}
+	}
+	for _, name := range names {
+		b, bok := base.MetaTag(name)
+		o, ook := ours.MetaTag(name)
+		t, tok := theirs.MetaTag(name)
+		switch {
+		case t == b && tok == bok, t == o && tok == ook:
+		case o == b && ook == bok:
+			if tok {
+				ours.SetMetaTag(name, t)
+			} else {
+				ours.DeleteMetaTag(name)
+			}
+		default:
+			conflicts = append(conflicts, &Conflict{Name: name, Reason: changedInBoth})
+		}
+	}
+	return conflicts
+}
+
+// row holds the XML of a measure of each staff, which identifies its
+// complete contents.
+type row struct {
+	staves []string
+	key    string
+}
+
+func measureRows(score *mscx.Score) ([]*row, error) {
+	var result []*row
+	for s, staff := range score.Staffs {
+		if len(staff.Measure) != len(score.Staffs[0].Measure) {
+			return nil, fmt.Errorf("staff %v has %v measures, want %v", staff.ID, len(staff.Measure), len(score.Staffs[0].Measure))
+		}
+		for i, m := range staff.Measure {
+			buf, err := xml.Marshal(m)
+			if err != nil {
+				return nil, fmt.Errorf("staff %v, measure %v: %w", staff.ID, i+1, err)
+			}
+			for len(result) <= i {
+				result = append(result, &row{staves: make([]string, len(score.Staffs))})
+			}
+			result[i].staves[s] = string(buf)
+		}
+	}
+	for _, r := range result {
+		r.key = strings.Join(r.staves, "\x00")
+	}
+	return result, nil
+}
+
+func sameRows(a []*row, ai []int, b []*row, bi []int) bool {
+	if len(ai) != len(bi) {
+		return false
+	}
+	for k := range ai {
+		if a[ai[k]].key != b[bi[k]].key {
+			return false
+		}
+	}
+	return true
+}
+
+// edits describes a version of a score in terms of the base version.
+type edits struct {
+	// kept holds the index of each base measure in the version, or -1 if
+	// it was deleted.
+	kept []int
+	// inserted holds the indexes of the measures inserted before each
+	// base measure (or, at len(base), after the last one).
+	inserted [][]int
+}
+
+func newEdits(base, version []*row) *edits {
+	baseKeys := make([]string, len(base))
+	for i, r := range base {
+		baseKeys[i] = r.key
+	}
+	keys := make([]string, len(version))
+	for i, r := range version {
+		keys[i] = r.key
+	}
+
+	e := &edits{kept: make([]int, len(base)), inserted: make([][]int, len(base)+1)}
+	next := 0 // the next base measure
+	for _, a := range alignMeasures(baseKeys, keys) {
+		switch {
+		case a.old < 0:
+			e.inserted[next] = append(e.inserted[next], a.new)
+		default:
+			e.kept[a.old] = a.new
+			next = a.old + 1
+		}
+	}
+	return e
+}
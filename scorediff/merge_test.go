@@ -0,0 +1,220 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scorediff
+
+import (
+	"testing"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/google/go-cmp/cmp"
+)
+
+// twoStaves builds a score with a whole note in each measure of a soprano
+// and a bass staff.
+func twoStaves(t *testing.T, composer string, soprano, bass []string) *mscx.Score {
+	t.Helper()
+	b := mscx.NewScore().Title("Hymn").Composer(composer).AddPart("Soprano")
+	for _, p := range soprano {
+		b.AddMeasure("4/4").Note(p, "whole")
+	}
+	b.AddPart("Bass")
+	for _, p := range bass {
+		b.AddMeasure("4/4").Note(p, "whole")
+	}
+	return build(t, b)
+}
+
+// staffPitches returns the pitch names of the chords of each staff.
+func staffPitches(t *testing.T, score *mscx.Score) [][]string {
+	t.Helper()
+	result := make([][]string, len(score.Staffs))
+	for s, staff := range score.Staffs {
+		err := score.WalkStaff(staff, func(ev *mscx.Event) error {
+			if chord, ok := ev.Element.(*mscx.Chord); ok {
+				result[s] = append(result[s], mscx.PitchName(chord.Note[0].Pitch, chord.Note[0].TPC))
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return result
+}
+
+func TestMerge(t *testing.T) {
+	base := func(t *testing.T) *mscx.Score {
+		return twoStaves(t, "Anon.", []string{"C5", "D5", "E5"}, []string{"C3", "G2", "C3"})
+	}
+	tests := []struct {
+		name          string
+		ours, theirs  *mscx.Score
+		want          [][]string
+		wantComposer  string
+		wantConflicts []*Conflict
+	}{
+		{
+			name:         "different staves and metadata",
+			ours:         twoStaves(t, "Anon.", []string{"C5", "F5", "E5"}, []string{"C3", "G2", "C3"}),
+			theirs:       twoStaves(t, "J. Smith", []string{"C5", "D5", "E5"}, []string{"C3", "B2", "C3"}),
+			want:         [][]string{{"C5", "F5", "E5"}, {"C3", "B2", "C3"}},
+			wantComposer: "J. Smith",
+		},
+		{
+			name:         "same change in both",
+			ours:         twoStaves(t, "Anon.", []string{"C5", "F5", "E5"}, []string{"C3", "G2", "C3"}),
+			theirs:       twoStaves(t, "Anon.", []string{"C5", "F5", "E5"}, []string{"C3", "G2", "C3"}),
+			want:         [][]string{{"C5", "F5", "E5"}, {"C3", "G2", "C3"}},
+			wantComposer: "Anon.",
+		},
+		{
+			name:          "conflicting changes",
+			ours:          twoStaves(t, "A. Jones", []string{"C5", "F5", "E5"}, []string{"C3", "G2", "C3"}),
+			theirs:        twoStaves(t, "J. Smith", []string{"C5", "B4", "E5"}, []string{"C3", "G2", "C3"}),
+			want:          [][]string{{"C5", "F5", "E5"}, {"C3", "G2", "C3"}},
+			wantComposer:  "A. Jones",
+			wantConflicts: []*Conflict{{Name: "composer", Reason: changedInBoth}, {Measure: 2, Staff: "Soprano", Reason: changedInBoth}},
+		},
+		{
+			name:         "measure appended in theirs",
+			ours:         twoStaves(t, "Anon.", []string{"G5", "D5", "E5"}, []string{"C3", "G2", "C3"}),
+			theirs:       twoStaves(t, "Anon.", []string{"C5", "D5", "E5", "C5"}, []string{"C3", "G2", "C3", "C3"}),
+			want:         [][]string{{"G5", "D5", "E5", "C5"}, {"C3", "G2", "C3", "C3"}},
+			wantComposer: "Anon.",
+		},
+		{
+			name:         "measure deleted in ours",
+			ours:         twoStaves(t, "Anon.", []string{"C5", "E5"}, []string{"C3", "C3"}),
+			theirs:       twoStaves(t, "Anon.", []string{"C5", "D5", "E5"}, []string{"C3", "G2", "E3"}),
+			want:         [][]string{{"C5", "E5"}, {"C3", "E3"}},
+			wantComposer: "Anon.",
+		},
+		{
+			name:          "measures inserted in both",
+			ours:          twoStaves(t, "Anon.", []string{"C5", "D5", "E5", "F5"}, []string{"C3", "G2", "C3", "F2"}),
+			theirs:        twoStaves(t, "Anon.", []string{"C5", "D5", "E5", "G5"}, []string{"C3", "G2", "C3", "G2"}),
+			want:          [][]string{{"C5", "D5", "E5", "F5"}, {"C3", "G2", "C3", "F2"}},
+			wantComposer:  "Anon.",
+			wantConflicts: []*Conflict{{Measure: 4, Reason: insertedInBoth}},
+		},
+		{
+			name:          "deleted and changed",
+			ours:          twoStaves(t, "Anon.", []string{"C5", "E5"}, []string{"C3", "C3"}),
+			theirs:        twoStaves(t, "Anon.", []string{"C5", "A4", "E5"}, []string{"C3", "G2", "C3"}),
+			want:          [][]string{{"C5", "E5"}, {"C3", "C3"}},
+			wantComposer:  "Anon.",
+			wantConflicts: []*Conflict{{Measure: 2, Reason: deletedChanged}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflicts, err := Merge(base(t), tt.ours, tt.theirs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.wantConflicts, conflicts); diff != "" {
+				t.Errorf("Merge conflicts mismatch (-want +got):\n%v", diff)
+			}
+			if diff := cmp.Diff(tt.want, staffPitches(t, tt.ours)); diff != "" {
+				t.Errorf("Merge result mismatch (-want +got):\n%v", diff)
+			}
+			if got, _ := tt.ours.MetaTag(mscx.MetaComposer); got != tt.wantComposer {
+				t.Errorf("composer = %q, want %q", got, tt.wantComposer)
+			}
+		})
+	}
+}
+
+func TestMerge_Excerpts(t *testing.T) {
+	withExcerpts := func(t *testing.T, soprano, bass []string) *mscx.Score {
+		score := twoStaves(t, "Anon.", soprano, bass)
+		for _, part := range score.Part {
+			if _, err := score.NewExcerpt(part); err != nil {
+				t.Fatal(err)
+			}
+		}
+		score.Excerpts[1].Name = "Bass part"
+		return score
+	}
+	base := withExcerpts(t, []string{"C5", "D5"}, []string{"C3", "G2"})
+
+	t.Run("unchanged", func(t *testing.T) {
+		ours := withExcerpts(t, []string{"C5", "F5"}, []string{"C3", "G2"})
+		theirs := withExcerpts(t, []string{"C5", "D5"}, []string{"C3", "G2"})
+		excerpts := append([]*mscx.Score{}, ours.Excerpts...)
+		if _, err := Merge(base, ours, theirs); err != nil {
+			t.Fatal(err)
+		}
+		for i, e := range ours.Excerpts {
+			if e != excerpts[i] {
+				t.Errorf("excerpt %q was replaced", e.Name)
+			}
+		}
+	})
+
+	t.Run("regenerated", func(t *testing.T) {
+		ours := withExcerpts(t, []string{"C5", "F5"}, []string{"C3", "G2"})
+		theirs := withExcerpts(t, []string{"C5", "D5"}, []string{"C3", "B2"})
+		conflicts, err := Merge(base, ours, theirs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(conflicts) != 0 {
+			t.Errorf("Merge conflicts = %v, want none", conflicts)
+		}
+		var names []string
+		var got [][]string
+		for _, e := range ours.Excerpts {
+			names = append(names, e.Name)
+			got = append(got, staffPitches(t, e)...)
+		}
+		if diff := cmp.Diff([]string{"Soprano", "Bass part"}, names); diff != "" {
+			t.Errorf("excerpt names mismatch (-want +got):\n%v", diff)
+		}
+		if diff := cmp.Diff([][]string{{"C5", "F5"}, {"C3", "B2"}}, got); diff != "" {
+			t.Errorf("excerpt measures mismatch (-want +got):\n%v", diff)
+		}
+	})
+
+	t.Run("not one part", func(t *testing.T) {
+		ours := withExcerpts(t, []string{"C5", "F5"}, []string{"C3", "G2"})
+		ours.Excerpts[0].Part = nil
+		theirs := withExcerpts(t, []string{"C5", "D5"}, []string{"C3", "B2"})
+		conflicts, err := Merge(base, ours, theirs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []*Conflict{{Staff: "Soprano", Reason: staleExcerpt}}
+		if diff := cmp.Diff(want, conflicts); diff != "" {
+			t.Errorf("Merge conflicts mismatch (-want +got):\n%v", diff)
+		}
+		if got := len(ours.Excerpts); got != 2 {
+			t.Errorf("Merge kept %v excerpts, want 2", got)
+		}
+	})
+}
+
+func TestMerge_StavesDiffer(t *testing.T) {
+	base := twoStaves(t, "Anon.", []string{"C5"}, []string{"C3"})
+	ours := twoStaves(t, "Anon.", []string{"C5"}, []string{"C3"})
+	theirs := build(t, mscx.NewScore().AddPart("Soprano").AddMeasure("4/4").Note("C5", "whole"))
+	if _, err := Merge(base, ours, theirs); err == nil {
+		t.Error("Merge with different staves: want error")
+	}
+}
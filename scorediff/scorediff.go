@@ -0,0 +1,181 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scorediff compares two versions of a MuseScore score and reports
+// the differences in musical terms, e.g.
+//
+//	m.12 Piano staff 1 beat 2: E4 quarter → F4 quarter
+//
+// The versions are aligned by staff, measure and voice. Measures that were
+// inserted or deleted are detected, so that the measures after them are
+// still compared with their counterparts.
+package scorediff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// Kind is the kind of a change.
+type Kind string
+
+// Kinds of changes.
+const (
+	Added   Kind = "added"
+	Removed Kind = "removed"
+	Changed Kind = "changed"
+)
+
+// Category is the kind of element that changed.
+type Category string
+
+// Categories of changes.
+const (
+	Note          Category = "note" // a chord or rest
+	Lyric         Category = "lyric"
+	Dynamic       Category = "dynamic"
+	Tempo         Category = "tempo"
+	StaffText     Category = "text"
+	Harmony       Category = "harmony"
+	RehearsalMark Category = "rehearsal mark"
+	TimeSignature Category = "time signature"
+	KeySignature  Category = "key signature"
+	Measure       Category = "measure"
+	Staff         Category = "staff"
+	Part          Category = "part"
+	Metadata      Category = "metadata"
+)
+
+// Change is a single difference between two versions of a score.
+type Change struct {
+	Kind     Kind     `json:"kind"`
+	Category Category `json:"category"`
+	// Measure is the 1-based measure number in the new version, or in the
+	// old version for removed measures.
+	Measure int `json:"measure,omitempty"`
+	// Staff names the staff by its part, e.g. "Piano staff 1".
+	Staff string `json:"staff,omitempty"`
+	// Voice is the 1-based voice number.
+	Voice int     `json:"voice,omitempty"`
+	Beat  float64 `json:"beat,omitempty"`
+	// Verse is the 1-based verse number of a lyric.
+	Verse int `json:"verse,omitempty"`
+	// Name is the name of a metaTag.
+	Name string `json:"name,omitempty"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// String returns the change as a single line of text.
+func (c *Change) String() string {
+	var where []string
+	if c.Measure > 0 {
+		where = append(where, fmt.Sprintf("m.%v", c.Measure))
+	}
+	if c.Staff != "" {
+		where = append(where, c.Staff)
+	}
+	if c.Voice > 1 {
+		where = append(where, fmt.Sprintf("voice %v", c.Voice))
+	}
+	if c.Beat > 0 {
+		where = append(where, "beat "+strconv.FormatFloat(c.Beat, 'f', -1, 64))
+	}
+	if c.Verse > 0 {
+		where = append(where, fmt.Sprintf("verse %v", c.Verse))
+	}
+	switch c.Category {
+	case Note:
+	case Metadata:
+		where = append(where, "metadata", c.Name)
+	default:
+		where = append(where, string(c.Category))
+	}
+
+	var what string
+	switch c.Kind {
+	case Added:
+		what = strings.TrimSpace("added " + c.New)
+	case Removed:
+		what = strings.TrimSpace("removed " + c.Old)
+	default:
+		what = fmt.Sprintf("%v → %v", quote(c.Old), quote(c.New))
+	}
+	return strings.Join(where, " ") + ": " + what
+}
+
+// quote returns an empty value visibly.
+func quote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	return s
+}
+
+// Compare returns the differences from the old to the new version of a
+// score: first metadata and parts, then the changes to each measure in
+// order of staff, time, voice and category.
+func Compare(old, new *mscx.Score) ([]*Change, error) {
+	result := compareMetaTags(old, new)
+	result = append(result, compareParts(old, new)...)
+
+	oldStaves, err := collect(old)
+	if err != nil {
+		return nil, fmt.Errorf("scorediff.Compare: old: %w", err)
+	}
+	newStaves, err := collect(new)
+	if err != nil {
+		return nil, fmt.Errorf("scorediff.Compare: new: %w", err)
+	}
+	return append(result, compareMeasures(oldStaves, newStaves)...), nil
+}
+
+func compareMetaTags(old, new *mscx.Score) []*Change {
+	var result []*Change
+	for _, mt := range old.MetaTags {
+		text, ok := new.MetaTag(mt.Name)
+		switch {
+		case !ok && mt.Text != "":
+			result = append(result, &Change{Kind: Removed, Category: Metadata, Name: mt.Name, Old: mt.Text})
+		case ok && text != mt.Text:
+			result = append(result, &Change{Kind: Changed, Category: Metadata, Name: mt.Name, Old: mt.Text, New: text})
+		}
+	}
+	for _, mt := range new.MetaTags {
+		if _, ok := old.MetaTag(mt.Name); !ok && mt.Text != "" {
+			result = append(result, &Change{Kind: Added, Category: Metadata, Name: mt.Name, New: mt.Text})
+		}
+	}
+	return result
+}
+
+func compareParts(old, new *mscx.Score) []*Change {
+	var result []*Change
+	for i := 0; i < len(old.Part) || i < len(new.Part); i++ {
+		switch {
+		case i >= len(new.Part):
+			result = append(result, &Change{Kind: Removed, Category: Part, Old: old.Part[i].TrackName})
+		case i >= len(old.Part):
+			result = append(result, &Change{Kind: Added, Category: Part, New: new.Part[i].TrackName})
+		case old.Part[i].TrackName != new.Part[i].TrackName:
+			result = append(result, &Change{Kind: Changed, Category: Part, Old: old.Part[i].TrackName, New: new.Part[i].TrackName})
+		}
+	}
+	return result
+}
@@ -0,0 +1,145 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scorediff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/google/go-cmp/cmp"
+)
+
+const test01 = "../mscx/testfiles/001-O_For_a_Thousand_Tongues_to_Sing.mscz"
+
+func build(t *testing.T, b *mscx.ScoreBuilder) *mscx.Score {
+	t.Helper()
+	sz, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sz.MuseScore.Score
+}
+
+func TestCompare_Identical(t *testing.T) {
+	old, err := mscx.NewFromFile(test01, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := mscx.NewFromFile(test01, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Compare(&old.MuseScore.Score, &new.MuseScore.Score)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Compare = %v, want no changes", got)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	old := build(t, mscx.NewScore().
+		Title("Hymn").
+		Composer("J. S. Bach").
+		AddPart("Soprano").
+		AddMeasure("4/4").Note("E4", "quarter").Lyric("Hal-").Note("F4", "quarter").Lyric("le-").Note("G4", "half").Lyric("lu-").
+		AddMeasure("4/4").Note("A4", "half").Lyric("jah!").Rest("half").
+		AddMeasure("4/4").Note("G4", "whole"))
+	sz, err := mscx.NewScore().
+		Title("Hymn").
+		Composer("Johann Sebastian Bach").
+		AddPart("Soprano").
+		AddMeasure("4/4").Note("E4", "quarter").Lyric("Hal-").Note("F4", "quarter").Lyric("le-").Note("G4", "half").Lyric("lu-").
+		AddMeasure("4/4").Note("A4", "half").Lyric("ia!").Note("B4", "half").
+		AddMeasure("4/4").Note("C5", "whole").
+		AddMeasure("4/4").Note("G4", "whole").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := sz.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Add an mf dynamic to the first chord, as MuseScore writes it.
+	i := bytes.Index(buf, []byte("<Chord>"))
+	dynamic := "<Dynamic>\n<subtype>mf</subtype>\n<velocity>80</velocity>\n</Dynamic>\n"
+	buf = append(buf[:i:i], append([]byte(dynamic), buf[i:]...)...)
+	parsed, err := mscx.New(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	new := &parsed.MuseScore.Score
+
+	got, err := Compare(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Change{
+		{Kind: Changed, Category: Metadata, Name: "composer", Old: "J. S. Bach", New: "Johann Sebastian Bach"},
+		{Kind: Added, Category: Dynamic, Measure: 1, Staff: "Soprano", Voice: 1, Beat: 1, New: "mf"},
+		{Kind: Changed, Category: Lyric, Measure: 2, Staff: "Soprano", Voice: 1, Beat: 1, Verse: 1, Old: "jah!", New: "ia!"},
+		{Kind: Changed, Category: Note, Measure: 2, Staff: "Soprano", Voice: 1, Beat: 3, Old: "half rest", New: "B4 half"},
+		{Kind: Added, Category: Measure, Measure: 3},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Compare mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestChange_String(t *testing.T) {
+	tests := []struct {
+		change *Change
+		want   string
+	}{
+		{
+			change: &Change{Kind: Changed, Category: Note, Measure: 12, Staff: "Soprano", Voice: 1, Beat: 2, Old: "E4 quarter", New: "F4 quarter"},
+			want:   "m.12 Soprano beat 2: E4 quarter → F4 quarter",
+		},
+		{
+			change: &Change{Kind: Removed, Category: Lyric, Measure: 3, Staff: "Piano staff 1", Voice: 2, Beat: 1.5, Verse: 2, Old: "thou"},
+			want:   "m.3 Piano staff 1 voice 2 beat 1.5 verse 2 lyric: removed thou",
+		},
+		{
+			change: &Change{Kind: Changed, Category: Metadata, Name: "lyricist", Old: "Charles Wesley"},
+			want:   `metadata lyricist: Charles Wesley → ""`,
+		},
+		{
+			change: &Change{Kind: Added, Category: Measure, Measure: 5},
+			want:   "m.5 measure: added",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.change.String(); got != tt.want {
+				t.Errorf("String = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlignMeasures(t *testing.T) {
+	got := alignMeasures([]string{"a", "b", "c", "d"}, []string{"a", "x", "c", "y", "d", "e"})
+	want := []alignment{{0, 0}, {1, 1}, {2, 2}, {-1, 3}, {3, 4}, {-1, 5}}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(alignment{})); diff != "" {
+		t.Errorf("alignMeasures mismatch (-want +got):\n%v", diff)
+	}
+}
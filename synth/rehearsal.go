@@ -0,0 +1,317 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synth
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// Line is a line of music that a rehearsal track emphasizes, such as a
+// part or one voice of a hymn.
+type Line struct {
+	Name   string
+	Tracks []*Track
+}
+
+// PartLines returns a line for each part of the tracks, in order, named
+// after the part.
+func PartLines(tracks []*Track) []*Line {
+	var lines []*Line
+	byPart := map[*mscx.Part]*Line{}
+	for _, t := range tracks {
+		line, ok := byPart[t.Part]
+		if !ok {
+			line = &Line{Name: partName(t.Part, len(lines)+1)}
+			byPart[t.Part] = line
+			lines = append(lines, line)
+		}
+		line.Tracks = append(line.Tracks, t)
+	}
+	return lines
+}
+
+// satbNames are the names of the lines of a hymn written on two staves.
+var satbNames = []string{"Soprano", "Alto", "Tenor", "Bass"}
+
+// VoiceLines returns a line for each voice of the tracks, named after its
+// part, staff and voice. A voice of chords, such as the soprano and alto
+// of a hymn sharing stems, is split into an upper and a lower line, which
+// share any single notes. When this gives two lines on each of two staves,
+// they are named Soprano, Alto, Tenor and Bass.
+func VoiceLines(tracks []*Track) []*Line {
+	staves := map[*mscx.Part]map[string]bool{}
+	for _, t := range tracks {
+		if staves[t.Part] == nil {
+			staves[t.Part] = map[string]bool{}
+		}
+		staves[t.Part][t.StaffID] = true
+	}
+
+	var lines []*Line
+	for _, t := range tracks {
+		name := fmt.Sprintf("%v voice %v", partName(t.Part, 0), t.Voice)
+		if len(staves[t.Part]) > 1 {
+			name = fmt.Sprintf("%v staff %v voice %v", partName(t.Part, 0), t.StaffID, t.Voice)
+		}
+		upper, lower := splitChords(t)
+		if lower == nil {
+			lines = append(lines, &Line{Name: name, Tracks: []*Track{t}})
+			continue
+		}
+		lines = append(lines,
+			&Line{Name: name + " upper", Tracks: []*Track{upper}},
+			&Line{Name: name + " lower", Tracks: []*Track{lower}})
+	}
+
+	if isSATB(lines) {
+		for i, line := range lines {
+			line.Name = satbNames[i]
+		}
+	}
+	return lines
+}
+
+// splitChords returns tracks with the highest and the lowest note of each
+// chord of t, or nil for lower if t has no chords of more than one note.
+func splitChords(t *Track) (upper, lower *Track) {
+	chords := map[float64][]*Note{}
+	var starts []float64
+	for _, n := range t.Notes {
+		if _, ok := chords[n.Start]; !ok {
+			starts = append(starts, n.Start)
+		}
+		chords[n.Start] = append(chords[n.Start], n)
+	}
+	if len(starts) == len(t.Notes) {
+		return t, nil
+	}
+
+	u, l := *t, *t
+	u.Notes, l.Notes = nil, nil
+	for _, start := range starts {
+		high, low := chords[start][0], chords[start][0]
+		for _, n := range chords[start] {
+			if n.Pitch > high.Pitch {
+				high = n
+			}
+			if n.Pitch < low.Pitch {
+				low = n
+			}
+		}
+		u.Notes = append(u.Notes, high)
+		l.Notes = append(l.Notes, low)
+	}
+	return &u, &l
+}
+
+// isSATB reports whether the lines are two lines of one staff followed by
+// two lines of another.
+func isSATB(lines []*Line) bool {
+	if len(lines) != 4 {
+		return false
+	}
+	staff := func(i int) string { return lines[i].Tracks[0].StaffID }
+	return staff(0) == staff(1) && staff(2) == staff(3) && staff(0) != staff(2)
+}
+
+// partName returns the name of a part, or "Part n" if it has none.
+func partName(part *mscx.Part, n int) string {
+	if part != nil {
+		if part.TrackName != "" {
+			return part.TrackName
+		}
+		if part.Instrument != nil && part.Instrument.LongName != "" {
+			return part.Instrument.LongName
+		}
+	}
+	if n == 0 {
+		return "Part"
+	}
+	return fmt.Sprintf("Part %v", n)
+}
+
+// RehearsalOptions control how a rehearsal track emphasizes its line.
+type RehearsalOptions struct {
+	// Pan is the pan of the emphasized line, from -1 (left) to 1 (right).
+	// The other lines are panned to the opposite side.
+	Pan float64
+	// Others scales the volume of the other lines, from 0 (silent) to 1
+	// (unchanged).
+	Others float64
+	// Click adds a click on every beat, accented on the first beat of each
+	// measure.
+	Click bool
+	// CountIn is the number of measures of clicks before the score starts.
+	CountIn int
+}
+
+// DefaultRehearsalOptions returns options that pan the emphasized line to
+// the left and play the other lines at 40% volume (about 16 dB quieter).
+func DefaultRehearsalOptions() *RehearsalOptions {
+	return &RehearsalOptions{Pan: -0.5, Others: 0.4}
+}
+
+// General MIDI percussion keys of the clicks.
+const (
+	clickAccent = 76 // high wood block
+	clickBeat   = 77 // low wood block
+)
+
+// Rehearsal returns the tracks of the lines of a score for a rehearsal
+// track of the lead line: its tracks are played unmuted at full volume and
+// panned to opts.Pan, and the tracks of the other lines are attenuated and
+// panned to the opposite side. If opts asks for clicks or a count-in, a
+// click track on bank 128 (the percussion bank) is added, and the count-in
+// delays the score. A nil opts uses DefaultRehearsalOptions. The tracks
+// of the lines are not modified.
+func Rehearsal(score *mscx.Score, lines []*Line, lead *Line, opts *RehearsalOptions) ([]*Track, error) {
+	if opts == nil {
+		opts = DefaultRehearsalOptions()
+	}
+
+	var click *Track
+	var delay float64
+	if opts.Click || opts.CountIn > 0 {
+		var err error
+		if click, delay, err = clickTrack(score, opts.Click, opts.CountIn); err != nil {
+			return nil, fmt.Errorf("Rehearsal: %w", err)
+		}
+	}
+
+	var result []*Track
+	for _, line := range lines {
+		for _, t := range line.Tracks {
+			c := *t
+			if line == lead {
+				c.Volume, c.Pan, c.Mute = 1, opts.Pan, false
+			} else {
+				c.Volume, c.Pan = t.Volume*opts.Others, -opts.Pan
+			}
+			c.Notes = make([]*Note, len(t.Notes))
+			for i, n := range t.Notes {
+				shifted := *n
+				shifted.Start += delay
+				c.Notes[i] = &shifted
+			}
+			result = append(result, &c)
+		}
+	}
+	if click != nil {
+		result = append(result, click)
+	}
+	return result, nil
+}
+
+// clickTrack returns a track that clicks on the beats of the count-in
+// measures and, if throughout is true, of every measure of the score,
+// along with the length of the count-in in seconds. The count-in measures
+// have the first time signature and tempo of the score. A pickup measure
+// is counted from its end.
+func clickTrack(score *mscx.Score, throughout bool, countIn int) (*Track, float64, error) {
+	if len(score.Staffs) == 0 {
+		return nil, 0, fmt.Errorf("score has no staves")
+	}
+	tempo, err := score.TempoMap()
+	if err != nil {
+		return nil, 0, err
+	}
+	division := score.Division
+	if division <= 0 {
+		division = mscx.DefaultDivision
+	}
+	t := &Track{Bank: percussionBank, Volume: 100.0 / 127}
+	const clickSeconds = 0.1
+
+	var timeSig *mscx.TimeSig
+	var measureStart int
+	var delay float64
+	for mi, m := range score.Staffs[0].Measure {
+		if m.TimeSig != nil {
+			timeSig = m.TimeSig
+		}
+		if len(m.Voice) > 0 && m.Voice[0].TimeSig != nil {
+			timeSig = m.Voice[0].TimeSig
+		}
+		if timeSig == nil {
+			return nil, 0, fmt.Errorf("measure %v: no time signature", mi+1)
+		}
+		measureTicks, err := score.MeasureTicks(m, timeSig)
+		if err != nil {
+			return nil, 0, fmt.Errorf("measure %v: %w", mi+1, err)
+		}
+		fullTicks, err := timeSig.Ticks(division)
+		if err != nil {
+			return nil, 0, fmt.Errorf("measure %v: %w", mi+1, err)
+		}
+		beat := beatTicks(timeSig, division)
+
+		if mi == 0 && countIn > 0 {
+			// The count-in is played at the initial tempo, before tick 0.
+			perTick := 1 / (float64(division) * tempo.Tempo(0))
+			delay = float64(countIn*fullTicks) * perTick
+			for tick := 0; tick < countIn*fullTicks; tick += beat {
+				key, vel := clickBeat, defaultVelocity
+				if tick%fullTicks == 0 {
+					key, vel = clickAccent, 100
+				}
+				t.Notes = append(t.Notes, &Note{Start: float64(tick) * perTick, Duration: clickSeconds, Pitch: key, Velocity: vel})
+			}
+		}
+		if !throughout {
+			break
+		}
+
+		// Beats are counted from the end of a short first measure (a
+		// pickup) and from the start of any other measure.
+		first := 0
+		if mi == 0 && measureTicks < fullTicks {
+			first = (measureTicks - fullTicks) % beat
+			if first < 0 {
+				first += beat
+			}
+		}
+		for tick := first; tick < measureTicks; tick += beat {
+			key, vel := clickBeat, defaultVelocity
+			if tick == 0 && (mi > 0 || measureTicks >= fullTicks) {
+				key, vel = clickAccent, 100
+			}
+			start := delay + tempo.Seconds(measureStart+tick)
+			t.Notes = append(t.Notes, &Note{Start: start, Duration: clickSeconds, Pitch: key, Velocity: vel})
+		}
+		measureStart += measureTicks
+	}
+	return t, delay, nil
+}
+
+// beatTicks returns the length of a beat of a time signature: a dotted
+// quarter note in compound meters such as 6/8 and a note of the
+// signature's denominator otherwise.
+func beatTicks(timeSig *mscx.TimeSig, division int) int {
+	num, _ := strconv.Atoi(timeSig.SigN)
+	den, err := strconv.Atoi(timeSig.SigD)
+	if err != nil || den <= 0 {
+		return division
+	}
+	beat := 4 * division / den
+	if den >= 8 && num > 3 && num%3 == 0 {
+		beat *= 3
+	}
+	return beat
+}
@@ -0,0 +1,272 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synth
+
+import (
+	"testing"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// hymnTracks returns the tracks of a one-measure hymn with the soprano
+// and alto in chords on the upper staff and the tenor and bass on the
+// lower staff, followed by an organ part.
+func hymnTracks(t *testing.T) []*Track {
+	t.Helper()
+	sz, err := mscx.NewScore().
+		AddPart("Choir").
+		AddMeasure("4/4").Chord([]string{"E5", "C5"}, "half").Note("D5", "half").
+		AddStaff("F").
+		AddMeasure("4/4").Chord([]string{"G3", "C3"}, "half").Chord([]string{"G3", "G2"}, "half").
+		AddPart("Organ").
+		AddMeasure("4/4").Note("C4", "whole").
+		Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	tracks, err := Tracks(&sz.MuseScore.Score)
+	if err != nil {
+		t.Fatalf("Tracks: %v", err)
+	}
+	return tracks
+}
+
+type lineInfo struct {
+	Name    string
+	Pitches [][]int // of each track
+}
+
+func lineInfos(lines []*Line) []lineInfo {
+	var result []lineInfo
+	for _, line := range lines {
+		info := lineInfo{Name: line.Name}
+		for _, t := range line.Tracks {
+			var pitches []int
+			for _, n := range t.Notes {
+				pitches = append(pitches, n.Pitch)
+			}
+			info.Pitches = append(info.Pitches, pitches)
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+func TestPartLines(t *testing.T) {
+	got := lineInfos(PartLines(hymnTracks(t)))
+	want := []lineInfo{
+		{Name: "Choir", Pitches: [][]int{{76, 72, 74}, {55, 48, 55, 43}}},
+		{Name: "Organ", Pitches: [][]int{{60}}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("PartLines mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestVoiceLines(t *testing.T) {
+	tracks := hymnTracks(t)
+	tests := []struct {
+		name   string
+		tracks []*Track
+		want   []lineInfo
+	}{
+		{
+			name:   "SATB",
+			tracks: tracks[:2],
+			want: []lineInfo{
+				{Name: "Soprano", Pitches: [][]int{{76, 74}}},
+				{Name: "Alto", Pitches: [][]int{{72, 74}}},
+				{Name: "Tenor", Pitches: [][]int{{55, 55}}},
+				{Name: "Bass", Pitches: [][]int{{48, 43}}},
+			},
+		},
+		{
+			name:   "parts",
+			tracks: tracks,
+			want: []lineInfo{
+				{Name: "Choir staff 1 voice 1 upper", Pitches: [][]int{{76, 74}}},
+				{Name: "Choir staff 1 voice 1 lower", Pitches: [][]int{{72, 74}}},
+				{Name: "Choir staff 2 voice 1 upper", Pitches: [][]int{{55, 55}}},
+				{Name: "Choir staff 2 voice 1 lower", Pitches: [][]int{{48, 43}}},
+				{Name: "Organ voice 1", Pitches: [][]int{{60}}},
+			},
+		},
+		{
+			name:   "voices",
+			tracks: []*Track{tracks[2], {StaffID: "3", Voice: 2, Part: tracks[2].Part, Notes: []*Note{{Pitch: 53}}}},
+			want: []lineInfo{
+				{Name: "Organ voice 1", Pitches: [][]int{{60}}},
+				{Name: "Organ voice 2", Pitches: [][]int{{53}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lineInfos(VoiceLines(tt.tracks))
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("VoiceLines mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestRehearsal(t *testing.T) {
+	tracks := hymnTracks(t)
+	tracks[2].Mute = true
+	lines := VoiceLines(tracks[:2])
+	lines = append(lines, &Line{Name: "Organ", Tracks: tracks[2:]})
+	alto := lines[1]
+	alto.Tracks[0].Mute = true
+
+	got, err := Rehearsal(nil, lines, alto, &RehearsalOptions{Pan: 0.75, Others: 0.5})
+	if err != nil {
+		t.Fatalf("Rehearsal: %v", err)
+	}
+	type trackInfo struct {
+		Volume, Pan float64
+		Mute        bool
+	}
+	var infos []trackInfo
+	for _, track := range got {
+		infos = append(infos, trackInfo{track.Volume, track.Pan, track.Mute})
+	}
+	v := 100.0 / 127
+	want := []trackInfo{
+		{v / 2, -0.75, false},
+		{1, 0.75, false},
+		{v / 2, -0.75, false},
+		{v / 2, -0.75, false},
+		{v / 2, -0.75, true},
+	}
+	if diff := cmp.Diff(want, infos); diff != "" {
+		t.Errorf("Rehearsal mismatch (-want +got):\n%v", diff)
+	}
+	if got[1] == alto.Tracks[0] || !alto.Tracks[0].Mute || alto.Tracks[0].Volume != v {
+		t.Errorf("Rehearsal modified the tracks of the line")
+	}
+}
+
+func TestRehearsal_Click(t *testing.T) {
+	score := testScore(t)
+	tracks, err := Tracks(score)
+	if err != nil {
+		t.Fatalf("Tracks: %v", err)
+	}
+	lines := PartLines(tracks)
+
+	got, err := Rehearsal(score, lines, lines[0], &RehearsalOptions{Click: true, CountIn: 1})
+	if err != nil {
+		t.Fatalf("Rehearsal: %v", err)
+	}
+	if len(got) != len(tracks)+1 {
+		t.Fatalf("got %v tracks, want %v", len(got), len(tracks)+1)
+	}
+	// One measure of count-in at ♩ = 60 delays the score by 4 seconds.
+	if got, want := got[0].Notes[1].Start, tracks[0].Notes[1].Start+4; got != want {
+		t.Errorf("second note starts at %v, want %v", got, want)
+	}
+
+	click := got[len(got)-1]
+	if click.Bank != percussionBank || click.String() != "click track" {
+		t.Errorf("click track = %v on bank %v", click, click.Bank)
+	}
+	// The count-in, measure 1 at ♩ = 60 and measure 2 at ♩ = 120.
+	want := []*Note{
+		{Start: 0, Pitch: 76, Velocity: 100}, {Start: 1, Pitch: 77, Velocity: 80},
+		{Start: 2, Pitch: 77, Velocity: 80}, {Start: 3, Pitch: 77, Velocity: 80},
+		{Start: 4, Pitch: 76, Velocity: 100}, {Start: 5, Pitch: 77, Velocity: 80},
+		{Start: 6, Pitch: 77, Velocity: 80}, {Start: 7, Pitch: 77, Velocity: 80},
+		{Start: 8, Pitch: 76, Velocity: 100}, {Start: 8.5, Pitch: 77, Velocity: 80},
+		{Start: 9, Pitch: 77, Velocity: 80}, {Start: 9.5, Pitch: 77, Velocity: 80},
+	}
+	if diff := cmp.Diff(want, click.Notes, cmpopts.IgnoreFields(Note{}, "Duration")); diff != "" {
+		t.Errorf("click notes mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestClickTrack_Pickup(t *testing.T) {
+	sz, err := mscx.NewScore().
+		AddPart("Melody").
+		AddMeasure("6/8").Note("C5", "quarter.").Note("D5", "quarter.").
+		AddMeasure("").Note("E5", "quarter.").Note("F5", "quarter.").
+		Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	score := &sz.MuseScore.Score
+	// Make the first measure a pickup of four eighth notes, whose first beat
+	// starts on its second eighth note.
+	pickup := score.Staffs[0].Measure[0]
+	pickup.Len = "1/2"
+
+	tests := []struct {
+		name       string
+		throughout bool
+		countIn    int
+		want       []float64
+	}{
+		{name: "count-in only", countIn: 2, want: []float64{0, 0.75, 1.5, 2.25}},
+		{name: "clicks", throughout: true, want: []float64{0.25, 1, 1.75}},
+		{name: "both", throughout: true, countIn: 1, want: []float64{0, 0.75, 1.75, 2.5, 3.25}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track, delay, err := clickTrack(score, tt.throughout, tt.countIn)
+			if err != nil {
+				t.Fatalf("clickTrack: %v", err)
+			}
+			if want := 1.5 * float64(tt.countIn); delay != want {
+				t.Errorf("delay = %v, want %v", delay, want)
+			}
+			var got []float64
+			for _, n := range track.Notes {
+				got = append(got, n.Start)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("click times mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestBeatTicks(t *testing.T) {
+	tests := []struct {
+		sigN, sigD string
+		want       int
+	}{
+		{sigN: "4", sigD: "4", want: 480},
+		{sigN: "3", sigD: "4", want: 480},
+		{sigN: "2", sigD: "2", want: 960},
+		{sigN: "3", sigD: "8", want: 240},
+		{sigN: "6", sigD: "8", want: 720},
+		{sigN: "9", sigD: "8", want: 720},
+		{sigN: "12", sigD: "16", want: 360},
+		{sigN: "5", sigD: "8", want: 240},
+	}
+
+	for _, tt := range tests {
+		if got := beatTicks(&mscx.TimeSig{SigN: tt.sigN, SigD: tt.sigD}, 480); got != tt.want {
+			t.Errorf("beatTicks(%v/%v) = %v, want %v", tt.sigN, tt.sigD, got, tt.want)
+		}
+	}
+}
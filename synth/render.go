@@ -0,0 +1,166 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synth
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// DefaultSampleRate is the sample rate of CD audio.
+const DefaultSampleRate = 44100
+
+// Audio is rendered stereo audio.
+type Audio struct {
+	SampleRate  int
+	Left, Right []float32
+}
+
+// Duration returns the length of the audio.
+func (a *Audio) Duration() time.Duration {
+	return time.Duration(float64(len(a.Left)) / float64(a.SampleRate) * float64(time.Second))
+}
+
+// Render plays the tracks with the presets of the SoundFont and returns
+// the resulting audio at the given sample rate (or DefaultSampleRate if
+// zero), including the tail of the last notes and the reverb. Muted tracks
+// are skipped. A track whose bank and program are not in the SoundFont is
+// played with the same program of bank 0, or else with the first program
+// of its bank or of bank 0.
+func Render(sf *SoundFont, tracks []*Track, settings *Settings, sampleRate int) (*Audio, error) {
+	if sampleRate <= 0 {
+		sampleRate = DefaultSampleRate
+	}
+	if settings == nil {
+		settings = NewSettings(nil)
+	}
+	tuning := 1200 * math.Log2(settings.Tuning/440)
+
+	dry, send := &stereo{}, &stereo{}
+	var length int
+	for _, t := range tracks {
+		if t.Mute || len(t.Notes) == 0 {
+			continue
+		}
+		p := sf.lookup(t.Bank, t.Program)
+		if p == nil {
+			return nil, fmt.Errorf("Render: %v: no preset for bank %v, program %v", t, t.Bank, t.Program)
+		}
+		for _, n := range t.Notes {
+			vel := n.Velocity
+			if vel < 1 {
+				vel = 1
+			} else if vel > 127 {
+				vel = 127
+			}
+			offset := int(n.Start * float64(sampleRate))
+			held := int(n.Duration * float64(sampleRate))
+			for _, r := range p.regions {
+				if n.Pitch < r.keyLo || n.Pitch > r.keyHi || vel < r.velLo || vel > r.velHi {
+					continue
+				}
+				v := newVoice(sf, r, t, n.Pitch, vel, tuning, sampleRate)
+				if end := offset + v.render(dry, send, offset, held); end > length {
+					length = end
+				}
+			}
+		}
+	}
+
+	if settings.Reverb != nil {
+		rev := newReverb(settings.Reverb, sampleRate)
+		length += rev.tailFrames
+		dry.add(length-1, 0, 0)
+		rev.process(dry, send)
+	}
+	dry.add(length, 0, 0) // make sure that dry is at least length long
+	audio := &Audio{SampleRate: sampleRate, Left: dry.left[:length], Right: dry.right[:length]}
+
+	gain := float32(settings.Gain / DefaultGain)
+	for i := range audio.Left {
+		audio.Left[i] *= gain
+		audio.Right[i] *= gain
+	}
+	audio.trim()
+	return audio, nil
+}
+
+// RenderScore renders a score with its own synthesizer settings.
+func RenderScore(sf *SoundFont, score *mscx.Score, sampleRate int) (*Audio, error) {
+	tracks, err := Tracks(score)
+	if err != nil {
+		return nil, err
+	}
+	return Render(sf, tracks, NewSettings(score.Synthesizer), sampleRate)
+}
+
+// trim removes the inaudible end of the audio.
+func (a *Audio) trim() {
+	const threshold = 1.0 / 32768
+	n := len(a.Left)
+	for n > 0 && math.Abs(float64(a.Left[n-1])) < threshold && math.Abs(float64(a.Right[n-1])) < threshold {
+		n--
+	}
+	a.Left, a.Right = a.Left[:n], a.Right[:n]
+}
+
+// WriteWAV writes the audio as a 16-bit stereo PCM WAV file, clipping
+// samples beyond full scale.
+func (a *Audio) WriteWAV(w io.Writer) error {
+	const channels, bytesPerSample = 2, 2
+	dataSize := len(a.Left) * channels * bytesPerSample
+	bw := bufio.NewWriter(w)
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, uint32(36 + dataSize), [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16),
+		uint16(1), // PCM
+		uint16(channels),
+		uint32(a.SampleRate),
+		uint32(a.SampleRate * channels * bytesPerSample),
+		uint16(channels * bytesPerSample),
+		uint16(8 * bytesPerSample),
+		[4]byte{'d', 'a', 't', 'a'}, uint32(dataSize),
+	}
+	for _, v := range header {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return fmt.Errorf("Audio.WriteWAV: %w", err)
+		}
+	}
+	var buf [4]byte
+	for i := range a.Left {
+		binary.LittleEndian.PutUint16(buf[0:], uint16(pcm16(a.Left[i])))
+		binary.LittleEndian.PutUint16(buf[2:], uint16(pcm16(a.Right[i])))
+		if _, err := bw.Write(buf[:]); err != nil {
+			return fmt.Errorf("Audio.WriteWAV: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("Audio.WriteWAV: %w", err)
+	}
+	return nil
+}
+
+func pcm16(x float32) int16 {
+	v := math.Round(float64(x) * 32767)
+	return int16(math.Max(-32768, math.Min(32767, v)))
+}
@@ -0,0 +1,229 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dry is the settings without reverb.
+var dry = &Settings{Gain: DefaultGain, Tuning: 440}
+
+// a4 returns a track that plays A4 for half a second.
+func a4(pan float64) *Track {
+	return &Track{StaffID: "1", Voice: 1, Volume: 1, Pan: pan,
+		Notes: []*Note{{Start: 0, Duration: 0.5, Pitch: 69, Velocity: 127}}}
+}
+
+func peak(samples []float32) float64 {
+	var p float64
+	for _, x := range samples {
+		p = math.Max(p, math.Abs(float64(x)))
+	}
+	return p
+}
+
+func TestRender(t *testing.T) {
+	sf := testSoundFont(t)
+	audio, err := Render(sf, []*Track{a4(0)}, dry, 0)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	if audio.SampleRate != DefaultSampleRate {
+		t.Errorf("SampleRate = %v, want %v", audio.SampleRate, DefaultSampleRate)
+	}
+	// The note is released after 0.5s and takes 0.24s to fall by 96 dB.
+	if d := audio.Duration(); d < 700*time.Millisecond || d > 750*time.Millisecond {
+		t.Errorf("Duration = %v, want about 740ms", d)
+	}
+	// A centered note at full velocity and volume is at -3 dB in each
+	// channel.
+	if got, want := peak(audio.Left), 16000.0/32768*math.Sqrt(0.5); math.Abs(got-want) > 0.01 {
+		t.Errorf("peak(Left) = %v, want %v", got, want)
+	}
+	if got, want := peak(audio.Right), peak(audio.Left); got != want {
+		t.Errorf("peak(Right) = %v, want %v", got, want)
+	}
+
+	// The sample plays 441 Hz at its root key of A4 and 44.1 kHz.
+	var crossings int
+	for i := 1; i < audio.SampleRate/2; i++ {
+		if audio.Left[i-1] < 0 && audio.Left[i] >= 0 {
+			crossings++
+		}
+	}
+	if crossings < 218 || crossings > 222 {
+		t.Errorf("got %v cycles in 0.5s, want about 220", crossings)
+	}
+}
+
+func TestRender_Pitch(t *testing.T) {
+	sf := testSoundFont(t)
+	cycles := func(track *Track, settings *Settings) int {
+		audio, err := Render(sf, []*Track{track}, settings, 0)
+		if err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+		var crossings int
+		for i := 1; i < audio.SampleRate/2; i++ {
+			if audio.Left[i-1] < 0 && audio.Left[i] >= 0 {
+				crossings++
+			}
+		}
+		return crossings
+	}
+
+	octave := a4(0)
+	octave.Notes[0].Pitch = 81
+	if got := cycles(octave, dry); got < 438 || got > 442 {
+		t.Errorf("A5: got %v cycles in 0.5s, want about 441", got)
+	}
+	lowTuning := &Settings{Gain: DefaultGain, Tuning: 220}
+	if got := cycles(a4(0), lowTuning); got < 108 || got > 112 {
+		t.Errorf("A4 tuned to 220 Hz: got %v cycles in 0.5s, want about 110", got)
+	}
+}
+
+func TestRender_Mix(t *testing.T) {
+	sf := testSoundFont(t)
+	render := func(settings *Settings, tracks ...*Track) *Audio {
+		t.Helper()
+		audio, err := Render(sf, tracks, settings, 0)
+		if err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+		return audio
+	}
+	centered := render(dry, a4(0))
+
+	left := render(dry, a4(-1))
+	if peak(left.Right) > 1e-6 || math.Abs(peak(left.Left)-peak(centered.Left)*math.Sqrt2) > 0.01 {
+		t.Errorf("panned left: peaks = %v, %v", peak(left.Left), peak(left.Right))
+	}
+
+	loud := render(&Settings{Gain: 2 * DefaultGain, Tuning: 440}, a4(0))
+	if got, want := peak(loud.Left), 2*peak(centered.Left); math.Abs(got-want) > 1e-6 {
+		t.Errorf("double gain: peak = %v, want %v", got, want)
+	}
+
+	quiet := a4(0)
+	quiet.Volume = 0.5
+	if got, want := peak(render(dry, quiet).Left), peak(centered.Left)/4; math.Abs(got-want) > 1e-3 {
+		t.Errorf("half volume: peak = %v, want %v", got, want)
+	}
+
+	muted := a4(0)
+	muted.Mute = true
+	if got := render(dry, muted).Duration(); got != 0 {
+		t.Errorf("muted: Duration = %v, want 0", got)
+	}
+
+	later := a4(0)
+	later.Notes[0].Start = 1
+	if got, want := render(dry, later, a4(0)).Duration(), centered.Duration()+time.Second; got < want-time.Millisecond || got > want+time.Millisecond {
+		t.Errorf("two notes: Duration = %v, want %v", got, want)
+	}
+
+	reverb := render(NewSettings(nil), a4(0))
+	if got := reverb.Duration(); got < 2*time.Second {
+		t.Errorf("reverb: Duration = %v, want the reverb tail", got)
+	}
+	if got := peak(reverb.Left[centered.SampleRate:]); got < 1e-4 {
+		t.Errorf("reverb: peak after 1s = %v, want reverberation", got)
+	}
+}
+
+func TestRender_NoPreset(t *testing.T) {
+	sf, err := ParseSoundFont(buildSoundFont(testPreset{name: "Drums", bank: percussionBank, keyHi: 127}))
+	if err != nil {
+		t.Fatalf("ParseSoundFont: %v", err)
+	}
+	_, err = Render(sf, []*Track{a4(0)}, dry, 0)
+	if want := "no preset for bank 0, program 0"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Render = %v, want error containing %q", err, want)
+	}
+}
+
+func TestRenderScore(t *testing.T) {
+	audio, err := RenderScore(testSoundFont(t), testScore(t), 22050)
+	if err != nil {
+		t.Fatalf("RenderScore: %v", err)
+	}
+	if audio.SampleRate != 22050 {
+		t.Errorf("SampleRate = %v, want 22050", audio.SampleRate)
+	}
+	// The score lasts 6 seconds, followed by the release and reverb.
+	if d := audio.Duration(); d < 6*time.Second {
+		t.Errorf("Duration = %v, want at least 6s", d)
+	}
+	if peak(audio.Left) == 0 || peak(audio.Right) == 0 {
+		t.Errorf("audio is silent")
+	}
+}
+
+func TestWriteWAV(t *testing.T) {
+	audio := &Audio{SampleRate: 8000, Left: []float32{0, 0.5, 2}, Right: []float32{-0.5, -1, -2}}
+	var buf bytes.Buffer
+	if err := audio.WriteWAV(&buf); err != nil {
+		t.Fatalf("WriteWAV: %v", err)
+	}
+	b := buf.Bytes()
+	if got, want := len(b), 44+3*4; got != want {
+		t.Fatalf("len = %v, want %v", got, want)
+	}
+
+	le := binary.LittleEndian
+	if got := string(b[0:4]) + string(b[8:16]) + string(b[36:40]); got != "RIFFWAVEfmt data" {
+		t.Errorf("chunk IDs = %q", got)
+	}
+	header := []uint32{le.Uint32(b[4:]), le.Uint32(b[24:]), le.Uint32(b[28:]), le.Uint32(b[40:])}
+	if want := []uint32{48, 8000, 32000, 12}; !equal(header, want) {
+		t.Errorf("sizes and rates = %v, want %v", header, want)
+	}
+	format := []uint16{le.Uint16(b[20:]), le.Uint16(b[22:]), le.Uint16(b[32:]), le.Uint16(b[34:])}
+	if want := []uint16{1, 2, 4, 16}; !equal(format, want) {
+		t.Errorf("format = %v, want %v", format, want)
+	}
+
+	var samples []int16
+	for i := 44; i < len(b); i += 2 {
+		samples = append(samples, int16(le.Uint16(b[i:])))
+	}
+	if want := []int16{0, -16384, 16384, -32767, 32767, -32768}; !equal(samples, want) {
+		t.Errorf("samples = %v, want %v", samples, want)
+	}
+}
+
+func equal[T comparable](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synth
+
+import (
+	"math"
+)
+
+// The reverb follows the design of Fons Adriaensen's Zita-rev1, on which
+// MuseScore's Zita1 effect is based: eight delay lines with diffusing
+// all-pass filters, mixed by a Hadamard matrix, each with a filter that
+// sets separate decay times for the low and mid bands and damps the high
+// frequencies.
+var (
+	reverbDiffusion = [8]float64{20346e-6, 24421e-6, 31604e-6, 27333e-6, 22904e-6, 29291e-6, 13458e-6, 19123e-6}
+	reverbDelays    = [8]float64{153129e-6, 210389e-6, 127837e-6, 256891e-6, 174713e-6, 192303e-6, 125000e-6, 219991e-6}
+)
+
+type reverb struct {
+	mix        float64
+	predelay   *delayLine
+	diffusers  [8]*allPass
+	delays     [8]*delayLine
+	filters    [8]*decayFilter
+	eqL, eqR   []*biquad
+	tailFrames int
+}
+
+// newReverb returns a reverb with the given parameters at a sample rate.
+func newReverb(p *ReverbParams, sampleRate int) *reverb {
+	rate := float64(sampleRate)
+	r := &reverb{
+		mix:        p.Mix,
+		predelay:   newDelayLine(int(p.Delay*rate) + 1),
+		tailFrames: int((p.Delay + math.Max(p.RTLow, p.RTMid)) * rate),
+	}
+	wlo := 2 * math.Pi * p.Crossover / rate
+	chi := 2.0
+	if p.Damping < 0.49*rate {
+		chi = 1 - math.Cos(2*math.Pi*p.Damping/rate)
+	}
+	for i := range r.delays {
+		r.diffusers[i] = &allPass{delayLine: newDelayLine(int(reverbDiffusion[i] * rate)), gain: 0.6}
+		r.delays[i] = newDelayLine(int((reverbDelays[i] - reverbDiffusion[i]) * rate))
+		r.filters[i] = newDecayFilter(reverbDelays[i], p.RTMid, p.RTLow, wlo, p.RTMid/2, chi)
+	}
+	for _, eq := range [][2]float64{{p.EQ1Freq, p.EQ1Gain}, {p.EQ2Freq, p.EQ2Gain}} {
+		if eq[1] != 0 && eq[0] < 0.45*rate {
+			r.eqL = append(r.eqL, newPeaking(eq[0], eq[1], rate))
+			r.eqR = append(r.eqR, newPeaking(eq[0], eq[1], rate))
+		}
+	}
+	return r
+}
+
+// process mixes the reverberation of in and send into in, which must have
+// room for the reverb's tail. The output is in (dry) and its reverberation
+// mixed with equal power according to the reverb's Mix.
+func (r *reverb) process(in, send *stereo) {
+	dryGain, wetGain := math.Cos(r.mix*math.Pi/2), math.Sin(r.mix*math.Pi/2)
+	var y, h [8]float64
+	for i := range in.left {
+		x := float64(in.left[i] + in.right[i])
+		if i < len(send.left) {
+			x += float64(send.left[i] + send.right[i])
+		}
+		x = r.predelay.process(0.3 * x)
+
+		for j := range y {
+			y[j] = r.filters[j].process(r.delays[j].read())
+		}
+		// A fast Hadamard transform, normalized to keep the energy.
+		h = y
+		for n := 1; n < 8; n *= 2 {
+			for j := 0; j < 8; j += 2 * n {
+				for k := j; k < j+n; k++ {
+					h[k], h[k+n] = h[k]+h[k+n], h[k]-h[k+n]
+				}
+			}
+		}
+		for j := range h {
+			input := x
+			if j%2 == 1 {
+				input = -x
+			}
+			r.delays[j].write(r.diffusers[j].process(h[j]/math.Sqrt(8) + input))
+		}
+
+		wetL := 0.5 * (y[0] + y[2] + y[4] + y[6])
+		wetR := 0.5 * (y[1] + y[3] + y[5] + y[7])
+		for k := range r.eqL {
+			wetL, wetR = r.eqL[k].process(wetL), r.eqR[k].process(wetR)
+		}
+		in.left[i] = float32(dryGain*float64(in.left[i]) + wetGain*wetL)
+		in.right[i] = float32(dryGain*float64(in.right[i]) + wetGain*wetR)
+	}
+}
+
+// delayLine is a circular buffer that delays its input by a fixed number
+// of frames.
+type delayLine struct {
+	buf []float64
+	i   int
+}
+
+func newDelayLine(frames int) *delayLine {
+	if frames < 1 {
+		frames = 1
+	}
+	return &delayLine{buf: make([]float64, frames)}
+}
+
+// read returns the oldest value, which write then replaces.
+func (d *delayLine) read() float64 { return d.buf[d.i] }
+
+func (d *delayLine) write(x float64) {
+	d.buf[d.i] = x
+	d.i = (d.i + 1) % len(d.buf)
+}
+
+func (d *delayLine) process(x float64) float64 {
+	y := d.read()
+	d.write(x)
+	return y
+}
+
+// allPass is a Schroeder all-pass filter that diffuses its input.
+type allPass struct {
+	*delayLine
+	gain float64
+}
+
+func (a *allPass) process(x float64) float64 {
+	v := a.read()
+	w := x - a.gain*v
+	a.write(w)
+	return v + a.gain*w
+}
+
+// decayFilter sets the decay of a delay line in the feedback loop: the
+// low band decays by 60 dB in tlo seconds and the mid band in tmf
+// seconds, while frequencies above the damping frequency decay as if in
+// thi seconds.
+type decayFilter struct {
+	gmf, glo, wlo, whi float64
+	slo, shi           float64
+}
+
+// newDecayFilter returns the filter for a delay of del seconds, a
+// crossover at angular frequency wlo (per sample) and damping given by chi
+// (1 - cos of the damping frequency).
+func newDecayFilter(del, tmf, tlo, wlo, thi, chi float64) *decayFilter {
+	f := &decayFilter{wlo: wlo}
+	f.gmf = math.Pow(0.001, del/tmf)
+	f.glo = math.Pow(0.001, del/tlo)/f.gmf - 1
+	g := math.Pow(0.001, del/thi) / f.gmf
+	t := (1 - g*g) / (2 * g * g * chi)
+	f.whi = (math.Sqrt(1+4*t) - 1) / (2 * t)
+	return f
+}
+
+func (f *decayFilter) process(x float64) float64 {
+	f.slo += f.wlo * (x - f.slo)
+	x += f.glo * f.slo
+	f.shi += f.whi * (x - f.shi)
+	return f.gmf * f.shi
+}
@@ -0,0 +1,389 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SoundFont generators used by the sampler, numbered as in the SoundFont
+// 2.01 specification.
+const (
+	genStartAddrsOffset       = 0
+	genEndAddrsOffset         = 1
+	genStartloopAddrsOffset   = 2
+	genEndloopAddrsOffset     = 3
+	genStartAddrsCoarseOffset = 4
+	genEndAddrsCoarseOffset   = 12
+	genInitialFilterFc        = 8
+	genInitialFilterQ         = 9
+	genReverbEffectsSend      = 16
+	genPan                    = 17
+	genDelayVolEnv            = 33
+	genAttackVolEnv           = 34
+	genHoldVolEnv             = 35
+	genDecayVolEnv            = 36
+	genSustainVolEnv          = 37
+	genReleaseVolEnv          = 38
+	genInstrument             = 41
+	genKeyRange               = 43
+	genVelRange               = 44
+	genStartloopCoarseOffset  = 45
+	genInitialAttenuation     = 48
+	genEndloopCoarseOffset    = 50
+	genCoarseTune             = 51
+	genFineTune               = 52
+	genSampleID               = 53
+	genSampleModes            = 54
+	genScaleTuning            = 56
+	genOverridingRootKey      = 58
+	numGenerators             = 61
+)
+
+// generators holds the values of the generators of a zone.
+type generators [numGenerators]int
+
+// defaultGenerators returns the default generator values of an instrument
+// zone. Ranges are stored with the low value in the low byte.
+func defaultGenerators() generators {
+	var g generators
+	g[genInitialFilterFc] = 13500
+	for _, gen := range []int{genDelayVolEnv, genAttackVolEnv, genHoldVolEnv, genDecayVolEnv, genReleaseVolEnv} {
+		g[gen] = -12000
+	}
+	g[genKeyRange] = 127 << 8
+	g[genVelRange] = 127 << 8
+	g[genScaleTuning] = 100
+	g[genOverridingRootKey] = -1
+	return g
+}
+
+// SoundFont is a parsed SoundFont 2 (SF2) file.
+type SoundFont struct {
+	// Name is the name of the SoundFont from its INFO chunk.
+	Name string
+
+	samples []float32
+	presets map[int]*preset // keyed by bank<<8 | program
+}
+
+type preset struct {
+	name    string
+	regions []*region
+}
+
+// region is a combination of a preset zone and an instrument zone that
+// plays a sample over a range of keys and velocities.
+type region struct {
+	keyLo, keyHi int
+	velLo, velHi int
+	sample       *sampleHeader
+	gen          generators
+}
+
+type sampleHeader struct {
+	name               string
+	start, end         int
+	startLoop, endLoop int
+	sampleRate         int
+	originalPitch      int
+	pitchCorrection    int
+	sampleType         int
+}
+
+// LoadSoundFont reads and parses the SF2 file with the given name.
+func LoadSoundFont(filename string) (*SoundFont, error) {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("LoadSoundFont: %w", err)
+	}
+	sf, err := ParseSoundFont(buf)
+	if err != nil {
+		return nil, fmt.Errorf("LoadSoundFont(%q): %w", filename, err)
+	}
+	return sf, nil
+}
+
+// ParseSoundFont parses an SF2 file. SF3 files, whose samples are
+// compressed, are not supported.
+func ParseSoundFont(buf []byte) (*SoundFont, error) {
+	if len(buf) < 12 || string(buf[0:4]) != "RIFF" || string(buf[8:12]) != "sfbk" {
+		return nil, fmt.Errorf("ParseSoundFont: not a SoundFont file")
+	}
+	chunks := map[string][]byte{}
+	if err := readChunks(buf[12:], chunks); err != nil {
+		return nil, fmt.Errorf("ParseSoundFont: %w", err)
+	}
+	for _, id := range []string{"smpl", "phdr", "pbag", "pgen", "inst", "ibag", "igen", "shdr"} {
+		if _, ok := chunks[id]; !ok {
+			return nil, fmt.Errorf("ParseSoundFont: missing %q chunk", id)
+		}
+	}
+
+	sf := &SoundFont{Name: cString(chunks["INAM"]), presets: map[int]*preset{}}
+	smpl := chunks["smpl"]
+	sf.samples = make([]float32, len(smpl)/2)
+	for i := range sf.samples {
+		sf.samples[i] = float32(int16(binary.LittleEndian.Uint16(smpl[2*i:]))) / 32768
+	}
+
+	samples, err := parseSampleHeaders(chunks["shdr"], len(sf.samples))
+	if err != nil {
+		return nil, fmt.Errorf("ParseSoundFont: %w", err)
+	}
+	instruments, err := parseZones(chunks["inst"], chunks["ibag"], chunks["igen"], genSampleID)
+	if err != nil {
+		return nil, fmt.Errorf("ParseSoundFont: instruments: %w", err)
+	}
+	presets, err := parseZones(chunks["phdr"], chunks["pbag"], chunks["pgen"], genInstrument)
+	if err != nil {
+		return nil, fmt.Errorf("ParseSoundFont: presets: %w", err)
+	}
+
+	phdr := chunks["phdr"]
+	for pi, pzones := range presets {
+		rec := phdr[38*pi:]
+		p := &preset{name: cString(rec[:20])}
+		program, bank := int(binary.LittleEndian.Uint16(rec[20:])), int(binary.LittleEndian.Uint16(rec[22:]))
+		for _, pz := range pzones {
+			ii := pz.gen[genInstrument]
+			if ii < 0 || ii >= len(instruments) {
+				return nil, fmt.Errorf("ParseSoundFont: preset %q: no instrument %v", p.name, ii)
+			}
+			for _, iz := range instruments[ii] {
+				si := iz.gen[genSampleID]
+				if si < 0 || si >= len(samples) {
+					return nil, fmt.Errorf("ParseSoundFont: preset %q: no sample %v", p.name, si)
+				}
+				if samples[si].sampleType&0x10 != 0 {
+					return nil, fmt.Errorf("ParseSoundFont: compressed (SF3) samples are not supported")
+				}
+				if r := newRegion(pz, iz, samples[si]); r != nil {
+					p.regions = append(p.regions, r)
+				}
+			}
+		}
+		if _, ok := sf.presets[bank<<8|program]; !ok {
+			sf.presets[bank<<8|program] = p
+		}
+	}
+	return sf, nil
+}
+
+// readChunks records the data of every chunk in buf by its ID, descending
+// into LIST chunks.
+func readChunks(buf []byte, chunks map[string][]byte) error {
+	for len(buf) >= 8 {
+		id := string(buf[0:4])
+		size := int(binary.LittleEndian.Uint32(buf[4:8]))
+		if size > len(buf)-8 {
+			return fmt.Errorf("chunk %q is truncated", id)
+		}
+		data := buf[8 : 8+size]
+		if id == "LIST" {
+			if len(data) < 4 {
+				return fmt.Errorf("LIST chunk is truncated")
+			}
+			if err := readChunks(data[4:], chunks); err != nil {
+				return err
+			}
+		} else {
+			chunks[id] = data
+		}
+		buf = buf[8+size+size%2:]
+	}
+	return nil
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func parseSampleHeaders(shdr []byte, numSamples int) ([]*sampleHeader, error) {
+	const size = 46
+	if len(shdr)%size != 0 {
+		return nil, fmt.Errorf("shdr chunk has a bad size")
+	}
+	var result []*sampleHeader
+	for i := 0; i+size <= len(shdr)-size; i += size { // the last is the terminal record
+		rec := shdr[i : i+size]
+		s := &sampleHeader{
+			name:            cString(rec[:20]),
+			start:           int(binary.LittleEndian.Uint32(rec[20:])),
+			end:             int(binary.LittleEndian.Uint32(rec[24:])),
+			startLoop:       int(binary.LittleEndian.Uint32(rec[28:])),
+			endLoop:         int(binary.LittleEndian.Uint32(rec[32:])),
+			sampleRate:      int(binary.LittleEndian.Uint32(rec[36:])),
+			originalPitch:   int(rec[40]),
+			pitchCorrection: int(int8(rec[41])),
+			sampleType:      int(binary.LittleEndian.Uint16(rec[44:])),
+		}
+		if s.sampleType&0x10 == 0 && (s.end > numSamples || s.start > s.end) {
+			return nil, fmt.Errorf("sample %q is out of range", s.name)
+		}
+		if s.sampleRate <= 0 {
+			s.sampleRate = 44100
+		}
+		if s.originalPitch > 127 {
+			s.originalPitch = 60
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// zone is a preset or instrument zone. set records which generators the
+// zone sets.
+type zone struct {
+	gen generators
+	set [numGenerators]bool
+}
+
+// parseZones returns the zones of each preset or instrument, with the
+// values of its global zone (if any) applied to each of its other zones.
+// Zones without the terminal generator (an instrument or a sample) are
+// dropped.
+func parseZones(headers, bags, gens []byte, terminal int) ([][]*zone, error) {
+	// The size of a header record and the offset of its bag index.
+	hsize, bagOffset := 38, 24 // phdr
+	if terminal == genSampleID {
+		hsize, bagOffset = 22, 20 // inst
+	}
+	if len(headers)%hsize != 0 || len(bags)%4 != 0 || len(gens)%4 != 0 {
+		return nil, fmt.Errorf("bad chunk size")
+	}
+	numHeaders, numBags, numGens := len(headers)/hsize, len(bags)/4, len(gens)/4
+	bagIndex := func(h int) int { return int(binary.LittleEndian.Uint16(headers[h*hsize+bagOffset:])) }
+	genIndex := func(b int) int { return int(binary.LittleEndian.Uint16(bags[b*4:])) }
+
+	var result [][]*zone
+	for h := 0; h < numHeaders-1; h++ {
+		bagStart, bagEnd := bagIndex(h), bagIndex(h+1)
+		if bagStart > bagEnd || bagEnd > numBags-1 {
+			return nil, fmt.Errorf("bad bag index")
+		}
+		var global *zone
+		var zones []*zone
+		for b := bagStart; b < bagEnd; b++ {
+			genStart, genEnd := genIndex(b), genIndex(b+1)
+			if genStart > genEnd || genEnd > numGens {
+				return nil, fmt.Errorf("bad generator index")
+			}
+			z := &zone{}
+			if global != nil {
+				*z = *global
+			}
+			for g := genStart; g < genEnd; g++ {
+				oper := int(binary.LittleEndian.Uint16(gens[g*4:]))
+				if oper >= numGenerators {
+					continue
+				}
+				amount := int(int16(binary.LittleEndian.Uint16(gens[g*4+2:])))
+				switch oper {
+				case genKeyRange, genVelRange, genInstrument, genSampleID, genSampleModes:
+					amount = int(binary.LittleEndian.Uint16(gens[g*4+2:]))
+				}
+				z.gen[oper], z.set[oper] = amount, true
+			}
+			if !z.set[terminal] {
+				if b == bagStart && global == nil {
+					global = z
+				}
+				continue
+			}
+			zones = append(zones, z)
+		}
+		result = append(result, zones)
+	}
+	return result, nil
+}
+
+// newRegion combines a preset zone and an instrument zone, or returns nil
+// if their key or velocity ranges do not overlap. Instrument generators
+// are absolute; preset generators are added to them.
+func newRegion(pz, iz *zone, s *sampleHeader) *region {
+	gen := defaultGenerators()
+	for i := range gen {
+		if iz.set[i] {
+			gen[i] = iz.gen[i]
+		}
+	}
+	for i := range gen {
+		switch i {
+		case genKeyRange, genVelRange, genInstrument, genSampleID, genSampleModes, genOverridingRootKey,
+			genStartAddrsOffset, genEndAddrsOffset, genStartloopAddrsOffset, genEndloopAddrsOffset,
+			genStartAddrsCoarseOffset, genEndAddrsCoarseOffset, genStartloopCoarseOffset, genEndloopCoarseOffset:
+			continue
+		}
+		if pz.set[i] {
+			gen[i] += pz.gen[i]
+		}
+	}
+
+	r := &region{sample: s, gen: gen}
+	r.keyLo, r.keyHi = intersect(gen[genKeyRange], pz, genKeyRange)
+	r.velLo, r.velHi = intersect(gen[genVelRange], pz, genVelRange)
+	if r.keyLo > r.keyHi || r.velLo > r.velHi {
+		return nil
+	}
+	return r
+}
+
+// intersect returns the intersection of an instrument zone range with the
+// same range of a preset zone.
+func intersect(rng int, pz *zone, gen int) (lo, hi int) {
+	lo, hi = rng&0xff, rng>>8
+	if pz.set[gen] {
+		if plo := pz.gen[gen] & 0xff; plo > lo {
+			lo = plo
+		}
+		if phi := pz.gen[gen] >> 8; phi < hi {
+			hi = phi
+		}
+	}
+	return lo, hi
+}
+
+// lookup returns the preset with the given bank and program, falling back
+// to the same program in bank 0 (or, for percussion, the first drum kit)
+// and then to the first program of the bank.
+func (sf *SoundFont) lookup(bank, program int) *preset {
+	candidates := []int{bank<<8 | program, program, bank << 8, 0}
+	if bank == percussionBank {
+		candidates = []int{bank<<8 | program, bank << 8}
+	}
+	for _, key := range candidates {
+		if p, ok := sf.presets[key]; ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// HasPreset reports whether the SoundFont has a preset for the given bank
+// and program.
+func (sf *SoundFont) HasPreset(bank, program int) bool {
+	_, ok := sf.presets[bank<<8|program]
+	return ok
+}
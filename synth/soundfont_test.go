@@ -0,0 +1,242 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synth
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testPreset describes a preset of a test SoundFont. Each preset has its
+// own instrument whose single zone plays a looped sine wave over the given
+// key range. The instrument's global zone sets a release time of 0.25s.
+type testPreset struct {
+	name           string
+	bank, program  int
+	keyLo, keyHi   int
+	presetVelRange [2]int // ignored if zero
+}
+
+// sinePeriod is the period in samples of the test sample, whose root key
+// is A4: 441 Hz at 44.1 kHz.
+const sinePeriod = 100
+
+// buildSoundFont returns an SF2 file with the given presets.
+func buildSoundFont(presets ...testPreset) []byte {
+	le := binary.LittleEndian
+	chunk := func(id string, data []byte) []byte {
+		b := append([]byte(id), 0, 0, 0, 0)
+		le.PutUint32(b[4:], uint32(len(data)))
+		b = append(b, data...)
+		if len(data)%2 == 1 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	list := func(typ string, chunks ...[]byte) []byte {
+		data := []byte(typ)
+		for _, c := range chunks {
+			data = append(data, c...)
+		}
+		return chunk("LIST", data)
+	}
+	name := func(s string) []byte {
+		b := make([]byte, 20)
+		copy(b, s)
+		return b
+	}
+	u16 := func(vs ...int) []byte {
+		var b []byte
+		for _, v := range vs {
+			b = append(b, byte(v), byte(v>>8))
+		}
+		return b
+	}
+	u32 := func(vs ...int) []byte {
+		var b []byte
+		for _, v := range vs {
+			b = append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+		}
+		return b
+	}
+	cat := func(bs ...[]byte) []byte {
+		var b []byte
+		for _, x := range bs {
+			b = append(b, x...)
+		}
+		return b
+	}
+
+	var smpl []byte
+	for i := 0; i < sinePeriod; i++ {
+		smpl = append(smpl, u16(int(16000*math.Sin(2*math.Pi*float64(i)/sinePeriod)))...)
+	}
+	smpl = append(smpl, make([]byte, 2*46)...) // the required zero padding
+
+	shdr := cat(name("sine"), u32(0, sinePeriod, 0, sinePeriod, 44100), []byte{69, 0}, u16(0, 1),
+		name("EOS"), make([]byte, 26))
+
+	var phdr, pbag, pgen, inst, ibag, igen []byte
+	var pgens, igens int
+	for i, p := range presets {
+		phdr = cat(phdr, name(p.name), u16(p.program, p.bank, len(pbag)/4), u32(0, 0, 0))
+		pbag = cat(pbag, u16(pgens, 0))
+		if p.presetVelRange != [2]int{} {
+			pgen = cat(pgen, u16(genVelRange, p.presetVelRange[0]|p.presetVelRange[1]<<8))
+			pgens++
+		}
+		pgen = cat(pgen, u16(genInstrument, i))
+		pgens++
+
+		inst = cat(inst, name(p.name), u16(len(ibag)/4))
+		ibag = cat(ibag, u16(igens, 0), u16(igens+1, 0))
+		igen = cat(igen,
+			u16(genReleaseVolEnv, -2400), // global zone
+			u16(genKeyRange, p.keyLo|p.keyHi<<8), u16(genSampleModes, 1), u16(genSampleID, 0))
+		igens += 4
+	}
+	phdr = cat(phdr, name("EOP"), u16(0, 0, len(pbag)/4), u32(0, 0, 0))
+	pbag = cat(pbag, u16(pgens, 0))
+	pgen = cat(pgen, u16(0, 0))
+	inst = cat(inst, name("EOI"), u16(len(ibag)/4))
+	ibag = cat(ibag, u16(igens, 0))
+	igen = cat(igen, u16(0, 0))
+
+	body := cat([]byte("sfbk"),
+		list("INFO", chunk("ifil", u16(2, 1)), chunk("INAM", []byte("Test Font\x00"))),
+		list("sdta", chunk("smpl", smpl)),
+		list("pdta", chunk("phdr", phdr), chunk("pbag", pbag), chunk("pmod", make([]byte, 10)), chunk("pgen", pgen),
+			chunk("inst", inst), chunk("ibag", ibag), chunk("imod", make([]byte, 10)), chunk("igen", igen),
+			chunk("shdr", shdr)))
+	return chunk("RIFF", body)
+}
+
+// testSoundFont returns a parsed SoundFont with a piano (bank 0, program
+// 0), a strings preset (program 48) limited to keys 55-96, and a drum kit
+// (bank 128).
+func testSoundFont(t *testing.T) *SoundFont {
+	t.Helper()
+	sf, err := ParseSoundFont(buildSoundFont(
+		testPreset{name: "Piano", keyHi: 127},
+		testPreset{name: "Strings", program: 48, keyLo: 55, keyHi: 96},
+		testPreset{name: "Drums", bank: percussionBank, keyLo: 35, keyHi: 81},
+	))
+	if err != nil {
+		t.Fatalf("ParseSoundFont: %v", err)
+	}
+	return sf
+}
+
+func TestParseSoundFont(t *testing.T) {
+	sf := testSoundFont(t)
+	if got, want := sf.Name, "Test Font"; got != want {
+		t.Errorf("Name = %q, want %q", got, want)
+	}
+	if got, want := len(sf.samples), sinePeriod+46; got != want {
+		t.Errorf("len(samples) = %v, want %v", got, want)
+	}
+
+	type regionInfo struct {
+		Preset                     string
+		KeyLo, KeyHi, VelLo, VelHi int
+		Release, Modes, Root       int
+	}
+	var got []regionInfo
+	for _, key := range []int{0, 48, percussionBank << 8} {
+		p := sf.presets[key]
+		for _, r := range p.regions {
+			got = append(got, regionInfo{p.name, r.keyLo, r.keyHi, r.velLo, r.velHi,
+				r.gen[genReleaseVolEnv], r.gen[genSampleModes], r.sample.originalPitch})
+		}
+	}
+	want := []regionInfo{
+		{"Piano", 0, 127, 0, 127, -2400, 1, 69},
+		{"Strings", 55, 96, 0, 127, -2400, 1, 69},
+		{"Drums", 35, 81, 0, 127, -2400, 1, 69},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("regions mismatch (-want +got):\n%v", diff)
+	}
+}
+
+func TestParseSoundFont_PresetRanges(t *testing.T) {
+	sf, err := ParseSoundFont(buildSoundFont(
+		testPreset{name: "Soft", keyLo: 40, keyHi: 80, presetVelRange: [2]int{0, 63}},
+	))
+	if err != nil {
+		t.Fatalf("ParseSoundFont: %v", err)
+	}
+	r := sf.presets[0].regions[0]
+	if got, want := [4]int{r.keyLo, r.keyHi, r.velLo, r.velHi}, [4]int{40, 80, 0, 63}; got != want {
+		t.Errorf("ranges = %v, want %v", got, want)
+	}
+}
+
+func TestParseSoundFont_Errors(t *testing.T) {
+	valid := buildSoundFont(testPreset{name: "Piano", keyHi: 127})
+	tests := []struct {
+		name string
+		buf  []byte
+		want string
+	}{
+		{name: "empty", want: "not a SoundFont file"},
+		{name: "wave file", buf: append([]byte("RIFF\x04\x00\x00\x00WAVE"), valid[12:]...), want: "not a SoundFont file"},
+		{name: "truncated", buf: valid[:len(valid)-10], want: "truncated"},
+		{name: "missing chunk", buf: []byte("RIFF\x04\x00\x00\x00sfbk"), want: `missing "smpl" chunk`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSoundFont(tt.buf)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseSoundFont = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	sf := testSoundFont(t)
+	tests := []struct {
+		bank, program int
+		want          string
+	}{
+		{bank: 0, program: 0, want: "Piano"},
+		{bank: 0, program: 48, want: "Strings"},
+		{bank: 0, program: 73, want: "Piano"},
+		{bank: 8, program: 48, want: "Strings"},
+		{bank: percussionBank, program: 0, want: "Drums"},
+		{bank: percussionBank, program: 25, want: "Drums"},
+	}
+
+	for _, tt := range tests {
+		p := sf.lookup(tt.bank, tt.program)
+		if p == nil || p.name != tt.want {
+			t.Errorf("lookup(%v, %v) = %+v, want %q", tt.bank, tt.program, p, tt.want)
+		}
+	}
+
+	if !sf.HasPreset(0, 48) || sf.HasPreset(0, 73) {
+		t.Errorf("HasPreset(0, 48), HasPreset(0, 73) = %v, %v, want true, false", sf.HasPreset(0, 48), sf.HasPreset(0, 73))
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package synth renders MuseScore scores to audio with a SoundFont (SF2)
+// sampler written in pure Go, so that recordings can be made without
+// MuseScore or an audio device.
+//
+// A score is first converted to Tracks, one per voice of each staff, which
+// may be adjusted (e.g. to emphasize one voice) before they are rendered:
+//
+//	sf, err := synth.LoadSoundFont("FluidR3_GM.sf2")
+//	...
+//	tracks, err := synth.Tracks(score)
+//	...
+//	audio, err := synth.Render(sf, tracks, synth.NewSettings(score.Synthesizer), 44100)
+//	...
+//	err = audio.WriteWAV(w)
+//
+// Rehearsal returns tracks for a practice recording that emphasizes one
+// Line, such as a part or the alto of a hymn, optionally with clicks.
+package synth
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+// DefaultGain is MuseScore's default master gain. Scores rendered with it
+// are not attenuated.
+const DefaultGain = 0.1
+
+// Settings are the master synthesizer settings of a score.
+type Settings struct {
+	// Gain is the master gain. A score with DefaultGain is rendered at
+	// unity gain.
+	Gain float64
+	// Tuning is the frequency of A4 in Hz.
+	Tuning float64
+	// Reverb is the master reverb, or nil for none.
+	Reverb *ReverbParams
+}
+
+// ReverbParams are the parameters of MuseScore's Zita1 reverb.
+type ReverbParams struct {
+	// Delay is the delay before the reverberation starts, in seconds.
+	Delay float64
+	// Crossover is the frequency in Hz between the low and mid bands.
+	Crossover float64
+	// RTLow and RTMid are the times in seconds for the reverberation of
+	// the low and mid bands to decay by 60 dB.
+	RTLow, RTMid float64
+	// Damping is the frequency in Hz above which the reverberation of the
+	// mid band decays twice as fast.
+	Damping float64
+	// EQ1Freq and EQ1Gain (in dB) set the first equalizer band of the
+	// reverberation, and EQ2Freq and EQ2Gain the second.
+	EQ1Freq, EQ1Gain float64
+	EQ2Freq, EQ2Gain float64
+	// Mix is the proportion of reverberation in the output, from 0 (dry)
+	// to 1 (wet).
+	Mix float64
+}
+
+// DefaultReverbParams returns the parameters of the Zita1 reverb as
+// MuseScore initializes them.
+func DefaultReverbParams() *ReverbParams {
+	return &ReverbParams{
+		Delay:     0.04,
+		Crossover: 200,
+		RTLow:     3,
+		RTMid:     2,
+		Damping:   6000,
+		EQ1Freq:   160,
+		EQ2Freq:   2500,
+		Mix:       0.5,
+	}
+}
+
+// zitaLimits are the ranges of the Zita1 parameters, in the order of
+// their IDs.
+var zitaLimits = [][2]float64{
+	{0.02, 0.1}, {50, 1000}, {1, 8}, {1, 8}, {1500, 24000},
+	{40, 2500}, {-15, 15}, {160, 10000}, {-15, 15}, {0, 1},
+}
+
+// NewSettings returns the settings stored in a score's Synthesizer, which
+// may be nil for MuseScore's defaults: DefaultGain, A4 = 440 Hz, and the
+// Zita1 reverb as the first master effect. Values that cannot be parsed
+// are ignored.
+func NewSettings(synth *mscx.Synthesizer) *Settings {
+	s := &Settings{Gain: DefaultGain, Tuning: 440, Reverb: DefaultReverbParams()}
+	if synth == nil {
+		return s
+	}
+
+	if synth.Master != nil {
+		for _, v := range synth.Master.Val {
+			f, err := strconv.ParseFloat(v.Text, 64)
+			switch v.ID {
+			case 0: // effect A
+				if v.Text != "Zita1" {
+					s.Reverb = nil
+				}
+			case 2:
+				if err == nil && f >= 0 {
+					s.Gain = f
+				}
+			case 3:
+				if err == nil && f > 0 {
+					s.Tuning = f
+				}
+			}
+		}
+	}
+
+	if synth.Zita1 != nil && s.Reverb != nil {
+		params := []*float64{
+			&s.Reverb.Delay, &s.Reverb.Crossover, &s.Reverb.RTLow, &s.Reverb.RTMid, &s.Reverb.Damping,
+			&s.Reverb.EQ1Freq, &s.Reverb.EQ1Gain, &s.Reverb.EQ2Freq, &s.Reverb.EQ2Gain, &s.Reverb.Mix,
+		}
+		for _, v := range synth.Zita1.Val {
+			f, err := strconv.ParseFloat(v.Text, 64)
+			if err != nil || v.ID < 0 || v.ID >= len(params) {
+				continue
+			}
+			limits := zitaLimits[v.ID]
+			*params[v.ID] = math.Max(limits[0], math.Min(limits[1], f))
+		}
+	}
+	return s
+}
@@ -0,0 +1,76 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synth
+
+import (
+	"testing"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewSettings(t *testing.T) {
+	vals := func(texts ...string) *mscx.SynthVals {
+		sv := &mscx.SynthVals{}
+		for i, text := range texts {
+			if text != "" {
+				sv.Val = append(sv.Val, &mscx.Val{ID: i, Text: text})
+			}
+		}
+		return sv
+	}
+
+	tests := []struct {
+		name  string
+		synth *mscx.Synthesizer
+		want  *Settings
+	}{
+		{
+			name: "nil",
+			want: &Settings{Gain: DefaultGain, Tuning: 440, Reverb: DefaultReverbParams()},
+		},
+		{
+			name:  "master",
+			synth: &mscx.Synthesizer{Master: vals("Zita1", "NoEffect", "0.2", "442")},
+			want:  &Settings{Gain: 0.2, Tuning: 442, Reverb: DefaultReverbParams()},
+		},
+		{
+			name:  "no reverb",
+			synth: &mscx.Synthesizer{Master: vals("NoEffect", "Zita1", "bad", "-1")},
+			want:  &Settings{Gain: DefaultGain, Tuning: 440},
+		},
+		{
+			name:  "zita1",
+			synth: &mscx.Synthesizer{Zita1: vals("0.06", "300", "bad", "", "100000", "100", "-3", "3000", "20", "0.25")},
+			want: &Settings{Gain: DefaultGain, Tuning: 440, Reverb: &ReverbParams{
+				Delay: 0.06, Crossover: 300, RTLow: 3, RTMid: 2, Damping: 24000,
+				EQ1Freq: 100, EQ1Gain: -3, EQ2Freq: 3000, EQ2Gain: 15, Mix: 0.25,
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewSettings(tt.synth)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("NewSettings mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synth
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gmlewis/go-musescore/mscx"
+)
+
+const (
+	// percussionBank is the SoundFont bank of drum kits.
+	percussionBank = 128
+	// defaultVelocity is the velocity of notes before any dynamic (mf).
+	defaultVelocity = 80
+)
+
+// Track is the notes of one voice of one staff, played on the first
+// channel of the staff's part.
+type Track struct {
+	Part    *mscx.Part
+	StaffID string
+	// Voice is the 1-based voice within the staff.
+	Voice int
+
+	Bank, Program int
+	// Volume and Reverb range from 0 to 1 and Pan from -1 (left) to 1
+	// (right), like the channel's volume, reverb and pan controllers. The
+	// reverb sends extra signal from the track to the master reverb.
+	Volume, Pan, Reverb float64
+	Mute                bool
+
+	Notes []*Note
+}
+
+// String describes the track by its staff and voice, or as a click track
+// if it belongs to no staff.
+func (t *Track) String() string {
+	if t.StaffID == "" {
+		return "click track"
+	}
+	return fmt.Sprintf("staff %v voice %v", t.StaffID, t.Voice)
+}
+
+// Note is a note to be played.
+type Note struct {
+	// Start and Duration are in seconds.
+	Start, Duration float64
+	// Pitch is the MIDI pitch.
+	Pitch    int
+	Velocity int
+}
+
+// End returns the time in seconds at which the note is released.
+func (n *Note) End() float64 { return n.Start + n.Duration }
+
+// dynamicVelocities are MuseScore's velocities for its dynamics.
+var dynamicVelocities = map[string]int{
+	"pppppp": 1, "ppppp": 5, "pppp": 10, "ppp": 16, "pp": 33, "p": 49, "mp": 64,
+	"mf": 80, "f": 96, "ff": 112, "fff": 126, "ffff": 127, "fffff": 127, "ffffff": 127,
+	"fp": 96, "pf": 49, "sf": 112, "sfz": 112, "sff": 126, "sffz": 126,
+	"sfp": 112, "sfpp": 112, "rfz": 112, "rf": 112, "fz": 112,
+}
+
+// velocity returns the velocity of notes after a dynamic, or zero for a
+// dynamic (e.g. "m") that does not change it.
+func velocity(d *mscx.Dynamic) int {
+	if d.Velocity > 0 {
+		return d.Velocity
+	}
+	return dynamicVelocities[d.Subtype]
+}
+
+// Tracks returns the tracks of a score, in order of staff and voice, with
+// the tempo map (see mscx.Score.TempoMap), dynamics and ties of the score
+// applied. Dynamics apply to every staff of their part, and each note is
+// shortened by the gate time of the instrument's default articulation.
+// Repeats are not expanded.
+func Tracks(score *mscx.Score) ([]*Track, error) {
+	tempo, err := score.TempoMap()
+	if err != nil {
+		return nil, fmt.Errorf("Tracks: %w", err)
+	}
+	dynamics := map[*mscx.Part]map[int]int{}
+	err = score.Walk(func(ev *mscx.Event) error {
+		if d, ok := ev.Element.(*mscx.Dynamic); ok {
+			if v := velocity(d); v > 0 {
+				part := score.PartForStaff(ev.StaffID)
+				if dynamics[part] == nil {
+					dynamics[part] = map[int]int{}
+				}
+				dynamics[part][ev.Tick] = v
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Tracks: %w", err)
+	}
+
+	var result []*Track
+	for _, staff := range score.Staffs {
+		part := score.PartForStaff(staff.ID)
+		velocityAt := velocityFunc(dynamics[part])
+		gate := gateTime(part)
+		tracks := map[int]*Track{}
+		// tied holds the note of each track and pitch tied to a following
+		// note, with the duration of its last tied piece.
+		type tiedNote struct {
+			note *Note
+			last float64
+		}
+		tied := map[[2]int]*tiedNote{}
+
+		err := score.WalkStaff(staff, func(ev *mscx.Event) error {
+			chord, ok := ev.Element.(*mscx.Chord)
+			if !ok {
+				return nil
+			}
+			t := tracks[ev.Voice]
+			if t == nil {
+				t = newTrack(part, staff.ID, ev.Voice)
+				tracks[ev.Voice] = t
+			}
+			start, end := tempo.Seconds(ev.Tick), tempo.Seconds(ev.Tick+ev.Ticks)
+			for _, n := range chord.Note {
+				key := [2]int{ev.Voice, n.Pitch}
+				var prev, next bool
+				for _, sp := range n.Spanner {
+					if sp.Type == "Tie" {
+						prev = prev || sp.Prev != nil
+						next = next || sp.Next != nil
+					}
+				}
+
+				tn := tied[key]
+				delete(tied, key)
+				if prev && tn != nil {
+					tn.note.Duration = end - tn.note.Start
+					tn.last = end - start
+				} else {
+					tn = &tiedNote{note: &Note{Start: start, Duration: end - start, Pitch: n.Pitch, Velocity: velocityAt(ev.Tick)}, last: end - start}
+					t.Notes = append(t.Notes, tn.note)
+				}
+				if next {
+					tied[key] = tn
+				} else {
+					tn.note.Duration -= (1 - gate) * tn.last
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Tracks: %w", err)
+		}
+		for _, tn := range tied {
+			tn.note.Duration -= (1 - gate) * tn.last
+		}
+
+		voices := make([]int, 0, len(tracks))
+		for v := range tracks {
+			voices = append(voices, v)
+		}
+		sort.Ints(voices)
+		for _, v := range voices {
+			result = append(result, tracks[v])
+		}
+	}
+	return result, nil
+}
+
+// newTrack returns a track with the channel settings of the part.
+func newTrack(part *mscx.Part, staffID string, voice int) *Track {
+	t := &Track{Part: part, StaffID: staffID, Voice: voice, Volume: 100.0 / 127}
+	if part == nil || part.Instrument == nil {
+		return t
+	}
+	inst := part.Instrument
+	var bankMSB, bankLSB int
+	if len(inst.Channel) > 0 {
+		ch := inst.Channel[0]
+		t.Mute = ch.Mute != 0
+		for _, el := range ch.ChannelElements {
+			switch e := el.(type) {
+			case mscx.Program:
+				if p, err := strconv.Atoi(e.Value); err == nil {
+					t.Program = p
+				}
+			case *mscx.Controller:
+				switch e.Ctrl {
+				case 0:
+					bankMSB = e.Value
+				case 32:
+					bankLSB = e.Value
+				case 7:
+					t.Volume = float64(e.Value) / 127
+				case 10:
+					t.Pan = float64(e.Value-64) / 64
+				case 91:
+					t.Reverb = float64(e.Value) / 127
+				}
+			}
+		}
+	}
+	t.Bank = bankMSB*128 + bankLSB
+	if inst.UseDrumset != 0 {
+		t.Bank = percussionBank
+	}
+	return t
+}
+
+// velocityFunc returns a function that gives the velocity at a tick after
+// the given dynamics.
+func velocityFunc(dynamics map[int]int) func(tick int) int {
+	ticks := make([]int, 0, len(dynamics))
+	for tick := range dynamics {
+		ticks = append(ticks, tick)
+	}
+	sort.Ints(ticks)
+	return func(tick int) int {
+		i := sort.SearchInts(ticks, tick+1) - 1
+		if i < 0 {
+			return defaultVelocity
+		}
+		return dynamics[ticks[i]]
+	}
+}
+
+// gateTime returns the proportion of its written duration for which a
+// note of the part sounds.
+func gateTime(part *mscx.Part) float64 {
+	if part != nil && part.Instrument != nil {
+		for _, a := range part.Instrument.Articulation {
+			if a.Name != "" {
+				continue
+			}
+			if g, err := strconv.ParseFloat(a.GateTime, 64); err == nil && g > 0 && g <= 100 {
+				return g / 100
+			}
+		}
+	}
+	return 1
+}
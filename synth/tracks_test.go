@@ -0,0 +1,195 @@
+// -*- compile-command: "go test -v ./..."; -*-
+
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synth
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gmlewis/go-musescore/mscx"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// testScore returns a two-measure piano score at ♩ = 60 that changes to
+// ♩ = 120 in measure 2. Staff 1 plays C5 and D5 quarter notes and an E5
+// half note tied to a quarter note, with a G4 whole note in voice 2, and
+// staff 2 plays C3 and G2 whole notes. The dynamic p sounds from D5.
+func testScore(t *testing.T) *mscx.Score {
+	t.Helper()
+	sz, err := mscx.NewScore().
+		AddPart("Piano").
+		AddMeasure("4/4").Note("C5", "quarter").Note("D5", "quarter").Note("E5", "half").
+		AddMeasure("").Note("E5", "quarter").
+		AddStaff("F").
+		AddMeasure("4/4").Note("C3", "whole").
+		AddMeasure("").Note("G2", "whole").
+		Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	score := &sz.MuseScore.Score
+
+	m1, m2 := score.Staffs[0].Measure[0], score.Staffs[0].Measure[1]
+	v1 := m1.Voice[0]
+	v1.TimedElements = append([]any{&mscx.Tempo{Tempo: 1}}, v1.TimedElements...)
+	v1.TimedElements = append(v1.TimedElements[:2], append([]any{&mscx.Dynamic{Subtype: "p"}}, v1.TimedElements[2:]...)...)
+	m1.Voice = append(m1.Voice, &mscx.Voice{TimedElements: []any{
+		&mscx.Chord{DurationType: "whole", Note: []*mscx.Note{{Pitch: 67}}},
+	}})
+	m2.Voice[0].TimedElements = append([]any{&mscx.Tempo{Tempo: 2}}, m2.Voice[0].TimedElements...)
+
+	tiedFrom := v1.TimedElements[4].(*mscx.Chord).Note[0]
+	tiedFrom.Spanner = []*mscx.Spanner{{Type: "Tie", Tie: &mscx.Tie{},
+		Next: &mscx.NextPrev{Location: &mscx.Location{Measures: 1, Fractions: "-1/2"}}}}
+	tiedTo := m2.Voice[0].TimedElements[1].(*mscx.Chord).Note[0]
+	tiedTo.Spanner = []*mscx.Spanner{{Type: "Tie",
+		Prev: &mscx.NextPrev{Location: &mscx.Location{Measures: -1, Fractions: "1/2"}}}}
+	return score
+}
+
+func TestTracks(t *testing.T) {
+	score := testScore(t)
+	ch := score.Part[0].Instrument.Channel[0]
+	ch.ChannelElements = append(ch.ChannelElements,
+		&mscx.Controller{Ctrl: 7, Value: 127},
+		&mscx.Controller{Ctrl: 10, Value: 0},
+		&mscx.Controller{Ctrl: 91, Value: 0})
+
+	got, err := Tracks(score)
+	if err != nil {
+		t.Fatalf("Tracks: %v", err)
+	}
+
+	part := score.Part[0]
+	// The default articulation's gate time is 95%.
+	want := []*Track{
+		{Part: part, StaffID: "1", Voice: 1, Volume: 1, Pan: -1, Notes: []*Note{
+			{Start: 0, Duration: 0.95, Pitch: 72, Velocity: 80},
+			{Start: 1, Duration: 0.95, Pitch: 74, Velocity: 49},
+			{Start: 2, Duration: 2.5 - 0.025, Pitch: 76, Velocity: 49},
+		}},
+		{Part: part, StaffID: "1", Voice: 2, Volume: 1, Pan: -1, Notes: []*Note{
+			{Start: 0, Duration: 3.8, Pitch: 67, Velocity: 80},
+		}},
+		{Part: part, StaffID: "2", Voice: 1, Volume: 1, Pan: -1, Notes: []*Note{
+			{Start: 0, Duration: 3.8, Pitch: 48, Velocity: 80},
+			{Start: 4, Duration: 1.9, Pitch: 43, Velocity: 49},
+		}},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateApprox(0, 1e-9), cmpopts.IgnoreFields(Track{}, "Part")); diff != "" {
+		t.Errorf("Tracks mismatch (-want +got):\n%v", diff)
+	}
+	for _, track := range got {
+		if track.Part != part {
+			t.Errorf("track %v/%v: Part = %p, want %p", track.StaffID, track.Voice, track.Part, part)
+		}
+	}
+}
+
+func TestTracks_ParsedDynamics(t *testing.T) {
+	sz, err := mscx.NewScore().
+		AddPart("Piano").
+		AddMeasure("4/4").Note("C5", "whole").
+		AddMeasure("").Note("D5", "whole").
+		Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	buf, err := sz.XML()
+	if err != nil {
+		t.Fatalf("XML: %v", err)
+	}
+	// Mark the second measure pp, as MuseScore writes it in the voice.
+	i := bytes.LastIndex(buf, []byte("<Chord>"))
+	dynamic := "<Dynamic>\n<subtype>pp</subtype>\n<velocity>33</velocity>\n</Dynamic>\n"
+	buf = append(buf[:i:i], append([]byte(dynamic), buf[i:]...)...)
+
+	parsed, err := mscx.New(buf, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	tracks, err := Tracks(&parsed.MuseScore.Score)
+	if err != nil {
+		t.Fatalf("Tracks: %v", err)
+	}
+	var got []int
+	for _, track := range tracks {
+		for _, n := range track.Notes {
+			got = append(got, n.Velocity)
+		}
+	}
+	if want := []int{80, 33}; !cmp.Equal(want, got) {
+		t.Errorf("velocities = %v, want %v", got, want)
+	}
+}
+
+func TestNewTrack(t *testing.T) {
+	tests := []struct {
+		name     string
+		elements []any
+		drums    bool
+		mute     bool
+		want     *Track
+	}{
+		{
+			name:     "defaults",
+			elements: []any{mscx.Program{Value: "0"}},
+			want:     &Track{Volume: 100.0 / 127},
+		},
+		{
+			name: "program and controllers",
+			elements: []any{
+				&mscx.Controller{Ctrl: 0, Value: 1},
+				&mscx.Controller{Ctrl: 32, Value: 2},
+				mscx.Program{Value: "48"},
+				&mscx.Controller{Ctrl: 7, Value: 0},
+				&mscx.Controller{Ctrl: 10, Value: 96},
+				&mscx.Controller{Ctrl: 91, Value: 127},
+			},
+			mute: true,
+			want: &Track{Bank: 130, Program: 48, Pan: 0.5, Reverb: 1, Mute: true},
+		},
+		{
+			name:     "drums",
+			elements: []any{mscx.Program{Value: "25"}},
+			drums:    true,
+			want:     &Track{Bank: percussionBank, Program: 25, Volume: 100.0 / 127},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &mscx.Channel{ChannelElements: tt.elements}
+			if tt.mute {
+				ch.Mute = 1
+			}
+			part := &mscx.Part{Instrument: &mscx.Instrument{Channel: []*mscx.Channel{ch}}}
+			if tt.drums {
+				part.Instrument.UseDrumset = 1
+			}
+			tt.want.Part, tt.want.StaffID, tt.want.Voice = part, "1", 1
+
+			got := newTrack(part, "1", 1)
+			if diff := cmp.Diff(tt.want, got, cmpopts.IgnoreFields(Track{}, "Part")); diff != "" {
+				t.Errorf("newTrack mismatch (-want +got):\n%v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+/*
+Copyright © 2022 Glenn M. Lewis
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package synth
+
+import (
+	"math"
+)
+
+// silenceDB is the attenuation at which a released voice stops.
+const silenceDB = 96
+
+// voice plays one region of a preset for one note.
+type voice struct {
+	samples []float32
+
+	pos, step            float64 // position in samples and its increment per frame
+	start, end           int     // the sample data to play
+	loopStart, loopEnd   int
+	loopMode             int // 0: none, 1: continuous, 3: until release
+	gainL, gainR         float64
+	sendL, sendR         float64
+	delay, attack, hold  float64 // envelope times in frames
+	decayRate, sustainDB float64 // dB per frame and dB
+	releaseRate          float64 // dB per frame
+
+	filter *biquad
+}
+
+// timecents converts a SoundFont time in timecents to seconds.
+func timecents(tc int) float64 {
+	if tc <= -12000 {
+		return 0
+	}
+	return math.Pow(2, float64(tc)/1200)
+}
+
+// newVoice prepares region r of sf to play a note of the given pitch and
+// velocity on a track at the output sample rate. tuning is the offset in
+// cents of the master tuning.
+func newVoice(sf *SoundFont, r *region, t *Track, pitch, velocity int, tuning float64, sampleRate int) *voice {
+	g, s := &r.gen, r.sample
+	v := &voice{samples: sf.samples, loopMode: g[genSampleModes] & 3}
+
+	clamp := func(i int) int {
+		return int(math.Max(0, math.Min(float64(len(sf.samples)), float64(i))))
+	}
+	v.start = clamp(s.start + g[genStartAddrsOffset] + 32768*g[genStartAddrsCoarseOffset])
+	v.end = clamp(s.end + g[genEndAddrsOffset] + 32768*g[genEndAddrsCoarseOffset])
+	v.loopStart = clamp(s.startLoop + g[genStartloopAddrsOffset] + 32768*g[genStartloopCoarseOffset])
+	v.loopEnd = clamp(s.endLoop + g[genEndloopAddrsOffset] + 32768*g[genEndloopCoarseOffset])
+	if v.loopEnd-v.loopStart < 2 || v.loopStart < v.start || v.loopEnd > v.end {
+		v.loopMode = 0
+	}
+	v.pos = float64(v.start)
+
+	root := g[genOverridingRootKey]
+	if root < 0 {
+		root = s.originalPitch
+	}
+	cents := float64((pitch-root)*g[genScaleTuning]+100*g[genCoarseTune]+g[genFineTune]+s.pitchCorrection) + tuning
+	v.step = math.Pow(2, cents/1200) * float64(s.sampleRate) / float64(sampleRate)
+
+	// Velocity and the volume controller follow the usual MIDI squared
+	// curve; the zone attenuation is in centibels.
+	amp := math.Pow(float64(velocity)/127, 2) * math.Pow(t.Volume, 2) * math.Pow(10, -float64(g[genInitialAttenuation])/200)
+	pan := math.Max(-0.5, math.Min(0.5, float64(g[genPan])/1000+t.Pan/2))
+	v.gainL = amp * math.Cos((pan+0.5)*math.Pi/2)
+	v.gainR = amp * math.Sin((pan+0.5)*math.Pi/2)
+	send := math.Max(0, math.Min(1, t.Reverb+float64(g[genReverbEffectsSend])/1000))
+	v.sendL, v.sendR = v.gainL*send, v.gainR*send
+
+	rate := float64(sampleRate)
+	v.delay = timecents(g[genDelayVolEnv]) * rate
+	v.attack = timecents(g[genAttackVolEnv]) * rate
+	v.hold = timecents(g[genHoldVolEnv]) * rate
+	v.sustainDB = math.Max(0, math.Min(144, float64(g[genSustainVolEnv])/10))
+	// The decay and release times are those for a change of 100 dB.
+	v.decayRate = 100 / math.Max(1, timecents(g[genDecayVolEnv])*rate)
+	v.releaseRate = 100 / math.Max(1, timecents(g[genReleaseVolEnv])*rate)
+
+	if fc := g[genInitialFilterFc]; fc < 13500 {
+		hz := 8.176 * math.Pow(2, float64(fc)/1200)
+		q := math.Pow(10, float64(g[genInitialFilterQ])/200) / math.Sqrt2
+		if hz < 0.45*rate {
+			v.filter = newLowpass(hz, q, rate)
+		}
+	}
+	return v
+}
+
+// envelopeInterval is the number of frames between updates of the
+// envelope.
+const envelopeInterval = 16
+
+// render adds the voice for a note held for the given number of frames to
+// the dry and reverb send buffers, starting at frame offset. It returns
+// the number of frames played.
+func (v *voice) render(dry, send *stereo, offset, held int) int {
+	var amp float64
+	for frame := 0; ; frame++ {
+		if frame%envelopeInterval == 0 || frame == held {
+			var ok bool
+			if amp, ok = v.amplitude(frame, held); !ok {
+				return frame
+			}
+		}
+		x, ok := v.next(frame >= held)
+		if !ok {
+			return frame
+		}
+		if v.filter != nil {
+			x = v.filter.process(x)
+		}
+		x *= amp
+		dry.add(offset+frame, x*v.gainL, x*v.gainR)
+		if v.sendL != 0 || v.sendR != 0 {
+			send.add(offset+frame, x*v.sendL, x*v.sendR)
+		}
+	}
+}
+
+// amplitude returns the volume envelope at a frame of a note held for the
+// given number of frames, or false once the released note is silent.
+// A note released before the end of its attack is released from the
+// level it reached.
+func (v *voice) amplitude(frame, held int) (float64, bool) {
+	f := math.Min(float64(frame), float64(held))
+	var attack float64
+	switch {
+	case f < v.delay:
+	case f < v.delay+v.attack:
+		attack = (f - v.delay) / v.attack
+	default:
+		attack = 1
+	}
+
+	t := f - v.delay - v.attack - v.hold
+	db := math.Max(0, math.Min(v.sustainDB, t*v.decayRate))
+	if frame > held {
+		db += float64(frame-held) * v.releaseRate
+		if db >= silenceDB {
+			return 0, false
+		}
+	}
+	return attack * math.Pow(10, -db/20), true
+}
+
+// next returns the next interpolated sample, or false at the end of the
+// sample data.
+func (v *voice) next(released bool) (float64, bool) {
+	looping := v.loopMode == 1 || v.loopMode == 3 && !released
+	if looping {
+		for v.pos >= float64(v.loopEnd) {
+			v.pos -= float64(v.loopEnd - v.loopStart)
+		}
+	} else if v.pos >= float64(v.end-1) {
+		return 0, false
+	}
+	i := int(v.pos)
+	frac := v.pos - float64(i)
+	next := i + 1
+	if looping && next >= v.loopEnd {
+		next = v.loopStart
+	}
+	x := float64(v.samples[i]) + frac*float64(v.samples[next]-v.samples[i])
+	v.pos += v.step
+	return x, true
+}
+
+// stereo is a growable pair of audio channels.
+type stereo struct {
+	left, right []float32
+}
+
+func (s *stereo) add(frame int, l, r float64) {
+	if frame >= len(s.left) {
+		n := 2*len(s.left) + 1024
+		if n <= frame {
+			n = frame + 1024
+		}
+		s.left = append(s.left, make([]float32, n-len(s.left))...)
+		s.right = append(s.right, make([]float32, n-len(s.right))...)
+	}
+	s.left[frame] += float32(l)
+	s.right[frame] += float32(r)
+}
+
+// biquad is a second-order IIR filter.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// newLowpass returns a low-pass filter with the given cutoff frequency and
+// resonance Q.
+func newLowpass(hz, q, rate float64) *biquad {
+	w := 2 * math.Pi * hz / rate
+	alpha := math.Sin(w) / (2 * q)
+	cos := math.Cos(w)
+	a0 := 1 + alpha
+	return &biquad{
+		b0: (1 - cos) / 2 / a0,
+		b1: (1 - cos) / a0,
+		b2: (1 - cos) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+// newPeaking returns a peaking equalizer filter one octave wide (Q =
+// 1/√2) with the given center frequency and gain in dB.
+func newPeaking(hz, gainDB, rate float64) *biquad {
+	a := math.Pow(10, gainDB/40)
+	w := 2 * math.Pi * hz / rate
+	alpha := math.Sin(w) / math.Sqrt2
+	cos := math.Cos(w)
+	a0 := 1 + alpha/a
+	return &biquad{
+		b0: (1 + alpha*a) / a0,
+		b1: -2 * cos / a0,
+		b2: (1 - alpha*a) / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha/a) / a0,
+	}
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}